@@ -1,38 +1,69 @@
 package options
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/robfig/cron/v3"
 	"net/http"
 	"v1/pkg/apiserver"
 	"v1/pkg/apiserver/imsystem"
+	"v1/pkg/apiserver/middleware"
+	"v1/pkg/captcha"
 	"v1/pkg/client/cache"
 	"v1/pkg/client/mysql"
+	"v1/pkg/dao"
+	"v1/pkg/idp"
+	"v1/pkg/lockout"
 	"v1/pkg/logger"
 	"v1/pkg/model"
+	"v1/pkg/notify"
+	"v1/pkg/password"
+	"v1/pkg/ratelimit"
 	genericoptions "v1/pkg/server/options"
+	"v1/pkg/storage"
 	"v1/pkg/token"
+	"v1/pkg/totp"
 
+	"go.uber.org/zap"
 	cliflag "k8s.io/component-base/cli/flag"
 )
 
-var jwtSecret = []byte("6322ecab234de98bf206aff5b216d1e4") // MD5 ("cspm")
-
 type ServerRunOptions struct {
 	GenericServerRunOptions *genericoptions.ServerRunOptions
 	RDBOptions              *mysql.Options
+	CacheOptions            *cache.Options
+	CaptchaOptions          *captcha.Options
 	LoggerOptions           *logger.Options
+	PasswordOptions         *password.Options
+	TokenOptions            *token.Options
+	LockoutOptions          *lockout.Options
+	TOTPOptions             *totp.Options
+	NotifyOptions           *notify.Options
+	IDPOptions              *idp.Options
+	StorageOptions          *storage.Options
+	ChatOptions             *imsystem.Options
 
 	DebugMode bool
+	DevAuth   bool
 }
 
 func NewServerRunOptions() *ServerRunOptions {
 	s := &ServerRunOptions{
 		GenericServerRunOptions: genericoptions.NewServerRunOptions(),
 		RDBOptions:              mysql.NewMysqlOptions(mysql.SetDefaultRdbDbname("graduation_project")),
+		CacheOptions:            cache.NewCacheOptions(),
+		CaptchaOptions:          captcha.NewCaptchaOptions(),
 		LoggerOptions:           logger.NewLoggerOptions(),
+		PasswordOptions:         password.NewPasswordOptions(),
+		TokenOptions:            token.NewTokenOptions(),
+		LockoutOptions:          lockout.NewLockoutOptions(),
+		TOTPOptions:             totp.NewTOTPOptions(),
+		NotifyOptions:           notify.NewNotifyOptions(),
+		IDPOptions:              idp.NewIDPOptions(),
+		StorageOptions:          storage.NewStorageOptions(),
+		ChatOptions:             imsystem.NewChatOptions(),
+		DevAuth:                 middleware.DevAuthDefault,
 	}
 
 	return s
@@ -41,9 +72,20 @@ func NewServerRunOptions() *ServerRunOptions {
 func (s *ServerRunOptions) Flags() (fss cliflag.NamedFlagSets) {
 	fs := fss.FlagSet("generic")
 	fs.BoolVar(&s.DebugMode, "debug", s.DebugMode, "Don't enable this if you don't know what it means.")
+	fs.BoolVar(&s.DevAuth, "dev-auth", s.DevAuth, "Serve requests without token as the user given by the X-Dev-* headers. Never enable it in production.")
 	s.GenericServerRunOptions.AddFlags(fs)
 	s.RDBOptions.AddFlags(fss.FlagSet("rdb"))
+	s.CacheOptions.AddFlags(fss.FlagSet("cache"))
+	s.CaptchaOptions.AddFlags(fss.FlagSet("captcha"))
 	s.LoggerOptions.AddFlags(fss.FlagSet("log"))
+	s.PasswordOptions.AddFlags(fss.FlagSet("password"))
+	s.TokenOptions.AddFlags(fss.FlagSet("token"))
+	s.LockoutOptions.AddFlags(fss.FlagSet("login"))
+	s.TOTPOptions.AddFlags(fss.FlagSet("totp"))
+	s.NotifyOptions.AddFlags(fss.FlagSet("notify"))
+	s.IDPOptions.AddFlags(fss.FlagSet("idp"))
+	s.StorageOptions.AddFlags(fss.FlagSet("storage"))
+	s.ChatOptions.AddFlags(fss.FlagSet("chat"))
 
 	return fss
 }
@@ -53,15 +95,50 @@ func (s *ServerRunOptions) NewAPIServer(stopCh <-chan struct{}) (*apiserver.APIS
 
 	var (
 		apiServer = &apiserver.APIServer{
-			TokenManager: token.NewJWTTokenManager(jwtSecret, jwt.SigningMethodHS256),
-			CacheClient:  cache.NewSimpleCache(),
-			Crontab:      cron.New(),
+			Crontab: cron.New(),
+			DevAuth: s.DevAuth,
 			// Sched:        scan.NewScheduler(),
 		}
 	)
 
 	logger.InitLogger(s.LoggerOptions)
 
+	cacheClient, err := s.CacheOptions.NewCacheClient(stopCh)
+	if err != nil {
+		return nil, err
+	}
+	apiServer.CacheClient = cacheClient
+	captcha.SetDefault(s.CaptchaOptions.NewService(cacheClient))
+
+	tokenManager, err := s.TokenOptions.NewTokenManager()
+	if err != nil {
+		return nil, err
+	}
+	apiServer.TokenManager = tokenManager
+
+	password.SetDefault(s.PasswordOptions.NewHasher())
+	lockout.SetDefault(s.LockoutOptions.NewGuard(apiServer.CacheClient))
+	ratelimit.SetDefault(ratelimit.NewLimiter(apiServer.CacheClient))
+
+	authenticator, err := s.TOTPOptions.NewAuthenticator()
+	if err != nil {
+		return nil, err
+	}
+	totp.SetDefault(authenticator)
+	notify.SetDefault(s.NotifyOptions.NewNotifier())
+
+	providers, err := s.IDPOptions.NewProviders()
+	if err != nil {
+		return nil, err
+	}
+	idp.SetProviders(providers)
+
+	fileService, err := s.StorageOptions.NewService()
+	if err != nil {
+		return nil, err
+	}
+	storage.SetDefault(fileService)
+
 	// connect to mysql
 	if s.RDBOptions != nil {
 		apiServer.RDBClient = mysql.NewMysqlClient(s.RDBOptions)
@@ -73,13 +150,34 @@ func (s *ServerRunOptions) NewAPIServer(stopCh <-chan struct{}) (*apiserver.APIS
 			new(model.Profession),
 			new(model.Project),
 			new(model.ProjectSelectLog),
+			new(model.SelectionRound),
+			new(model.ProjectMember),
+			new(model.ProjectInvitation),
+			new(model.ChatMessage),
+			new(model.ChatRoom),
+			new(model.ChatRoomMember),
+			new(model.ProjectStatusHistory),
+			new(model.PhaseTemplate),
+			new(model.ProjectPhase),
+			new(model.ProjectFile),
 			new(model.Config),
 			new(model.Resume),
 			new(model.Company),
 			new(model.AuditLog),
 			new(model.College),
 			new(model.Interview),
+			new(model.UserTwoFactor),
+			new(model.UserIdentity),
 		)
+
+		// 旧版本把项目文件存在 projects.project_file 列中，迁移到对象存储
+		moved, err := dao.MigrateProjectFileBlobs(context.Background(), apiServer.RDBClient, fileService.Storage)
+		if err != nil {
+			return nil, fmt.Errorf("migrate project files: %w", err)
+		}
+		if moved > 0 {
+			zap.L().Info("project files migrated to the storage", zap.Int("count", moved))
+		}
 	}
 
 	// apiServer.Sched = scan.NewScheduler()
@@ -99,9 +197,21 @@ func (s *ServerRunOptions) NewAPIServer(stopCh <-chan struct{}) (*apiserver.APIS
 
 	apiServer.Server = server
 
-	// 初始化 聊天server/client
-	apiServer.ChatServer = imsystem.InitChatServer(imsystem.ChatServerIp, imsystem.ChatServerPort)
-	imsystem.InitChatClient()
+	// 聊天的 websocket 连接挂在本实例的 hub 上，其他实例经 backplane 转发；退出时全部断开
+	backplane, err := s.ChatOptions.NewBackplane()
+	if err != nil {
+		return nil, err
+	}
+	chatHub, err := imsystem.NewHub(apiServer.RDBClient, backplane)
+	if err != nil {
+		_ = backplane.Close()
+		return nil, err
+	}
+	imsystem.SetDefault(chatHub)
+	go func() {
+		<-stopCh
+		chatHub.Close()
+	}()
 
 	return apiServer, nil
 }
@@ -8,6 +8,16 @@ func (s *ServerRunOptions) Validate() []error {
 	errors = append(errors, s.GenericServerRunOptions.Validate()...)
 	errors = append(errors, s.LoggerOptions.Validate()...)
 	errors = append(errors, s.RDBOptions.Validate()...)
+	errors = append(errors, s.CacheOptions.Validate()...)
+	errors = append(errors, s.CaptchaOptions.Validate()...)
+	errors = append(errors, s.PasswordOptions.Validate()...)
+	errors = append(errors, s.TokenOptions.Validate()...)
+	errors = append(errors, s.LockoutOptions.Validate()...)
+	errors = append(errors, s.TOTPOptions.Validate()...)
+	errors = append(errors, s.NotifyOptions.Validate()...)
+	errors = append(errors, s.IDPOptions.Validate()...)
+	errors = append(errors, s.StorageOptions.Validate()...)
+	errors = append(errors, s.ChatOptions.Validate()...)
 
 	return errors
 }
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"v1/pkg/client/cache"
+	"v1/pkg/model"
+	"v1/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestHandler returns a handler on an in-memory database with the users table
+func newTestHandler(t *testing.T, models ...any) *authHandler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	for _, m := range append([]any{new(model.User)}, models...) {
+		// sqlite 的索引名全局唯一，多张表同名的 idx_created_at 会冲突，表已建好即可
+		if err = db.AutoMigrate(m); err != nil && !(strings.Contains(err.Error(), "already exists") && db.Migrator().HasTable(m)) {
+			t.Fatalf("AutoMigrate %T: %v", m, err)
+		}
+	}
+
+	cacheClient := cache.NewSimpleCache()
+	return newAuthHandler(authHandlerOption{
+		tokenManager:   token.NewJWTTokenManager([]byte("s3cret"), jwt.SigningMethodHS256),
+		refreshManager: token.NewRefreshManager(cacheClient),
+		db:             db,
+		cacheClient:    cacheClient,
+	})
+}
+
+// call sends the json body to the handler and returns the recorded response
+func call(handler gin.HandlerFunc, body any, params ...gin.Param) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	handler(c)
+	return w
+}
@@ -2,11 +2,12 @@ package auth
 
 import (
 	"context"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 	v1 "v1/pkg/apis/v1"
@@ -16,16 +17,20 @@ import (
 	"v1/pkg/captcha"
 	"v1/pkg/client/cache"
 	"v1/pkg/dao"
+	"v1/pkg/lockout"
 	"v1/pkg/model"
+	"v1/pkg/password"
 	"v1/pkg/server/errutil"
 	"v1/pkg/token"
-	"v1/pkg/utils"
+	"v1/pkg/totp"
 )
 
 type authHandlerOption struct {
-	tokenManager token.Manager
-	db           *gorm.DB
-	cacheClient  cache.Interface
+	tokenManager   token.Manager
+	refreshManager token.RefreshManager
+	loginGuard     lockout.Guard
+	db             *gorm.DB
+	cacheClient    cache.Interface
 }
 
 type authHandler struct {
@@ -54,58 +59,159 @@ func (h *authHandler) login(c *gin.Context) {
 		return
 	}
 
-	captchaService := captcha.GetService()
+	// 失败次数过多时需要等待，或账号已被锁定
+	ip := c.ClientIP()
+	retryAfter, locked, err := h.loginGuard.Check(ctx, req.Account, ip)
+	if err != nil {
+		zap.L().Error("loginGuard.Check", zap.Error(err))
+	}
+	if retryAfter > 0 {
+		handleLoginThrottled(c, retryAfter, locked)
+		return
+	}
 
-	if !captchaService.VerifyCaptcha(req.CaptchaID, strings.ToLower(req.CaptchaValue)) {
+	// 同一账号或IP失败次数达到阈值后才需要验证码
+	accountFailures, ipFailures, err := h.loginGuard.Failures(ctx, req.Account, ip)
+	if err != nil {
+		zap.L().Error("loginGuard.Failures", zap.Error(err))
+	}
+	captchaService := captcha.GetService()
+	if captchaService.Required(accountFailures, ipFailures) &&
+		!captchaService.VerifyCaptcha(req.CaptchaID, strings.ToLower(req.CaptchaValue)) {
 		zap.L().Error("captcha value is wrong")
-		encoding.HandleError(c, errutil.NewError(400, "captcha value is wrong"))
+		encoding.HandleError(c, errutil.NewError(400, "captcha value is wrong", captchaRequiredResp{CaptchaRequired: true}))
 		return
 	}
 
+	var (
+		u  *model.User
+		ok bool
+	)
+	if req.Provider != "" {
+		u, ok = h.providerLogin(ctx, c, req, ip)
+	} else {
+		u, ok = h.localLogin(ctx, c, req, ip)
+	}
+	if !ok {
+		return
+	}
+
+	h.finishLogin(ctx, c, u, req.Device)
+}
+
+// finishLogin continues after the password is verified, with the second factor or the tokens
+func (h *authHandler) finishLogin(ctx context.Context, c *gin.Context, u *model.User, device string) {
+	// 两步验证：已启用，或所属角色被要求启用
+	tfConf, err := dao.GetTwoFactorConfig(ctx, h.db)
+	if err != nil {
+		zap.L().Error("dao.GetTwoFactorConfig", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	found, tf, err := dao.GetUserTwoFactor(ctx, h.db, u.UID)
+	if err != nil {
+		zap.L().Error("dao.GetUserTwoFactor", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	enrolled := found && tf.Enabled
+	// 关闭了两步验证时只校验密码
+	if totp.Enabled() && (enrolled || tfConf.Required(u.Role)) {
+		challenge, err := h.newLoginChallenge(ctx, loginChallenge{UserUID: u.UID, Enroll: !enrolled, Device: device})
+		if err != nil {
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+
+		encoding.HandleSuccess(c, &loginResp{
+			ID:       u.ID,
+			UID:      u.UID,
+			Username: u.Username,
+			Role:     u.Role,
+			Name:     u.Name,
+
+			TwoFactorRequired:  true,
+			TwoFactorEnroll:    !enrolled,
+			Challenge:          challenge,
+			ChallengeExpiresIn: int64(loginChallengeExpiration.Seconds()),
+		})
+		return
+	}
+
+	h.completeLogin(ctx, c, u, device)
+}
+
+// localLogin checks the password of a local user
+func (h *authHandler) localLogin(ctx context.Context, c *gin.Context, req loginReq, ip string) (*model.User, bool) {
 	u, err := dao.GetUserByUsername(ctx, h.db, req.Account)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
+			h.loginFailed(ctx, req.Account, ip)
 			encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "用户不存在"))
-			return
+			return nil, false
 		}
 
 		encoding.HandleError(c, err)
-		return
+		return nil, false
 	}
 
 	if u.Status == model.UserStatusDisabled {
 		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "用户已经被停用，请联系管理员"))
-		return
+		return nil, false
 	}
 
-	if u.Password != utils.MD5Hex(req.Password) {
+	ok, rehash, err := password.Verify(req.Password, u.Password)
+	if err != nil {
+		zap.L().Error("password.Verify", zap.String("username", u.Username), zap.Error(err))
+	}
+	if !ok {
+		h.loginFailed(ctx, req.Account, ip)
 		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "密码错误"))
-		return
+		return nil, false
+	}
+
+	if err = h.loginGuard.Succeed(ctx, u.Username); err != nil {
+		zap.L().Error("loginGuard.Succeed", zap.Error(err))
 	}
 
+	// 旧格式(md5)或参数过弱的密码，登录成功后透明升级
+	if rehash {
+		if encoded, err := password.Hash(req.Password); err != nil {
+			zap.L().Error("password.Hash", zap.Error(err))
+		} else if err = dao.UpdateUserPassword(ctx, h.db, u.ID, encoded, u.Username); err != nil {
+			zap.L().Error("dao.UpdateUserPassword", zap.Error(err))
+		}
+	}
+
+	return u, true
+}
+
+// completeLogin issues the tokens of an authenticated user
+func (h *authHandler) completeLogin(ctx context.Context, c *gin.Context, u *model.User, device string) {
 	// 签发token
-	tokenStr, err := h.tokenManager.IssueTo(token.Payload{
+	payload := token.Payload{
 		ID:       u.ID,
 		UID:      u.UID,
 		Username: u.Username,
 		Name:     u.Name,
 		Role:     u.Role,
-	}, time.Hour*24)
-	if err != nil {
-		encoding.HandleSuccess(c, err)
-		return
 	}
 
-	if err = h.cacheClient.Set(ctx, "token:"+tokenStr, u.Username, time.Minute*30); err != nil {
-		zap.L().Error("", zap.Error(err))
-		encoding.HandleSuccess(c, errutil.ErrInternalServer)
+	refreshToken, sessionID, err := h.refreshManager.Issue(ctx, payload, token.SessionInfo{
+		Device:    device,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		zap.L().Error("refreshManager.Issue", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
+	payload.SessionID = sessionID
 
-	err = imsystem.AddChatClient(imsystem.ChatServerIp, imsystem.ChatServerPort, u.UID)
+	tokenStr, err := h.issueAccessToken(ctx, payload)
 	if err != nil {
-		zap.L().Error(" imsystem.AddChatClient ", zap.Error(err))
-		encoding.HandleSuccess(c, errutil.ErrInternalServer)
+		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
 
@@ -116,32 +222,179 @@ func (h *authHandler) login(c *gin.Context) {
 		Role:     u.Role,
 		Name:     u.Name,
 		Token:    tokenStr,
+
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(token.DefaultAccessTokenExpiration.Seconds()),
 	}
 	encoding.HandleSuccess(c, &result)
 }
 
-func (h *authHandler) createCaptcha(c *gin.Context) {
-	if !utils.Lmt.AllowKey(utils.MD5Hex(c.Request.UserAgent())) {
-		zap.L().Error("The captcha request is too fast. Please try again later")
-		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "The captcha request is too fast"))
+func (h *authHandler) refresh(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := refreshReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	payload, refreshToken, err := h.refreshManager.Rotate(ctx, req.RefreshToken)
+	if err != nil {
+		zap.L().Info("refreshManager.Rotate", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrUnauthorized)
+		return
+	}
+
+	// 重新读取用户信息，角色变更或停用需要及时生效
+	found, u, err := dao.GetUserByUID(ctx, h.db, payload.UID)
+	if err != nil || !found || u.Status == model.UserStatusDisabled {
+		zap.L().Info("refresh token user unavailable", zap.String("uid", payload.UID), zap.Error(err))
+		_ = h.refreshManager.Revoke(ctx, payload.SessionID)
+		imsystem.DisconnectSession(payload.UID, payload.SessionID)
+		encoding.HandleError(c, errutil.ErrUnauthorized)
+		return
+	}
+
+	tokenStr, err := h.issueAccessToken(ctx, token.Payload{
+		ID:        u.ID,
+		UID:       u.UID,
+		Username:  u.Username,
+		Name:      u.Name,
+		Role:      u.Role,
+		SessionID: payload.SessionID,
+	})
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
 
+	encoding.HandleSuccess(c, refreshResp{
+		Token:        tokenStr,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(token.DefaultAccessTokenExpiration.Seconds()),
+	})
+}
+
+// loginFailed records a failed login attempt
+func (h *authHandler) loginFailed(ctx context.Context, account, ip string) {
+	if err := h.loginGuard.Fail(ctx, account, ip); err != nil {
+		zap.L().Error("loginGuard.Fail", zap.String("account", account), zap.Error(err))
+	}
+}
+
+func handleLoginThrottled(c *gin.Context, retryAfter time.Duration, locked bool) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+
+	serviceErr := errutil.ErrTooManyRequests
+	if locked {
+		serviceErr = errutil.ErrAccountLocked
+	}
+	encoding.HandleError(c, errutil.NewError(serviceErr.Code, serviceErr.Message, loginThrottledResp{RetryAfter: seconds}))
+}
+
+// issueAccessToken signs a short-lived access token and registers it in cache for CheckToken
+func (h *authHandler) issueAccessToken(ctx context.Context, payload token.Payload) (string, error) {
+	tokenStr, err := h.tokenManager.IssueTo(payload, token.DefaultAccessTokenExpiration)
+	if err != nil {
+		zap.L().Error("tokenManager.IssueTo", zap.Error(err))
+		return "", err
+	}
+
+	if err = h.cacheClient.Set(ctx, "token:"+tokenStr, payload.Username, time.Minute*30); err != nil {
+		zap.L().Error("", zap.Error(err))
+		return "", err
+	}
+
+	return tokenStr, nil
+}
+
+func (h *authHandler) createCaptcha(c *gin.Context) {
 	serveice := captcha.GetService()
-	captchaId, captchaValue, answer, err := serveice.CreateCaptcha()
+	captchaId, captchaValue, _, err := serveice.CreateCaptcha()
 	if err != nil {
 		zap.L().Error("create captcha failed", zap.Error(err))
 		encoding.HandleError(c, errutil.NewError(400, "create captcha failed"))
 		return
 	}
 
-	fmt.Println("answer:", answer)
-
 	encoding.HandleSuccess(c, createCaptchaResp{captchaId, captchaValue})
 }
 
 func (h *authHandler) logout(c *gin.Context) {
+	payload, err := request.TokenPayloadFromCtx(c)
+	if err == nil && payload.SessionID != "" {
+		if err = h.refreshManager.Revoke(c, payload.SessionID); err != nil {
+			zap.L().Error("refreshManager.Revoke", zap.Error(err))
+		}
+	}
+	if tokenVal := request.AccessTokenFromCtx(c); tokenVal != "" {
+		if err = h.cacheClient.Del(c, "token:"+tokenVal); err != nil {
+			zap.L().Error("cacheClient.Del", zap.Error(err))
+		}
+	}
 
-	imsystem.DeleteClient(request.GetUserUIDFromCtx(c))
+	// 断开本次会话的聊天连接
+	if payload != nil {
+		imsystem.DisconnectSession(payload.UID, payload.SessionID)
+	}
 	encoding.HandleSuccess(c)
 }
+
+// listSessions lists the sessions of the current user
+func (h *authHandler) listSessions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	sessions, err := h.refreshManager.Sessions(ctx, request.GetUserUIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("refreshManager.Sessions", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	current := ""
+	if payload, err := request.TokenPayloadFromCtx(ctx); err == nil {
+		current = payload.SessionID
+	}
+
+	items := make([]sessionItem, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, sessionItem{Session: session, Current: session.ID == current})
+	}
+
+	encoding.HandleSuccessList(c, int64(len(items)), items)
+}
+
+// revokeSession logs one session of the current user out
+func (h *authHandler) revokeSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	sessionID := c.Param("id")
+	sessions, err := h.refreshManager.Sessions(ctx, request.GetUserUIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("refreshManager.Sessions", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	// 只能注销自己的会话
+	for _, session := range sessions {
+		if session.ID != sessionID {
+			continue
+		}
+		if err = h.refreshManager.Revoke(ctx, sessionID); err != nil {
+			zap.L().Error("refreshManager.Revoke", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		imsystem.DisconnectSession(request.GetUserUIDFromCtx(ctx), sessionID)
+		encoding.HandleSuccess(c)
+		return
+	}
+
+	encoding.HandleError(c, errutil.ErrNotFound)
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/imsystem"
+	"v1/pkg/captcha"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/notify"
+	"v1/pkg/password"
+	"v1/pkg/server/errutil"
+	"v1/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	passwordResetExpiration    = time.Minute * 30
+	passwordResetKeyPrefix     = "password_reset:"
+	passwordResetUserKeyPrefix = "password_reset_user:"
+)
+
+var errInvalidResetToken = errutil.NewError(http.StatusBadRequest, "password reset token invalid or expired")
+
+// forgotPassword sends a one-time reset token to the user. It always succeeds,
+// so it can't be used to find out which accounts exist.
+func (h *authHandler) forgotPassword(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := forgotPasswordReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Account == "" {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if !captcha.GetService().VerifyCaptcha(req.CaptchaID, strings.ToLower(req.CaptchaValue)) {
+		zap.L().Error("captcha value is wrong")
+		encoding.HandleError(c, errutil.NewError(400, "captcha value is wrong"))
+		return
+	}
+
+	u, err := dao.GetUserByUsername(ctx, h.db, req.Account)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			zap.L().Error("dao.GetUserByUsername", zap.Error(err))
+		}
+		encoding.HandleSuccess(c)
+		return
+	}
+	if u.Status == model.UserStatusDisabled {
+		encoding.HandleSuccess(c)
+		return
+	}
+
+	// 发送失败也返回成功，否则只有存在的账号会报错
+	if err = h.sendResetToken(ctx, u); err != nil {
+		zap.L().Error("send password reset token", zap.String("username", u.Username), zap.Error(err))
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// sendResetToken issues a reset token to the user, dropping the previous one, and notifies the user of it
+func (h *authHandler) sendResetToken(ctx context.Context, u *model.User) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	resetToken := base64.RawURLEncoding.EncodeToString(b)
+	hashed := utils.SHA256Hex(resetToken)
+
+	// 只有最新的重置令牌有效
+	if previous, err := h.cacheClient.Get(ctx, passwordResetUserKeyPrefix+u.UID); err == nil {
+		_ = h.cacheClient.Del(ctx, passwordResetKeyPrefix+previous)
+	}
+	if err := h.cacheClient.Set(ctx, passwordResetKeyPrefix+hashed, u.UID, passwordResetExpiration); err != nil {
+		return err
+	}
+	if err := h.cacheClient.Set(ctx, passwordResetUserKeyPrefix+u.UID, hashed, passwordResetExpiration); err != nil {
+		return err
+	}
+
+	return notify.Default().Notify(ctx, notify.Message{
+		Username: u.Username,
+		Email:    u.Emial,
+		Phone:    u.Phone,
+		Subject:  "重置密码",
+		Body:     fmt.Sprintf("您的密码重置令牌为 %s ，%d 分钟内有效，仅可使用一次。如非本人操作请忽略。", resetToken, int(passwordResetExpiration.Minutes())),
+		Secrets:  []string{resetToken},
+	})
+}
+
+// resetPassword sets a new password with a reset token, and logs the user out everywhere
+func (h *authHandler) resetPassword(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := resetPasswordReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if !utils.CheckPWD(req.NewPassword) {
+		zap.L().Error("password illegal")
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	hashed := utils.SHA256Hex(req.Token)
+	uid, err := h.cacheClient.Get(ctx, passwordResetKeyPrefix+hashed)
+	if err != nil {
+		encoding.HandleError(c, errInvalidResetToken)
+		return
+	}
+	// 令牌只能使用一次
+	if err = h.cacheClient.Del(ctx, passwordResetKeyPrefix+hashed, passwordResetUserKeyPrefix+uid); err != nil {
+		zap.L().Error("cacheClient.Del", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	found, u, err := dao.GetUserByUID(ctx, h.db, uid)
+	if err != nil || !found || u.Status == model.UserStatusDisabled {
+		zap.L().Info("password reset user unavailable", zap.String("uid", uid), zap.Error(err))
+		encoding.HandleError(c, errInvalidResetToken)
+		return
+	}
+
+	encoded, err := password.Hash(req.NewPassword)
+	if err != nil {
+		zap.L().Error("password.Hash", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrChangeUserPWD)
+		return
+	}
+	if err = dao.UpdateUserPassword(ctx, h.db, u.ID, encoded, u.Username); err != nil {
+		zap.L().Error("dao.UpdateUserPassword", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrChangeUserPWD)
+		return
+	}
+
+	if err = h.refreshManager.RevokeAll(ctx, u.UID); err != nil {
+		zap.L().Error("refreshManager.RevokeAll", zap.Error(err))
+	}
+	imsystem.DisconnectSession(u.UID, "")
+	if err = h.loginGuard.Unlock(ctx, u.Username); err != nil {
+		zap.L().Error("loginGuard.Unlock", zap.Error(err))
+	}
+
+	encoding.HandleSuccess(c)
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"v1/pkg/captcha"
+	"v1/pkg/model"
+	"v1/pkg/notify"
+)
+
+type notifierFunc func(ctx context.Context, msg notify.Message) error
+
+func (f notifierFunc) Notify(ctx context.Context, msg notify.Message) error {
+	return f(ctx, msg)
+}
+
+func useNotifier(t *testing.T, n notify.Notifier) {
+	t.Helper()
+	old := notify.Default()
+	notify.SetDefault(n)
+	t.Cleanup(func() { notify.SetDefault(old) })
+}
+
+// TestForgotPasswordSameResponse answers an existing account whose notification fails
+// the same way as an account that doesn't exist
+func TestForgotPasswordSameResponse(t *testing.T) {
+	h := newTestHandler(t)
+	if err := h.db.Create(&model.User{UID: "u1", Username: "alice", Status: model.UserStatusNormal}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []notify.Message
+	useNotifier(t, notifierFunc(func(ctx context.Context, msg notify.Message) error {
+		sent = append(sent, msg)
+		return errors.New("smtp down")
+	}))
+
+	forgot := func(account string) (int, string) {
+		id, _, answer, err := captcha.GetService().CreateCaptcha()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := call(h.forgotPassword, forgotPasswordReq{Account: account, CaptchaID: id, CaptchaValue: answer})
+		return w.Code, w.Body.String()
+	}
+
+	existingCode, existingBody := forgot("alice")
+	missingCode, missingBody := forgot("bob")
+	if existingCode != missingCode || existingBody != missingBody {
+		t.Fatalf("existing account got %d %s, missing one %d %s", existingCode, existingBody, missingCode, missingBody)
+	}
+	if existingCode != 200 {
+		t.Fatalf("got %d, want 200", existingCode)
+	}
+
+	if len(sent) != 1 || sent[0].Username != "alice" {
+		t.Fatalf("sent %+v, want one message to alice", sent)
+	}
+	if len(sent[0].Secrets) != 1 || !strings.Contains(sent[0].Body, sent[0].Secrets[0]) {
+		t.Fatalf("the reset token is not marked secret: %+v", sent[0])
+	}
+}
@@ -5,22 +5,45 @@ import (
 	"gorm.io/gorm"
 	"v1/pkg/apiserver/middleware"
 	"v1/pkg/client/cache"
+	"v1/pkg/lockout"
+	"v1/pkg/ratelimit"
+	"v1/pkg/rbac"
 	"v1/pkg/token"
 )
 
 func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, cacheClient cache.Interface, db *gorm.DB) {
 	authG := group.Group("/auth")
 	handler := newAuthHandler(authHandlerOption{
-		tokenManager: tokenManager,
-		db:           db,
-		cacheClient:  cacheClient,
+		tokenManager:   tokenManager,
+		refreshManager: token.NewRefreshManager(cacheClient),
+		loginGuard:     lockout.Default(),
+		db:             db,
+		cacheClient:    cacheClient,
 	})
 
-	authG.POST("/login", handler.login)
-	authG.GET("/captcha", handler.createCaptcha)
+	limiter := ratelimit.Default()
+	authG.POST("/login", middleware.RateLimit(limiter, ratelimit.PolicyLogin), handler.login)
+	authG.GET("/captcha", middleware.RateLimit(limiter, ratelimit.PolicyCaptcha), handler.createCaptcha)
+	authG.POST("/refresh", handler.refresh)                                // 刷新token
+	authG.POST("/login/2fa", requireTwoFactor, handler.loginTwoFactor)     // 两步验证
+	authG.POST("/login/2fa/enroll", requireTwoFactor, handler.loginEnroll) // 强制绑定两步验证
+	authG.POST("/password/forgot", handler.forgotPassword)                 // 忘记密码，发送重置令牌
+	authG.POST("/password/reset", handler.resetPassword)                   // 使用重置令牌设置新密码
+	authG.GET("/providers", handler.listProviders)                         // 统一身份认证列表
+	authG.GET("/sso/:provider", handler.ssoStart)                          // 获取统一身份认证登录地址
+	authG.POST("/sso/:provider/callback", handler.ssoCallback)             // 统一身份认证回调，换取token
 	// authG.GET("/license", handler.licenseInfo)      // 获取license信息
 	// authG.POST("/license", handler.registerLicense) // 激活license
 
 	authG.Use(middleware.CheckToken(tokenManager, cacheClient))
 	authG.POST("/logout", handler.logout)
+	authG.GET("/sessions", handler.listSessions)         // 当前用户的登录会话
+	authG.DELETE("/sessions/:id", handler.revokeSession) // 注销某个会话
+
+	// 两步验证管理
+	authG.GET("/2fa", middleware.RequirePermission(rbac.PermissionTwoFactorEnroll), requireTwoFactor, handler.getTwoFactorStatus)
+	authG.POST("/2fa/enroll", middleware.RequirePermission(rbac.PermissionTwoFactorEnroll), requireTwoFactor, handler.enrollTwoFactor)
+	authG.POST("/2fa/enable", middleware.RequirePermission(rbac.PermissionTwoFactorEnroll), requireTwoFactor, handler.enableTwoFactor)
+	authG.POST("/2fa/disable", middleware.RequirePermission(rbac.PermissionTwoFactorEnroll), requireTwoFactor, handler.disableTwoFactor)
+	authG.POST("/2fa/recovery-codes", middleware.RequirePermission(rbac.PermissionTwoFactorEnroll), requireTwoFactor, handler.regenerateRecoveryCodes)
 }
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/dao"
+	"v1/pkg/idp"
+	"v1/pkg/model"
+	"v1/pkg/password"
+	"v1/pkg/server/errutil"
+	"v1/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	ssoStateExpiration = time.Minute * 10
+	ssoStateKeyPrefix  = "sso_state:"
+
+	// length of model.User.Username
+	maxUsernameLength = 32
+)
+
+var (
+	errInvalidSSOState   = errutil.NewError(http.StatusBadRequest, "sso state invalid or expired")
+	errSSOLoginFailed    = errutil.NewError(http.StatusUnauthorized, "single sign-on failed")
+	errSSONotMapped      = errutil.NewError(http.StatusForbidden, "no account can be provisioned for this identity, please contact the administrator")
+	errSSOUsernameExists = errutil.NewError(http.StatusConflict, "a local account with the same username already exists, please contact the administrator")
+)
+
+// ssoState is what ssoStart remembers for the callback of the same login
+type ssoState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+	Device   string `json:"device"`
+}
+
+// listProviders lists the configured single sign-on providers for the login page
+func (h *authHandler) listProviders(c *gin.Context) {
+	providers := idp.List()
+
+	items := make([]providerItem, 0, len(providers))
+	for _, p := range providers {
+		items = append(items, providerItem{Name: p.Name(), Type: p.Type()})
+	}
+
+	encoding.HandleSuccessList(c, int64(len(items)), items)
+}
+
+// ssoStart returns the url of the provider's login page
+func (h *authHandler) ssoStart(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	p, err := idp.Get(c.Param("provider"))
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+	provider, ok := p.(idp.RedirectProvider)
+	if !ok {
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	state, err1 := randomToken()
+	nonce, err2 := randomToken()
+	verifier, err3 := randomToken()
+	if err = errors.Join(err1, err2, err3); err != nil {
+		zap.L().Error("randomToken", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		zap.L().Error("provider.AuthCodeURL", zap.String("provider", provider.Name()), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	b, _ := json.Marshal(ssoState{Provider: provider.Name(), Nonce: nonce, Verifier: verifier, Device: c.Query("device")})
+	if err = h.cacheClient.Set(ctx, ssoStateKeyPrefix+utils.SHA256Hex(state), string(b), ssoStateExpiration); err != nil {
+		zap.L().Error("cacheClient.Set", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, ssoStartResp{AuthURL: authURL, State: state})
+}
+
+// ssoCallback exchanges the authorization code the provider redirected back with for the tokens
+func (h *authHandler) ssoCallback(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := ssoCallbackReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" || req.State == "" {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	// state 只能使用一次
+	stateKey := ssoStateKeyPrefix + utils.SHA256Hex(req.State)
+	val, err := h.cacheClient.Get(ctx, stateKey)
+	if err != nil {
+		encoding.HandleError(c, errInvalidSSOState)
+		return
+	}
+	_ = h.cacheClient.Del(ctx, stateKey)
+
+	var state ssoState
+	if err = json.Unmarshal([]byte(val), &state); err != nil || state.Provider != c.Param("provider") {
+		encoding.HandleError(c, errInvalidSSOState)
+		return
+	}
+
+	p, err := idp.Get(state.Provider)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+	provider, ok := p.(idp.RedirectProvider)
+	if !ok {
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, req.Code, state.Nonce, state.Verifier)
+	if err != nil {
+		zap.L().Info("provider.Exchange", zap.String("provider", provider.Name()), zap.Error(err))
+		encoding.HandleError(c, errSSOLoginFailed)
+		return
+	}
+
+	u, err := h.provision(ctx, provider, identity)
+	if err != nil {
+		encoding.HandleError(c, err)
+		return
+	}
+	if u.Status == model.UserStatusDisabled {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "用户已经被停用，请联系管理员"))
+		return
+	}
+
+	h.finishLogin(ctx, c, u, state.Device)
+}
+
+// providerLogin checks the password against a PasswordProvider such as LDAP
+func (h *authHandler) providerLogin(ctx context.Context, c *gin.Context, req loginReq, ip string) (*model.User, bool) {
+	p, err := idp.Get(req.Provider)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return nil, false
+	}
+	provider, ok := p.(idp.PasswordProvider)
+	if !ok {
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return nil, false
+	}
+
+	identity, err := provider.Authenticate(ctx, req.Account, req.Password)
+	if errors.Is(err, idp.ErrInvalidCredentials) {
+		h.loginFailed(ctx, req.Account, ip)
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "用户名或密码错误"))
+		return nil, false
+	}
+	if err != nil {
+		zap.L().Error("provider.Authenticate", zap.String("provider", provider.Name()), zap.Error(err))
+		encoding.HandleError(c, errSSOLoginFailed)
+		return nil, false
+	}
+
+	u, err := h.provision(ctx, provider, identity)
+	if err != nil {
+		encoding.HandleError(c, err)
+		return nil, false
+	}
+	if u.Status == model.UserStatusDisabled {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "用户已经被停用，请联系管理员"))
+		return nil, false
+	}
+
+	if err = h.loginGuard.Succeed(ctx, req.Account); err != nil {
+		zap.L().Error("loginGuard.Succeed", zap.Error(err))
+	}
+	return u, true
+}
+
+// provision returns the local user linked to the identity, creating it on the first login
+func (h *authHandler) provision(ctx context.Context, provider idp.IdentityProvider, identity *idp.Identity) (*model.User, error) {
+	if identity.Subject == "" {
+		zap.L().Error("identity without subject", zap.String("provider", provider.Name()))
+		return nil, errSSOLoginFailed
+	}
+
+	found, link, err := dao.GetUserIdentity(ctx, h.db, provider.Name(), identity.Subject)
+	if err != nil {
+		zap.L().Error("dao.GetUserIdentity", zap.Error(err))
+		return nil, errutil.ErrInternalServer
+	}
+	if found {
+		ok, u, err := dao.GetUserByUID(ctx, h.db, link.UserUID)
+		if !ok {
+			zap.L().Error("dao.GetUserByUID", zap.String("uid", link.UserUID), zap.Error(err))
+			return nil, errutil.ErrInternalServer
+		}
+		return u, nil
+	}
+
+	mapped, ok := provider.Mapping().Apply(identity)
+	if !ok {
+		zap.L().Info("identity not mapped to a role", zap.String("provider", provider.Name()), zap.String("subject", identity.Subject))
+		return nil, errSSONotMapped
+	}
+	if identity.Username == "" || len(identity.Username) > maxUsernameLength {
+		zap.L().Info("identity username unusable", zap.String("provider", provider.Name()), zap.String("username", identity.Username))
+		return nil, errSSONotMapped
+	}
+
+	// 同名的本地账号不自动绑定，避免外部账号接管本地账号
+	exists, _, err := dao.GetUserByAccount(ctx, h.db, identity.Username)
+	if err != nil {
+		zap.L().Error("dao.GetUserByAccount", zap.Error(err))
+		return nil, errutil.ErrInternalServer
+	}
+	if exists {
+		return nil, errSSOUsernameExists
+	}
+
+	// 验证学院和班级合理性，规则与 createUser 保持一致
+	if mapped.ProfessionHashID != "" {
+		if found, _, _ := dao.GetProfessionByHashID(ctx, h.db, mapped.ProfessionHashID); !found {
+			mapped.ProfessionHashID = ""
+		}
+	}
+	if mapped.ClassHashID != "" {
+		if found, _, _ := dao.GetClassByHashID(ctx, h.db, mapped.ClassHashID); !found {
+			mapped.ClassHashID = ""
+		}
+	}
+	if mapped.Role == model.RoleTypeStudent {
+		if mapped.ProfessionHashID == "" || mapped.ClassHashID == "" {
+			zap.L().Info("student identity without profession or class", zap.String("provider", provider.Name()), zap.String("subject", identity.Subject))
+			return nil, errSSONotMapped
+		}
+	} else if mapped.ProfessionHashID == "" {
+		admin, _ := dao.GetSuperProfession(ctx, h.db)
+		mapped.ProfessionHashID = admin.HashID
+	}
+
+	// 外部账号不能使用本地密码登录
+	unusable, err := randomToken()
+	if err != nil {
+		zap.L().Error("randomToken", zap.Error(err))
+		return nil, errutil.ErrInternalServer
+	}
+	encoded, err := password.Hash(unusable)
+	if err != nil {
+		zap.L().Error("password.Hash", zap.Error(err))
+		return nil, errutil.ErrInternalServer
+	}
+
+	name := identity.Name
+	if name == "" {
+		name = identity.Username
+	}
+
+	u, err := dao.ProvisionUser(ctx, h.db, model.User{
+		UID:              utils.NextID(),
+		Username:         identity.Username,
+		Name:             name,
+		Role:             mapped.Role,
+		Password:         encoded,
+		ProfessionHashID: mapped.ProfessionHashID,
+		ClassHashID:      mapped.ClassHashID,
+		Creator:          model.SystemUsername,
+		Updater:          model.SystemUsername,
+		Status:           model.UserStatusNormal,
+		Phone:            identity.Phone,
+		Emial:            identity.Email,
+	}, provider.Name(), identity.Subject)
+	if err != nil {
+		zap.L().Error("dao.ProvisionUser", zap.String("provider", provider.Name()), zap.Error(err))
+		return nil, errutil.ErrCreateUser
+	}
+
+	zap.L().Info("user provisioned", zap.String("provider", provider.Name()), zap.String("username", u.Username), zap.String("role", string(u.Role)))
+	return u, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"v1/pkg/idp"
+	"v1/pkg/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeProvider returns the identity it is given, with the mapping compiled the way the real providers do
+type fakeProvider struct {
+	idp.IdentityProvider
+	identity *idp.Identity
+}
+
+func newFakeProvider(t *testing.T, mapping idp.Mapping, identity *idp.Identity) *fakeProvider {
+	t.Helper()
+	p, err := idp.NewLDAPProvider("corp", idp.LDAPConfig{URL: "ldap://127.0.0.1:1", BaseDN: "dc=example"}, mapping)
+	if err != nil {
+		t.Fatalf("NewLDAPProvider: %v", err)
+	}
+	return &fakeProvider{IdentityProvider: p, identity: identity}
+}
+
+func (p *fakeProvider) Type() string {
+	return idp.TypeOIDC
+}
+
+func (p *fakeProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	return "https://idp.example/authorize?state=" + state, nil
+}
+
+func (p *fakeProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*idp.Identity, error) {
+	if code != "good" {
+		return nil, idp.ErrInvalidCredentials
+	}
+	return p.identity, nil
+}
+
+func useProviders(t *testing.T, list ...idp.IdentityProvider) {
+	t.Helper()
+	old := idp.List()
+	idp.SetProviders(list)
+	t.Cleanup(func() { idp.SetProviders(old) })
+}
+
+// newSSOTestHandler returns a handler with a super admin profession, a profession "p-cs" and its class "c-1"
+func newSSOTestHandler(t *testing.T) *authHandler {
+	t.Helper()
+	h := newTestHandler(t, new(model.UserIdentity), new(model.Profession), new(model.Class), new(model.Config), new(model.UserTwoFactor))
+
+	rows := []any{
+		&model.Profession{HashID: "p-admin", CollegeName: "admin", ProfessionName: "admin"},
+		&model.Profession{HashID: "p-cs", CollegeName: "science", ProfessionName: "cs"},
+		&model.Class{ProfessionHashID: "p-cs", ClassHashID: "c-1", ClassName: "1"},
+		&model.User{UID: "local", Username: "carol", Status: model.UserStatusNormal},
+	}
+	for _, row := range rows {
+		if err := h.db.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+	return h
+}
+
+func TestProvision(t *testing.T) {
+	mapping := idp.Mapping{
+		Rules: []idp.Rule{
+			{Attribute: "groups", Match: "^teachers$", Role: model.RoleTypeTeacher},
+			{Attribute: "groups", Match: "^students$", Role: model.RoleTypeStudent},
+			{Attribute: "department", Match: "^cs$", ProfessionHashID: "p-cs"},
+			{Attribute: "department", Match: "^gone$", ProfessionHashID: "p-gone"},
+			{Attribute: "class", Match: "^1$", ClassHashID: "c-1"},
+			{Attribute: "class", Match: "^2$", ClassHashID: "c-2"},
+		},
+	}
+
+	identity := func(subject, username string, attributes map[string][]string) *idp.Identity {
+		return &idp.Identity{Provider: "corp", Subject: subject, Username: username, Name: strings.ToUpper(username), Email: username + "@example.com", Attributes: attributes}
+	}
+
+	tests := []struct {
+		name     string
+		identity *idp.Identity
+		err      error
+		want     model.User // role, profession and class of the provisioned user
+	}{
+		{
+			name:     "student",
+			identity: identity("s1", "alice", map[string][]string{"groups": {"students"}, "department": {"cs"}, "class": {"1"}}),
+			want:     model.User{Role: model.RoleTypeStudent, ProfessionHashID: "p-cs", ClassHashID: "c-1"},
+		},
+		{
+			name:     "teacher without profession gets the super admin profession",
+			identity: identity("s2", "bob", map[string][]string{"groups": {"teachers"}}),
+			want:     model.User{Role: model.RoleTypeTeacher, ProfessionHashID: "p-admin"},
+		},
+		{
+			name:     "teacher of an unknown profession",
+			identity: identity("s3", "dave", map[string][]string{"groups": {"teachers"}, "department": {"gone"}}),
+			want:     model.User{Role: model.RoleTypeTeacher, ProfessionHashID: "p-admin"},
+		},
+		{
+			name:     "student of an unknown class",
+			identity: identity("s4", "erin", map[string][]string{"groups": {"students"}, "department": {"cs"}, "class": {"2"}}),
+			err:      errSSONotMapped,
+		},
+		{
+			name:     "student without profession",
+			identity: identity("s5", "frank", map[string][]string{"groups": {"students"}, "class": {"1"}}),
+			err:      errSSONotMapped,
+		},
+		{
+			name:     "no role",
+			identity: identity("s6", "grace", map[string][]string{"groups": {"guests"}}),
+			err:      errSSONotMapped,
+		},
+		{
+			name:     "no username",
+			identity: identity("s7", "", map[string][]string{"groups": {"teachers"}}),
+			err:      errSSONotMapped,
+		},
+		{
+			name:     "username too long",
+			identity: identity("s8", strings.Repeat("x", maxUsernameLength+1), map[string][]string{"groups": {"teachers"}}),
+			err:      errSSONotMapped,
+		},
+		{
+			name:     "local account with the same username",
+			identity: identity("s9", "carol", map[string][]string{"groups": {"teachers"}}),
+			err:      errSSOUsernameExists,
+		},
+		{
+			name:     "no subject",
+			identity: identity("", "heidi", map[string][]string{"groups": {"teachers"}}),
+			err:      errSSOLoginFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newSSOTestHandler(t)
+			p := newFakeProvider(t, mapping, tt.identity)
+			ctx := context.Background()
+
+			u, err := h.provision(ctx, p, tt.identity)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				var count int64
+				h.db.Model(&model.UserIdentity{}).Count(&count)
+				if count != 0 {
+					t.Fatalf("%d identities linked after a refused provisioning", count)
+				}
+				return
+			}
+
+			if u.Role != tt.want.Role || u.ProfessionHashID != tt.want.ProfessionHashID || u.ClassHashID != tt.want.ClassHashID {
+				t.Fatalf("user role %s, profession %q, class %q, want %s, %q, %q",
+					u.Role, u.ProfessionHashID, u.ClassHashID, tt.want.Role, tt.want.ProfessionHashID, tt.want.ClassHashID)
+			}
+			if u.Username != tt.identity.Username || u.Name != tt.identity.Name || u.Emial != tt.identity.Email || u.Creator != model.SystemUsername {
+				t.Fatalf("user = %+v", u)
+			}
+			// 外部账号的本地密码不可用
+			if u.Password == "" {
+				t.Fatal("provisioned user without a password hash")
+			}
+
+			// 再次登录使用已绑定的账号，即使映射规则已经变化
+			again, err := h.provision(ctx, newFakeProvider(t, idp.Mapping{}, tt.identity), tt.identity)
+			if err != nil {
+				t.Fatalf("second provision: %v", err)
+			}
+			if again.UID != u.UID || again.Role != u.Role {
+				t.Fatalf("second provision got %s (%s), want %s (%s)", again.UID, again.Role, u.UID, u.Role)
+			}
+		})
+	}
+}
+
+func TestSSOCallback(t *testing.T) {
+	h := newSSOTestHandler(t)
+	mapping := idp.Mapping{DefaultRole: model.RoleTypeTeacher}
+	useProviders(t, newFakeProvider(t, mapping, &idp.Identity{Provider: "corp", Subject: "s1", Username: "alice"}))
+	provider := gin.Param{Key: "provider", Value: "corp"}
+
+	start := func() string {
+		w := call(h.ssoStart, nil, provider)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ssoStart: %d %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data ssoStartResp `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal %s: %v", w.Body.String(), err)
+		}
+		if !strings.HasSuffix(resp.Data.AuthURL, "state="+resp.Data.State) {
+			t.Fatalf("auth url %q doesn't carry state %q", resp.Data.AuthURL, resp.Data.State)
+		}
+		return resp.Data.State
+	}
+
+	state := start()
+	if w := call(h.ssoCallback, ssoCallbackReq{Code: "good", State: state}, gin.Param{Key: "provider", Value: "other"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("callback of another provider: %d %s", w.Code, w.Body.String())
+	}
+	// 校验失败同样消耗 state
+	if w := call(h.ssoCallback, ssoCallbackReq{Code: "good", State: state}, provider); w.Code != http.StatusBadRequest {
+		t.Fatalf("callback with a used state: %d %s", w.Code, w.Body.String())
+	}
+
+	state = start()
+	if w := call(h.ssoCallback, ssoCallbackReq{Code: "bad", State: state}, provider); w.Code != http.StatusUnauthorized {
+		t.Fatalf("callback with a bad code: %d %s", w.Code, w.Body.String())
+	}
+
+	state = start()
+	w := call(h.ssoCallback, ssoCallbackReq{Code: "good", State: state}, provider)
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data loginResp `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal %s: %v", w.Body.String(), err)
+	}
+	if resp.Data.Username != "alice" || resp.Data.Role != model.RoleTypeTeacher || resp.Data.Token == "" || resp.Data.RefreshToken == "" {
+		t.Fatalf("login = %+v", resp.Data)
+	}
+
+	if w = call(h.ssoCallback, ssoCallbackReq{Code: "good", State: state}, provider); w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed callback: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,399 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/server/errutil"
+	"v1/pkg/totp"
+	"v1/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	loginChallengeExpiration = time.Minute * 5
+	loginChallengeKeyPrefix  = "login_challenge:"
+
+	// wrong codes before the challenge is dropped and the password has to be entered again
+	loginChallengeMaxAttempts = 5
+)
+
+var (
+	errInvalidChallenge  = errutil.NewError(http.StatusUnauthorized, "login challenge invalid or expired")
+	errInvalidCode       = errutil.NewError(http.StatusBadRequest, "two-factor code is wrong")
+	errTwoFactorDisabled = errutil.NewError(http.StatusNotFound, "two-factor authentication is disabled")
+)
+
+// requireTwoFactor rejects the two-factor requests when it is disabled by --totp-enabled=false
+func requireTwoFactor(c *gin.Context) {
+	if !totp.Enabled() {
+		encoding.HandleError(c, errTwoFactorDisabled)
+	}
+}
+
+// loginChallenge is what a user who passed the password step may do next
+type loginChallenge struct {
+	UserUID  string `json:"uid"`
+	Enroll   bool   `json:"enroll"` // 强制绑定：尚未启用两步验证
+	Device   string `json:"device"`
+	Attempts int    `json:"attempts"`
+}
+
+func (h *authHandler) newLoginChallenge(ctx context.Context, challenge loginChallenge) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		zap.L().Error("rand.Read", zap.Error(err))
+		return "", err
+	}
+	challengeStr := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := h.saveLoginChallenge(ctx, challengeStr, challenge); err != nil {
+		zap.L().Error("saveLoginChallenge", zap.Error(err))
+		return "", err
+	}
+	return challengeStr, nil
+}
+
+func (h *authHandler) saveLoginChallenge(ctx context.Context, challengeStr string, challenge loginChallenge) error {
+	b, _ := json.Marshal(challenge)
+	return h.cacheClient.Set(ctx, loginChallengeKeyPrefix+utils.SHA256Hex(challengeStr), string(b), loginChallengeExpiration)
+}
+
+func (h *authHandler) getLoginChallenge(ctx context.Context, challengeStr string) (loginChallenge, bool) {
+	var challenge loginChallenge
+	if challengeStr == "" {
+		return challenge, false
+	}
+
+	val, err := h.cacheClient.Get(ctx, loginChallengeKeyPrefix+utils.SHA256Hex(challengeStr))
+	if err != nil {
+		return challenge, false
+	}
+	if err = json.Unmarshal([]byte(val), &challenge); err != nil {
+		return challenge, false
+	}
+	return challenge, true
+}
+
+// loginTwoFactor the second login step, exchanges the challenge and a code for the tokens
+func (h *authHandler) loginTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := loginTwoFactorReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	challenge, ok := h.getLoginChallenge(ctx, req.Challenge)
+	if !ok {
+		encoding.HandleError(c, errInvalidChallenge)
+		return
+	}
+
+	found, u, err := dao.GetUserByUID(ctx, h.db, challenge.UserUID)
+	if err != nil || !found || u.Status == model.UserStatusDisabled {
+		zap.L().Info("login challenge user unavailable", zap.String("uid", challenge.UserUID), zap.Error(err))
+		_ = h.cacheClient.Del(ctx, loginChallengeKeyPrefix+utils.SHA256Hex(req.Challenge))
+		encoding.HandleError(c, errInvalidChallenge)
+		return
+	}
+
+	// 绑定中只能用验证码完成首次验证
+	if challenge.Enroll {
+		req.RecoveryCode = ""
+	}
+	ok, err = h.verifySecondFactor(ctx, u.UID, req.Code, req.RecoveryCode, challenge.Enroll)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !ok {
+		h.loginFailed(ctx, u.Username, c.ClientIP())
+
+		challenge.Attempts++
+		if challenge.Attempts >= loginChallengeMaxAttempts {
+			_ = h.cacheClient.Del(ctx, loginChallengeKeyPrefix+utils.SHA256Hex(req.Challenge))
+		} else if err = h.saveLoginChallenge(ctx, req.Challenge, challenge); err != nil {
+			zap.L().Error("saveLoginChallenge", zap.Error(err))
+		}
+		encoding.HandleError(c, errInvalidCode)
+		return
+	}
+
+	// challenge 只能使用一次
+	if err = h.cacheClient.Del(ctx, loginChallengeKeyPrefix+utils.SHA256Hex(req.Challenge)); err != nil {
+		zap.L().Error("cacheClient.Del", zap.Error(err))
+	}
+
+	h.completeLogin(ctx, c, u, challenge.Device)
+}
+
+// loginEnroll starts the mandatory enrollment of a user who passed the password step
+func (h *authHandler) loginEnroll(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := loginEnrollReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	challenge, ok := h.getLoginChallenge(ctx, req.Challenge)
+	if !ok || !challenge.Enroll {
+		encoding.HandleError(c, errInvalidChallenge)
+		return
+	}
+
+	found, u, err := dao.GetUserByUID(ctx, h.db, challenge.UserUID)
+	if err != nil || !found {
+		zap.L().Info("login challenge user unavailable", zap.String("uid", challenge.UserUID), zap.Error(err))
+		encoding.HandleError(c, errInvalidChallenge)
+		return
+	}
+
+	h.enroll(ctx, c, u)
+}
+
+// enrollTwoFactor starts the enrollment of the current user
+func (h *authHandler) enrollTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	found, u, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+
+	found, tf, err := dao.GetUserTwoFactor(ctx, h.db, u.UID)
+	if err != nil {
+		zap.L().Error("dao.GetUserTwoFactor", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if found && tf.Enabled {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "two-factor authentication is already enabled"))
+		return
+	}
+
+	h.enroll(ctx, c, u)
+}
+
+// enroll creates a pending enrollment, it is enabled by the first valid code
+func (h *authHandler) enroll(ctx context.Context, c *gin.Context, u *model.User) {
+	if !u.Role.TwoFactorCapable() {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	secret, uri, err := totp.Default().NewSecret(u.Username)
+	if err != nil {
+		zap.L().Error("totp.NewSecret", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	codes, hashes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		zap.L().Error("totp.NewRecoveryCodes", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	if err = dao.UpsertUserTwoFactor(ctx, h.db, u.UID, secret, hashes); err != nil {
+		zap.L().Error("dao.UpsertUserTwoFactor", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, twoFactorEnrollResp{URI: uri, RecoveryCodes: codes})
+}
+
+// enableTwoFactor finishes the enrollment of the current user with the first code
+func (h *authHandler) enableTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := twoFactorCodeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	ok, err := h.verifySecondFactor(ctx, request.GetUserUIDFromCtx(ctx), req.Code, "", true)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !ok {
+		encoding.HandleError(c, errInvalidCode)
+		return
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// disableTwoFactor removes the enrollment of the current user, unless it is mandatory for the role
+func (h *authHandler) disableTwoFactor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := twoFactorCodeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	tfConf, err := dao.GetTwoFactorConfig(ctx, h.db)
+	if err != nil {
+		zap.L().Error("dao.GetTwoFactorConfig", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if tfConf.Required(request.GetRoleTypeFromCtx(ctx)) {
+		encoding.HandleError(c, errutil.NewError(http.StatusBadRequest, "two-factor authentication is mandatory for your role"))
+		return
+	}
+
+	uid := request.GetUserUIDFromCtx(ctx)
+	ok, err := h.verifySecondFactor(ctx, uid, req.Code, req.RecoveryCode, false)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !ok {
+		encoding.HandleError(c, errInvalidCode)
+		return
+	}
+
+	if err = dao.DeleteUserTwoFactor(ctx, h.db, uid); err != nil {
+		zap.L().Error("dao.DeleteUserTwoFactor", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c)
+}
+
+// regenerateRecoveryCodes replaces all recovery codes of the current user
+func (h *authHandler) regenerateRecoveryCodes(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := twoFactorCodeReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	uid := request.GetUserUIDFromCtx(ctx)
+	ok, err := h.verifySecondFactor(ctx, uid, req.Code, "", false)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !ok {
+		encoding.HandleError(c, errInvalidCode)
+		return
+	}
+
+	codes, hashes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		zap.L().Error("totp.NewRecoveryCodes", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if err = dao.UpdateRecoveryCodes(ctx, h.db, uid, hashes); err != nil {
+		zap.L().Error("dao.UpdateRecoveryCodes", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, recoveryCodesResp{RecoveryCodes: codes})
+}
+
+func (h *authHandler) getTwoFactorStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	tfConf, err := dao.GetTwoFactorConfig(ctx, h.db)
+	if err != nil {
+		zap.L().Error("dao.GetTwoFactorConfig", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	found, tf, err := dao.GetUserTwoFactor(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("dao.GetUserTwoFactor", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	data := twoFactorStatusResp{Required: tfConf.Required(request.GetRoleTypeFromCtx(ctx))}
+	if found && tf.Enabled {
+		var hashes []string
+		_ = json.Unmarshal(tf.RecoveryCodes, &hashes)
+
+		data.Enabled = true
+		data.RecoveryCodesLeft = len(hashes)
+	}
+
+	encoding.HandleSuccess(c, data)
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code, of the user. Pending enrollments
+// are only accepted when pending is true, and get enabled by the code.
+func (h *authHandler) verifySecondFactor(ctx context.Context, uid, code, recoveryCode string, pending bool) (bool, error) {
+	found, tf, err := dao.GetUserTwoFactor(ctx, h.db, uid)
+	if err != nil {
+		zap.L().Error("dao.GetUserTwoFactor", zap.Error(err))
+		return false, err
+	}
+	if !found || (!tf.Enabled && !pending) {
+		return false, nil
+	}
+
+	if recoveryCode != "" {
+		if !tf.Enabled {
+			return false, nil
+		}
+		ok, err := dao.UseRecoveryCode(ctx, h.db, uid, totp.HashRecoveryCode(recoveryCode))
+		if err != nil {
+			zap.L().Error("dao.UseRecoveryCode", zap.Error(err))
+		}
+		return ok, err
+	}
+
+	step, ok, err := totp.Default().Verify(tf.Secret, code, tf.LastUsedStep)
+	if err != nil {
+		zap.L().Error("totp.Verify", zap.String("uid", uid), zap.Error(err))
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+
+	ok, err = dao.UseTwoFactorStep(ctx, h.db, uid, step)
+	if err != nil {
+		zap.L().Error("dao.UseTwoFactorStep", zap.Error(err))
+	}
+	return ok, err
+}
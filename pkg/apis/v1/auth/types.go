@@ -1,6 +1,9 @@
 package auth
 
-import "v1/pkg/model"
+import (
+	"v1/pkg/model"
+	"v1/pkg/token"
+)
 
 type (
 	loginReq struct {
@@ -8,6 +11,8 @@ type (
 		Password     string `json:"password"`      // 密码
 		CaptchaID    string `json:"captcha_id"`    // 验证码id
 		CaptchaValue string `json:"captcha_value"` // 验证码
+		Device       string `json:"device"`        // 设备名称，用于会话列表展示
+		Provider     string `json:"provider"`      // 统一身份认证(LDAP)名称，为空时使用本地账号
 	}
 
 	loginResp struct {
@@ -17,10 +22,98 @@ type (
 		Name     string         `json:"name"`
 		Role     model.RoleType `json:"role"`
 		Token    string         `json:"token"`
+
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"` // token有效期(秒)
+
+		// 需要两步验证时不返回token，凭 challenge 调用 /auth/login/2fa
+		TwoFactorRequired  bool   `json:"two_factor_required,omitempty"`
+		TwoFactorEnroll    bool   `json:"two_factor_enroll,omitempty"` // 尚未绑定，需先调用 /auth/login/2fa/enroll
+		Challenge          string `json:"challenge,omitempty"`
+		ChallengeExpiresIn int64  `json:"challenge_expires_in,omitempty"`
+	}
+
+	loginTwoFactorReq struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`          // 验证器中的6位验证码
+		RecoveryCode string `json:"recovery_code"` // 或者一次性恢复码
+	}
+
+	loginEnrollReq struct {
+		Challenge string `json:"challenge"`
+	}
+
+	twoFactorEnrollResp struct {
+		URI           string   `json:"uri"` // otpauth:// 链接，生成二维码供验证器扫描
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	twoFactorCodeReq struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	twoFactorStatusResp struct {
+		Enabled           bool `json:"enabled"`
+		Required          bool `json:"required"`
+		RecoveryCodesLeft int  `json:"recovery_codes_left"`
+	}
+
+	recoveryCodesResp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	forgotPasswordReq struct {
+		Account      string `json:"account"`
+		CaptchaID    string `json:"captcha_id"`
+		CaptchaValue string `json:"captcha_value"`
+	}
+
+	resetPasswordReq struct {
+		Token       string `json:"token"` // 通知中收到的重置令牌
+		NewPassword string `json:"new_password"`
+	}
+
+	sessionItem struct {
+		token.Session
+		Current bool `json:"current"` // 当前请求所在的会话
+	}
+
+	refreshReq struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	refreshResp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+
+	loginThrottledResp struct {
+		RetryAfter int64 `json:"retry_after"` // 秒
+	}
+
+	captchaRequiredResp struct {
+		CaptchaRequired bool `json:"captcha_required"` // 需要先获取验证码再登录
 	}
 
 	createCaptchaResp struct {
 		CapthchaID string
 		Image      string
 	}
+
+	providerItem struct {
+		Name string `json:"name"`
+		Type string `json:"type"` // ldap: 使用 /auth/login 并填写 provider; oidc: 使用 /auth/sso/:provider
+	}
+
+	ssoStartResp struct {
+		AuthURL string `json:"auth_url"` // 跳转到统一身份认证登录页
+		State   string `json:"state"`
+	}
+
+	ssoCallbackReq struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
 )
@@ -0,0 +1,238 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"net/http"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/imsystem"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/server/errutil"
+)
+
+const (
+	maxPageSize      = 50
+	maxPresenceBatch = 100
+)
+
+type chatHandlerOption struct {
+	db *gorm.DB
+}
+
+type chatHandler struct {
+	chatHandlerOption
+	upgrader websocket.Upgrader
+}
+
+func newChatHandler(option chatHandlerOption) *chatHandler {
+	return &chatHandler{
+		chatHandlerOption: option,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// 与 cors 配置一致，允许所有来源；token 只来自查询参数或请求头，其他网站拿不到
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// serveWS upgrades the request to a websocket and serves the chat of the current user on it
+func (h *chatHandler) serveWS(c *gin.Context) {
+	payload, err := request.TokenPayloadFromCtx(c)
+	if err != nil {
+		zap.L().Error("request.TokenPayloadFromCtx", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrUnauthorized)
+		return
+	}
+
+	hub, ok := defaultHub(c)
+	if !ok {
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 已经写了错误响应
+		zap.L().Info("websocket upgrade failed", zap.Error(err))
+		return
+	}
+
+	imsystem.ServeConn(hub, conn, *payload)
+}
+
+// conversations lists the conversations of the current user with their latest message and unread count
+func (h *chatHandler) conversations(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := conversationListReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if req.Size <= 0 || req.Size > maxPageSize {
+		req.Size = maxPageSize
+	}
+
+	uid := request.GetUserUIDFromCtx(ctx)
+	latest, err := dao.ListLatestChatMessages(ctx, h.db, uid, req.Size)
+	if err != nil {
+		zap.L().Error("dao.ListLatestChatMessages", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	unread, err := dao.CountUnreadChatMessages(ctx, h.db, uid)
+	if err != nil {
+		zap.L().Error("dao.CountUnreadChatMessages", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]conversationItem, 0, len(latest))
+	for _, msg := range latest {
+		peer := msg.RecipientUID
+		if peer == uid {
+			peer = msg.SenderUID
+		}
+		items = append(items, conversationItem{
+			ConversationID: msg.ConversationID,
+			Peer:           peer,
+			LastMessage:    toMessageItem(msg),
+			Unread:         unread[msg.ConversationID],
+		})
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+// inConversation reports whether the current user is a member of the conversation
+func inConversation(ctx context.Context, conversationID string) bool {
+	uid := request.GetUserUIDFromCtx(ctx)
+	a, b, ok := model.PrivateConversationMembers(conversationID)
+	return ok && (uid == a || uid == b)
+}
+
+func (h *chatHandler) history(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := historyReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if req.Size <= 0 || req.Size > maxPageSize {
+		req.Size = maxPageSize
+	}
+
+	if !inConversation(ctx, req.ConversationID) {
+		zap.L().Error("not in the conversation", zap.String("conversation_id", req.ConversationID))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	messages, err := dao.ListChatHistory(ctx, h.db, req.ConversationID, req.BeforeID, req.Size)
+	if err != nil {
+		zap.L().Error("dao.ListChatHistory", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]messageItem, 0, len(messages))
+	for _, msg := range messages {
+		items = append(items, toMessageItem(msg))
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+// markRead marks the conversation read, the other user gets the read receipt if online
+func (h *chatHandler) markRead(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := markReadReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	hub, ok := defaultHub(c)
+	if !ok {
+		return
+	}
+
+	n, err := hub.MarkRead(ctx, request.GetUserUIDFromCtx(ctx), req.ConversationID, req.UpToID)
+	if errors.Is(err, imsystem.ErrNotInConversation) {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, n)
+}
+
+// presence returns the presence of a batch of users
+func (h *chatHandler) presence(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := presenceReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.UIDs) == 0 || len(req.UIDs) > maxPresenceBatch {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	hub, ok := defaultHub(c)
+	if !ok {
+		return
+	}
+
+	presence, err := hub.Presence(ctx, req.UIDs...)
+	if err != nil {
+		zap.L().Error("hub.Presence", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]presenceItem, 0, len(presence))
+	for _, p := range presence {
+		items = append(items, presenceItem{UID: p.UID, Status: p.Status, LastSeen: p.LastSeen})
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+// defaultHub returns the chat hub, or writes the error response if the chat is not started
+func defaultHub(c *gin.Context) (*imsystem.Hub, bool) {
+	hub := imsystem.Default()
+	if hub == nil {
+		zap.L().Error("chat hub is not started")
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return nil, false
+	}
+	return hub, true
+}
+
+func toMessageItem(msg model.ChatMessage) messageItem {
+	return messageItem{
+		ID:           msg.ID,
+		SenderUID:    msg.SenderUID,
+		RecipientUID: msg.RecipientUID,
+		Content:      msg.Content,
+		CreatedAt:    msg.CreatedAt,
+		DeliveredAt:  msg.DeliveredAt,
+		ReadAt:       msg.ReadAt,
+	}
+}
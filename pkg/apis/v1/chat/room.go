@@ -0,0 +1,326 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/imsystem"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/server/errutil"
+)
+
+const (
+	maxRoomNameLength = 32
+	maxMuteMinutes    = 7 * 24 * 60
+)
+
+var (
+	errNotRoomOwner       = errutil.NewError(http.StatusForbidden, "only the owner of the room can do this")
+	errRoomMemberNotFound = errutil.NewError(http.StatusNotFound, "not a member of the room")
+)
+
+// createRoom creates the chat room of a class or an interview, the project rooms are created along with their team
+func (h *chatHandler) createRoom(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := createRoomReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefID == "" {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	uid := request.GetUserUIDFromCtx(ctx)
+	room := model.ChatRoom{
+		Kind:       req.Kind,
+		RefID:      req.RefID,
+		CreatorUID: uid,
+		Creator:    request.GetUsernameFromCtx(ctx),
+	}
+
+	switch req.Kind {
+	case model.RoomKindClass:
+		found, class, err := dao.GetClassByHashID(ctx, h.db, req.RefID)
+		if err != nil || !found {
+			zap.L().Error("dao.GetClassByHashID", zap.String("class_hash_id", req.RefID), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		if ok, err := v1.InScope(ctx, h.db, "", class.ProfessionHashID); !ok {
+			zap.L().Error("class out of permission scope", zap.String("class_hash_id", req.RefID), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+		room.Name = class.ClassName
+
+	case model.RoomKindInterview:
+		id, err := strconv.ParseInt(req.RefID, 10, 64)
+		if err != nil {
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		interview, err := dao.GetInterviewByID(ctx, h.db, id)
+		if err != nil {
+			zap.L().Error("dao.GetInterviewByID", zap.Int64("interview_id", id), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		// 面试群由面试发起人创建
+		if interview.CreatorUID != uid {
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+		room.Name = interview.Ttile
+
+	default:
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	room.Name = truncate(room.Name, maxRoomNameLength)
+
+	created, err := dao.CreateChatRoom(ctx, h.db, room)
+	if err != nil {
+		zap.L().Error("dao.CreateChatRoom", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, created.ID)
+}
+
+// rooms lists the rooms of the current user with their latest message and unread count
+func (h *chatHandler) rooms(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	rooms, members, err := dao.ListUserChatRooms(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("dao.ListUserChatRooms", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	conversationIDs := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		conversationIDs = append(conversationIDs, model.RoomConversationID(room.ID))
+	}
+	latest, err := dao.ListLatestMessagesOf(ctx, h.db, conversationIDs)
+	if err != nil {
+		zap.L().Error("dao.ListLatestMessagesOf", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	latestOf := make(map[string]messageItem, len(latest))
+	for _, msg := range latest {
+		latestOf[msg.ConversationID] = toMessageItem(msg)
+	}
+
+	items := make([]roomItem, 0, len(rooms))
+	for i, room := range rooms {
+		unread, err := dao.CountUnreadRoomMessages(ctx, h.db, members[i])
+		if err != nil {
+			zap.L().Error("dao.CountUnreadRoomMessages", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+
+		item := roomItem{
+			ID:             room.ID,
+			ConversationID: conversationIDs[i],
+			Kind:           room.Kind,
+			RefID:          room.RefID,
+			Name:           room.Name,
+			Creator:        room.Creator,
+			Role:           members[i].Role,
+			MutedUntil:     members[i].MutedUntil,
+			Unread:         unread,
+		}
+		if msg, ok := latestOf[conversationIDs[i]]; ok {
+			item.LastMessage = &msg
+		}
+		items = append(items, item)
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+// roomMember returns the membership of the current user, or writes the error response if the user is not in the room
+func (h *chatHandler) roomMember(ctx context.Context, c *gin.Context, roomID int64) (model.ChatRoomMember, bool) {
+	found, member, err := dao.GetChatRoomMember(ctx, h.db, roomID, request.GetUserUIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("dao.GetChatRoomMember", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return member, false
+	}
+	if !found {
+		zap.L().Error("not in the room", zap.Int64("room_id", roomID))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return member, false
+	}
+	return member, true
+}
+
+func (h *chatHandler) roomMembers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := roomReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if _, ok := h.roomMember(ctx, c, req.RoomID); !ok {
+		return
+	}
+
+	members, err := dao.ListChatRoomMembers(ctx, h.db, req.RoomID)
+	if err != nil {
+		zap.L().Error("dao.ListChatRoomMembers", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]roomMemberItem, 0, len(members))
+	for _, member := range members {
+		items = append(items, roomMemberItem{
+			UserUID:    member.UserUID,
+			Username:   member.Username,
+			Role:       member.Role,
+			MutedUntil: member.MutedUntil,
+			JoinedAt:   member.JoinedAt,
+		})
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+func (h *chatHandler) roomHistory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := roomHistoryReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if req.Size <= 0 || req.Size > maxPageSize {
+		req.Size = maxPageSize
+	}
+	if _, ok := h.roomMember(ctx, c, req.RoomID); !ok {
+		return
+	}
+
+	messages, err := dao.ListChatHistory(ctx, h.db, model.RoomConversationID(req.RoomID), req.BeforeID, req.Size)
+	if err != nil {
+		zap.L().Error("dao.ListChatHistory", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]messageItem, 0, len(messages))
+	for _, msg := range messages {
+		items = append(items, toMessageItem(msg))
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+// muteMember mutes the member of the room for some minutes, 0 unmutes
+func (h *chatHandler) muteMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := roomMemberReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Minutes < 0 || req.Minutes > maxMuteMinutes {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if !h.roomOwner(ctx, c, req.RoomID) {
+		return
+	}
+
+	var until int64
+	event := imsystem.RoomEventUnmuted
+	if req.Minutes > 0 {
+		until = time.Now().Add(time.Duration(req.Minutes) * time.Minute).UnixMilli()
+		event = imsystem.RoomEventMuted
+	}
+
+	err := dao.MuteRoomMember(ctx, h.db, req.RoomID, req.UserUID, until)
+	if errors.Is(err, dao.ErrRoomMemberNotFound) {
+		encoding.HandleError(c, errRoomMemberNotFound)
+		return
+	}
+	if err != nil {
+		zap.L().Error("dao.MuteRoomMember", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	if hub := imsystem.Default(); hub != nil {
+		hub.NotifyRoom(ctx, req.RoomID, request.GetUserUIDFromCtx(ctx), req.UserUID, event)
+	}
+	encoding.HandleSuccess(c)
+}
+
+// kickMember removes the member from the room, the member is not added back when the room syncs
+func (h *chatHandler) kickMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := roomMemberReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if !h.roomOwner(ctx, c, req.RoomID) {
+		return
+	}
+
+	err := dao.KickRoomMember(ctx, h.db, req.RoomID, req.UserUID)
+	if errors.Is(err, dao.ErrRoomMemberNotFound) {
+		encoding.HandleError(c, errRoomMemberNotFound)
+		return
+	}
+	if err != nil {
+		zap.L().Error("dao.KickRoomMember", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	if hub := imsystem.Default(); hub != nil {
+		hub.NotifyRoom(ctx, req.RoomID, request.GetUserUIDFromCtx(ctx), req.UserUID, imsystem.RoomEventKicked)
+	}
+	encoding.HandleSuccess(c)
+}
+
+// roomOwner reports whether the current user owns the room, or writes the error response
+func (h *chatHandler) roomOwner(ctx context.Context, c *gin.Context, roomID int64) bool {
+	member, ok := h.roomMember(ctx, c, roomID)
+	if !ok {
+		return false
+	}
+	if member.Role != model.RoomRoleOwner {
+		encoding.HandleError(c, errNotRoomOwner)
+		return false
+	}
+	return true
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,35 @@
+package chat
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"v1/pkg/apiserver/middleware"
+	"v1/pkg/client/cache"
+	"v1/pkg/rbac"
+	"v1/pkg/token"
+)
+
+func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, cacheClient cache.Interface, db *gorm.DB) {
+	chatG := group.Group("/chat")
+	handler := newChatHandler(chatHandlerOption{
+		db: db,
+	})
+
+	// 浏览器建立 websocket 时无法设置请求头，token 放在 jwt 查询参数中。
+	// websocket 不受 cors 限制，任何网站都能带着 cookie 发起连接，所以不接受 cookie 中的 token
+	chatG.GET("/ws", middleware.CheckTokenWithoutCookie(tokenManager, cacheClient), middleware.RequirePermission(rbac.PermissionChat), handler.serveWS)
+
+	chatG.Use(middleware.CheckToken(tokenManager, cacheClient))
+	chatG.POST("/conversations", middleware.RequirePermission(rbac.PermissionChat), handler.conversations) // 会话列表及未读数
+	chatG.POST("/history", middleware.RequirePermission(rbac.PermissionChat), handler.history)             // 翻页查看历史消息
+	chatG.POST("/read", middleware.RequirePermission(rbac.PermissionChat), handler.markRead)               // 标记已读，私聊和群聊通用
+	chatG.POST("/presence", middleware.RequirePermission(rbac.PermissionChat), handler.presence)           // 批量查询在线状态
+
+	// 群聊：项目群随团队自动创建，班级群和面试群手动创建
+	chatG.POST("/rooms/create", middleware.RequirePermission(rbac.PermissionChatRoom), handler.createRoom)
+	chatG.POST("/rooms/list", middleware.RequirePermission(rbac.PermissionChat), handler.rooms)
+	chatG.POST("/rooms/members", middleware.RequirePermission(rbac.PermissionChat), handler.roomMembers)
+	chatG.POST("/rooms/history", middleware.RequirePermission(rbac.PermissionChat), handler.roomHistory)
+	chatG.POST("/rooms/mute", middleware.RequirePermission(rbac.PermissionChat), handler.muteMember) // 群主禁言
+	chatG.POST("/rooms/kick", middleware.RequirePermission(rbac.PermissionChat), handler.kickMember) // 群主移出成员
+}
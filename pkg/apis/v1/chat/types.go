@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"v1/pkg/apiserver/imsystem"
+	"v1/pkg/model"
+)
+
+type (
+	conversationListReq struct {
+		Size int `json:"size"`
+	}
+
+	conversationItem struct {
+		ConversationID string      `json:"conversation_id"`
+		Peer           string      `json:"peer"` // 对方uid
+		LastMessage    messageItem `json:"last_message"`
+		Unread         int64       `json:"unread"`
+	}
+
+	historyReq struct {
+		ConversationID string `json:"conversation_id"`
+		BeforeID       int64  `json:"before_id"` // 从这条消息往前翻页，0 表示从最新开始
+		Size           int    `json:"size"`
+	}
+
+	messageItem struct {
+		ID           int64  `json:"id"`
+		SenderUID    string `json:"sender_uid"`
+		RecipientUID string `json:"recipient_uid"`
+		Content      string `json:"content"`
+		CreatedAt    int64  `json:"created_at"`
+		DeliveredAt  int64  `json:"delivered_at"`
+		ReadAt       int64  `json:"read_at"`
+	}
+
+	markReadReq struct {
+		ConversationID string `json:"conversation_id"`
+		UpToID         int64  `json:"up_to_id"` // 0 表示全部已读
+	}
+)
+
+type (
+	createRoomReq struct {
+		Kind  model.RoomKind `json:"kind"`   // class 或 interview，项目群自动创建
+		RefID string         `json:"ref_id"` // 班级hash_id 或面试id
+	}
+
+	roomReq struct {
+		RoomID int64 `json:"room_id"`
+	}
+
+	roomHistoryReq struct {
+		RoomID   int64 `json:"room_id"`
+		BeforeID int64 `json:"before_id"` // 从这条消息往前翻页，0 表示从最新开始
+		Size     int   `json:"size"`
+	}
+
+	roomMemberReq struct {
+		RoomID  int64  `json:"room_id"`
+		UserUID string `json:"user_uid"`
+		Minutes int    `json:"minutes"` // 禁言时长，0 表示解除禁言
+	}
+
+	roomItem struct {
+		ID             int64          `json:"id"`
+		ConversationID string         `json:"conversation_id"`
+		Kind           model.RoomKind `json:"kind"`
+		RefID          string         `json:"ref_id"`
+		Name           string         `json:"name"`
+		Creator        string         `json:"creator"`
+		Role           model.RoomRole `json:"role"`
+		MutedUntil     int64          `json:"muted_until"`
+		Unread         int64          `json:"unread"`
+		LastMessage    *messageItem   `json:"last_message,omitempty"`
+	}
+
+	roomMemberItem struct {
+		UserUID    string         `json:"user_uid"`
+		Username   string         `json:"username"`
+		Role       model.RoomRole `json:"role"`
+		MutedUntil int64          `json:"muted_until"`
+		JoinedAt   int64          `json:"joined_at"`
+	}
+)
+
+type (
+	presenceReq struct {
+		UIDs []string `json:"uids"`
+	}
+
+	presenceItem struct {
+		UID      string                  `json:"uid"`
+		Status   imsystem.PresenceStatus `json:"status"` // online、away 或 offline
+		LastSeen int64                   `json:"last_seen"`
+	}
+)
@@ -118,6 +118,12 @@ func (h *interviewHandler) deleteInterview(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, h.db, interview.CreatorUID, ""); !ok {
+		zap.L().Error("interview out of permission scope", zap.Int64("id", interview.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	err = dao.DeleteInterviewByID(ctx, h.db, interview.ID)
 	if err != nil {
 		zap.L().Error("dao.DeleteInterviewByID", zap.Error(err))
@@ -156,6 +162,17 @@ func (h *interviewHandler) interviewList(c *gin.Context) {
 	var interviews []model.Interview
 	var count int64
 	if req.IntervieweeUID != "" || req.CreatorUID != "" {
+		// 按别人筛选时对方要在权限范围内，筛选条件里有自己时结果只会是自己的面试
+		if req.IntervieweeUID != user.UID && req.CreatorUID != user.UID {
+			for _, uid := range []string{req.IntervieweeUID, req.CreatorUID} {
+				if ok, err := h.userInScope(ctx, uid); !ok {
+					zap.L().Error("user out of permission scope", zap.String("uid", uid), zap.Error(err))
+					encoding.HandleError(c, errutil.ErrPermissionDenied)
+					return
+				}
+			}
+		}
+
 		count, interviews, err = dao.FindInterviewByOption(ctx, h.db, model.InterviewOption{
 			Size: req.Size,
 			Page: req.Page,
@@ -172,7 +189,7 @@ func (h *interviewHandler) interviewList(c *gin.Context) {
 			Title:          req.Title,
 			IntervieweeUID: user.UID,
 		})
-	} else if user.Role == model.RoleTypeFirm || user.Role == model.RoleTypeSuperAdmin {
+	} else {
 		count, interviews, err = dao.FindInterviewByOption(ctx, h.db, model.InterviewOption{
 			Size: req.Size,
 			Page: req.Page,
@@ -229,7 +246,7 @@ func (h interviewHandler) interviewChangeStatus(c *gin.Context) {
 		return
 	}
 
-	if interview.CreatorUID != user.UID && interview.IntervieweeUID != user.UID {
+	if ok, _ := v1.InScope(ctx, h.db, interview.CreatorUID, ""); !ok && interview.IntervieweeUID != user.UID {
 		zap.L().Error("permission denied")
 		encoding.HandleError(c, errutil.ErrPermissionDenied)
 		return
@@ -270,5 +287,24 @@ func (h *interviewHandler) interviewDetail(c *gin.Context) {
 		return
 	}
 
+	if ok, _ := v1.InScope(ctx, h.db, interview.CreatorUID, ""); !ok && interview.IntervieweeUID != request.GetUserUIDFromCtx(ctx) {
+		zap.L().Error("interview out of permission scope", zap.Int64("id", interview.ID))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	encoding.HandleSuccess(c, interviewDetailResp{ID: interview.ID, Title: interview.Ttile, Info: interview.Info, Interviewee: interview.Interviewee, Status: interview.Status})
 }
+
+// userInScope reports whether the user is covered by the permission scope of the current user, an empty uid always is
+func (h *interviewHandler) userInScope(ctx context.Context, uid string) (bool, error) {
+	if uid == "" {
+		return true, nil
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, h.db, uid)
+	if err != nil || !found {
+		return false, err
+	}
+	return v1.InScope(ctx, h.db, user.UID, user.ProfessionHashID)
+}
@@ -5,6 +5,8 @@ import (
 	"gorm.io/gorm"
 	"v1/pkg/apiserver/middleware"
 	"v1/pkg/client/cache"
+	"v1/pkg/ratelimit"
+	"v1/pkg/rbac"
 	"v1/pkg/token"
 )
 
@@ -15,13 +17,14 @@ func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, cacheCli
 	})
 
 	resumeG.Use(middleware.CheckToken(tokenManager, cacheClient))
+	listLimit := middleware.RateLimit(ratelimit.Default(), ratelimit.PolicyList)
 
-	resumeG.POST("", handler.createInterview)    // done
-	resumeG.DELETE("", handler.deleteInterview)  // done
-	resumeG.POST("/list", handler.interviewList) // done
+	resumeG.POST("", middleware.RequirePermission(rbac.PermissionInterviewCreate), handler.createInterview)             // done
+	resumeG.DELETE("", middleware.RequirePermission(rbac.PermissionInterviewDelete), handler.deleteInterview)           // done
+	resumeG.POST("/list", middleware.RequirePermission(rbac.PermissionInterviewList), listLimit, handler.interviewList) // done
 
 	// 改变状态
-	resumeG.POST("/change", handler.interviewChangeStatus) // done
+	resumeG.POST("/change", middleware.RequirePermission(rbac.PermissionInterviewUpdate), handler.interviewChangeStatus) // done
 	// 详情
-	resumeG.POST("/:id/detail", handler.interviewDetail) // done
+	resumeG.POST("/:id/detail", middleware.RequirePermission(rbac.PermissionInterviewDetail), handler.interviewDetail) // done
 }
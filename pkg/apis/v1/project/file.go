@@ -0,0 +1,624 @@
+package project
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/server/errutil"
+	"v1/pkg/storage"
+	"v1/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	uploadSessionKeyPrefix = "upload:"
+	// 断点续传的会话保留一天
+	uploadSessionExpiration = time.Hour * 24
+
+	fileResourcePrefix = "project-file:"
+
+	// 写入存储的最低速率，按文件大小估算超时，100MB 的文件最多等待 105 秒
+	minStorageRate = 1 << 20 // bytes per second
+)
+
+var (
+	errFileTooLarge     = errutil.NewError(http.StatusRequestEntityTooLarge, "file too large")
+	errFileType         = errutil.NewError(http.StatusUnsupportedMediaType, "file type not allowed")
+	errChecksum         = errutil.NewError(http.StatusBadRequest, "file checksum mismatch")
+	errUploadIncomplete = errutil.NewError(http.StatusBadRequest, "upload incomplete")
+)
+
+// uploadSession state of a resumable upload, kept in the cache so the chunks can go to any instance
+type uploadSession struct {
+	ID          string `json:"id"`
+	ProjectID   int64  `json:"project_id"`
+	PhaseID     int64  `json:"phase_id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ChunkSize   int64  `json:"chunk_size"`
+	Chunks      int    `json:"chunks"`
+	UploaderUID string `json:"uploader_uid"`
+}
+
+func (s *uploadSession) chunkLength(index int) int64 {
+	if index == s.Chunks-1 {
+		return s.Size - s.ChunkSize*int64(s.Chunks-1)
+	}
+	return s.ChunkSize
+}
+
+// storeTimeout is how long writing size bytes to the storage may take, DefaultTimeout is too short for large files
+func storeTimeout(size int64) time.Duration {
+	return v1.DefaultTimeout + time.Duration(size/minStorageRate)*time.Second
+}
+
+func chunkStorageKey(uploadID string, index int) string {
+	return fmt.Sprintf("uploads/%s/%d", uploadID, index)
+}
+
+func chunkCacheKey(uploadID string, index int) string {
+	return fmt.Sprintf("%s%s:chunk:%d", uploadSessionKeyPrefix, uploadID, index)
+}
+
+// fileService returns the configured storage, or writes the error response if there is none
+func fileService(c *gin.Context) (*storage.Service, bool) {
+	svc := storage.Default()
+	if svc == nil {
+		zap.L().Error("file storage is not configured")
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return nil, false
+	}
+	return svc, true
+}
+
+// getUploadProject returns the project if the current user may upload to it: the teacher who created it or a member of the team
+func (h *projectHandler) getUploadProject(ctx context.Context, c *gin.Context, projectID, phaseID int64) (model.Project, bool) {
+	found, project, err := dao.GetProjectByID(ctx, h.db, projectID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return project, false
+	}
+
+	if project.CreatorUID != request.GetUserUIDFromCtx(ctx) {
+		if member, err := h.isMember(ctx, project.ID); !member {
+			zap.L().Error("only the owner or the team can upload files", zap.Int64("project_id", project.ID), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return project, false
+		}
+	}
+
+	if phaseID != 0 {
+		found, phase, err := dao.GetProjectPhaseByID(ctx, h.db, phaseID)
+		if err != nil || !found || phase.ProjectID != project.ID {
+			zap.L().Error("the phase is not of the project", zap.Int64("phase_id", phaseID), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return project, false
+		}
+	}
+
+	return project, true
+}
+
+// storeFile detects the type of the content, writes it to the storage and records the metadata.
+// checksum is the expected sha256 in hex, empty if the client didn't give one
+func (h *projectHandler) storeFile(ctx context.Context, c *gin.Context, svc *storage.Service, file model.ProjectFile,
+	r io.Reader, checksum string) (*model.ProjectFile, bool) {
+	br := bufio.NewReaderSize(r, 512)
+	head, _ := br.Peek(512)
+	file.ContentType = http.DetectContentType(head)
+	if !svc.Allowed(file.ContentType) {
+		zap.L().Error("file type not allowed", zap.String("content_type", file.ContentType))
+		encoding.HandleError(c, errFileType)
+		return nil, false
+	}
+
+	hash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(br, hash)}
+	file.StorageKey = path.Join("projects", strconv.FormatInt(file.ProjectID, 10), utils.NextID())
+	if err := svc.Storage.Put(ctx, file.StorageKey, counter, file.Size, file.ContentType); err != nil {
+		zap.L().Error("storage.Put", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return nil, false
+	}
+
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if (checksum != "" && !strings.EqualFold(checksum, file.SHA256)) || counter.n != file.Size {
+		zap.L().Error("file checksum mismatch", zap.String("expected", checksum), zap.String("actual", file.SHA256),
+			zap.Int64("size", file.Size), zap.Int64("read", counter.n))
+		_ = svc.Storage.Delete(ctx, file.StorageKey)
+		encoding.HandleError(c, errChecksum)
+		return nil, false
+	}
+
+	saved, err := dao.InsertProjectFile(ctx, h.db, file)
+	if err != nil {
+		zap.L().Error("dao.InsertProjectFile", zap.Error(err))
+		_ = svc.Storage.Delete(ctx, file.StorageKey)
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return nil, false
+	}
+	return saved, true
+}
+
+// uploadFile uploads a whole file in one multipart/form-data request: project_id, phase_id, sha256 and file
+func (h *projectHandler) uploadFile(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	svc, ok := fileService(c)
+	if !ok {
+		return
+	}
+
+	// 表单字段的开销留 1MB
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, svc.MaxSize+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		zap.L().Error("c.FormFile", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if header.Size > svc.MaxSize {
+		encoding.HandleError(c, errFileTooLarge)
+		return
+	}
+
+	projectID, _ := strconv.ParseInt(c.PostForm("project_id"), 10, 64)
+	phaseID, _ := strconv.ParseInt(c.PostForm("phase_id"), 10, 64)
+	project, ok := h.getUploadProject(ctx, c, projectID, phaseID)
+	if !ok {
+		return
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		zap.L().Error("header.Open", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	defer f.Close()
+
+	// 表单已经读完，从这里开始按文件大小计时
+	storeCtx, storeCancel := context.WithTimeout(c, storeTimeout(header.Size))
+	defer storeCancel()
+	saved, ok := h.storeFile(storeCtx, c, svc, model.ProjectFile{
+		ProjectID:   project.ID,
+		PhaseID:     phaseID,
+		Name:        path.Base(header.Filename),
+		Size:        header.Size,
+		UploaderUID: request.GetUserUIDFromCtx(ctx),
+	}, f, c.PostForm("sha256"))
+	if !ok {
+		return
+	}
+
+	encoding.HandleSuccess(c, toFileItem(*saved))
+}
+
+// createUpload starts a resumable upload, the chunks are uploaded with uploadChunk in any order
+func (h *projectHandler) createUpload(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	svc, ok := fileService(c)
+	if !ok {
+		return
+	}
+
+	req := createUploadReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || req.Size <= 0 || len(req.SHA256) != sha256.Size*2 {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if req.Size > svc.MaxSize {
+		encoding.HandleError(c, errFileTooLarge)
+		return
+	}
+
+	project, ok := h.getUploadProject(ctx, c, req.ProjectID, req.PhaseID)
+	if !ok {
+		return
+	}
+
+	session := uploadSession{
+		ID:          utils.NextID(),
+		ProjectID:   project.ID,
+		PhaseID:     req.PhaseID,
+		Name:        path.Base(req.Name),
+		Size:        req.Size,
+		SHA256:      strings.ToLower(req.SHA256),
+		ChunkSize:   svc.ChunkSize,
+		Chunks:      int((req.Size + svc.ChunkSize - 1) / svc.ChunkSize),
+		UploaderUID: request.GetUserUIDFromCtx(ctx),
+	}
+	b, _ := json.Marshal(session)
+	if err := h.cacheClient.Set(ctx, uploadSessionKeyPrefix+session.ID, string(b), uploadSessionExpiration); err != nil {
+		zap.L().Error("cacheClient.Set", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, uploadStatusResp{UploadID: session.ID, ChunkSize: session.ChunkSize, Chunks: session.Chunks, Received: []int{}})
+}
+
+// getUploadSession returns the session of the current user, or writes the error response
+func (h *projectHandler) getUploadSession(ctx context.Context, c *gin.Context) (*uploadSession, bool) {
+	val, err := h.cacheClient.Get(ctx, uploadSessionKeyPrefix+c.Param("id"))
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return nil, false
+	}
+
+	session := &uploadSession{}
+	if err = json.Unmarshal([]byte(val), session); err != nil {
+		zap.L().Error("json.Unmarshal", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return nil, false
+	}
+	if session.UploaderUID != request.GetUserUIDFromCtx(ctx) {
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return nil, false
+	}
+	return session, true
+}
+
+func (h *projectHandler) receivedChunks(ctx context.Context, session *uploadSession) ([]int, error) {
+	received := make([]int, 0, session.Chunks)
+	for i := 0; i < session.Chunks; i++ {
+		ok, err := h.cacheClient.Exists(ctx, chunkCacheKey(session.ID, i))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			received = append(received, i)
+		}
+	}
+	return received, nil
+}
+
+// uploadStatus lists the received chunks, the client resumes by uploading the others
+func (h *projectHandler) uploadStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	session, ok := h.getUploadSession(ctx, c)
+	if !ok {
+		return
+	}
+
+	received, err := h.receivedChunks(ctx, session)
+	if err != nil {
+		zap.L().Error("receivedChunks", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, uploadStatusResp{UploadID: session.ID, ChunkSize: session.ChunkSize, Chunks: session.Chunks, Received: received})
+}
+
+// uploadChunk stores a chunk sent as the raw request body, uploading a chunk again replaces it
+func (h *projectHandler) uploadChunk(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	svc, ok := fileService(c)
+	if !ok {
+		return
+	}
+	session, ok := h.getUploadSession(ctx, c)
+	if !ok {
+		return
+	}
+
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 || index >= session.Chunks {
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	length := session.chunkLength(index)
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, length+1))
+	if err != nil || int64(len(body)) != length {
+		zap.L().Error("chunk length mismatch", zap.Int("index", index), zap.Int64("expected", length), zap.Int("actual", len(body)), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	// 尽早拒绝不允许的文件类型
+	if index == 0 && !svc.Allowed(http.DetectContentType(body)) {
+		encoding.HandleError(c, errFileType)
+		return
+	}
+
+	storeCtx, storeCancel := context.WithTimeout(c, storeTimeout(length))
+	defer storeCancel()
+	if err = svc.Storage.Put(storeCtx, chunkStorageKey(session.ID, index), strings.NewReader(string(body)), length, "application/octet-stream"); err != nil {
+		zap.L().Error("storage.Put", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if err = h.cacheClient.Set(ctx, chunkCacheKey(session.ID, index), "1", uploadSessionExpiration); err != nil {
+		zap.L().Error("cacheClient.Set", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, "success")
+}
+
+// completeUpload joins the chunks into the file once all of them are received
+func (h *projectHandler) completeUpload(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	svc, ok := fileService(c)
+	if !ok {
+		return
+	}
+	session, ok := h.getUploadSession(ctx, c)
+	if !ok {
+		return
+	}
+
+	received, err := h.receivedChunks(ctx, session)
+	if err != nil {
+		zap.L().Error("receivedChunks", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if len(received) != session.Chunks {
+		encoding.HandleError(c, errUploadIncomplete)
+		return
+	}
+
+	// 上传期间项目可能已被转交或关闭
+	if _, ok = h.getUploadProject(ctx, c, session.ProjectID, session.PhaseID); !ok {
+		return
+	}
+
+	// 读取分块和写入文件都按文件大小计时
+	storeCtx, storeCancel := context.WithTimeout(c, storeTimeout(session.Size)*2)
+	defer storeCancel()
+	chunks := &chunkReader{ctx: storeCtx, storage: svc.Storage, session: session}
+	defer chunks.Close()
+
+	saved, ok := h.storeFile(storeCtx, c, svc, model.ProjectFile{
+		ProjectID:   session.ProjectID,
+		PhaseID:     session.PhaseID,
+		Name:        session.Name,
+		Size:        session.Size,
+		UploaderUID: session.UploaderUID,
+	}, chunks, session.SHA256)
+	if !ok {
+		return
+	}
+
+	keys := make([]string, 0, session.Chunks+1)
+	chunkKeys := make([]string, 0, session.Chunks)
+	keys = append(keys, uploadSessionKeyPrefix+session.ID)
+	for i := 0; i < session.Chunks; i++ {
+		keys = append(keys, chunkCacheKey(session.ID, i))
+		chunkKeys = append(chunkKeys, chunkStorageKey(session.ID, i))
+	}
+	if err = h.cacheClient.Del(storeCtx, keys...); err != nil {
+		zap.L().Error("cacheClient.Del", zap.Error(err))
+	}
+	if err = svc.Storage.Delete(storeCtx, chunkKeys...); err != nil {
+		zap.L().Error("storage.Delete", zap.Error(err))
+	}
+
+	encoding.HandleSuccess(c, toFileItem(*saved))
+}
+
+func (h *projectHandler) fileList(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := projectDetailReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, project, err := dao.GetProjectByID(ctx, h.db, req.ID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if ok, err := v1.InScope(ctx, h.db, project.CreatorUID, project.ProfessionHashID); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	files, err := dao.ListProjectFiles(ctx, h.db, project.ID)
+	if err != nil {
+		zap.L().Error("dao.ListProjectFiles", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]fileItem, 0, len(files))
+	for _, file := range files {
+		items = append(items, toFileItem(file))
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+// fileURL signs a download url, the url works without token until it expires
+func (h *projectHandler) fileURL(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	svc, ok := fileService(c)
+	if !ok {
+		return
+	}
+
+	req := fileURLReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, file, err := dao.GetProjectFileByID(ctx, h.db, req.FileID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectFileByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+	found, project, err := dao.GetProjectByID(ctx, h.db, file.ProjectID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+	if ok, err := v1.InScope(ctx, h.db, project.CreatorUID, project.ProfessionHashID); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	id := strconv.FormatInt(file.ID, 10)
+	expires, signature := svc.Signer.Sign(fileResourcePrefix+id, svc.URLExpiration)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", signature)
+
+	encoding.HandleSuccess(c, fileURLResp{
+		URL:       "/api/v1/project/files/" + id + "/download?" + query.Encode(),
+		ExpiresAt: expires,
+	})
+}
+
+// downloadFile streams the file of a signed url
+func (h *projectHandler) downloadFile(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	svc, ok := fileService(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if !svc.Signer.Verify(fileResourcePrefix+id, expires, c.Query("signature")) {
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	fileID, _ := strconv.ParseInt(id, 10, 64)
+	found, file, err := dao.GetProjectFileByID(ctx, h.db, fileID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectFileByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+
+	r, err := svc.Storage.Get(c, file.StorageKey)
+	if err != nil {
+		zap.L().Error("storage.Get", zap.String("key", file.StorageKey), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+	defer r.Close()
+
+	c.DataFromReader(http.StatusOK, file.Size, file.ContentType, r, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(file.Name)),
+		"ETag":                `"` + file.SHA256 + `"`,
+		"Cache-Control":       "private, max-age=0",
+	})
+}
+
+func toFileItem(file model.ProjectFile) fileItem {
+	return fileItem{
+		ID:          file.ID,
+		PhaseID:     file.PhaseID,
+		Name:        file.Name,
+		Version:     file.Version,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+		SHA256:      file.SHA256,
+		UploaderUID: file.UploaderUID,
+		CreatedAt:   file.CreatedAt,
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// chunkReader reads the chunks of an upload one after another, opening each only when needed
+type chunkReader struct {
+	ctx     context.Context
+	storage storage.Interface
+	session *uploadSession
+
+	index   int
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.index >= r.session.Chunks {
+				return 0, io.EOF
+			}
+			rc, err := r.storage.Get(r.ctx, chunkStorageKey(r.session.ID, r.index))
+			if err != nil {
+				return 0, err
+			}
+			r.current = rc
+			r.index++
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			_ = r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package project
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"v1/pkg/model"
+	"v1/pkg/rbac"
+	"v1/pkg/storage"
+)
+
+func withStorage(t *testing.T) storage.Interface {
+	t.Helper()
+	local, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	old := storage.Default()
+	storage.SetDefault(&storage.Service{
+		Storage:       local,
+		Signer:        storage.NewSigner([]byte("0123456789abcdef")),
+		MaxSize:       1 << 10,
+		ChunkSize:     8,
+		AllowedTypes:  []string{"text/plain"},
+		URLExpiration: time.Minute,
+	})
+	t.Cleanup(func() { storage.SetDefault(old) })
+	return local
+}
+
+// startUpload creates a resumable upload of the content with the checksum to the project as the teacher
+func startUpload(t *testing.T, h *projectHandler, project model.Project, size int, checksum string) uploadStatusResp {
+	t.Helper()
+	var resp uploadStatusResp
+	decode(t, post(teacher, rbac.PermissionProjectUpload, h.createUpload, createUploadReq{
+		ProjectID: project.ID, Name: "report.txt", Size: int64(size), SHA256: checksum,
+	}), &resp)
+	return resp
+}
+
+func putChunk(h *projectHandler, user model.User, uploadID string, index int, body string) *httptest.ResponseRecorder {
+	return serve(user, rbac.PermissionProjectUpload, h.uploadChunk, http.MethodPut, "/uploads/:id/chunks/:index",
+		"/uploads/"+uploadID+"/chunks/"+strconv.Itoa(index), strings.NewReader(body))
+}
+
+func uploadStatusOf(t *testing.T, h *projectHandler, uploadID string) uploadStatusResp {
+	t.Helper()
+	var resp uploadStatusResp
+	decode(t, serve(teacher, rbac.PermissionProjectUpload, h.uploadStatus, http.MethodGet, "/uploads/:id", "/uploads/"+uploadID, nil), &resp)
+	return resp
+}
+
+func completeUploadOf(h *projectHandler, uploadID string) *httptest.ResponseRecorder {
+	return serve(teacher, rbac.PermissionProjectUpload, h.completeUpload, http.MethodPost, "/uploads/:id/complete",
+		"/uploads/"+uploadID+"/complete", nil)
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestResumableUpload(t *testing.T) {
+	ctx := context.Background()
+	local := withStorage(t)
+	h := newTestHandler(t)
+	project := createProject(t, h, model.ProjectStatusProceed)
+
+	// 20 字节分成 8、8、4 三片
+	content := "0123456789abcdefghij"
+	chunks := []string{content[:8], content[8:16], content[16:]}
+	upload := startUpload(t, h, project, len(content), sha256Hex(content))
+	if upload.Chunks != 3 || upload.ChunkSize != 8 || len(upload.Received) != 0 {
+		t.Fatalf("upload %+v, want 3 chunks of 8 bytes", upload)
+	}
+
+	// 分片可以乱序上传
+	for _, i := range []int{2, 0} {
+		if w := putChunk(h, teacher, upload.UploadID, i, chunks[i]); w.Code != http.StatusOK {
+			t.Fatalf("chunk %d: %d %s", i, w.Code, w.Body.String())
+		}
+	}
+	if got := uploadStatusOf(t, h, upload.UploadID).Received; !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Fatalf("received %v, want [0 2]", got)
+	}
+	if w := completeUploadOf(h, upload.UploadID); w.Code != http.StatusBadRequest {
+		t.Fatalf("complete with a missing chunk: %d %s, want 400", w.Code, w.Body.String())
+	}
+
+	// 长度不对和越界的分片被拒绝，不算收到
+	for _, c := range []struct {
+		name  string
+		index int
+		body  string
+	}{
+		{name: "short", index: 1, body: chunks[1][:7]},
+		{name: "long", index: 1, body: chunks[1] + "x"},
+		{name: "short last", index: 2, body: chunks[2][:3]},
+		{name: "negative index", index: -1, body: chunks[1]},
+		{name: "index out of range", index: 3, body: chunks[1]},
+	} {
+		if w := putChunk(h, teacher, upload.UploadID, c.index, c.body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s chunk: %d %s, want 400", c.name, w.Code, w.Body.String())
+		}
+	}
+	if got := uploadStatusOf(t, h, upload.UploadID).Received; !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Fatalf("received %v after the rejected chunks, want [0 2]", got)
+	}
+
+	// 别人看不到这次上传
+	if w := putChunk(h, student, upload.UploadID, 1, chunks[1]); w.Code != http.StatusNotFound {
+		t.Fatalf("chunk of another user: %d %s, want 404", w.Code, w.Body.String())
+	}
+
+	if w := putChunk(h, teacher, upload.UploadID, 1, chunks[1]); w.Code != http.StatusOK {
+		t.Fatalf("chunk 1: %d %s", w.Code, w.Body.String())
+	}
+	var file fileItem
+	decode(t, completeUploadOf(h, upload.UploadID), &file)
+	if file.Name != "report.txt" || file.Size != 20 || file.SHA256 != sha256Hex(content) || file.Version != 1 {
+		t.Fatalf("file %+v", file)
+	}
+
+	var stored model.ProjectFile
+	if err := h.db.First(&stored, file.ID).Error; err != nil {
+		t.Fatalf("load file: %v", err)
+	}
+	r, err := local.Get(ctx, stored.StorageKey)
+	if err != nil {
+		t.Fatalf("get %s: %v", stored.StorageKey, err)
+	}
+	b, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(b) != content {
+		t.Fatalf("stored %q, want %q", b, content)
+	}
+
+	// 合并后分片和会话被清理
+	for i := range chunks {
+		if _, err = local.Get(ctx, chunkStorageKey(upload.UploadID, i)); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("chunk %d after complete: %v, want ErrNotFound", i, err)
+		}
+	}
+	if w := completeUploadOf(h, upload.UploadID); w.Code != http.StatusNotFound {
+		t.Fatalf("complete again: %d %s, want 404", w.Code, w.Body.String())
+	}
+}
+
+func TestResumableUploadChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	local := withStorage(t)
+	h := newTestHandler(t)
+	project := createProject(t, h, model.ProjectStatusProceed)
+
+	content := "twelve bytes"
+	upload := startUpload(t, h, project, len(content), sha256Hex("another file"))
+	for i, chunk := range []string{content[:8], content[8:]} {
+		if w := putChunk(h, teacher, upload.UploadID, i, chunk); w.Code != http.StatusOK {
+			t.Fatalf("chunk %d: %d %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	if w := completeUploadOf(h, upload.UploadID); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "checksum") {
+		t.Fatalf("complete: %d %s, want the checksum error", w.Code, w.Body.String())
+	}
+	var n int64
+	if err := h.db.Model(new(model.ProjectFile)).Count(&n).Error; err != nil || n != 0 {
+		t.Fatalf("%d files, %v, want none recorded", n, err)
+	}
+	// 分片保留，客户端可以重传出错的分片
+	if _, err := local.Get(ctx, chunkStorageKey(upload.UploadID, 0)); err != nil {
+		t.Fatalf("chunk 0 after the failed complete: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package project
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -10,13 +11,15 @@ import (
 	v1 "v1/pkg/apis/v1"
 	"v1/pkg/apiserver/encoding"
 	"v1/pkg/apiserver/request"
+	"v1/pkg/client/cache"
 	"v1/pkg/dao"
 	"v1/pkg/model"
 	"v1/pkg/server/errutil"
 )
 
 type projectHandlerOption struct {
-	db *gorm.DB
+	db          *gorm.DB
+	cacheClient cache.Interface
 }
 
 type projectHandler struct {
@@ -41,16 +44,6 @@ func (h *projectHandler) createProject(c *gin.Context) {
 		return
 	}
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(ctx)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-	if Role == model.RoleTypeStudent {
-		zap.L().Error("the operator's authority is illegal")
-	}
-
 	// 验证老师合法（x专业的老师只能创建x专业的项目）--搁置
 
 	//
@@ -67,6 +60,7 @@ func (h *projectHandler) createProject(c *gin.Context) {
 		ProjectName:      req.ProjectName,
 		ProjectBasicInfo: projectBadicInfo,
 		Title:            req.Title,
+		Capacity:         req.Capacity,
 		ProfessionHashID: user.ProfessionHashID,
 		CreatorUID:       user.UID,
 		Creator:          user.Username,
@@ -84,18 +78,6 @@ func (h *projectHandler) deleteProject(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(ctx)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-	if Role != model.RoleTypeTeacher && Role != model.RoleTypeSuperAdmin && Role != model.RoleTypeCollegeAdmin {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-
 	req := deleteProjectReq{}
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
@@ -104,7 +86,7 @@ func (h *projectHandler) deleteProject(c *gin.Context) {
 		return
 	}
 
-	found, _, err := dao.GetProjectByID(ctx, h.db, req.ID)
+	found, project, err := dao.GetProjectByID(ctx, h.db, req.ID)
 	if err != nil {
 		zap.L().Error("the project not found", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrInternalServer)
@@ -116,6 +98,12 @@ func (h *projectHandler) deleteProject(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, h.db, project.CreatorUID, project.ProfessionHashID); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	// 软删除
 	err = dao.DeleteProjectByID(ctx, h.db, req.ID)
 	if err != nil {
@@ -239,7 +227,7 @@ func (h *projectHandler) getProjects(c *gin.Context) {
 	case model.RoleTypeCollegeAdmin:
 		db = db.Where("profession_hash_id = ?", user.ProfessionHashID).Where("status = ?", model.ProjectStatusAudit)
 	case model.RoleTypeStudent:
-		db = db.Where("participator_id = ?", user.UID)
+		db = db.Where("id IN (?)", dao.MemberProjectIDs(h.db, user.UID))
 	}
 
 	if request.GetRoleTypeFromCtx(ctx) != model.RoleTypeSuperAdmin {
@@ -302,24 +290,45 @@ func (h *projectHandler) projectDetail(c *gin.Context) {
 		return
 	}
 
-	_, user, err := dao.GetUserByUID(ctx, h.db, project.ParticipatorID)
-	if err != nil {
-		zap.L().Error("dao.GetUserByUID", zap.Error(err))
-		encoding.HandleError(c, errutil.ErrIllegalParameter)
+	if ok, err := h.canView(ctx, project); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
 		return
 	}
 
-	found, class, err := dao.GetClassByHashID(ctx, h.db, user.ClassHashID)
+	members, err := dao.ListProjectMembers(ctx, h.db, project.ID)
 	if err != nil {
-		zap.L().Error("dao.GetClassByHashID", zap.Error(err))
-		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		zap.L().Error("dao.ListProjectMembers", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
 
+	// 组长的班级
+	class := model.Class{}
+	if project.ParticipatorID != "" {
+		_, user, err := dao.GetUserByUID(ctx, h.db, project.ParticipatorID)
+		if err != nil {
+			zap.L().Error("dao.GetUserByUID", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+
+		found, participatorClass, err := dao.GetClassByHashID(ctx, h.db, user.ClassHashID)
+		if err != nil {
+			zap.L().Error("dao.GetClassByHashID", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		if found {
+			class = participatorClass
+		}
+	}
+
 	result := projectDetailResp{
 		ID:               project.ID,
 		ProjectName:      project.ProjectName,
 		ProjectBasicInfo: project.ProjectBasicInfo,
+		ProjectFileID:    project.ProjectFileID,
 		Title:            project.Title,
 		Status:           project.Status,
 		ProfessionHashID: project.ProfessionHashID,
@@ -331,6 +340,8 @@ func (h *projectHandler) projectDetail(c *gin.Context) {
 		CollegeName:           profession.CollegeName,
 		ParticipatorClassName: class.ClassName,
 		ParticipatorClassID:   class.ClassID,
+		Capacity:              project.Capacity,
+		Members:               toMemberItems(members),
 	}
 
 	encoding.HandleSuccess(c, result)
@@ -348,11 +359,6 @@ func (h *projectHandler) chooseProject(c *gin.Context) {
 		return
 	}
 
-	if request.GetRoleTypeFromCtx(ctx) != model.RoleTypeStudent && request.GetRoleTypeFromCtx(ctx) != model.RoleTypeSuperAdmin {
-		zap.L().Error("not student")
-		encoding.HandleError(c, errutil.ErrIllegalOperation)
-	}
-
 	found, project, err := dao.GetProjectByID(ctx, h.db, req.ProjectID)
 	if err != nil || !found {
 		zap.L().Error("dao.GetProjectByID", zap.Error(err))
@@ -360,12 +366,18 @@ func (h *projectHandler) chooseProject(c *gin.Context) {
 		return
 	}
 
-	// == 5 表示未被选择
-	if project.Status != 5 {
+	// 审核通过且未被选择
+	if project.Status != model.ProjectStatusPASS {
 		zap.L().Error("project status is not : PASS")
 		encoding.HandleError(c, errutil.ErrIllegalParameter)
 		return
 	}
+	// 选题轮次进行中只能填报志愿
+	if inProgress, err := dao.SelectionRoundInProgress(ctx, h.db, project.ProfessionHashID); err != nil || inProgress {
+		zap.L().Error("selection round in progress", zap.String("profession_hash_id", project.ProfessionHashID), zap.Error(err))
+		encoding.HandleError(c, errRoundInProgress)
+		return
+	}
 	// 已经被选择
 	if project.Participator != "" {
 		zap.L().Error("this project is choose by other")
@@ -373,12 +385,28 @@ func (h *projectHandler) chooseProject(c *gin.Context) {
 		return
 	}
 
-	_, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
 
-	err = dao.UpdateProjectParticipator(ctx, h.db, project.ID, *user)
+	// 只有一个学生能选中：版本号和参与者都未变时才写入
+	err = dao.ClaimProject(ctx, h.db, project, *user)
+	if errors.Is(err, dao.ErrProjectStatusChanged) {
+		zap.L().Error("this project is choose by other", zap.Int64("project_id", project.ID))
+		encoding.HandleError(c, errProjectClaimed)
+		return
+	}
+	if errors.Is(err, dao.ErrStudentHasProject) {
+		zap.L().Error("the student already has an active project", zap.String("uid", user.UID))
+		encoding.HandleError(c, errStudentHasProject)
+		return
+	}
 	if err != nil {
-		zap.L().Error("dao.UpdateProjectParticipator", zap.Error(err))
-		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		zap.L().Error("dao.ClaimProject", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
 
@@ -396,12 +424,6 @@ func (h *projectHandler) auditProject(c *gin.Context) {
 		return
 	}
 
-	if request.GetRoleTypeFromCtx(ctx) != model.RoleTypeCollegeAdmin && request.GetRoleTypeFromCtx(ctx) != model.RoleTypeSuperAdmin {
-		zap.L().Error("not college admin")
-		encoding.HandleError(c, errutil.ErrIllegalOperation)
-		return
-	}
-
 	found, project, err := dao.GetProjectByID(ctx, h.db, req.ProjectID)
 	if err != nil || !found {
 		zap.L().Error("dao.GetProjectByID", zap.Error(err))
@@ -409,18 +431,21 @@ func (h *projectHandler) auditProject(c *gin.Context) {
 		return
 	}
 
-	if project.Status != model.ProjectStatusAudit {
-		zap.L().Error("the project status is not auditing")
-		encoding.HandleError(c, errutil.ErrIllegalParameter)
+	// 学院管理员只能审核本学院的项目
+	if ok, err := v1.InScope(ctx, h.db, "", project.ProfessionHashID); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
 		return
 	}
 
 	_, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
-
-	err = h.db.WithContext(ctx).Model(&model.Project{}).Where("id = ?", req.ProjectID).Updates(map[string]interface{}{"audit_uid": user.UID, "auditor": user.Username, "status": 5}).Error
 	if err != nil {
-		zap.L().Error("change project status failed", zap.Error(err))
-		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	if !h.transit(ctx, c, project, model.ProjectStatusPASS, "", map[string]interface{}{"audit_uid": user.UID, "auditor": user.Username}) {
 		return
 	}
 	encoding.HandleSuccess(c, "success")
@@ -437,23 +462,32 @@ func (h *projectHandler) changeStatus(c *gin.Context) {
 		return
 	}
 
-	_, project, err := dao.GetProjectByID(ctx, h.db, req.ProjectID)
-	if err != nil {
+	found, project, err := dao.GetProjectByID(ctx, h.db, req.ProjectID)
+	if err != nil || !found {
 		zap.L().Error("dao.GetProjectByID", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrIllegalParameter)
 		return
 	}
 
-	if request.GetRoleTypeFromCtx(ctx) == model.RoleTypeStudent {
-		zap.L().Error("illegal parameter, user is student")
-		encoding.HandleError(c, errutil.ErrIllegalParameter)
+	if ok, err := v1.InScope(ctx, h.db, project.CreatorUID, project.ProfessionHashID); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
 		return
 	}
 
-	err = dao.UpdateProjectStatus(ctx, h.db, project.ID, req.Status)
-	if err != nil {
-		zap.L().Error("dao.UpdateProjectStatus", zap.Error(err))
-		encoding.HandleError(c, errutil.ErrIllegalParameter)
+	// 审核通过时记录审核人
+	var updates map[string]interface{}
+	if project.Status == model.ProjectStatusAudit {
+		_, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+		if err != nil {
+			zap.L().Error("dao.GetUserByUID", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		updates = map[string]interface{}{"audit_uid": user.UID, "auditor": user.Username}
+	}
+
+	if !h.transit(ctx, c, project, req.Status, req.Reason, updates) {
 		return
 	}
 	encoding.HandleSuccess(c, "success")
@@ -0,0 +1,121 @@
+package project
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"v1/pkg/apiserver/middleware"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/client/cache"
+	"v1/pkg/model"
+	"v1/pkg/rbac"
+	"v1/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// users of the test database: professions p-cs and p-se of the college c-sci, p-art of c-art
+var (
+	superAdmin   = model.User{UID: "u-admin", Username: "admin", Role: model.RoleTypeSuperAdmin, ProfessionHashID: "p-art"}
+	collegeAdmin = model.User{UID: "u-cadmin", Username: "cadmin", Role: model.RoleTypeCollegeAdmin, ProfessionHashID: "p-se"}
+	artAdmin     = model.User{UID: "u-aadmin", Username: "aadmin", Role: model.RoleTypeCollegeAdmin, ProfessionHashID: "p-art"}
+	teacher      = model.User{UID: "u-teacher", Username: "teacher", Role: model.RoleTypeTeacher, ProfessionHashID: "p-cs"}
+	otherTeacher = model.User{UID: "u-teacher2", Username: "teacher2", Role: model.RoleTypeTeacher, ProfessionHashID: "p-cs"}
+	student      = model.User{UID: "u-student", Username: "student", Role: model.RoleTypeStudent, ProfessionHashID: "p-cs"}
+	otherStudent = model.User{UID: "u-student2", Username: "student2", Role: model.RoleTypeStudent, ProfessionHashID: "p-cs"}
+	thirdStudent = model.User{UID: "u-student3", Username: "student3", Role: model.RoleTypeStudent, ProfessionHashID: "p-cs"}
+)
+
+// newTestHandler returns a handler on an in-memory database holding the users, the professions and the project tables
+func newTestHandler(t *testing.T) *projectHandler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	models := []any{new(model.User), new(model.Profession), new(model.Project), new(model.ProjectMember), new(model.ProjectInvitation),
+		new(model.ProjectStatusHistory), new(model.ProjectSelectLog), new(model.ProjectFile), new(model.PhaseTemplate),
+		new(model.ProjectPhase), new(model.ChatRoom), new(model.ChatRoomMember)}
+	for _, m := range models {
+		// sqlite 的索引名全局唯一，多张表同名的 idx_created_at 会冲突，表已建好即可
+		if err = db.AutoMigrate(m); err != nil && !(strings.Contains(err.Error(), "already exists") && db.Migrator().HasTable(m)) {
+			t.Fatalf("AutoMigrate %T: %v", m, err)
+		}
+	}
+
+	rows := []any{
+		&model.Profession{HashID: "p-cs", CollegeHashID: "c-sci", CollegeName: "science", ProfessionName: "cs"},
+		&model.Profession{HashID: "p-se", CollegeHashID: "c-sci", CollegeName: "science", ProfessionName: "se"},
+		&model.Profession{HashID: "p-art", CollegeHashID: "c-art", CollegeName: "art", ProfessionName: "art"},
+	}
+	for _, u := range []model.User{superAdmin, collegeAdmin, artAdmin, teacher, otherTeacher, student, otherStudent, thirdStudent} {
+		u := u
+		u.Status = model.UserStatusNormal
+		rows = append(rows, &u)
+	}
+	for _, row := range rows {
+		if err = db.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+
+	return newProjectHandler(projectHandlerOption{db: db, cacheClient: cache.NewSimpleCache()})
+}
+
+// createProject creates a project of the teacher in p-cs with the status
+func createProject(t *testing.T, h *projectHandler, status model.ProjectStatus) model.Project {
+	t.Helper()
+	project := model.Project{ProjectName: "p", Status: status, ProfessionHashID: "p-cs", Capacity: 2,
+		Creator: teacher.Username, CreatorUID: teacher.UID}
+	if err := h.db.Create(&project).Error; err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	return project
+}
+
+// serve runs the request through RequirePermission and the handler as the user.
+// route is the pattern holding the path parameters of target, e.g. /uploads/:id and /uploads/1
+func serve(user model.User, permission rbac.Permission, handler gin.HandlerFunc, method, route, target string, body io.Reader) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.ContextWithFallback = true
+	payload := &token.Payload{ID: user.ID, UID: user.UID, Username: user.Username, Role: user.Role}
+	router.Handle(method, route, func(c *gin.Context) {
+		c.Request = c.Request.WithContext(request.WithTokenPayloadToCtx(c.Request.Context(), payload))
+	}, middleware.RequirePermission(permission), handler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, target, body))
+	return w
+}
+
+// post sends the json body to the handler as the user
+func post(user model.User, permission rbac.Permission, handler gin.HandlerFunc, body any) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	return serve(user, permission, handler, http.MethodPost, "/", "/", bytes.NewReader(b))
+}
+
+// decode unmarshals the data of a successful response into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("response %d %s", w.Code, w.Body.String())
+	}
+	resp := struct {
+		Data any `json:"data"`
+	}{Data: v}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal %s: %v", w.Body.String(), err)
+	}
+}
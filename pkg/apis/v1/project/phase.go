@@ -0,0 +1,326 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"time"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/server/errutil"
+)
+
+func (h *projectHandler) createPhaseTemplate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := createPhaseTemplateReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || len(req.Deliverables) == 0 {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	// 默认为自己所在专业定义阶段
+	if req.ProfessionHashID == "" {
+		req.ProfessionHashID = user.ProfessionHashID
+	}
+	if ok, err := v1.InScope(ctx, h.db, "", req.ProfessionHashID); !ok {
+		zap.L().Error("profession out of permission scope", zap.String("profession_hash_id", req.ProfessionHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	deliverables, _ := json.Marshal(req.Deliverables)
+	template, err := dao.InsertPhaseTemplate(ctx, h.db, model.PhaseTemplate{
+		ProfessionHashID: req.ProfessionHashID,
+		Name:             req.Name,
+		Sequence:         req.Sequence,
+		Deadline:         req.Deadline,
+		Deliverables:     deliverables,
+		CreatorUID:       user.UID,
+	})
+	if err != nil {
+		zap.L().Error("dao.InsertPhaseTemplate", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, template.ID)
+}
+
+func (h *projectHandler) phaseTemplateList(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := phaseTemplateListReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if req.ProfessionHashID == "" {
+		found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+		if err != nil || !found {
+			zap.L().Error("dao.GetUserByUID", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		req.ProfessionHashID = user.ProfessionHashID
+	} else if ok, err := v1.InScope(ctx, h.db, "", req.ProfessionHashID); !ok {
+		zap.L().Error("profession out of permission scope", zap.String("profession_hash_id", req.ProfessionHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	templates, err := dao.ListPhaseTemplates(ctx, h.db, req.ProfessionHashID)
+	if err != nil {
+		zap.L().Error("dao.ListPhaseTemplates", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]phaseTemplateItem, 0, len(templates))
+	for _, template := range templates {
+		items = append(items, phaseTemplateItem{
+			ID:               template.ID,
+			ProfessionHashID: template.ProfessionHashID,
+			Name:             template.Name,
+			Sequence:         template.Sequence,
+			Deadline:         template.Deadline,
+			Deliverables:     template.Deliverables,
+		})
+	}
+
+	encoding.HandleSuccess(c, items)
+}
+
+func (h *projectHandler) deletePhaseTemplate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := deletePhaseTemplateReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, template, err := dao.GetPhaseTemplateByID(ctx, h.db, req.ID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetPhaseTemplateByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+
+	if ok, err := v1.InScope(ctx, h.db, template.CreatorUID, template.ProfessionHashID); !ok {
+		zap.L().Error("phase template out of permission scope", zap.Int64("template_id", template.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	if err = dao.DeletePhaseTemplate(ctx, h.db, template.ID); err != nil {
+		zap.L().Error("dao.DeletePhaseTemplate", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, "success")
+}
+
+func (h *projectHandler) phaseList(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := projectDetailReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, project, err := dao.GetProjectByID(ctx, h.db, req.ID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if ok, err := v1.InScope(ctx, h.db, project.CreatorUID, project.ProfessionHashID); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	phases, err := dao.ListProjectPhases(ctx, h.db, project.ID)
+	if err != nil {
+		zap.L().Error("dao.ListProjectPhases", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]phaseItem, 0, len(phases))
+	for _, phase := range phases {
+		items = append(items, phaseItem{
+			ID:            phase.ID,
+			Name:          phase.Name,
+			Sequence:      phase.Sequence,
+			Deadline:      phase.Deadline,
+			Deliverables:  phase.Deliverables,
+			Status:        phase.Status,
+			Submission:    phase.Submission,
+			SubmittedAt:   phase.SubmittedAt,
+			ReviewComment: phase.ReviewComment,
+			ReviewedAt:    phase.ReviewedAt,
+		})
+	}
+
+	encoding.HandleSuccess(c, items)
+}
+
+// submitPhase 选题的学生按顺序提交各阶段的材料，前一阶段通过后才能提交下一阶段
+func (h *projectHandler) submitPhase(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := submitPhaseReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	phase, project, ok := h.getPhaseProject(ctx, c, req.PhaseID)
+	if !ok {
+		return
+	}
+
+	if member, err := h.isMember(ctx, project.ID); !member {
+		zap.L().Error("only the team can submit the phase", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+	if project.Status != model.ProjectStatusProceed {
+		zap.L().Error("project status is not : PROCEED", zap.Int64("project_id", project.ID))
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+	if phase.Deadline > 0 && time.Now().UnixMilli() > phase.Deadline {
+		zap.L().Error("the phase deadline has passed", zap.Int64("phase_id", phase.ID))
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	// 前面的阶段必须已经通过
+	phases, err := dao.ListProjectPhases(ctx, h.db, project.ID)
+	if err != nil {
+		zap.L().Error("dao.ListProjectPhases", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	for _, p := range phases {
+		if p.ID == phase.ID {
+			break
+		}
+		if p.Status != model.PhaseStatusApproved {
+			zap.L().Error("the previous phase is not approved", zap.Int64("phase_id", p.ID))
+			encoding.HandleError(c, errutil.ErrIllegalOperation)
+			return
+		}
+	}
+
+	// 必须提交所有要求的材料
+	var deliverables []string
+	_ = json.Unmarshal(phase.Deliverables, &deliverables)
+	for _, name := range deliverables {
+		if req.Deliverables[name] == "" {
+			zap.L().Error("deliverable missing", zap.String("deliverable", name))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+	}
+
+	submission, _ := json.Marshal(req.Deliverables)
+	ok, err = dao.SubmitProjectPhase(ctx, h.db, phase.ID, request.GetUserUIDFromCtx(ctx), submission)
+	if err != nil {
+		zap.L().Error("dao.SubmitProjectPhase", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !ok {
+		zap.L().Error("the phase is not waiting for submission", zap.Int64("phase_id", phase.ID))
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	encoding.HandleSuccess(c, "success")
+}
+
+// reviewPhase 项目的创建老师审核学生提交的阶段材料
+func (h *projectHandler) reviewPhase(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := reviewPhaseReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	phase, project, ok := h.getPhaseProject(ctx, c, req.PhaseID)
+	if !ok {
+		return
+	}
+
+	uid := request.GetUserUIDFromCtx(ctx)
+	if project.CreatorUID != uid {
+		zap.L().Error("only the project owner can review the phase", zap.Int64("project_id", project.ID))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	ok, err := dao.ReviewProjectPhase(ctx, h.db, phase.ID, uid, req.Approved, req.Comment)
+	if err != nil {
+		zap.L().Error("dao.ReviewProjectPhase", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if !ok {
+		zap.L().Error("the phase is not waiting for review", zap.Int64("phase_id", phase.ID))
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	encoding.HandleSuccess(c, "success")
+}
+
+func (h *projectHandler) getPhaseProject(ctx context.Context, c *gin.Context, phaseID int64) (model.ProjectPhase, model.Project, bool) {
+	found, phase, err := dao.GetProjectPhaseByID(ctx, h.db, phaseID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectPhaseByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return phase, model.Project{}, false
+	}
+
+	found, project, err := dao.GetProjectByID(ctx, h.db, phase.ProjectID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return phase, project, false
+	}
+
+	return phase, project, true
+}
@@ -0,0 +1,177 @@
+package project
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/rbac"
+
+	"gorm.io/datatypes"
+)
+
+// createPhaseTemplates defines opening and closing for p-cs, and one phase for p-art
+func createPhaseTemplates(t *testing.T, h *projectHandler) {
+	t.Helper()
+	templates := []model.PhaseTemplate{
+		{ProfessionHashID: "p-cs", Name: "closing", Sequence: 2, Deliverables: datatypes.JSON(`["thesis"]`), CreatorUID: teacher.UID},
+		{ProfessionHashID: "p-cs", Name: "opening", Sequence: 1, Deliverables: datatypes.JSON(`["proposal","plan"]`), CreatorUID: teacher.UID},
+		{ProfessionHashID: "p-art", Name: "sketch", Sequence: 1, Deliverables: datatypes.JSON(`["sketch"]`), CreatorUID: "u-art"},
+	}
+	if err := h.db.Create(&templates).Error; err != nil {
+		t.Fatalf("create templates: %v", err)
+	}
+}
+
+func TestPhaseTemplateListScope(t *testing.T) {
+	h := newTestHandler(t)
+	createPhaseTemplates(t, h)
+
+	cases := []struct {
+		name       string
+		user       model.User
+		profession string
+		code       int
+		templates  int
+	}{
+		{name: "own profession", user: teacher, code: http.StatusOK, templates: 2},
+		{name: "own profession given", user: student, profession: "p-cs", code: http.StatusOK, templates: 2},
+		{name: "same college", user: collegeAdmin, profession: "p-cs", code: http.StatusOK, templates: 2},
+		{name: "other college", user: teacher, profession: "p-art", code: http.StatusForbidden},
+		{name: "student of other college", user: student, profession: "p-art", code: http.StatusForbidden},
+		{name: "unknown profession", user: collegeAdmin, profession: "p-none", code: http.StatusForbidden},
+		{name: "super admin", user: superAdmin, profession: "p-cs", code: http.StatusOK, templates: 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := post(c.user, rbac.PermissionProjectList, h.phaseTemplateList, phaseTemplateListReq{ProfessionHashID: c.profession})
+			if w.Code != c.code {
+				t.Fatalf("response %d %s, want %d", w.Code, w.Body.String(), c.code)
+			}
+			if c.code != http.StatusOK {
+				return
+			}
+			var items []phaseTemplateItem
+			decode(t, w, &items)
+			if len(items) != c.templates {
+				t.Fatalf("%d templates, want %d", len(items), c.templates)
+			}
+		})
+	}
+}
+
+func TestPhaseWorkflow(t *testing.T) {
+	h := newTestHandler(t)
+	createPhaseTemplates(t, h)
+	project := createProject(t, h, model.ProjectStatusPASS)
+	if err := dao.ClaimProject(context.Background(), h.db, project, student); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+
+	var phases []phaseItem
+	decode(t, post(teacher, rbac.PermissionProjectDetail, h.phaseList, projectDetailReq{ID: project.ID}), &phases)
+	if len(phases) != 2 || phases[0].Name != "opening" || phases[1].Name != "closing" {
+		t.Fatalf("phases %+v, want opening and closing", phases)
+	}
+	opening, closing := phases[0].ID, phases[1].ID
+
+	submit := func(user model.User, phaseID int64, deliverables map[string]string) int {
+		t.Helper()
+		return post(user, rbac.PermissionProjectUpload, h.submitPhase, submitPhaseReq{PhaseID: phaseID, Deliverables: deliverables}).Code
+	}
+	review := func(user model.User, phaseID int64, approved bool) int {
+		t.Helper()
+		return post(user, rbac.PermissionProjectUpdate, h.reviewPhase, reviewPhaseReq{PhaseID: phaseID, Approved: approved, Comment: "comment"}).Code
+	}
+	finish := func() int {
+		t.Helper()
+		var current model.Project
+		if err := h.db.First(&current, project.ID).Error; err != nil {
+			t.Fatalf("load project: %v", err)
+		}
+		return transitAs(h, teacher, current, model.ProjectStatusFinish).Code
+	}
+	status := func(phaseID int64) model.PhaseStatus {
+		t.Helper()
+		var phase model.ProjectPhase
+		if err := h.db.First(&phase, phaseID).Error; err != nil {
+			t.Fatalf("load phase: %v", err)
+		}
+		return phase.Status
+	}
+	proposal := map[string]string{"proposal": "p.pdf", "plan": "plan.pdf"}
+
+	// 按顺序提交，材料要齐全，只有团队成员能提交
+	for _, c := range []struct {
+		name       string
+		code, want int
+	}{
+		{name: "closing before opening", code: submit(student, closing, map[string]string{"thesis": "t.pdf"}), want: http.StatusBadRequest},
+		{name: "missing deliverable", code: submit(student, opening, map[string]string{"proposal": "p.pdf"}), want: http.StatusBadRequest},
+		{name: "not in the team", code: submit(otherStudent, opening, proposal), want: http.StatusForbidden},
+		{name: "review before submission", code: review(teacher, opening, true), want: http.StatusBadRequest},
+		{name: "finish before the phases", code: finish(), want: http.StatusBadRequest},
+	} {
+		if c.code != c.want {
+			t.Fatalf("%s: %d, want %d", c.name, c.code, c.want)
+		}
+	}
+	if status(opening) != model.PhaseStatusPending || status(closing) != model.PhaseStatusPending {
+		t.Fatal("refused submissions changed the phases")
+	}
+
+	if code := submit(student, opening, proposal); code != http.StatusOK {
+		t.Fatalf("submit opening: %d", code)
+	}
+	if code := submit(student, opening, proposal); code != http.StatusBadRequest {
+		t.Fatalf("submit opening again while waiting for review: %d, want 400", code)
+	}
+
+	// 只有出题老师审核，退回后重新提交
+	if code := review(otherTeacher, opening, true); code != http.StatusForbidden {
+		t.Fatalf("review by another teacher: %d, want 403", code)
+	}
+	if code := review(teacher, opening, false); code != http.StatusOK || status(opening) != model.PhaseStatusRejected {
+		t.Fatalf("reject opening: %d, status %d", code, status(opening))
+	}
+	if code := submit(student, closing, map[string]string{"thesis": "t.pdf"}); code != http.StatusBadRequest {
+		t.Fatalf("submit closing after the opening was rejected: %d, want 400", code)
+	}
+	if code := submit(student, opening, proposal); code != http.StatusOK {
+		t.Fatalf("submit opening again: %d", code)
+	}
+	if code := review(teacher, opening, true); code != http.StatusOK || status(opening) != model.PhaseStatusApproved {
+		t.Fatalf("approve opening: %d, status %d", code, status(opening))
+	}
+	if code := review(teacher, opening, false); code != http.StatusBadRequest {
+		t.Fatalf("review the approved phase: %d, want 400", code)
+	}
+	if code := finish(); code != http.StatusBadRequest {
+		t.Fatalf("finish with the closing pending: %d, want 400", code)
+	}
+
+	// 截止后不能提交
+	if err := h.db.Model(&model.ProjectPhase{}).Where("id = ?", closing).Update("deadline", 1).Error; err != nil {
+		t.Fatalf("set deadline: %v", err)
+	}
+	if code := submit(student, closing, map[string]string{"thesis": "t.pdf"}); code != http.StatusBadRequest {
+		t.Fatalf("submit after the deadline: %d, want 400", code)
+	}
+	if err := h.db.Model(&model.ProjectPhase{}).Where("id = ?", closing).Update("deadline", 0).Error; err != nil {
+		t.Fatalf("clear deadline: %v", err)
+	}
+
+	if code := submit(student, closing, map[string]string{"thesis": "t.pdf"}); code != http.StatusOK {
+		t.Fatalf("submit closing: %d", code)
+	}
+	if code := finish(); code != http.StatusBadRequest {
+		t.Fatalf("finish with the closing waiting for review: %d, want 400", code)
+	}
+	if code := review(teacher, closing, true); code != http.StatusOK {
+		t.Fatalf("approve closing: %d", code)
+	}
+	if code := finish(); code != http.StatusOK {
+		t.Fatalf("finish with all phases approved: %d", code)
+	}
+}
@@ -5,28 +5,69 @@ import (
 	"gorm.io/gorm"
 	"v1/pkg/apiserver/middleware"
 	"v1/pkg/client/cache"
+	"v1/pkg/ratelimit"
+	"v1/pkg/rbac"
 	"v1/pkg/token"
 )
 
 func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, cacheClient cache.Interface, db *gorm.DB) {
 	projectG := group.Group("/project")
 	handler := newProjectHandler(projectHandlerOption{
-		db: db,
+		db:          db,
+		cacheClient: cacheClient,
 	})
 
+	// 签名的下载地址不需要token
+	projectG.GET("/files/:id/download", handler.downloadFile)
+
 	projectG.Use(middleware.CheckToken(tokenManager, cacheClient))
+	limiter := ratelimit.Default()
+	listLimit := middleware.RateLimit(limiter, ratelimit.PolicyList)
+
+	projectG.POST("", middleware.RequirePermission(rbac.PermissionProjectCreate), handler.createProject)             // done
+	projectG.DELETE("", middleware.RequirePermission(rbac.PermissionProjectDelete), handler.deleteProject)           // done
+	projectG.POST("/list", middleware.RequirePermission(rbac.PermissionProjectList), listLimit, handler.projectList) // done
+
+	projectG.POST("/user/list", middleware.RequirePermission(rbac.PermissionProjectList), listLimit, handler.getProjects) // 用户相关列表(我的)
+	projectG.POST("/detail", middleware.RequirePermission(rbac.PermissionProjectDetail), handler.projectDetail)           // 详情 done
+	projectG.POST("/changeStatus", middleware.RequirePermission(rbac.PermissionProjectUpdate), handler.changeStatus)      // 更改状态 done
+	projectG.POST("/statusHistory", middleware.RequirePermission(rbac.PermissionProjectDetail), handler.statusHistory)    // 状态变更记录
+
+	projectG.POST("/choose", middleware.RequirePermission(rbac.PermissionProjectChoose),
+		middleware.RateLimit(limiter, ratelimit.PolicyProjectChoose), handler.chooseProject) // 学生选择 done
+	projectG.GET("/audit", middleware.RequirePermission(rbac.PermissionProjectAudit), handler.auditProject) // 审核 废弃
+
+	// 选题轮次
+	projectG.POST("/rounds", middleware.RequirePermission(rbac.PermissionSelectionRound), handler.createSelectionRound)
+	projectG.POST("/rounds/list", middleware.RequirePermission(rbac.PermissionProjectList), listLimit, handler.selectionRoundList)
+	projectG.POST("/rounds/match", middleware.RequirePermission(rbac.PermissionSelectionRound), handler.matchSelectionRound)    // 提前截止并匹配
+	projectG.POST("/rounds/preferences", middleware.RequirePermission(rbac.PermissionProjectChoose), handler.submitPreferences) // 学生填报志愿
+	projectG.POST("/rounds/myApplications", middleware.RequirePermission(rbac.PermissionProjectChoose), handler.myApplications)
+	projectG.POST("/rounds/applicants", middleware.RequirePermission(rbac.PermissionProjectUpdate), handler.projectApplicants)
+	projectG.POST("/rounds/rankApplicants", middleware.RequirePermission(rbac.PermissionProjectUpdate), handler.rankApplicants) // 老师给申请者排名
 
-	projectG.POST("", handler.createProject)    // done
-	projectG.DELETE("", handler.deleteProject)  // done
-	projectG.POST("/list", handler.projectList) // done
+	// 项目团队
+	projectG.POST("/team/members", middleware.RequirePermission(rbac.PermissionProjectDetail), handler.teamMembers)
+	projectG.POST("/team/invite", middleware.RequirePermission(rbac.PermissionProjectChoose), handler.inviteMember)       // 组长邀请组员
+	projectG.POST("/team/invitations", middleware.RequirePermission(rbac.PermissionProjectChoose), handler.myInvitations) // 我收到的邀请
+	projectG.POST("/team/respond", middleware.RequirePermission(rbac.PermissionProjectChoose), handler.respondInvitation) // 接受或拒绝邀请
 
-	projectG.POST("/user/list", handler.getProjects)     // 用户相关列表(我的)
-	projectG.POST("/detail", handler.projectDetail)      // 详情 done
-	projectG.POST("/changeStatus", handler.changeStatus) // 更改状态 done
+	// 项目文件
+	projectG.POST("/upload/file", middleware.RequirePermission(rbac.PermissionProjectUpload), handler.uploadFile)                     // 提交文件
+	projectG.POST("/files/uploads", middleware.RequirePermission(rbac.PermissionProjectUpload), handler.createUpload)                 // 断点续传：创建
+	projectG.GET("/files/uploads/:id", middleware.RequirePermission(rbac.PermissionProjectUpload), handler.uploadStatus)              // 断点续传：已收到的分片
+	projectG.PUT("/files/uploads/:id/chunks/:index", middleware.RequirePermission(rbac.PermissionProjectUpload), handler.uploadChunk) // 断点续传：上传分片
+	projectG.POST("/files/uploads/:id/complete", middleware.RequirePermission(rbac.PermissionProjectUpload), handler.completeUpload)  // 断点续传：合并
+	projectG.POST("/files/list", middleware.RequirePermission(rbac.PermissionProjectDetail), handler.fileList)
+	projectG.POST("/files/url", middleware.RequirePermission(rbac.PermissionProjectDetail), handler.fileURL) // 获取带签名的下载地址
 
-	projectG.POST("/choose", handler.chooseProject) // 学生选择 done
-	projectG.GET("/audit", handler.auditProject)    // 审核 废弃
-	projectG.POST("/upload/file")                   // 提交文件
+	// 项目阶段
+	projectG.POST("/phaseTemplates", middleware.RequirePermission(rbac.PermissionPhaseTemplate), handler.createPhaseTemplate)
+	projectG.DELETE("/phaseTemplates", middleware.RequirePermission(rbac.PermissionPhaseTemplate), handler.deletePhaseTemplate)
+	projectG.POST("/phaseTemplates/list", middleware.RequirePermission(rbac.PermissionProjectList), listLimit, handler.phaseTemplateList)
+	projectG.POST("/phases", middleware.RequirePermission(rbac.PermissionProjectDetail), handler.phaseList)         // 项目的各阶段
+	projectG.POST("/phase/submit", middleware.RequirePermission(rbac.PermissionProjectUpload), handler.submitPhase) // 学生提交阶段材料
+	projectG.POST("/phase/review", middleware.RequirePermission(rbac.PermissionProjectUpdate), handler.reviewPhase) // 老师审核阶段材料
 
 	// projectG.GET("/")
 }
@@ -0,0 +1,368 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/server/errutil"
+)
+
+var (
+	errRoundClosed        = errutil.NewError(http.StatusConflict, "selection round closed")
+	errRoundInProgress    = errutil.NewError(http.StatusConflict, "selection round in progress")
+	errTooManyPreferences = errutil.NewError(http.StatusBadRequest, "too many preferences")
+	errProjectClaimed     = errutil.NewError(http.StatusConflict, "project taken by another student")
+	errStudentHasProject  = errutil.NewError(http.StatusConflict, "student already has an active project")
+)
+
+func (h *projectHandler) createSelectionRound(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := createSelectionRoundReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || req.MaxPreferences <= 0 || req.EndAt <= req.StartAt {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	if req.ProfessionHashID == "" {
+		req.ProfessionHashID = user.ProfessionHashID
+	}
+	if ok, err := v1.InScope(ctx, h.db, "", req.ProfessionHashID); !ok {
+		zap.L().Error("profession out of permission scope", zap.String("profession_hash_id", req.ProfessionHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	round, err := dao.InsertSelectionRound(ctx, h.db, model.SelectionRound{
+		Name:             req.Name,
+		ProfessionHashID: req.ProfessionHashID,
+		MaxPreferences:   req.MaxPreferences,
+		StartAt:          req.StartAt,
+		EndAt:            req.EndAt,
+		CreatorUID:       user.UID,
+	})
+	if err != nil {
+		zap.L().Error("dao.InsertSelectionRound", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, round.ID)
+}
+
+func (h *projectHandler) selectionRoundList(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := selectionRoundListReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if req.ProfessionHashID == "" {
+		found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+		if err != nil || !found {
+			zap.L().Error("dao.GetUserByUID", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return
+		}
+		req.ProfessionHashID = user.ProfessionHashID
+	}
+	if ok, err := v1.InScope(ctx, h.db, "", req.ProfessionHashID); !ok {
+		zap.L().Error("profession out of permission scope", zap.String("profession_hash_id", req.ProfessionHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	rounds, err := dao.ListSelectionRounds(ctx, h.db, req.ProfessionHashID)
+	if err != nil {
+		zap.L().Error("dao.ListSelectionRounds", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]selectionRoundItem, 0, len(rounds))
+	for _, round := range rounds {
+		items = append(items, selectionRoundItem{
+			ID:               round.ID,
+			Name:             round.Name,
+			ProfessionHashID: round.ProfessionHashID,
+			MaxPreferences:   round.MaxPreferences,
+			StartAt:          round.StartAt,
+			EndAt:            round.EndAt,
+			Status:           round.Status,
+			MatchedAt:        round.MatchedAt,
+		})
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+// getOpenRound returns the round if it is accepting preferences and rankings now
+func (h *projectHandler) getOpenRound(ctx context.Context, c *gin.Context, roundID int64) (model.SelectionRound, bool) {
+	found, round, err := dao.GetSelectionRoundByID(ctx, h.db, roundID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetSelectionRoundByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return round, false
+	}
+
+	now := time.Now().UnixMilli()
+	if round.Status != model.SelectionRoundOpen || now < round.StartAt || now >= round.EndAt {
+		zap.L().Error("selection round is not open", zap.Int64("round_id", round.ID))
+		encoding.HandleError(c, errRoundClosed)
+		return round, false
+	}
+	return round, true
+}
+
+// submitPreferences 学生填报志愿，重新填报会覆盖之前的志愿
+func (h *projectHandler) submitPreferences(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := submitPreferencesReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	round, ok := h.getOpenRound(ctx, c, req.RoundID)
+	if !ok {
+		return
+	}
+	if len(req.ProjectIDs) > round.MaxPreferences {
+		encoding.HandleError(c, errTooManyPreferences)
+		return
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if user.ProfessionHashID != round.ProfessionHashID {
+		zap.L().Error("the round is not of the student's profession", zap.Int64("round_id", round.ID))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	projects := make([]model.Project, 0, len(req.ProjectIDs))
+	seen := make(map[int64]bool, len(req.ProjectIDs))
+	for _, id := range req.ProjectIDs {
+		if seen[id] {
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		seen[id] = true
+
+		found, project, err := dao.GetProjectByID(ctx, h.db, id)
+		if err != nil || !found {
+			zap.L().Error("dao.GetProjectByID", zap.Int64("project_id", id), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		if project.ProfessionHashID != round.ProfessionHashID || project.Status != model.ProjectStatusPASS || project.ParticipatorID != "" {
+			zap.L().Error("the project can't be chosen in the round", zap.Int64("project_id", id))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		projects = append(projects, project)
+	}
+
+	err = dao.SubmitPreferences(ctx, h.db, round.ID, *user, projects)
+	if errors.Is(err, dao.ErrSelectionRoundClosed) {
+		encoding.HandleError(c, errRoundClosed)
+		return
+	}
+	if err != nil {
+		zap.L().Error("dao.SubmitPreferences", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, "success")
+}
+
+// myApplications 学生在轮次中的志愿及录取结果
+func (h *projectHandler) myApplications(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := roundReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	logs, err := dao.ListUserApplications(ctx, h.db, req.RoundID, request.GetUserUIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("dao.ListUserApplications", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, toApplicationItems(logs))
+}
+
+// getOwnProject returns the project if the current user created it
+func (h *projectHandler) getOwnProject(ctx context.Context, c *gin.Context, projectID int64) (model.Project, bool) {
+	found, project, err := dao.GetProjectByID(ctx, h.db, projectID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return project, false
+	}
+	if project.CreatorUID != request.GetUserUIDFromCtx(ctx) {
+		zap.L().Error("only the project owner can see and rank the applicants", zap.Int64("project_id", project.ID))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return project, false
+	}
+	return project, true
+}
+
+// projectApplicants 老师查看项目在轮次中的申请者，已排名的在前
+func (h *projectHandler) projectApplicants(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := projectApplicantsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	project, ok := h.getOwnProject(ctx, c, req.ProjectID)
+	if !ok {
+		return
+	}
+
+	logs, err := dao.ListProjectApplications(ctx, h.db, req.RoundID, project.ID)
+	if err != nil {
+		zap.L().Error("dao.ListProjectApplications", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, toApplicationItems(logs))
+}
+
+// rankApplicants 老师给申请者排名，未列出的申请者排在已排名者之后
+func (h *projectHandler) rankApplicants(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := rankApplicantsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if _, ok := h.getOpenRound(ctx, c, req.RoundID); !ok {
+		return
+	}
+	project, ok := h.getOwnProject(ctx, c, req.ProjectID)
+	if !ok {
+		return
+	}
+
+	err := dao.RankApplicants(ctx, h.db, req.RoundID, project.ID, req.ApplicantUIDs)
+	if errors.Is(err, dao.ErrSelectionRoundClosed) {
+		encoding.HandleError(c, errRoundClosed)
+		return
+	}
+	if err != nil {
+		zap.L().Error("dao.RankApplicants", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, "success")
+}
+
+// matchSelectionRound closes the round before its deadline and assigns the projects,
+// rounds past the deadline are matched by the cron job
+func (h *projectHandler) matchSelectionRound(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := roundReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, round, err := dao.GetSelectionRoundByID(ctx, h.db, req.RoundID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetSelectionRoundByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return
+	}
+	if ok, err := v1.InScope(ctx, h.db, "", round.ProfessionHashID); !ok {
+		zap.L().Error("profession out of permission scope", zap.String("profession_hash_id", round.ProfessionHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	matched, err := dao.MatchSelectionRound(ctx, h.db, round.ID, *user)
+	if errors.Is(err, dao.ErrSelectionRoundClosed) {
+		encoding.HandleError(c, errRoundClosed)
+		return
+	}
+	if err != nil {
+		zap.L().Error("dao.MatchSelectionRound", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, matched)
+}
+
+func toApplicationItems(logs []model.ProjectSelectLog) []applicationItem {
+	items := make([]applicationItem, 0, len(logs))
+	for _, log := range logs {
+		items = append(items, applicationItem{
+			ID:           log.ID,
+			ProjectID:    log.ProjectID,
+			ProjectName:  log.ProjectName,
+			Applicant:    log.Applicant,
+			ApplicantUID: log.ApplicantUID,
+			Rank:         log.Rank,
+			TeacherRank:  log.TeacherRank,
+			Status:       log.Status,
+			CreatedAt:    log.CreatedAt,
+		})
+	}
+	return items
+}
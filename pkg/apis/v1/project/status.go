@@ -0,0 +1,115 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/server/errutil"
+)
+
+// transit moves the project to the status if model.ProjectTransitions allows the current user to, and records the history.
+// It writes the error response and returns false otherwise
+func (h *projectHandler) transit(ctx context.Context, c *gin.Context, project model.Project, to model.ProjectStatus,
+	reason string, updates map[string]interface{}) bool {
+	found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return false
+	}
+
+	if !project.Status.CanTransit(to, user.Role, project.CreatorUID == user.UID) {
+		zap.L().Error("illegal project status transition", zap.Int64("project_id", project.ID),
+			zap.Int64("from", int64(project.Status)), zap.Int64("to", int64(to)), zap.String("role", string(user.Role)))
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return false
+	}
+
+	// 所有阶段审核通过后才能完成
+	if to == model.ProjectStatusFinish {
+		approved, err := dao.ProjectPhasesApproved(ctx, h.db, project.ID)
+		if err != nil {
+			zap.L().Error("dao.ProjectPhasesApproved", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrInternalServer)
+			return false
+		}
+		if !approved {
+			zap.L().Error("project phases are not all approved", zap.Int64("project_id", project.ID))
+			encoding.HandleError(c, errutil.ErrIllegalOperation)
+			return false
+		}
+	}
+
+	err = dao.TransitProjectStatus(ctx, h.db, project, model.ProjectStatusHistory{
+		FromStatus: project.Status,
+		ToStatus:   to,
+		ActorUID:   user.UID,
+		Actor:      user.Username,
+		ActorRole:  user.Role,
+		Reason:     reason,
+	}, updates)
+	if errors.Is(err, dao.ErrProjectStatusChanged) {
+		zap.L().Error("project status changed concurrently", zap.Int64("project_id", project.ID))
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return false
+	}
+	if err != nil {
+		zap.L().Error("dao.TransitProjectStatus", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return false
+	}
+
+	return true
+}
+
+func (h *projectHandler) statusHistory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := projectDetailReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, project, err := dao.GetProjectByID(ctx, h.db, req.ID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	if ok, err := v1.InScope(ctx, h.db, project.CreatorUID, project.ProfessionHashID); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	history, err := dao.ListProjectStatusHistory(ctx, h.db, project.ID)
+	if err != nil {
+		zap.L().Error("dao.ListProjectStatusHistory", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]statusHistoryItem, 0, len(history))
+	for _, item := range history {
+		items = append(items, statusHistoryItem{
+			FromStatus: item.FromStatus,
+			ToStatus:   item.ToStatus,
+			Actor:      item.Actor,
+			ActorRole:  item.ActorRole,
+			Reason:     item.Reason,
+			CreatedAt:  item.CreatedAt,
+		})
+	}
+
+	encoding.HandleSuccess(c, items)
+}
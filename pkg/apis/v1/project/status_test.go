@@ -0,0 +1,198 @@
+package project
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/model"
+	"v1/pkg/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	allStatuses = []model.ProjectStatus{model.ProjectStatusAudit, model.ProjectStatusPASS, model.ProjectStatusProceed,
+		model.ProjectStatusFinish, model.ProjectStatusClose}
+	allRoles = []model.RoleType{model.RoleTypeSuperAdmin, model.RoleTypeCollegeAdmin, model.RoleTypeTeacher,
+		model.RoleTypeStudent, model.RoleTypeNormal, model.RoleTypeFirm}
+)
+
+func TestCanTransit(t *testing.T) {
+	type transition struct {
+		from, to model.ProjectStatus
+		role     model.RoleType
+	}
+	const (
+		anyone = "anyone"
+		owner  = "owner"
+	)
+	// 允许的转换，其余全部禁止
+	allowed := map[transition]string{
+		{model.ProjectStatusAudit, model.ProjectStatusPASS, model.RoleTypeSuperAdmin}:      anyone,
+		{model.ProjectStatusAudit, model.ProjectStatusPASS, model.RoleTypeCollegeAdmin}:    anyone,
+		{model.ProjectStatusAudit, model.ProjectStatusClose, model.RoleTypeSuperAdmin}:     anyone,
+		{model.ProjectStatusAudit, model.ProjectStatusClose, model.RoleTypeCollegeAdmin}:   anyone,
+		{model.ProjectStatusAudit, model.ProjectStatusClose, model.RoleTypeTeacher}:        owner,
+		{model.ProjectStatusPASS, model.ProjectStatusProceed, model.RoleTypeStudent}:       anyone,
+		{model.ProjectStatusPASS, model.ProjectStatusClose, model.RoleTypeSuperAdmin}:      anyone,
+		{model.ProjectStatusPASS, model.ProjectStatusClose, model.RoleTypeCollegeAdmin}:    anyone,
+		{model.ProjectStatusPASS, model.ProjectStatusClose, model.RoleTypeTeacher}:         owner,
+		{model.ProjectStatusProceed, model.ProjectStatusFinish, model.RoleTypeTeacher}:     owner,
+		{model.ProjectStatusProceed, model.ProjectStatusClose, model.RoleTypeSuperAdmin}:   anyone,
+		{model.ProjectStatusProceed, model.ProjectStatusClose, model.RoleTypeCollegeAdmin}: anyone,
+		{model.ProjectStatusProceed, model.ProjectStatusClose, model.RoleTypeTeacher}:      owner,
+		{model.ProjectStatusClose, model.ProjectStatusAudit, model.RoleTypeTeacher}:        owner,
+	}
+
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			for _, role := range allRoles {
+				rule := allowed[transition{from, to, role}]
+				for _, isOwner := range []bool{false, true} {
+					want := rule == anyone || rule == owner && isOwner
+					if got := from.CanTransit(to, role, isOwner); got != want {
+						t.Errorf("%d -> %d by %s (owner %v) = %v, want %v", from, to, role, isOwner, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// transitAs runs transit of the project as the user
+func transitAs(h *projectHandler, user model.User, project model.Project, to model.ProjectStatus) *httptest.ResponseRecorder {
+	return serve(user, rbac.PermissionProjectDetail, func(c *gin.Context) {
+		if h.transit(c, c, project, to, "reason of "+user.UID, nil) {
+			encoding.HandleSuccess(c, "success")
+		}
+	}, http.MethodPost, "/", "/", nil)
+}
+
+func statusHistoryOf(t *testing.T, h *projectHandler, projectID int64) []model.ProjectStatusHistory {
+	t.Helper()
+	var history []model.ProjectStatusHistory
+	if err := h.db.Where("project_id = ?", projectID).Order("id").Find(&history).Error; err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	return history
+}
+
+func TestTransit(t *testing.T) {
+	cases := []struct {
+		user     model.User
+		from, to model.ProjectStatus
+		ok       bool
+	}{
+		{user: collegeAdmin, from: model.ProjectStatusAudit, to: model.ProjectStatusPASS, ok: true},
+		{user: superAdmin, from: model.ProjectStatusAudit, to: model.ProjectStatusPASS, ok: true},
+		{user: teacher, from: model.ProjectStatusAudit, to: model.ProjectStatusPASS},
+		{user: teacher, from: model.ProjectStatusAudit, to: model.ProjectStatusClose, ok: true},
+		{user: otherTeacher, from: model.ProjectStatusAudit, to: model.ProjectStatusClose},
+		{user: student, from: model.ProjectStatusAudit, to: model.ProjectStatusPASS},
+		{user: student, from: model.ProjectStatusPASS, to: model.ProjectStatusProceed, ok: true},
+		{user: teacher, from: model.ProjectStatusPASS, to: model.ProjectStatusProceed},
+		// 只有出题的老师能结题
+		{user: teacher, from: model.ProjectStatusProceed, to: model.ProjectStatusFinish, ok: true},
+		{user: otherTeacher, from: model.ProjectStatusProceed, to: model.ProjectStatusFinish},
+		{user: collegeAdmin, from: model.ProjectStatusProceed, to: model.ProjectStatusFinish},
+		{user: superAdmin, from: model.ProjectStatusProceed, to: model.ProjectStatusFinish},
+		{user: student, from: model.ProjectStatusProceed, to: model.ProjectStatusFinish},
+		{user: collegeAdmin, from: model.ProjectStatusProceed, to: model.ProjectStatusClose, ok: true},
+		{user: teacher, from: model.ProjectStatusFinish, to: model.ProjectStatusClose},
+		{user: superAdmin, from: model.ProjectStatusFinish, to: model.ProjectStatusProceed},
+		{user: teacher, from: model.ProjectStatusClose, to: model.ProjectStatusAudit, ok: true},
+		{user: collegeAdmin, from: model.ProjectStatusClose, to: model.ProjectStatusAudit},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s %d to %d", c.user.UID, c.from, c.to), func(t *testing.T) {
+			h := newTestHandler(t)
+			project := createProject(t, h, c.from)
+
+			w := transitAs(h, c.user, project, c.to)
+			var got model.Project
+			if err := h.db.First(&got, project.ID).Error; err != nil {
+				t.Fatalf("load project: %v", err)
+			}
+			history := statusHistoryOf(t, h, project.ID)
+
+			if !c.ok {
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("response %d %s, want 400", w.Code, w.Body.String())
+				}
+				if got.Status != c.from || got.Version != project.Version || len(history) != 0 {
+					t.Fatalf("refused transition changed the project: status %d, version %d, %d history rows", got.Status, got.Version, len(history))
+				}
+				return
+			}
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("response %d %s, want 200", w.Code, w.Body.String())
+			}
+			if got.Status != c.to || got.Version != project.Version+1 {
+				t.Fatalf("project status %d, version %d, want %d, %d", got.Status, got.Version, c.to, project.Version+1)
+			}
+			if len(history) != 1 {
+				t.Fatalf("%d history rows, want 1", len(history))
+			}
+			row := history[0]
+			if row.FromStatus != c.from || row.ToStatus != c.to || row.ActorUID != c.user.UID || row.Actor != c.user.Username ||
+				row.ActorRole != c.user.Role || row.Reason != "reason of "+c.user.UID || row.CreatedAt == 0 {
+				t.Fatalf("history %+v", row)
+			}
+		})
+	}
+}
+
+func TestTransitStaleVersion(t *testing.T) {
+	h := newTestHandler(t)
+	stale := createProject(t, h, model.ProjectStatusProceed)
+
+	// 读取之后项目被修改过，状态没变但版本变了
+	if err := h.db.Model(&model.Project{}).Where("id = ?", stale.ID).Update("version", stale.Version+1).Error; err != nil {
+		t.Fatalf("bump version: %v", err)
+	}
+	if w := transitAs(h, teacher, stale, model.ProjectStatusClose); w.Code != http.StatusBadRequest {
+		t.Fatalf("transit of a stale project: %d %s, want 400", w.Code, w.Body.String())
+	}
+	if history := statusHistoryOf(t, h, stale.ID); len(history) != 0 {
+		t.Fatalf("%d history rows after the refused transition", len(history))
+	}
+
+	// 两人读到同一版本，只有先到的成功
+	current := stale
+	current.Version++
+	if w := transitAs(h, collegeAdmin, current, model.ProjectStatusClose); w.Code != http.StatusOK {
+		t.Fatalf("transit: %d %s", w.Code, w.Body.String())
+	}
+	if w := transitAs(h, teacher, current, model.ProjectStatusFinish); w.Code != http.StatusBadRequest {
+		t.Fatalf("transit of the same version again: %d %s, want 400", w.Code, w.Body.String())
+	}
+	history := statusHistoryOf(t, h, stale.ID)
+	if len(history) != 1 || history[0].ActorUID != collegeAdmin.UID || history[0].ToStatus != model.ProjectStatusClose {
+		t.Fatalf("history %+v, want only the close by the college admin", history)
+	}
+}
+
+func TestChangeStatusScope(t *testing.T) {
+	h := newTestHandler(t)
+	project := createProject(t, h, model.ProjectStatusAudit)
+	req := changeStatusReq{ProjectID: project.ID, Status: model.ProjectStatusPASS, Reason: "ok"}
+
+	// 其他学院的管理员不能审核
+	if w := post(artAdmin, rbac.PermissionProjectUpdate, h.changeStatus, req); w.Code != http.StatusForbidden {
+		t.Fatalf("change status out of scope: %d %s, want 403", w.Code, w.Body.String())
+	}
+	if w := post(collegeAdmin, rbac.PermissionProjectUpdate, h.changeStatus, req); w.Code != http.StatusOK {
+		t.Fatalf("change status: %d %s", w.Code, w.Body.String())
+	}
+
+	var got model.Project
+	if err := h.db.First(&got, project.ID).Error; err != nil {
+		t.Fatalf("load project: %v", err)
+	}
+	if got.Status != model.ProjectStatusPASS || got.AuditUID != collegeAdmin.UID || got.Auditor != collegeAdmin.Username {
+		t.Fatalf("project status %d audited by %q %q, want passed by the college admin", got.Status, got.AuditUID, got.Auditor)
+	}
+}
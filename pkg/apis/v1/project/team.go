@@ -0,0 +1,204 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	v1 "v1/pkg/apis/v1"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/server/errutil"
+)
+
+var (
+	errTeamFull          = errutil.NewError(http.StatusConflict, "project team is full")
+	errInvitationExists  = errutil.NewError(http.StatusConflict, "already a member or invited")
+	errInvitationHandled = errutil.NewError(http.StatusConflict, "invitation already handled")
+)
+
+// isMember reports whether the current user is in the team of the project
+func (h *projectHandler) isMember(ctx context.Context, projectID int64) (bool, error) {
+	found, _, err := dao.GetProjectMember(ctx, h.db, projectID, request.GetUserUIDFromCtx(ctx))
+	return found, err
+}
+
+// canView reports whether the current user can see the project: it is in the permission scope or the user is in the team
+func (h *projectHandler) canView(ctx context.Context, project model.Project) (bool, error) {
+	if ok, err := v1.InScope(ctx, h.db, project.CreatorUID, project.ProfessionHashID); ok || err != nil {
+		return ok, err
+	}
+	return h.isMember(ctx, project.ID)
+}
+
+func (h *projectHandler) teamMembers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := projectDetailReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, project, err := dao.GetProjectByID(ctx, h.db, req.ID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if ok, err := h.canView(ctx, project); !ok {
+		zap.L().Error("project out of permission scope", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	members, err := dao.ListProjectMembers(ctx, h.db, project.ID)
+	if err != nil {
+		zap.L().Error("dao.ListProjectMembers", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	encoding.HandleSuccess(c, toMemberItems(members))
+}
+
+// inviteMember 组长邀请同专业的同学加入团队
+func (h *projectHandler) inviteMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := inviteMemberReq{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.InviteeUID == "" {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, project, err := dao.GetProjectByID(ctx, h.db, req.ProjectID)
+	if err != nil || !found {
+		zap.L().Error("dao.GetProjectByID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if project.Status != model.ProjectStatusProceed {
+		zap.L().Error("project status is not : PROCEED", zap.Int64("project_id", project.ID))
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+		return
+	}
+
+	uid := request.GetUserUIDFromCtx(ctx)
+	found, member, err := dao.GetProjectMember(ctx, h.db, project.ID, uid)
+	if err != nil || !found || member.Role != model.MemberRoleLeader {
+		zap.L().Error("only the team leader can invite members", zap.Int64("project_id", project.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	found, inviter, err := dao.GetUserByUID(ctx, h.db, uid)
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	found, invitee, err := dao.GetUserByUID(ctx, h.db, req.InviteeUID)
+	if err != nil || !found || invitee.Role != model.RoleTypeStudent || invitee.ProfessionHashID != project.ProfessionHashID {
+		zap.L().Error("the invitee is not a student of the profession", zap.String("invitee_uid", req.InviteeUID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	invitation, err := dao.InviteMember(ctx, h.db, project, *inviter, *invitee)
+	switch {
+	case errors.Is(err, dao.ErrTeamFull):
+		encoding.HandleError(c, errTeamFull)
+	case errors.Is(err, dao.ErrInvitationExists):
+		encoding.HandleError(c, errInvitationExists)
+	case err != nil:
+		zap.L().Error("dao.InviteMember", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+	default:
+		encoding.HandleSuccess(c, invitation.ID)
+	}
+}
+
+// myInvitations 当前用户待回复的邀请
+func (h *projectHandler) myInvitations(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	invitations, err := dao.ListUserInvitations(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil {
+		zap.L().Error("dao.ListUserInvitations", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	items := make([]invitationItem, 0, len(invitations))
+	for _, invitation := range invitations {
+		items = append(items, invitationItem{
+			ID:          invitation.ID,
+			ProjectID:   invitation.ProjectID,
+			ProjectName: invitation.ProjectName,
+			Inviter:     invitation.Inviter,
+			InviterUID:  invitation.InviterUID,
+			Status:      invitation.Status,
+			CreatedAt:   invitation.CreatedAt,
+		})
+	}
+	encoding.HandleSuccess(c, items)
+}
+
+// respondInvitation 接受或拒绝邀请
+func (h *projectHandler) respondInvitation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := respondInvitationReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByUID", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	err = dao.RespondInvitation(ctx, h.db, req.InvitationID, *user, req.Accept)
+	switch {
+	case errors.Is(err, dao.ErrInvitationHandled):
+		encoding.HandleError(c, errInvitationHandled)
+	case errors.Is(err, dao.ErrTeamFull):
+		encoding.HandleError(c, errTeamFull)
+	case errors.Is(err, dao.ErrStudentHasProject):
+		encoding.HandleError(c, errStudentHasProject)
+	case errors.Is(err, dao.ErrProjectStatusChanged):
+		encoding.HandleError(c, errutil.ErrIllegalOperation)
+	case err != nil:
+		zap.L().Error("dao.RespondInvitation", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+	default:
+		encoding.HandleSuccess(c, "success")
+	}
+}
+
+func toMemberItems(members []model.ProjectMember) []memberItem {
+	items := make([]memberItem, 0, len(members))
+	for _, member := range members {
+		items = append(items, memberItem{
+			UID:      member.UserUID,
+			Username: member.Username,
+			Role:     member.Role,
+			JoinedAt: member.JoinedAt,
+		})
+	}
+	return items
+}
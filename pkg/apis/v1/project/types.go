@@ -11,6 +11,7 @@ type (
 		model.ProjectBasicInfo
 		Title            string `json:"title"`
 		professionHashID string `json:"profession_hash_id"`
+		Capacity         int    `json:"capacity"` // 选题轮次中最多录取的学生数，默认 1
 	}
 
 	deleteProjectReq struct {
@@ -48,18 +49,20 @@ type (
 		ID               int64               `json:"id"`
 		ProjectName      string              `json:"projectName"`
 		ProjectBasicInfo datatypes.JSON      `json:"projectBasicInfo"`
-		ProjectFile      []byte              `json:"projectFile"`
+		ProjectFileID    int64               `json:"projectFileID"` // 最近上传的文件
 		Title            string              `json:"title"`
 		Status           model.ProjectStatus `json:"status"`
 		ProfessionHashID string              `json:"professionHashID"`
 		ProfessionName   string              `json:"professionName"`
 		CollegeName      string              `json:"collegeName"`
 
-		Creator               string `json:"creator"`
-		Auditor               string `json:"auditor"`
-		Participator          string `json:"participator"`
-		ParticipatorClassName string `json:"participatorClassName"`
-		ParticipatorClassID   int    `json:"participatorClassID"`
+		Creator               string       `json:"creator"`
+		Auditor               string       `json:"auditor"`
+		Participator          string       `json:"participator"` // 组长
+		ParticipatorClassName string       `json:"participatorClassName"`
+		ParticipatorClassID   int          `json:"participatorClassID"`
+		Capacity              int          `json:"capacity"` // 团队人数上限
+		Members               []memberItem `json:"members"`
 
 		Flag           bool   `json:"flag""` // 是否上链; false:没有;true:上链
 		ContractHashID string `json:"contract_hash_id"`
@@ -77,5 +80,182 @@ type (
 	changeStatusReq struct {
 		Status    model.ProjectStatus `json:"status"`
 		ProjectID int64               `json:"project_id"`
+		Reason    string              `json:"reason"` // 状态变更原因，如审核不通过的理由
+	}
+
+	statusHistoryItem struct {
+		FromStatus model.ProjectStatus `json:"from_status"`
+		ToStatus   model.ProjectStatus `json:"to_status"`
+		Actor      string              `json:"actor"`
+		ActorRole  model.RoleType      `json:"actor_role"`
+		Reason     string              `json:"reason"`
+		CreatedAt  int64               `json:"created_at"`
+	}
+
+	createPhaseTemplateReq struct {
+		ProfessionHashID string   `json:"profession_hash_id"` // 为空时使用自己所在专业
+		Name             string   `json:"name"`               // 开题、中期、结题
+		Sequence         int      `json:"sequence"`
+		Deadline         int64    `json:"deadline"`     // unix milli, 0 表示不限
+		Deliverables     []string `json:"deliverables"` // 需要提交的材料
+	}
+
+	phaseTemplateListReq struct {
+		ProfessionHashID string `json:"profession_hash_id"`
+	}
+
+	phaseTemplateItem struct {
+		ID               int64          `json:"id"`
+		ProfessionHashID string         `json:"profession_hash_id"`
+		Name             string         `json:"name"`
+		Sequence         int            `json:"sequence"`
+		Deadline         int64          `json:"deadline"`
+		Deliverables     datatypes.JSON `json:"deliverables"`
+	}
+
+	deletePhaseTemplateReq struct {
+		ID int64 `json:"id"`
+	}
+
+	phaseItem struct {
+		ID            int64             `json:"id"`
+		Name          string            `json:"name"`
+		Sequence      int               `json:"sequence"`
+		Deadline      int64             `json:"deadline"`
+		Deliverables  datatypes.JSON    `json:"deliverables"`
+		Status        model.PhaseStatus `json:"status"`
+		Submission    datatypes.JSON    `json:"submission"`
+		SubmittedAt   int64             `json:"submitted_at"`
+		ReviewComment string            `json:"review_comment"`
+		ReviewedAt    int64             `json:"reviewed_at"`
+	}
+
+	submitPhaseReq struct {
+		PhaseID      int64             `json:"phase_id"`
+		Deliverables map[string]string `json:"deliverables"` // 材料名称 -> 内容或文件地址
+	}
+
+	reviewPhaseReq struct {
+		PhaseID  int64  `json:"phase_id"`
+		Approved bool   `json:"approved"`
+		Comment  string `json:"comment"`
+	}
+
+	createUploadReq struct {
+		ProjectID int64  `json:"project_id"`
+		PhaseID   int64  `json:"phase_id"`
+		Name      string `json:"name"`
+		Size      int64  `json:"size"`
+		SHA256    string `json:"sha256"` // 整个文件的 sha256，合并分片后校验
+	}
+
+	uploadStatusResp struct {
+		UploadID  string `json:"upload_id"`
+		ChunkSize int64  `json:"chunk_size"`
+		Chunks    int    `json:"chunks"`
+		Received  []int  `json:"received"` // 已收到的分片序号
+	}
+
+	fileItem struct {
+		ID          int64  `json:"id"`
+		PhaseID     int64  `json:"phase_id"`
+		Name        string `json:"name"`
+		Version     int    `json:"version"`
+		Size        int64  `json:"size"`
+		ContentType string `json:"content_type"`
+		SHA256      string `json:"sha256"`
+		UploaderUID string `json:"uploader_uid"`
+		CreatedAt   int64  `json:"created_at"`
+	}
+
+	fileURLReq struct {
+		FileID int64 `json:"file_id"`
+	}
+
+	fileURLResp struct {
+		URL       string `json:"url"`
+		ExpiresAt int64  `json:"expires_at"` // unix seconds
+	}
+
+	createSelectionRoundReq struct {
+		Name             string `json:"name"`
+		ProfessionHashID string `json:"profession_hash_id"` // 为空时为自己所在专业
+		MaxPreferences   int    `json:"max_preferences"`
+		StartAt          int64  `json:"start_at"` // unix milli
+		EndAt            int64  `json:"end_at"`
+	}
+
+	selectionRoundListReq struct {
+		ProfessionHashID string `json:"profession_hash_id"`
+	}
+
+	selectionRoundItem struct {
+		ID               int64                      `json:"id"`
+		Name             string                     `json:"name"`
+		ProfessionHashID string                     `json:"profession_hash_id"`
+		MaxPreferences   int                        `json:"max_preferences"`
+		StartAt          int64                      `json:"start_at"`
+		EndAt            int64                      `json:"end_at"`
+		Status           model.SelectionRoundStatus `json:"status"`
+		MatchedAt        int64                      `json:"matched_at"`
+	}
+
+	roundReq struct {
+		RoundID int64 `json:"round_id"`
+	}
+
+	submitPreferencesReq struct {
+		RoundID    int64   `json:"round_id"`
+		ProjectIDs []int64 `json:"project_ids"` // 按志愿顺序
+	}
+
+	projectApplicantsReq struct {
+		RoundID   int64 `json:"round_id"`
+		ProjectID int64 `json:"project_id"`
+	}
+
+	rankApplicantsReq struct {
+		RoundID       int64    `json:"round_id"`
+		ProjectID     int64    `json:"project_id"`
+		ApplicantUIDs []string `json:"applicant_uids"` // 从最优到最差
+	}
+
+	applicationItem struct {
+		ID           int64                   `json:"id"`
+		ProjectID    int64                   `json:"project_id"`
+		ProjectName  string                  `json:"project_name"`
+		Applicant    string                  `json:"applicant"`
+		ApplicantUID string                  `json:"applicant_uid"`
+		Rank         int                     `json:"rank"`
+		TeacherRank  int                     `json:"teacher_rank"`
+		Status       model.ApplicationStatus `json:"status"`
+		CreatedAt    int64                   `json:"created_at"`
+	}
+
+	memberItem struct {
+		UID      string           `json:"uid"`
+		Username string           `json:"username"`
+		Role     model.MemberRole `json:"role"`
+		JoinedAt int64            `json:"joined_at"`
+	}
+
+	inviteMemberReq struct {
+		ProjectID  int64  `json:"project_id"`
+		InviteeUID string `json:"invitee_uid"`
+	}
+
+	invitationItem struct {
+		ID          int64                  `json:"id"`
+		ProjectID   int64                  `json:"project_id"`
+		ProjectName string                 `json:"project_name"`
+		Inviter     string                 `json:"inviter"`
+		InviterUID  string                 `json:"inviter_uid"`
+		Status      model.InvitationStatus `json:"status"`
+		CreatedAt   int64                  `json:"created_at"`
+	}
+
+	respondInvitationReq struct {
+		InvitationID int64 `json:"invitation_id"`
+		Accept       bool  `json:"accept"`
 	}
 )
@@ -87,7 +87,8 @@ func (h *resumeHandler) projectTreeList(c *gin.Context) {
 		return
 	}
 	projectList := make([]model.Project, 0)
-	db := h.db.WithContext(ctx).Model(&model.Project{}).Where("participator_id = ?", user.UID)
+	// 学生所在团队的项目
+	db := h.db.WithContext(ctx).Model(&model.Project{}).Where("id IN (?)", dao.MemberProjectIDs(h.db, user.UID))
 	err = db.Find(&projectList).Error
 	if err != nil {
 		zap.L().Error("get project failed", zap.Error(err))
@@ -241,6 +242,12 @@ func (h *resumeHandler) resumeDetail(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, h.db, resume.UserUid, ""); !ok {
+		zap.L().Error("resume out of permission scope", zap.Int64("id", resume.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	data := resumeDetailResp{
 		ID:              resume.ID,
 		UserUid:         resume.UserUid,
@@ -5,6 +5,8 @@ import (
 	"gorm.io/gorm"
 	"v1/pkg/apiserver/middleware"
 	"v1/pkg/client/cache"
+	"v1/pkg/ratelimit"
+	"v1/pkg/rbac"
 	"v1/pkg/token"
 )
 
@@ -15,11 +17,12 @@ func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, cacheCli
 	})
 
 	resumeG.Use(middleware.CheckToken(tokenManager, cacheClient))
+	listLimit := middleware.RateLimit(ratelimit.Default(), ratelimit.PolicyList)
 
-	resumeG.POST("", handler.createResume)                 // done
-	resumeG.POST("/project/tree", handler.projectTreeList) // done
-	resumeG.DELETE("", handler.deleteResume)               // done
-	resumeG.POST("/list", handler.resumeList)              // done
-	resumeG.POST("/:id/detail", handler.resumeDetail)      // 详情
+	resumeG.POST("", middleware.RequirePermission(rbac.PermissionResumeCreate), handler.createResume)                 // done
+	resumeG.POST("/project/tree", middleware.RequirePermission(rbac.PermissionResumeCreate), handler.projectTreeList) // done
+	resumeG.DELETE("", middleware.RequirePermission(rbac.PermissionResumeDelete), handler.deleteResume)               // done
+	resumeG.POST("/list", middleware.RequirePermission(rbac.PermissionResumeList), listLimit, handler.resumeList)     // done
+	resumeG.POST("/:id/detail", middleware.RequirePermission(rbac.PermissionResumeDetail), handler.resumeDetail)      // 详情
 
 }
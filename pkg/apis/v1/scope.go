@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/dao"
+	"v1/pkg/rbac"
+)
+
+// InScope reports whether a resource owned by ownerUID in the profession professionHashID
+// is covered by the permission scope granted to the current user
+func InScope(ctx context.Context, db *gorm.DB, ownerUID, professionHashID string) (bool, error) {
+	scope := request.PermissionScopeFromCtx(ctx)
+	if scope == rbac.ScopeAll {
+		return true, nil
+	}
+
+	uid := request.GetUserUIDFromCtx(ctx)
+	if ownerUID != "" && ownerUID == uid {
+		return true, nil
+	}
+
+	if scope != rbac.ScopeCollege {
+		return false, nil
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, db, uid)
+	if err != nil || !found {
+		return false, err
+	}
+
+	return dao.SameCollege(ctx, db, user.ProfessionHashID, professionHashID)
+}
+
+// InCollegeScope reports whether the college is covered by the permission scope granted to the current user
+func InCollegeScope(ctx context.Context, db *gorm.DB, collegeHashID string) (bool, error) {
+	scope := request.PermissionScopeFromCtx(ctx)
+	if scope == rbac.ScopeAll {
+		return true, nil
+	}
+	if scope != rbac.ScopeCollege {
+		return false, nil
+	}
+
+	found, user, err := dao.GetUserByUID(ctx, db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		return false, err
+	}
+
+	found, profession, err := dao.GetProfessionByHashID(ctx, db, user.ProfessionHashID)
+	if err != nil || !found {
+		return false, nil
+	}
+
+	return profession.CollegeHashID == collegeHashID, nil
+}
@@ -7,18 +7,24 @@ import (
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"strconv"
-	"time"
 	v1 "v1/pkg/apis/v1"
 	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/imsystem"
 	"v1/pkg/apiserver/request"
 	"v1/pkg/dao"
+	"v1/pkg/lockout"
 	"v1/pkg/model"
+	"v1/pkg/password"
+	"v1/pkg/rbac"
 	"v1/pkg/server/errutil"
+	"v1/pkg/token"
 	"v1/pkg/utils"
 )
 
 type systemHandlerOption struct {
-	db *gorm.DB
+	db             *gorm.DB
+	loginGuard     lockout.Guard
+	refreshManager token.RefreshManager
 }
 
 type systemHandler struct {
@@ -36,17 +42,6 @@ func (h *systemHandler) deleteUser(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(c)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-	if Role == model.RoleTypeStudent || Role == model.RoleTypeNormal {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrPermissionDenied)
-	}
-
 	req := deleteUserReq{}
 	err := c.ShouldBindQuery(&req)
 	if err != nil {
@@ -68,12 +63,27 @@ func (h *systemHandler) deleteUser(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, h.db, user.UID, user.ProfessionHashID); !ok {
+		zap.L().Error("user out of permission scope", zap.Int64("user_id", user.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	// 删除用户
 	if err = dao.DeleteUserByID(ctx, h.db, req.Id); err != nil {
 		zap.L().Error("delete user failed", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrDeleteUser)
 		return
 	}
+	if err = dao.SyncClassRooms(ctx, h.db, user.ClassHashID); err != nil {
+		zap.L().Error("dao.SyncClassRooms", zap.Error(err))
+	}
+
+	// 立即注销该用户的所有会话
+	if err = h.refreshManager.RevokeAll(ctx, user.UID); err != nil {
+		zap.L().Error("refreshManager.RevokeAll", zap.Error(err))
+	}
+	imsystem.DisconnectSession(user.UID, "")
 
 	// 删除其他相关数据
 	// 简历的数据库信息
@@ -97,6 +107,12 @@ func (h *systemHandler) deleteUser(c *gin.Context) {
 		encoding.HandleError(c, errutil.ErrDeleteUser)
 		return
 	}
+	// 统一身份认证的绑定关系
+	if err = dao.DeleteUserIdentities(ctx, h.db, user.UID); err != nil {
+		zap.L().Error("dao.DeleteUserIdentities", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrDeleteUser)
+		return
+	}
 
 	encoding.HandleSuccess(c)
 }
@@ -105,19 +121,6 @@ func (s *systemHandler) createUser(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(ctx)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-
-	if Role == model.RoleTypeNormal || Role == model.RoleTypeStudent {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrPermissionDenied)
-		return
-	}
-
 	req := createUserReq{}
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
@@ -133,6 +136,20 @@ func (s *systemHandler) createUser(c *gin.Context) {
 		return
 	}
 
+	// 学院管理员只能在本学院内创建非超级管理员用户
+	if request.PermissionScopeFromCtx(ctx) != rbac.ScopeAll {
+		if req.Role == string(model.RoleTypeSuperAdmin) {
+			zap.L().Error("scoped admin can not create super admin")
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+		if ok, err := v1.InScope(ctx, s.db, "", req.ProfessionHashID); !ok {
+			zap.L().Error("profession out of permission scope", zap.String("profession_hash_id", req.ProfessionHashID), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+	}
+
 	// 验证学院和班级合理性
 	if req.Role == string(model.RoleTypeStudent) {
 		if _, _, err := dao.GetProfessionByHashID(ctx, s.db, req.ProfessionHashID); err != nil {
@@ -170,12 +187,19 @@ func (s *systemHandler) createUser(c *gin.Context) {
 		return
 	}
 
+	encoded, err := password.Hash(req.Password)
+	if err != nil {
+		zap.L().Error("password.Hash", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrCreateUser)
+		return
+	}
+
 	user, err := dao.InsertUser(ctx, s.db, model.User{
 		UID:              utils.NextID(),
 		Username:         req.Account,
 		Name:             req.Username,
 		Role:             model.RoleType(req.Role),
-		Password:         utils.MD5Hex(req.Password),
+		Password:         encoded,
 		ProfessionHashID: req.ProfessionHashID,
 		ClassHashID:      req.ClassHashID,
 		Creator:          request.GetUsernameFromCtx(ctx),
@@ -189,6 +213,9 @@ func (s *systemHandler) createUser(c *gin.Context) {
 		encoding.HandleError(c, errutil.ErrCreateUser)
 		return
 	}
+	if err = dao.SyncClassRooms(ctx, s.db, user.ClassHashID); err != nil {
+		zap.L().Error("dao.SyncClassRooms", zap.Error(err))
+	}
 
 	encoding.HandleSuccess(c, strconv.FormatInt(user.ID, 10))
 }
@@ -211,6 +238,22 @@ func (h *systemHandler) getUserList(c *gin.Context) {
 	if req.Page <= 0 {
 		req.Page = 1
 	}
+
+	// 学院管理员只能查看本学院的用户
+	if request.PermissionScopeFromCtx(ctx) == rbac.ScopeCollege {
+		professionHashIDs, err := h.collegeProfessionHashIDs(ctx)
+		if err != nil {
+			zap.L().Error("h.collegeProfessionHashIDs error", zap.Error(err))
+			encoding.HandleError(c, errutil.ErrSelectUserList)
+			return
+		}
+		req.UserOption.ProfessionHashIDs = restrictTo(req.UserOption.ProfessionHashIDs, professionHashIDs)
+		if len(req.UserOption.ProfessionHashIDs) == 0 {
+			encoding.HandleSuccessList(c, 0, make([]userListItem, 0))
+			return
+		}
+	}
+
 	num, userList, err := dao.GETUserList(ctx, h.db, req.Page, req.Size, req.UserOption)
 	if err != nil {
 		zap.L().Error("dao.GETUserList error", zap.Error(err))
@@ -256,12 +299,15 @@ func (h *systemHandler) getUserList(c *gin.Context) {
 		}
 	}
 
+	presenceMap := h.userPresence(ctx, userList)
+
 	items := make([]userListItem, 0)
 	for _, user := range userList {
 		profession, _ := professionMap[user.ProfessionHashID]
 
 		class, _ := classMap[user.ClassHashID]
 
+		presence := presenceMap[user.UID]
 		items = append(items, userListItem{
 			UserName: user.Username,
 			Name:     user.Name,
@@ -270,12 +316,40 @@ func (h *systemHandler) getUserList(c *gin.Context) {
 
 			ClassName:      class.ClassName,
 			ProfessionName: profession.ProfessionName,
+
+			Presence: presence.Status,
+			LastSeen: presence.LastSeen,
 		})
 	}
 
 	encoding.HandleSuccessList(c, num, items)
 }
 
+// userPresence returns the chat presence of the users by uid, empty if the chat is not started or fails
+func (h *systemHandler) userPresence(ctx context.Context, users []model.User) map[string]imsystem.Presence {
+	hub := imsystem.Default()
+	if hub == nil || len(users) == 0 {
+		return nil
+	}
+
+	uids := make([]string, 0, len(users))
+	for _, user := range users {
+		uids = append(uids, user.UID)
+	}
+	presence, err := hub.Presence(ctx, uids...)
+	if err != nil {
+		// 在线状态只是附加信息，查询失败不影响用户列表
+		zap.L().Error("hub.Presence", zap.Error(err))
+		return nil
+	}
+
+	presenceMap := make(map[string]imsystem.Presence, len(presence))
+	for _, p := range presence {
+		presenceMap[p.UID] = p
+	}
+	return presenceMap
+}
+
 func (h *systemHandler) getUserDetail(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
@@ -293,6 +367,12 @@ func (h *systemHandler) getUserDetail(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, h.db, user.UID, user.ProfessionHashID); !ok {
+		zap.L().Error("user out of permission scope", zap.Int64("user_id", user.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	var profession model.Profession
 	var class model.Class
 	if user.ProfessionHashID != "" {
@@ -339,6 +419,10 @@ func (h *systemHandler) getUserDetail(c *gin.Context) {
 		Emial: user.Emial,
 	}
 
+	if data.Lock, err = h.loginGuard.Status(ctx, user.Username); err != nil {
+		zap.L().Error("loginGuard.Status", zap.Error(err))
+	}
+
 	encoding.HandleSuccess(c, data)
 }
 
@@ -355,7 +439,7 @@ func (h *systemHandler) editUserInfo(c *gin.Context) {
 	}
 
 	// 检查该用户是否存在
-	ok, _, err := dao.GetUserByID(ctx, h.db, req.Id)
+	ok, user, err := dao.GetUserByID(ctx, h.db, req.Id)
 	if err != nil {
 		zap.L().Error("find user by id failed", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrDeleteUser)
@@ -367,6 +451,36 @@ func (h *systemHandler) editUserInfo(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, h.db, user.UID, user.ProfessionHashID); !ok {
+		zap.L().Error("user out of permission scope", zap.Int64("user_id", user.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
+	// 转专业时新专业也要在权限范围内，否则能把用户移到别的学院
+	if req.ProfessionHashID != "" && req.ProfessionHashID != user.ProfessionHashID {
+		found, profession, err := dao.GetProfessionByHashID(ctx, h.db, req.ProfessionHashID)
+		if err != nil || !found {
+			zap.L().Error("dao.GetProfessionByHashID", zap.String("profession_hash_id", req.ProfessionHashID), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+		if ok, err := v1.InCollegeScope(ctx, h.db, profession.CollegeHashID); !ok {
+			zap.L().Error("college out of permission scope", zap.String("college_hash_id", profession.CollegeHashID), zap.Error(err))
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+	}
+
+	if req.Status != 0 && req.Status != model.UserStatusNormal && req.Status != model.UserStatusDisabled {
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if req.Status == model.UserStatusDisabled && user.UID == request.GetUserUIDFromCtx(ctx) {
+		encoding.HandleError(c, errutil.NewError(400, "can not disable yourself"))
+		return
+	}
+
 	updater := request.GetUsernameFromCtx(ctx)
 
 	err = dao.UpdateUserInfo(ctx, h.db, req.Id, model.User{
@@ -378,6 +492,7 @@ func (h *systemHandler) editUserInfo(c *gin.Context) {
 		Phone:   req.Phone,
 		Emial:   req.Email,
 		Updater: updater,
+		Status:  req.Status,
 	})
 	if err != nil {
 		zap.L().Error("dao.ChangeUserInfo error", zap.Error(err))
@@ -385,6 +500,19 @@ func (h *systemHandler) editUserInfo(c *gin.Context) {
 		return
 	}
 
+	// 班级或状态变了，同步班级群成员
+	if err = dao.SyncClassRooms(ctx, h.db, user.ClassHashID, req.ClassHashID); err != nil {
+		zap.L().Error("dao.SyncClassRooms", zap.Error(err))
+	}
+
+	// 停用后立即注销该用户的所有会话
+	if req.Status == model.UserStatusDisabled {
+		if err = h.refreshManager.RevokeAll(ctx, user.UID); err != nil {
+			zap.L().Error("refreshManager.RevokeAll", zap.Error(err))
+		}
+		imsystem.DisconnectSession(user.UID, "")
+	}
+
 	encoding.HandleSuccess(c)
 }
 
@@ -413,8 +541,8 @@ func (h *systemHandler) changeUserPwd(c *gin.Context) {
 		return
 	}
 
-	if u.Password != utils.MD5Hex(req.OldPwd) {
-		zap.L().Error("oldpassword error")
+	if ok, _, err := password.Verify(req.OldPwd, u.Password); !ok {
+		zap.L().Error("oldpassword error", zap.Error(err))
 		encoding.HandleError(c, errutil.NewError(400, "username or password error"))
 		return
 	}
@@ -424,18 +552,26 @@ func (h *systemHandler) changeUserPwd(c *gin.Context) {
 		encoding.HandleError(c, errutil.ErrIllegalParameter)
 		return
 	}
-	updated := map[string]interface{}{
-		"password":   utils.MD5Hex(req.NewPwd),
-		"updated_at": time.Now().UnixMilli(),
-		"updater":    request.GetUsernameFromCtx(ctx),
+	encoded, err := password.Hash(req.NewPwd)
+	if err != nil {
+		zap.L().Error("password.Hash", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrChangeUserPWD)
+		return
 	}
-	err = h.db.WithContext(ctx).Model(model.User{}).Where("id = ?", id).Updates(updated).Error
+
+	err = dao.UpdateUserPassword(ctx, h.db, id, encoded, request.GetUsernameFromCtx(ctx))
 	if err != nil {
 		zap.L().Error("update pwd failed", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrChangeUserPWD)
 		return
 	}
 
+	// 密码修改后所有登录会话失效，包括当前会话
+	if err = h.refreshManager.RevokeAll(ctx, u.UID); err != nil {
+		zap.L().Error("refreshManager.RevokeAll", zap.Error(err))
+	}
+	imsystem.DisconnectSession(u.UID, "")
+
 	encoding.HandleSuccess(c)
 }
 
@@ -443,16 +579,6 @@ func (h *systemHandler) resetUserPWD(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(ctx)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-	if Role != model.RoleTypeSuperAdmin && Role != model.RoleTypeCollegeAdmin {
-		zap.L().Error("the operator's authority is illegal")
-	}
-
 	req := resetPwdReq{}
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
@@ -461,7 +587,7 @@ func (h *systemHandler) resetUserPWD(c *gin.Context) {
 		return
 	}
 	id := c.Param("id")
-	ok, _, err := dao.GetUserByID(ctx, h.db, id)
+	ok, user, err := dao.GetUserByID(ctx, h.db, id)
 	if !ok {
 		zap.L().Error("this user not  exists")
 		encoding.HandleError(c, errutil.NewError(400, "username or password error"))
@@ -473,6 +599,12 @@ func (h *systemHandler) resetUserPWD(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, h.db, user.UID, user.ProfessionHashID); !ok {
+		zap.L().Error("user out of permission scope", zap.Int64("user_id", user.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	// 检验密码合规性
 	if !utils.CheckPWD(req.NewPwd) {
 		zap.L().Error("password illegal")
@@ -480,44 +612,115 @@ func (h *systemHandler) resetUserPWD(c *gin.Context) {
 		return
 	}
 
-	updated := map[string]interface{}{
-		"password":   utils.MD5Hex(req.NewPwd),
-		"updated_at": time.Now().UnixMilli(),
-		"updater":    request.GetUsernameFromCtx(ctx),
-	}
-	ID, err := strconv.Atoi(id)
+	ID, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
-		zap.L().Error("strconv.Atoi", zap.Error(err))
+		zap.L().Error("strconv.ParseInt", zap.Error(err))
 		encoding.HandleError(c, errutil.NewError(400, "reset password failed"))
 		return
 	}
 
-	err = h.db.WithContext(ctx).Model(model.User{}).Where("id = ?", ID).Updates(updated).Error
+	encoded, err := password.Hash(req.NewPwd)
+	if err != nil {
+		zap.L().Error("password.Hash", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrChangeUserPWD)
+		return
+	}
+
+	err = dao.UpdateUserPassword(ctx, h.db, ID, encoded, request.GetUsernameFromCtx(ctx))
 	if err != nil {
 		zap.L().Error("update pwd failed", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrChangeUserPWD)
 		return
 	}
 
+	if err = h.refreshManager.RevokeAll(ctx, user.UID); err != nil {
+		zap.L().Error("refreshManager.RevokeAll", zap.Error(err))
+	}
+	imsystem.DisconnectSession(user.UID, "")
+
 	encoding.HandleSuccess(c)
 }
 
-func (s *systemHandler) createCollege(c *gin.Context) {
+func (h *systemHandler) unlockUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	user, ok := h.scopedUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	if err := h.loginGuard.Unlock(ctx, user.Username); err != nil {
+		zap.L().Error("loginGuard.Unlock", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	zap.L().Info("account unlocked", zap.String("username", user.Username), zap.String("operator", request.GetUsernameFromCtx(ctx)))
+	encoding.HandleSuccess(c)
+}
+
+func (h *systemHandler) listUserSessions(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(ctx)
-	if Role == "" {
+	user, ok := h.scopedUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.refreshManager.Sessions(ctx, user.UID)
+	if err != nil {
+		zap.L().Error("refreshManager.Sessions", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
 
-	if Role == model.RoleTypeNormal || Role == model.RoleTypeStudent {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrPermissionDenied)
+	encoding.HandleSuccessList(c, int64(len(sessions)), sessions)
+}
+
+// forceLogout revokes all sessions of the user
+func (h *systemHandler) forceLogout(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	user, ok := h.scopedUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	if err := h.refreshManager.RevokeAll(ctx, user.UID); err != nil {
+		zap.L().Error("refreshManager.RevokeAll", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
 		return
 	}
+	imsystem.DisconnectSession(user.UID, "")
+
+	zap.L().Info("user forced to log out", zap.String("username", user.Username), zap.String("operator", request.GetUsernameFromCtx(ctx)))
+	encoding.HandleSuccess(c)
+}
+
+// scopedUser loads the user of the :id path parameter, and checks it is in the permission scope
+func (h *systemHandler) scopedUser(ctx context.Context, c *gin.Context) (*model.User, bool) {
+	found, user, err := dao.GetUserByID(ctx, h.db, c.Param("id"))
+	if err != nil || !found {
+		zap.L().Error("dao.GetUserByID error", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrNotFound)
+		return nil, false
+	}
+
+	if ok, err := v1.InScope(ctx, h.db, user.UID, user.ProfessionHashID); !ok {
+		zap.L().Error("user out of permission scope", zap.Int64("user_id", user.ID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (s *systemHandler) createCollege(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
 
 	req := ceateCollegeReq{}
 	err := c.ShouldBindJSON(&req)
@@ -567,17 +770,6 @@ func (h *systemHandler) deleteCollege(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(c)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-	if Role == model.RoleTypeStudent || Role == model.RoleTypeNormal {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrPermissionDenied)
-	}
-
 	req := deleteCollegeReq{}
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
@@ -636,19 +828,6 @@ func (s *systemHandler) createProfession(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(ctx)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-
-	if Role == model.RoleTypeNormal || Role == model.RoleTypeStudent {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrPermissionDenied)
-		return
-	}
-
 	req := ceateProfessionReq{}
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
@@ -657,6 +836,12 @@ func (s *systemHandler) createProfession(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InCollegeScope(ctx, s.db, req.CollegeHashID); !ok {
+		zap.L().Error("college out of permission scope", zap.String("college_hash_id", req.CollegeHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	// 专业重复性验证
 	found, _, err := dao.GetProfessionByHashID(ctx, s.db, utils.HashProfessionID(req.CollegeHashID, req.ProfessionName))
 	if err != nil && err != gorm.ErrRecordNotFound {
@@ -706,17 +891,6 @@ func (h *systemHandler) deleteProfession(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(c)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-	if Role == model.RoleTypeStudent || Role == model.RoleTypeNormal {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrPermissionDenied)
-	}
-
 	req := deleteProfessionrReq{}
 	err := c.ShouldBindQuery(&req)
 	if err != nil {
@@ -726,7 +900,7 @@ func (h *systemHandler) deleteProfession(c *gin.Context) {
 	}
 
 	// 检测用户是否存在
-	ok, _, err := dao.GetProfessionByHashID(ctx, h.db, req.HashID)
+	ok, profession, err := dao.GetProfessionByHashID(ctx, h.db, req.HashID)
 	if err != nil {
 		zap.L().Error("find profession by id failed", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrDeleteUser)
@@ -738,6 +912,12 @@ func (h *systemHandler) deleteProfession(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InCollegeScope(ctx, h.db, profession.CollegeHashID); !ok {
+		zap.L().Error("college out of permission scope", zap.String("college_hash_id", profession.CollegeHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	// 删除用户
 	if err = dao.DeleteProfession(ctx, h.db, req.HashID); err != nil {
 		zap.L().Error("delete profession failed", zap.Error(err))
@@ -775,19 +955,6 @@ func (s *systemHandler) createClass(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(ctx)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-
-	if Role == model.RoleTypeNormal || Role == model.RoleTypeStudent {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrPermissionDenied)
-		return
-	}
-
 	req := createClassReq{}
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
@@ -796,6 +963,12 @@ func (s *systemHandler) createClass(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, s.db, "", req.ProfessionHashID); !ok {
+		zap.L().Error("profession out of permission scope", zap.String("profession_hash_id", req.ProfessionHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	// 重复性验证
 	found, _, err := dao.GetClassByHashID(ctx, s.db, utils.HashClassID(req.ProfessionHashID, req.ClassName, req.ClassID))
 	if err != nil && err != gorm.ErrRecordNotFound {
@@ -831,17 +1004,6 @@ func (h *systemHandler) deleteClass(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
 	defer cancel()
 
-	// 验证权限
-	Role := request.GetRoleTypeFromCtx(c)
-	if Role == "" {
-		encoding.HandleError(c, errutil.ErrInternalServer)
-		return
-	}
-	if Role == model.RoleTypeStudent || Role == model.RoleTypeNormal {
-		zap.L().Error("the operator's authority is illegal")
-		encoding.HandleError(c, errutil.ErrPermissionDenied)
-	}
-
 	req := deleteClassReq{}
 	err := c.ShouldBindQuery(&req)
 	if err != nil {
@@ -850,7 +1012,7 @@ func (h *systemHandler) deleteClass(c *gin.Context) {
 		return
 	}
 
-	ok, _, err := dao.GetClassByHashID(ctx, h.db, req.HashID)
+	ok, class, err := dao.GetClassByHashID(ctx, h.db, req.HashID)
 	if err != nil {
 		zap.L().Error("find class by id failed", zap.Error(err))
 		encoding.HandleError(c, errutil.ErrDeleteUser)
@@ -862,6 +1024,12 @@ func (h *systemHandler) deleteClass(c *gin.Context) {
 		return
 	}
 
+	if ok, err := v1.InScope(ctx, h.db, "", class.ProfessionHashID); !ok {
+		zap.L().Error("profession out of permission scope", zap.String("profession_hash_id", class.ProfessionHashID), zap.Error(err))
+		encoding.HandleError(c, errutil.ErrPermissionDenied)
+		return
+	}
+
 	// 删除班级
 	if err = dao.DeleteClass(ctx, h.db, req.HashID); err != nil {
 		zap.L().Error("delete class failed", zap.Error(err))
@@ -900,3 +1068,95 @@ func (h *systemHandler) getClassTree(c *gin.Context) {
 
 	encoding.HandleSuccess(c, data)
 }
+
+// collegeProfessionHashIDs returns the professions of the current user's college
+func (h *systemHandler) collegeProfessionHashIDs(ctx context.Context) ([]string, error) {
+	found, user, err := dao.GetUserByUID(ctx, h.db, request.GetUserUIDFromCtx(ctx))
+	if err != nil || !found {
+		return nil, err
+	}
+	_, profession, err := dao.GetProfessionByHashID(ctx, h.db, user.ProfessionHashID)
+	if err != nil {
+		return nil, err
+	}
+	professions, err := dao.GetProfessionsByCollegeHashID(ctx, h.db, profession.CollegeHashID)
+	if err != nil {
+		return nil, err
+	}
+
+	hashIDs := make([]string, 0, len(professions))
+	for _, p := range professions {
+		hashIDs = append(hashIDs, p.HashID)
+	}
+	return hashIDs, nil
+}
+
+// restrictTo filters the requested hash ids to the allowed ones, all allowed ones if nothing requested
+func restrictTo(requested, allowed []string) []string {
+	if len(requested) == 0 {
+		return allowed
+	}
+	set := make(map[string]struct{}, len(allowed))
+	for _, id := range allowed {
+		set[id] = struct{}{}
+	}
+	result := make([]string, 0, len(requested))
+	for _, id := range requested {
+		if _, ok := set[id]; ok {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func (h *systemHandler) getTwoFactorPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	conf, err := dao.GetTwoFactorConfig(ctx, h.db)
+	if err != nil {
+		zap.L().Error("dao.GetTwoFactorConfig", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+	if conf.RequiredRoles == nil {
+		conf.RequiredRoles = make([]model.RoleType, 0)
+	}
+
+	encoding.HandleSuccess(c, conf)
+}
+
+func (h *systemHandler) setTwoFactorPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, v1.DefaultTimeout)
+	defer cancel()
+
+	req := model.ConfigTwoFactor{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.L().Error("c.ShouldBindJSON", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+
+	// 只有可以绑定两步验证的角色才能被要求启用
+	for _, role := range req.RequiredRoles {
+		if !role.TwoFactorCapable() {
+			zap.L().Error("role can not enroll in two-factor authentication", zap.String("role", string(role)))
+			encoding.HandleError(c, errutil.ErrIllegalParameter)
+			return
+		}
+	}
+
+	val, err := json.Marshal(req)
+	if err != nil {
+		encoding.HandleError(c, errutil.ErrIllegalParameter)
+		return
+	}
+	if _, err = dao.UpsertConfig(ctx, h.db, model.ConfigKeyTwoFactor, val); err != nil {
+		zap.L().Error("dao.UpsertConfig", zap.Error(err))
+		encoding.HandleError(c, errutil.ErrInternalServer)
+		return
+	}
+
+	zap.L().Info("two-factor policy changed", zap.Any("required_roles", req.RequiredRoles), zap.String("operator", request.GetUsernameFromCtx(ctx)))
+	encoding.HandleSuccess(c)
+}
@@ -4,6 +4,9 @@ import (
 	"gorm.io/gorm"
 	"v1/pkg/apiserver/middleware"
 	"v1/pkg/client/cache"
+	"v1/pkg/lockout"
+	"v1/pkg/ratelimit"
+	"v1/pkg/rbac"
 	"v1/pkg/token"
 
 	"github.com/gin-gonic/gin"
@@ -12,32 +15,42 @@ import (
 func RegisterRouter(group *gin.RouterGroup, tokenManager token.Manager, cacheClient cache.Interface, db *gorm.DB) {
 	systemG := group.Group("/system")
 	handler := newSystemHandler(systemHandlerOption{
-		db: db,
+		db:             db,
+		loginGuard:     lockout.Default(),
+		refreshManager: token.NewRefreshManager(cacheClient),
 	})
 
 	systemG.Use(middleware.CheckToken(tokenManager, cacheClient))
-
-	systemG.DELETE("/users", handler.deleteUser) // done
-	systemG.POST("/users", handler.createUser)
-	systemG.POST("/users/list", handler.getUserList)         // 用户列表 done
-	systemG.POST("/user/:id/detail", handler.getUserDetail)  // 用户详情 done
-	systemG.PATCH("/users", handler.editUserInfo)            // 编辑用户信息 done
-	systemG.PUT("/users/password", handler.changeUserPwd)    // 废弃
-	systemG.PUT("/users/:id/password", handler.resetUserPWD) // 管理员重置密码 done
+	listLimit := middleware.RateLimit(ratelimit.Default(), ratelimit.PolicyList)
+
+	systemG.DELETE("/users", middleware.RequirePermission(rbac.PermissionUserDelete), handler.deleteUser) // done
+	systemG.POST("/users", middleware.RequirePermission(rbac.PermissionUserCreate), handler.createUser)
+	systemG.POST("/users/list", middleware.RequirePermission(rbac.PermissionUserList), listLimit, handler.getUserList)       // 用户列表 done
+	systemG.POST("/user/:id/detail", middleware.RequirePermission(rbac.PermissionUserDetail), handler.getUserDetail)         // 用户详情 done
+	systemG.PATCH("/users", middleware.RequirePermission(rbac.PermissionUserUpdate), handler.editUserInfo)                   // 编辑用户信息 done
+	systemG.PUT("/users/password", middleware.RequirePermission(rbac.PermissionUserPassword), handler.changeUserPwd)         // 修改自己的密码
+	systemG.PUT("/users/:id/password", middleware.RequirePermission(rbac.PermissionUserResetPassword), handler.resetUserPWD) // 管理员重置密码 done
+	systemG.PUT("/users/:id/unlock", middleware.RequirePermission(rbac.PermissionUserUnlock), handler.unlockUser)            // 管理员解锁账号
+	systemG.GET("/users/:id/sessions", middleware.RequirePermission(rbac.PermissionUserSession), handler.listUserSessions)
+	systemG.DELETE("/users/:id/sessions", middleware.RequirePermission(rbac.PermissionUserSession), handler.forceLogout) // 强制下线
 
 	// college
-	systemG.POST("/colleges", handler.createCollege) //
-	systemG.DELETE("/colleges", handler.deleteCollege)
-	systemG.POST("/colleges/tree", handler.getCollegeTree) // tree done
+	systemG.POST("/colleges", middleware.RequirePermission(rbac.PermissionCollegeCreate), handler.createCollege) //
+	systemG.DELETE("/colleges", middleware.RequirePermission(rbac.PermissionCollegeDelete), handler.deleteCollege)
+	systemG.POST("/colleges/tree", middleware.RequirePermission(rbac.PermissionCollegeList), listLimit, handler.getCollegeTree) // tree done
 
 	// profession
-	systemG.POST("/professions", handler.createProfession)
-	systemG.DELETE("/professions", handler.deleteProfession)
-	systemG.POST("/profession/tree", handler.getProfessionTree) // tree done
+	systemG.POST("/professions", middleware.RequirePermission(rbac.PermissionProfessionCreate), handler.createProfession)
+	systemG.DELETE("/professions", middleware.RequirePermission(rbac.PermissionProfessionDelete), handler.deleteProfession)
+	systemG.POST("/profession/tree", middleware.RequirePermission(rbac.PermissionProfessionList), listLimit, handler.getProfessionTree) // tree done
 
 	// class
-	systemG.POST("/classes", handler.createClass)
-	systemG.DELETE("/classes", handler.deleteClass)
-	systemG.POST("/:profession_hash_id/class/tree", handler.getClassTree) // tree done
+	systemG.POST("/classes", middleware.RequirePermission(rbac.PermissionClassCreate), handler.createClass)
+	systemG.DELETE("/classes", middleware.RequirePermission(rbac.PermissionClassDelete), handler.deleteClass)
+	systemG.POST("/:profession_hash_id/class/tree", middleware.RequirePermission(rbac.PermissionClassList), listLimit, handler.getClassTree) // tree done
+
+	// two-factor policy
+	systemG.GET("/two-factor", middleware.RequirePermission(rbac.PermissionTwoFactorPolicy), handler.getTwoFactorPolicy)
+	systemG.PUT("/two-factor", middleware.RequirePermission(rbac.PermissionTwoFactorPolicy), handler.setTwoFactorPolicy) // 设置必须启用两步验证的角色
 
 }
@@ -1,6 +1,10 @@
 package system
 
-import "v1/pkg/model"
+import (
+	"v1/pkg/apiserver/imsystem"
+	"v1/pkg/lockout"
+	"v1/pkg/model"
+)
 
 type (
 	deleteUserReq struct {
@@ -30,6 +34,8 @@ type (
 
 		Phone string `json:"phone"`
 		Email string `json:"email"`
+
+		Status model.UserStatus `json:"status"` // 0 不修改，停用后立即注销该用户的所有会话
 	}
 
 	getUserListReq struct {
@@ -45,6 +51,9 @@ type (
 		Role           string `json:"role"`
 		ProfessionName string `json:"profession_name"`
 		ClassName      string `json:"class_name"`
+
+		Presence imsystem.PresenceStatus `json:"presence,omitempty"` // 聊天在线状态，聊天未启动时为空
+		LastSeen int64                   `json:"last_seen,omitempty"`
 	}
 
 	getUserDetailResp struct {
@@ -61,6 +70,8 @@ type (
 
 		Phone string `gorm:"column:phone; type:varchar(32)"`
 		Emial string `gorm:"column:email; type:varchar(32)"`
+
+		Lock lockout.Status `json:"lock"` // 登录锁定状态
 	}
 
 	changePwdReq struct {
@@ -0,0 +1,68 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"time"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	matchRoundsTimeout = time.Minute
+	syncRoomsTimeout   = 5 * time.Minute
+)
+
+// installCronJobs registers the periodic jobs, they run from Run until the server stops
+func (s *APIServer) installCronJobs() error {
+	if _, err := s.Crontab.AddFunc("@every 1m", s.matchDueSelectionRounds); err != nil {
+		return err
+	}
+	_, err := s.Crontab.AddFunc("@every 10m", s.syncClassRooms)
+	return err
+}
+
+// matchDueSelectionRounds matches the selection rounds past their deadline.
+// Every instance runs it, the round is matched by whichever closes it first
+func (s *APIServer) matchDueSelectionRounds() {
+	ctx, cancel := context.WithTimeout(context.Background(), matchRoundsTimeout)
+	defer cancel()
+
+	rounds, err := dao.ListDueSelectionRounds(ctx, s.RDBClient)
+	if err != nil {
+		zap.L().Error("dao.ListDueSelectionRounds", zap.Error(err))
+		return
+	}
+
+	for _, round := range rounds {
+		matched, err := dao.MatchSelectionRound(ctx, s.RDBClient, round.ID, model.User{Username: model.SystemUsername})
+		if errors.Is(err, dao.ErrSelectionRoundClosed) {
+			continue
+		}
+		if err != nil {
+			zap.L().Error("dao.MatchSelectionRound", zap.Int64("round_id", round.ID), zap.Error(err))
+			continue
+		}
+		zap.L().Info("selection round matched", zap.Int64("round_id", round.ID), zap.Int("matched", matched))
+	}
+}
+
+// syncClassRooms brings the class chat rooms in line with the classes, whose users also change outside the system api (sso)
+func (s *APIServer) syncClassRooms() {
+	ctx, cancel := context.WithTimeout(context.Background(), syncRoomsTimeout)
+	defer cancel()
+
+	rooms, err := dao.ListChatRoomsByKind(ctx, s.RDBClient, model.RoomKindClass)
+	if err != nil {
+		zap.L().Error("dao.ListChatRoomsByKind", zap.Error(err))
+		return
+	}
+
+	for _, room := range rooms {
+		if err = dao.SyncChatRoom(ctx, s.RDBClient, room); err != nil {
+			zap.L().Error("dao.SyncChatRoom", zap.Int64("room_id", room.ID), zap.Error(err))
+		}
+	}
+}
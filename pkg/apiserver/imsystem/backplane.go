@@ -0,0 +1,129 @@
+package imsystem
+
+import (
+	"context"
+	"sync"
+)
+
+// Delivery is what a hub publishes to the hubs of the other instances
+type Delivery struct {
+	Origin   string    `json:"origin"` // 发布的 hub，收到自己发布的直接忽略
+	UIDs     []string  `json:"uids"`
+	Envelope *Envelope `json:"envelope,omitempty"`
+	Skip     string    `json:"skip,omitempty"` // 不发给这个客户端，通常是发送者自己
+	// Disconnect closes the clients of the users connected with tokens of the session, all of them if SessionID is empty
+	Disconnect bool   `json:"disconnect,omitempty"`
+	SessionID  string `json:"session_id,omitempty"`
+}
+
+// Backplane connects the hubs of all the api server instances: the deliveries published by one reach
+// the others, and the presence of the users connected to any of them is shared
+type Backplane interface {
+	// Publish sends the delivery to the subscribers of every instance, the publisher included
+	Publish(ctx context.Context, d Delivery) error
+
+	// Subscribe calls fn with every delivery published until the backplane closes
+	Subscribe(fn func(Delivery)) error
+
+	// Connect and Disconnect track the connections of the user, clientID is unique on all instances
+	Connect(ctx context.Context, uid, clientID string) error
+	Disconnect(ctx context.Context, uid, clientID string) error
+
+	// SetAway marks the connection idle or active, the user is away when all of its connections are
+	SetAway(ctx context.Context, uid, clientID string, away bool) error
+
+	// Status returns the presence of the users on all instances
+	Status(ctx context.Context, uids []string) (map[string]PresenceStatus, error)
+
+	Close() error
+}
+
+// statusOf is the presence of a user with the connections, true for the away ones
+func statusOf(connections map[string]bool) PresenceStatus {
+	if len(connections) == 0 {
+		return PresenceOffline
+	}
+	for _, away := range connections {
+		if !away {
+			return PresenceOnline
+		}
+	}
+	return PresenceAway
+}
+
+// memoryBackplane connects the hubs of the process, only suitable for a single instance.
+// Several hubs may share one, as if they were on different instances
+type memoryBackplane struct {
+	mu          sync.RWMutex
+	subscribers []func(Delivery)
+	connections map[string]map[string]bool // uid -> client id -> away
+}
+
+func NewMemoryBackplane() Backplane {
+	return &memoryBackplane{connections: make(map[string]map[string]bool)}
+}
+
+func (b *memoryBackplane) Publish(_ context.Context, d Delivery) error {
+	b.mu.RLock()
+	subscribers := append([]func(Delivery){}, b.subscribers...)
+	b.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(d)
+	}
+	return nil
+}
+
+func (b *memoryBackplane) Subscribe(fn func(Delivery)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+	return nil
+}
+
+func (b *memoryBackplane) Connect(_ context.Context, uid, clientID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.connections[uid] == nil {
+		b.connections[uid] = make(map[string]bool)
+	}
+	b.connections[uid][clientID] = false
+	return nil
+}
+
+func (b *memoryBackplane) Disconnect(_ context.Context, uid, clientID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.connections[uid], clientID)
+	if len(b.connections[uid]) == 0 {
+		delete(b.connections, uid)
+	}
+	return nil
+}
+
+func (b *memoryBackplane) SetAway(_ context.Context, uid, clientID string, away bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.connections[uid][clientID]; ok {
+		b.connections[uid][clientID] = away
+	}
+	return nil
+}
+
+func (b *memoryBackplane) Status(_ context.Context, uids []string) (map[string]PresenceStatus, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	status := make(map[string]PresenceStatus, len(uids))
+	for _, uid := range uids {
+		status[uid] = statusOf(b.connections[uid])
+	}
+	return status, nil
+}
+
+func (b *memoryBackplane) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = nil
+	return nil
+}
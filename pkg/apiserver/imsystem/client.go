@@ -1,132 +1,152 @@
 package imsystem
 
 import (
-	"errors"
-	"fmt"
-	"io"
-	"net"
-)
-
-var ClientMap map[string]*Client // uid:client{}
+	"encoding/json"
+	"time"
+	"v1/pkg/token"
+	"v1/pkg/utils"
 
-type ChatFlag int
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
 
 const (
-	ChatFlagPrivate ChatFlag = 1 // 单对单
-	ChatFlagGroup   ChatFlag = 2
-	ChatFlagPublic  ChatFlag = 3
+	// 写超时
+	writeWait = 10 * time.Second
+	// 多久收不到 pong 认为连接已断开
+	pongWait = 60 * time.Second
+	// ping 间隔，必须小于 pongWait
+	pingPeriod = pongWait * 9 / 10
+	// 单帧最大字节数
+	maxFrameSize = 8 << 10
+	// 每个客户端的发送缓冲
+	sendBuffer = 256
 )
 
+// Client is a websocket connection of an authenticated user
 type Client struct {
-	ServerIp   string
-	ServerPort int
-	Adr        string
+	UID       string
+	Username  string
+	SessionID string
 
-	UserUID string
+	id   string // 在所有实例中唯一，转发时用来跳过发送者
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte
 
-	conn net.Conn
-	flag int // 当前client的模式
+	pendingUpTo int64 // 注册时最新的消息id，补发的离线消息不超过它
 }
 
-func NewClient(serverIp string, serverPort int, uid string) (*Client, error) {
-	// 创建客户端对象
-	client := &Client{
-		ServerIp:   serverIp,
-		ServerPort: serverPort,
-		flag:       1,
-		UserUID:    uid,
+// ServeConn registers the connection of the user to the hub and serves it until it closes
+func ServeConn(h *Hub, conn *websocket.Conn, payload token.Payload) {
+	c := &Client{
+		UID:       payload.UID,
+		Username:  payload.Username,
+		SessionID: payload.SessionID,
+		id:        utils.NextID(),
+		hub:       h,
+		conn:      conn,
+		send:      make(chan []byte, sendBuffer),
+	}
+	if !h.register(c) {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeWait))
+		_ = conn.Close()
+		return
 	}
 
-	// 链接server
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", serverIp, serverPort))
-	if err != nil {
-		fmt.Println("net.Dial error:", err)
-		return nil, err
+	// 补发离线消息后再开始推送
+	if err := h.deliverPending(c); err != nil {
+		zap.L().Error("deliver pending chat messages", zap.String("uid", c.UID), zap.Error(err))
+		h.unregister(c)
+		_ = conn.Close()
+		return
 	}
 
-	client.conn = conn
-	client.Adr = conn.RemoteAddr().String()
+	go c.writePump()
+	c.readPump()
+}
+
+// write writes the envelope to the connection, only before the write pump starts
+func (c *Client) write(env Envelope) error {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteJSON(env)
+}
 
-	sendMsg := "uid:" + client.UserUID
-	_, err = client.conn.Write([]byte(sendMsg))
+// Send queues the envelope to the client, it is dropped if the client can't keep up
+func (c *Client) Send(env Envelope) {
+	b, err := json.Marshal(env)
 	if err != nil {
-		fmt.Println("conn Write err:", err)
+		zap.L().Error("json.Marshal", zap.Error(err))
+		return
 	}
 
-	// 返回对象
-	return client, err
-}
-
-// 用于新增用户client
-func AddChatClient(serverIp string, serverPort int, uid string) error {
-	client, err := NewClient(serverIp, serverPort, uid)
-	if client == nil {
-		return err
+	// 持有读锁，保证 send 未被 unregister 关闭
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	if _, ok := c.hub.clients[c.UID][c]; !ok {
+		return
 	}
+	select {
+	case c.send <- b:
+	default:
+	}
+}
 
-	// 监听对端传来的消息
-	go client.listenHandler()
+// readPump reads the envelopes of the client until the connection fails or the client is unregistered
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister(c)
+		_ = c.conn.Close()
+	}()
 
-	ClientMap[uid] = client
-	return nil
-}
+	c.conn.SetReadLimit(maxFrameSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
 
-// 监听
-func (client *Client) listenHandler() {
-	buf := make([]byte, 4096)
 	for {
-		n, err := client.conn.Read(buf)
-
-		if err != nil && err != io.EOF {
-			fmt.Println("Conn Read err:", err)
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				zap.L().Info("chat connection closed", zap.String("uid", c.UID), zap.Error(err))
+			}
 			return
 		}
-		// 提取用户的消息(去除'\n')
-		msg := string(buf[:n-1])
 
-		// 用户针对msg进行消息处理
-		client.Domessage(msg)
-	}
-}
-
-func (client *Client) Domessage(msg string) {
-	fmt.Println(client.UserUID + " get a message:" + msg) // 测试
-}
-
-// 删除client --- 仅在退登时使用
-func DeleteClient(uid string) {
-	client, ok := ClientMap[uid]
-	if ok {
-		sendMsg := "quit"
-		_, err := client.conn.Write([]byte(sendMsg))
-		if err != nil {
-			fmt.Println("conn Write err:", err)
+		var env Envelope
+		if err = json.Unmarshal(data, &env); err != nil {
+			c.Send(errorEnvelope("", "invalid envelope"))
+			continue
 		}
+		c.hub.dispatch(c, env)
 	}
-
-	delete(ClientMap, uid)
-
 }
 
-// 初始化
-func InitChatClient() {
-	ClientMap = map[string]*Client{}
-}
-
-func SendMsg(sendUID string, GetUID string, msg string) error {
-	sendClient, ok := ClientMap[sendUID]
-	if !ok {
-		return errors.New("not get client")
-	}
-	sendClient.sendMsg(GetUID, msg)
-	return nil
-}
+// writePump writes the queued envelopes and the pings, it closes the connection once the send channel is closed
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		_ = c.conn.Close()
+	}()
 
-func (client *Client) sendMsg(getUID, msg string) {
-	sendMsg := "to|" + getUID + "|" + msg + "\n\n"
-	_, err := client.conn.Write([]byte(sendMsg))
-	if err != nil {
-		fmt.Println("conn Write err:", err)
-		return
+	for {
+		select {
+		case b, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, b); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
 	}
 }
@@ -0,0 +1,112 @@
+package imsystem
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// connPair returns the server and the client side of a websocket connection
+func connPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return <-conns, client
+}
+
+func TestDeliverPending(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, uid := range []string{"alice", "bob"} {
+		if err := db.Create(&model.User{UID: uid, Username: uid, Status: model.UserStatusNormal}).Error; err != nil {
+			t.Fatalf("create %s: %v", uid, err)
+		}
+	}
+	h, err := NewHub(db, NewMemoryBackplane())
+	if err != nil {
+		t.Fatalf("NewHub: %v", err)
+	}
+	t.Cleanup(h.Close)
+
+	store := func(delivered bool) model.ChatMessage {
+		t.Helper()
+		msg := model.ChatMessage{ConversationID: model.PrivateConversationID("alice", "bob"), SenderUID: "alice", RecipientUID: "bob", Content: "hi"}
+		if delivered {
+			msg.DeliveredAt = 1
+		}
+		if err := dao.InsertChatMessage(ctx, db, &msg); err != nil {
+			t.Fatalf("InsertChatMessage: %v", err)
+		}
+		return msg
+	}
+
+	// bob 离线期间收到超过一批的消息，已投递过的不再补发
+	store(true)
+	var want []int64
+	for i := 0; i < pendingBatchSize+20; i++ {
+		want = append(want, store(false).ID)
+	}
+
+	server, conn := connPair(t)
+	c := &Client{UID: "bob", Username: "bob", SessionID: "b1", id: utils.NextID(), hub: h, conn: server, send: make(chan []byte, sendBuffer)}
+	if !h.register(c) {
+		t.Fatal("register refused")
+	}
+	// 注册之后保存的消息，发送者已经放进了发送队列
+	live := store(false)
+	if n := h.send([]string{"bob"}, messageEnvelope(live), nil); n != 1 {
+		t.Fatalf("live message sent to %d clients, want 1", n)
+	}
+	want = append(want, live.ID)
+
+	if err = h.deliverPending(c); err != nil {
+		t.Fatalf("deliverPending: %v", err)
+	}
+	go c.writePump()
+	h.SendToUser("bob", Envelope{Type: TypeTyping, Content: "stop"})
+
+	var got []int64
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var env Envelope
+		if err = conn.ReadJSON(&env); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if env.Type == TypeTyping {
+			break
+		}
+		got = append(got, env.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bob got %d messages %v, want each of the %d once in order %v", len(got), got, len(want), want)
+	}
+
+	var undelivered int64
+	if err = db.Model(new(model.ChatMessage)).Where("delivered_at = 0 AND id != ?", live.ID).Count(&undelivered).Error; err != nil || undelivered != 0 {
+		t.Fatalf("%d pending messages not marked delivered, %v", undelivered, err)
+	}
+}
@@ -0,0 +1,528 @@
+package imsystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+	"v1/pkg/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	storeTimeout = 10 * time.Second
+	// 上线时补发离线消息，每批条数和最多批数
+	pendingBatchSize  = 100
+	maxPendingBatches = 50
+)
+
+// ErrNotInConversation the user is not a member of the conversation
+var ErrNotInConversation = errors.New("not in the conversation")
+
+// HandlerFunc handles an envelope of one type sent by the client
+type HandlerFunc func(h *Hub, c *Client, env Envelope)
+
+// Hub keeps the websocket clients connected to this instance, a user may have several (tabs, devices).
+// What is sent to users connected to other instances goes through the backplane
+type Hub struct {
+	id        string
+	db        *gorm.DB
+	backplane Backplane
+
+	mu       sync.RWMutex
+	clients  map[string]map[*Client]struct{} // uid -> clients
+	handlers map[string]HandlerFunc
+	closed   bool
+}
+
+// NewHub returns a hub that stores the messages in db and reaches the other instances through the backplane.
+// The hub closes the backplane when it closes
+func NewHub(db *gorm.DB, backplane Backplane) (*Hub, error) {
+	h := &Hub{
+		id:        utils.NextID(),
+		db:        db,
+		backplane: backplane,
+		clients:   make(map[string]map[*Client]struct{}),
+		handlers:  make(map[string]HandlerFunc),
+	}
+	h.Handle(TypeMessage, handlePrivateMessage)
+	h.Handle(TypeRoomMessage, handleRoomMessage)
+	h.Handle(TypeRead, handleRead)
+	h.Handle(TypePresence, handlePresence)
+	h.Handle(TypeTyping, handleTyping)
+
+	if err := backplane.Subscribe(h.receive); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+var defaultHub *Hub
+
+// SetDefault sets the hub used by the handlers
+func SetDefault(h *Hub) {
+	if h != nil {
+		defaultHub = h
+	}
+}
+
+func Default() *Hub {
+	return defaultHub
+}
+
+// DisconnectSession closes the chat connections of the session on the default hub, all of the user if sessionID is empty.
+// The revoked sessions call it, the hub doesn't check the token again once connected
+func DisconnectSession(uid, sessionID string) {
+	if defaultHub != nil {
+		defaultHub.DisconnectSession(uid, sessionID)
+	}
+}
+
+// Handle registers the handler of the envelope type, replacing the existing one
+func (h *Hub) Handle(typ string, fn HandlerFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[typ] = fn
+}
+
+// register adds the client and records the latest message at that moment in c.pendingUpTo:
+// the messages after it are sent to the client by their senders, deliverPending only delivers those before it
+func (h *Hub) register(c *Client) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return false
+	}
+	// 持有写锁时没有发送在进行，之后保存的消息发送时一定能找到这个客户端
+	upTo, err := dao.LatestChatMessageID(ctx, h.db)
+	if err != nil {
+		h.mu.Unlock()
+		zap.L().Error("dao.LatestChatMessageID", zap.String("uid", c.UID), zap.Error(err))
+		return false
+	}
+	c.pendingUpTo = upTo
+	if h.clients[c.UID] == nil {
+		h.clients[c.UID] = make(map[*Client]struct{})
+	}
+	h.clients[c.UID][c] = struct{}{}
+	h.mu.Unlock()
+
+	if err = h.backplane.Connect(ctx, c.UID, c.id); err != nil {
+		zap.L().Error("backplane.Connect", zap.String("uid", c.UID), zap.Error(err))
+	}
+	return true
+}
+
+// unregister removes the client and closes its send channel, it is safe to call more than once
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	clients, ok := h.clients[c.UID]
+	if ok {
+		_, ok = clients[c]
+	}
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(clients, c)
+	if len(clients) == 0 {
+		delete(h.clients, c.UID)
+	}
+	close(c.send)
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := h.backplane.Disconnect(ctx, c.UID, c.id); err != nil {
+		zap.L().Error("backplane.Disconnect", zap.String("uid", c.UID), zap.Error(err))
+	}
+	if err := dao.UpdateUserLastSeen(ctx, h.db, c.UID, time.Now().UnixMilli()); err != nil {
+		zap.L().Error("dao.UpdateUserLastSeen", zap.String("uid", c.UID), zap.Error(err))
+	}
+}
+
+// SendToUser sends the envelope to every client of the user on every instance
+func (h *Hub) SendToUser(uid string, env Envelope) {
+	h.send([]string{uid}, env, nil)
+}
+
+// send sends the envelope to the clients of the users except skip, and publishes it to the other instances.
+// It returns how many clients on this instance got it
+func (h *Hub) send(uids []string, env Envelope, skip *Client) int {
+	b, err := json.Marshal(env)
+	if err != nil {
+		zap.L().Error("json.Marshal", zap.Error(err))
+		return 0
+	}
+
+	var skipID string
+	if skip != nil {
+		skipID = skip.id
+	}
+	sent := h.sendLocal(uids, b, skipID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	err = h.backplane.Publish(ctx, Delivery{Origin: h.id, UIDs: uids, Envelope: &env, Skip: skipID})
+	if err != nil {
+		zap.L().Error("backplane.Publish", zap.Error(err))
+	}
+	return sent
+}
+
+// sendLocal queues the frame to the clients of the users on this instance except the client skip
+func (h *Hub) sendLocal(uids []string, b []byte, skip string) int {
+	h.mu.RLock()
+	var slow []*Client
+	sent := 0
+	for _, uid := range uids {
+		for c := range h.clients[uid] {
+			if skip != "" && c.id == skip {
+				continue
+			}
+			select {
+			case c.send <- b:
+				sent++
+			default:
+				// 发送缓冲已满，断开跟不上的客户端
+				slow = append(slow, c)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range slow {
+		zap.L().Info("chat client too slow, disconnected", zap.String("uid", c.UID))
+		h.unregister(c)
+	}
+	return sent
+}
+
+// receive handles the deliveries published by the hubs of the other instances
+func (h *Hub) receive(d Delivery) {
+	if d.Origin == h.id {
+		return
+	}
+
+	if d.Disconnect {
+		for _, uid := range d.UIDs {
+			h.disconnectLocal(uid, d.SessionID)
+		}
+		return
+	}
+	if d.Envelope == nil {
+		return
+	}
+
+	b, err := json.Marshal(d.Envelope)
+	if err != nil {
+		zap.L().Error("json.Marshal", zap.Error(err))
+		return
+	}
+	sent := h.sendLocal(d.UIDs, b, d.Skip)
+
+	// 私聊消息的接收者连在本实例上，由本实例记录投递
+	if sent > 0 && d.Envelope.Type == TypeMessage && d.Envelope.ID > 0 && h.localOnline(d.Envelope.To) {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancel()
+		if err = dao.MarkChatMessagesDelivered(ctx, h.db, []int64{d.Envelope.ID}); err != nil {
+			zap.L().Error("dao.MarkChatMessagesDelivered", zap.Error(err))
+		}
+	}
+}
+
+func (h *Hub) localOnline(uid string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[uid]) > 0
+}
+
+// DisconnectSession closes the clients of the user connected with tokens of the session on every instance,
+// all of them if sessionID is empty
+func (h *Hub) DisconnectSession(uid, sessionID string) {
+	h.disconnectLocal(uid, sessionID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	err := h.backplane.Publish(ctx, Delivery{Origin: h.id, UIDs: []string{uid}, Disconnect: true, SessionID: sessionID})
+	if err != nil {
+		zap.L().Error("backplane.Publish", zap.Error(err))
+	}
+}
+
+func (h *Hub) disconnectLocal(uid, sessionID string) {
+	h.mu.RLock()
+	var clients []*Client
+	for c := range h.clients[uid] {
+		if sessionID == "" || c.SessionID == sessionID {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range clients {
+		h.unregister(c)
+	}
+}
+
+// Close disconnects all the clients, refuses new ones and closes the backplane
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	var clients []*Client
+	for _, cs := range h.clients {
+		for c := range cs {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		h.unregister(c)
+	}
+	if err := h.backplane.Close(); err != nil {
+		zap.L().Error("backplane.Close", zap.Error(err))
+	}
+}
+
+func (h *Hub) dispatch(c *Client, env Envelope) {
+	h.mu.RLock()
+	fn, ok := h.handlers[env.Type]
+	h.mu.RUnlock()
+
+	if !ok {
+		c.Send(errorEnvelope(env.ClientID, "unknown message type"))
+		return
+	}
+	fn(h, c, env)
+}
+
+func handlePrivateMessage(h *Hub, c *Client, env Envelope) {
+	if env.To == "" || env.Content == "" {
+		c.Send(errorEnvelope(env.ClientID, "to and content are required"))
+		return
+	}
+	if len(env.Content) > MaxContentLength {
+		c.Send(errorEnvelope(env.ClientID, "content too long"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	found, _, err := dao.GetUserByUID(ctx, h.db, env.To)
+	if err != nil || !found {
+		c.Send(errorEnvelope(env.ClientID, "user not found"))
+		return
+	}
+
+	// 先保存，接收者不在线时上线后投递
+	msg := model.ChatMessage{
+		ConversationID: model.PrivateConversationID(c.UID, env.To),
+		SenderUID:      c.UID,
+		RecipientUID:   env.To,
+		Content:        env.Content,
+	}
+	if err = dao.InsertChatMessage(ctx, h.db, &msg); err != nil {
+		zap.L().Error("dao.InsertChatMessage", zap.Error(err))
+		c.Send(errorEnvelope(env.ClientID, "internal server error"))
+		return
+	}
+
+	out := messageEnvelope(msg)
+	delivered := h.send([]string{env.To}, out, nil) > 0
+	if delivered {
+		if err = dao.MarkChatMessagesDelivered(ctx, h.db, []int64{msg.ID}); err != nil {
+			zap.L().Error("dao.MarkChatMessagesDelivered", zap.Error(err))
+		}
+	} else if online, err := h.Online(ctx, env.To); err == nil {
+		// 接收者连在其他实例上，由那个实例记录投递
+		delivered = online[env.To]
+	}
+
+	// 同一用户的其他客户端同步这条消息
+	if env.To != c.UID {
+		h.send([]string{c.UID}, out, c)
+	}
+	c.Send(Envelope{Type: TypeAck, ID: msg.ID, ClientID: env.ClientID, Conversation: msg.ConversationID,
+		CreatedAt: msg.CreatedAt, Delivered: delivered})
+}
+
+func handleRead(h *Hub, c *Client, env Envelope) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	_, err := h.MarkRead(ctx, c.UID, env.Conversation, env.ID)
+	if errors.Is(err, ErrNotInConversation) {
+		c.Send(errorEnvelope(env.ClientID, err.Error()))
+	} else if err != nil {
+		c.Send(errorEnvelope(env.ClientID, "internal server error"))
+	}
+}
+
+// MarkRead marks the conversation read by the user up to the message id, 0 for all,
+// and sends the read receipt to the other user of a private conversation
+func (h *Hub) MarkRead(ctx context.Context, uid, conversationID string, upTo int64) (int64, error) {
+	if roomID, ok := model.RoomOfConversation(conversationID); ok {
+		return h.markRoomRead(ctx, uid, roomID, upTo)
+	}
+
+	a, b, ok := model.PrivateConversationMembers(conversationID)
+	if !ok || (uid != a && uid != b) {
+		return 0, ErrNotInConversation
+	}
+
+	n, err := dao.MarkConversationRead(ctx, h.db, conversationID, uid, upTo)
+	if err != nil {
+		zap.L().Error("dao.MarkConversationRead", zap.Error(err))
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	peer := a
+	if peer == uid {
+		peer = b
+	}
+	receipt := Envelope{Type: TypeRead, ID: upTo, Conversation: conversationID, From: uid, CreatedAt: time.Now().UnixMilli()}
+	h.SendToUser(peer, receipt)
+	// 自己的其他客户端同步未读数
+	h.SendToUser(uid, receipt)
+	return n, nil
+}
+
+// markRoomRead moves the read cursor of the member, only its own clients get the receipt
+func (h *Hub) markRoomRead(ctx context.Context, uid string, roomID, upTo int64) (int64, error) {
+	found, _, err := dao.GetChatRoomMember(ctx, h.db, roomID, uid)
+	if err != nil {
+		zap.L().Error("dao.GetChatRoomMember", zap.Error(err))
+		return 0, err
+	}
+	if !found {
+		return 0, ErrNotInConversation
+	}
+
+	moved, err := dao.MarkRoomRead(ctx, h.db, roomID, uid, upTo)
+	if err != nil {
+		zap.L().Error("dao.MarkRoomRead", zap.Error(err))
+		return 0, err
+	}
+	if !moved {
+		return 0, nil
+	}
+
+	h.SendToUser(uid, Envelope{Type: TypeRead, ID: upTo, Conversation: model.RoomConversationID(roomID), From: uid,
+		CreatedAt: time.Now().UnixMilli()})
+	return 1, nil
+}
+
+func handleRoomMessage(h *Hub, c *Client, env Envelope) {
+	roomID, ok := model.RoomOfConversation(env.Conversation)
+	if !ok || env.Content == "" {
+		c.Send(errorEnvelope(env.ClientID, "conversation and content are required"))
+		return
+	}
+	if len(env.Content) > MaxContentLength {
+		c.Send(errorEnvelope(env.ClientID, "content too long"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	found, member, err := dao.GetChatRoomMember(ctx, h.db, roomID, c.UID)
+	if err != nil {
+		zap.L().Error("dao.GetChatRoomMember", zap.Error(err))
+		c.Send(errorEnvelope(env.ClientID, "internal server error"))
+		return
+	}
+	if !found {
+		c.Send(errorEnvelope(env.ClientID, ErrNotInConversation.Error()))
+		return
+	}
+	if member.Muted(time.Now().UnixMilli()) {
+		c.Send(errorEnvelope(env.ClientID, "muted in the room"))
+		return
+	}
+
+	msg := model.ChatMessage{
+		ConversationID: env.Conversation,
+		SenderUID:      c.UID,
+		Content:        env.Content,
+	}
+	if err = dao.InsertChatMessage(ctx, h.db, &msg); err != nil {
+		zap.L().Error("dao.InsertChatMessage", zap.Error(err))
+		c.Send(errorEnvelope(env.ClientID, "internal server error"))
+		return
+	}
+
+	// 群消息不逐条记录投递，离线成员按已读游标翻页补看
+	if err = h.sendToRoom(ctx, roomID, messageEnvelope(msg), c); err != nil {
+		zap.L().Error("send to room", zap.Int64("room_id", roomID), zap.Error(err))
+	}
+	c.Send(Envelope{Type: TypeAck, ID: msg.ID, ClientID: env.ClientID, Conversation: msg.ConversationID, CreatedAt: msg.CreatedAt})
+}
+
+// sendToRoom sends the envelope to the online members of the room except skip
+func (h *Hub) sendToRoom(ctx context.Context, roomID int64, env Envelope, skip *Client) error {
+	uids, err := dao.ActiveRoomMemberUIDs(ctx, h.db, roomID)
+	if err != nil {
+		return err
+	}
+	h.send(uids, env, skip)
+	return nil
+}
+
+// NotifyRoom sends the room event about the member to everyone in the room, and to the member who may have just left it
+func (h *Hub) NotifyRoom(ctx context.Context, roomID int64, actor, member, event string) {
+	env := Envelope{Type: TypeRoomEvent, Conversation: model.RoomConversationID(roomID), From: actor, To: member,
+		Content: event, CreatedAt: time.Now().UnixMilli()}
+	if err := h.sendToRoom(ctx, roomID, env, nil); err != nil {
+		zap.L().Error("send to room", zap.Int64("room_id", roomID), zap.Error(err))
+	}
+	if event == RoomEventKicked {
+		h.SendToUser(member, env)
+	}
+}
+
+// deliverPending writes the messages sent while the user was offline straight to the connection,
+// before the write pump starts so nothing else writes to it. The client must be registered,
+// the messages stored after the registration are already in its send queue and skipped here
+func (h *Hub) deliverPending(c *Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	for i := 0; i < maxPendingBatches; i++ {
+		messages, err := dao.ListUndeliveredChatMessages(ctx, h.db, c.UID, c.pendingUpTo, pendingBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, 0, len(messages))
+		for _, msg := range messages {
+			if err = c.write(messageEnvelope(msg)); err != nil {
+				return err
+			}
+			ids = append(ids, msg.ID)
+		}
+		if err = dao.MarkChatMessagesDelivered(ctx, h.db, ids); err != nil {
+			return err
+		}
+		if len(messages) < pendingBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
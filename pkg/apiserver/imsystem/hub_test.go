@@ -0,0 +1,273 @@
+package imsystem
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"v1/pkg/model"
+	"v1/pkg/token"
+
+	"github.com/gorilla/websocket"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	// 两个 hub 的连接并发写同一个库，sqlite 只允许一个写者
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	if err = db.AutoMigrate(new(model.User), new(model.ChatMessage), new(model.ChatRoom), new(model.ChatRoomMember)); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	return db
+}
+
+// instance is a hub with its own websocket endpoint, as one api server instance
+type instance struct {
+	hub    *Hub
+	server *httptest.Server
+}
+
+// newInstance serves the hub at a url taking the user from the query: ?uid=&username=&session=
+func newInstance(t *testing.T, db *gorm.DB, backplane Backplane) *instance {
+	t.Helper()
+
+	h, err := NewHub(db, backplane)
+	if err != nil {
+		t.Fatalf("NewHub: %v", err)
+	}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		q := r.URL.Query()
+		ServeConn(h, conn, token.Payload{UID: q.Get("uid"), Username: q.Get("username"), SessionID: q.Get("session")})
+	}))
+	t.Cleanup(func() {
+		h.Close()
+		server.Close()
+	})
+	return &instance{hub: h, server: server}
+}
+
+// connect dials the instance as the user and waits until the hub has registered the client
+func (in *instance) connect(t *testing.T, uid, sessionID string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(in.server.URL, "http") + "?uid=" + uid + "&username=" + uid + "&session=" + sessionID
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	eventually(t, func() bool {
+		in.hub.mu.RLock()
+		defer in.hub.mu.RUnlock()
+		for c := range in.hub.clients[uid] {
+			if c.SessionID == sessionID {
+				return true
+			}
+		}
+		return false
+	}, "%s of session %s not registered", uid, sessionID)
+	return conn
+}
+
+func eventually(t *testing.T, cond func() bool, format string, args ...any) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expect reads the connection until an envelope of the type arrives, skipping the others
+func expect(t *testing.T, conn *websocket.Conn, typ string) Envelope {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var env Envelope
+		if err := conn.ReadJSON(&env); err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		if env.Type == typ {
+			return env
+		}
+	}
+}
+
+// expectClosed reads the connection until the server closes it
+func expectClosed(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				t.Fatal("connection still open")
+			}
+			return
+		}
+	}
+}
+
+func presenceOf(t *testing.T, h *Hub, uids ...string) map[string]PresenceStatus {
+	t.Helper()
+	presence, err := h.Presence(context.Background(), uids...)
+	if err != nil {
+		t.Fatalf("Presence: %v", err)
+	}
+	status := make(map[string]PresenceStatus, len(presence))
+	for _, p := range presence {
+		status[p.UID] = p.Status
+	}
+	return status
+}
+
+func TestHubsShareBackplane(t *testing.T) {
+	db := newTestDB(t)
+	for _, uid := range []string{"alice", "bob"} {
+		if err := db.Create(&model.User{UID: uid, Username: uid, Status: model.UserStatusNormal}).Error; err != nil {
+			t.Fatalf("create %s: %v", uid, err)
+		}
+	}
+	// 两个实例共用一个 backplane
+	backplane := NewMemoryBackplane()
+	in1, in2 := newInstance(t, db, backplane), newInstance(t, db, backplane)
+
+	alice := in1.connect(t, "alice", "a1")
+	bob := in2.connect(t, "bob", "b1")
+
+	// 在线状态在所有实例上一致
+	for i, h := range []*Hub{in1.hub, in2.hub} {
+		status := presenceOf(t, h, "alice", "bob", "carol")
+		if status["alice"] != PresenceOnline || status["bob"] != PresenceOnline || status["carol"] != PresenceOffline {
+			t.Fatalf("presence on hub %d = %v", i+1, status)
+		}
+	}
+
+	// 私聊消息经 backplane 到达另一个实例上的接收者
+	if err := alice.WriteJSON(Envelope{Type: TypeMessage, To: "bob", Content: "hello", ClientID: "m1"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	msg := expect(t, bob, TypeMessage)
+	if msg.From != "alice" || msg.Content != "hello" || msg.ID == 0 || msg.Conversation != model.PrivateConversationID("alice", "bob") {
+		t.Fatalf("bob got %+v", msg)
+	}
+	ack := expect(t, alice, TypeAck)
+	if ack.ClientID != "m1" || ack.ID != msg.ID || !ack.Delivered {
+		t.Fatalf("alice got ack %+v, want delivered message %d", ack, msg.ID)
+	}
+	var stored model.ChatMessage
+	if err := db.First(&stored, msg.ID).Error; err != nil || stored.DeliveredAt == 0 {
+		t.Fatalf("stored message %+v, %v, want it delivered", stored, err)
+	}
+
+	// 已读回执回到发送者所在的实例
+	if err := bob.WriteJSON(Envelope{Type: TypeRead, Conversation: msg.Conversation, ID: msg.ID}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if receipt := expect(t, alice, TypeRead); receipt.From != "bob" || receipt.ID != msg.ID {
+		t.Fatalf("alice got receipt %+v", receipt)
+	}
+
+	if err := bob.WriteJSON(Envelope{Type: TypePresence, Content: "away"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	eventually(t, func() bool { return presenceOf(t, in1.hub, "bob")["bob"] == PresenceAway }, "bob not away on hub 1")
+
+	// bob 在实例 1 上有另一个会话，恢复为在线
+	bobOther := in1.connect(t, "bob", "b2")
+	if status := presenceOf(t, in2.hub, "bob"); status["bob"] != PresenceOnline {
+		t.Fatalf("bob with an active client = %v, want online", status)
+	}
+
+	// 在实例 1 上注销会话 b1，实例 2 上的连接被关闭，其他会话不受影响
+	in1.hub.DisconnectSession("bob", "b1")
+	expectClosed(t, bob)
+	if online, _ := in2.hub.Online(context.Background(), "bob"); !online["bob"] {
+		t.Fatal("bob offline with session b2 still connected")
+	}
+	if err := alice.WriteJSON(Envelope{Type: TypeMessage, To: "bob", Content: "still there?", ClientID: "m2"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if msg = expect(t, bobOther, TypeMessage); msg.Content != "still there?" {
+		t.Fatalf("bob got %+v", msg)
+	}
+	if ack = expect(t, alice, TypeAck); ack.ClientID != "m2" || !ack.Delivered {
+		t.Fatalf("alice got ack %+v", ack)
+	}
+
+	// 在实例 2 上注销所有会话
+	in2.hub.DisconnectSession("bob", "")
+	expectClosed(t, bobOther)
+	eventually(t, func() bool { return presenceOf(t, in1.hub, "bob")["bob"] == PresenceOffline }, "bob still present on hub 1")
+	presence, err := in2.hub.Presence(context.Background(), "bob")
+	if err != nil || presence[0].LastSeen == 0 {
+		t.Fatalf("presence %+v, %v, want the last seen time", presence, err)
+	}
+
+	// 接收者离线时消息保存但未投递
+	if err = alice.WriteJSON(Envelope{Type: TypeMessage, To: "bob", Content: "bye", ClientID: "m3"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if ack = expect(t, alice, TypeAck); ack.ClientID != "m3" || ack.Delivered {
+		t.Fatalf("alice got ack %+v, want undelivered", ack)
+	}
+
+	// 重新连接到任一实例时补发
+	bob = in1.connect(t, "bob", "b3")
+	if msg = expect(t, bob, TypeMessage); msg.Content != "bye" || msg.ID != ack.ID {
+		t.Fatalf("bob got %+v, want the pending message", msg)
+	}
+}
+
+func TestDisconnectSessionOfDefaultHub(t *testing.T) {
+	// 聊天未启动时什么也不做
+	old := defaultHub
+	defaultHub = nil
+	t.Cleanup(func() { defaultHub = old })
+	DisconnectSession("alice", "")
+
+	db := newTestDB(t)
+	if err := db.Create(&model.User{UID: "alice", Username: "alice", Status: model.UserStatusNormal}).Error; err != nil {
+		t.Fatalf("create alice: %v", err)
+	}
+	backplane := NewMemoryBackplane()
+	in1, in2 := newInstance(t, db, backplane), newInstance(t, db, backplane)
+	SetDefault(in1.hub)
+
+	a1 := in1.connect(t, "alice", "a1")
+	a2 := in2.connect(t, "alice", "a2")
+	a3 := in2.connect(t, "alice", "a3")
+
+	// 注销一个会话
+	DisconnectSession("alice", "a2")
+	expectClosed(t, a2)
+	if !in2.hub.localOnline("alice") {
+		t.Fatal("session a3 disconnected with a2")
+	}
+
+	// 停用、强制下线和改密码注销所有会话
+	DisconnectSession("alice", "")
+	expectClosed(t, a1)
+	expectClosed(t, a3)
+	eventually(t, func() bool { return presenceOf(t, in2.hub, "alice")["alice"] == PresenceOffline }, "alice still present")
+}
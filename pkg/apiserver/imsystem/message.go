@@ -0,0 +1,59 @@
+package imsystem
+
+import "v1/pkg/model"
+
+// types of the envelopes
+const (
+	TypeMessage     = "message"      // 私聊消息，客户端发送时只需 to、content 和 client_id
+	TypeRoomMessage = "room_message" // 群消息，客户端发送时只需 conversation、content 和 client_id
+	TypeRoomEvent   = "room_event"   // 群成员变动，content 为事件，to 为被操作的成员
+	TypeAck         = "ack"          // 服务端确认收到并保存了客户端的消息
+	TypeRead        = "read"         // 客户端标记会话已读到 id；私聊中服务端据此向对方发送已读回执
+	TypeTyping      = "typing"       // 正在输入，content 为 start 或 stop，转发给会话中的其他人，不保存
+	TypePresence    = "presence"     // 客户端报告空闲或恢复，content 为 away 或 online
+	TypeError       = "error"
+)
+
+// events of the room_event envelopes
+const (
+	RoomEventMuted   = "muted"
+	RoomEventUnmuted = "unmuted"
+	RoomEventKicked  = "kicked"
+)
+
+// MaxContentLength is the longest message content in bytes
+const MaxContentLength = 4000
+
+// Envelope is the JSON frame sent both ways over the websocket
+type Envelope struct {
+	Type         string `json:"type"`
+	ID           int64  `json:"id,omitempty"`           // 消息id，客户端据此去重；已读回执中为已读到的消息id
+	ClientID     string `json:"client_id,omitempty"`    // 客户端生成，ack 时原样返回
+	Conversation string `json:"conversation,omitempty"` // 会话id，由服务端填写
+	From         string `json:"from,omitempty"`         // 发送者uid，由服务端填写
+	To           string `json:"to,omitempty"`           // 接收者uid，群消息为空
+	Content      string `json:"content,omitempty"`
+	CreatedAt    int64  `json:"created_at,omitempty"` // unix milli
+	Delivered    bool   `json:"delivered,omitempty"`  // ack 中表示接收者在线并已收到
+	Error        string `json:"error,omitempty"`
+}
+
+func errorEnvelope(clientID, msg string) Envelope {
+	return Envelope{Type: TypeError, ClientID: clientID, Error: msg}
+}
+
+func messageEnvelope(msg model.ChatMessage) Envelope {
+	typ := TypeMessage
+	if msg.RecipientUID == "" {
+		typ = TypeRoomMessage
+	}
+	return Envelope{
+		Type:         typ,
+		ID:           msg.ID,
+		Conversation: msg.ConversationID,
+		From:         msg.SenderUID,
+		To:           msg.RecipientUID,
+		Content:      msg.Content,
+		CreatedAt:    msg.CreatedAt,
+	}
+}
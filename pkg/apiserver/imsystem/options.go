@@ -0,0 +1,101 @@
+package imsystem
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	chatBackplane     = "chat-backplane"
+	chatRedisAddr     = "chat-redis-addr"
+	chatRedisPassword = "chat-redis-password"
+	chatRedisDB       = "chat-redis-db"
+
+	BackplaneMemory = "memory"
+	BackplaneRedis  = "redis"
+)
+
+type Options struct {
+	// memory only reaches the users connected to this instance.
+	// redis lets the users connected to different instances talk to each other and shares their presence
+	Backplane     string
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	v             *viper.Viper
+}
+
+func NewChatOptions() *Options {
+	o := &Options{
+		Backplane: BackplaneMemory,
+		RedisAddr: "localhost:6379",
+		v:         viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.Backplane = o.v.GetString(chatBackplane)
+	o.RedisAddr = o.v.GetString(chatRedisAddr)
+	o.RedisPassword = o.v.GetString(chatRedisPassword)
+	o.RedisDB = o.v.GetInt(chatRedisDB)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	switch o.Backplane {
+	case BackplaneMemory:
+	case BackplaneRedis:
+		if o.RedisAddr == "" {
+			errors = append(errors, fmt.Errorf("chat redis addr is empty"))
+		}
+		if o.RedisDB < 0 {
+			errors = append(errors, fmt.Errorf("chat redis db is invalid"))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("chat backplane must be %s or %s", BackplaneMemory, BackplaneRedis))
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Backplane, chatBackplane, o.Backplane, "memory or redis, redis is required to run more than one instance. env CHAT_BACKPLANE")
+	fs.StringVar(&o.RedisAddr, chatRedisAddr, o.RedisAddr, "host:port of the redis carrying the chat between instances. env CHAT_REDIS_ADDR")
+	fs.StringVar(&o.RedisPassword, chatRedisPassword, o.RedisPassword, "env CHAT_REDIS_PASSWORD")
+	fs.IntVar(&o.RedisDB, chatRedisDB, o.RedisDB, "env CHAT_REDIS_DB")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewBackplane creates the backplane of the configured type
+func (o *Options) NewBackplane() (Backplane, error) {
+	if o.Backplane != BackplaneRedis {
+		return NewMemoryBackplane(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	backplane, err := NewRedisBackplane(ctx, &redis.Options{
+		Addr:     o.RedisAddr,
+		Password: o.RedisPassword,
+		DB:       o.RedisDB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis %s: %w", o.RedisAddr, err)
+	}
+	return backplane, nil
+}
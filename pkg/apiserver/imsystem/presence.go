@@ -0,0 +1,147 @@
+package imsystem
+
+import (
+	"context"
+	"time"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+
+	"go.uber.org/zap"
+)
+
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away" // 已连接，但所有客户端都报告空闲
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// contents of the presence envelopes sent by the client
+const (
+	presenceAway   = "away"
+	presenceActive = "online"
+)
+
+// contents of the typing envelopes
+const (
+	TypingStart = "start"
+	TypingStop  = "stop"
+)
+
+// Presence is whether the user is connected to the chat on any instance, and when it was last
+type Presence struct {
+	UID      string
+	Status   PresenceStatus
+	LastSeen int64 // unix milli，在线时为当前时间
+}
+
+// Presence returns the presence of the users, in the order of uids
+func (h *Hub) Presence(ctx context.Context, uids ...string) ([]Presence, error) {
+	status, err := h.backplane.Status(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+	lastSeen, err := dao.GetUsersLastSeen(ctx, h.db, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	presence := make([]Presence, 0, len(uids))
+	for _, uid := range uids {
+		p := Presence{UID: uid, Status: status[uid], LastSeen: lastSeen[uid]}
+		if p.Status != PresenceOffline {
+			p.LastSeen = now
+		}
+		presence = append(presence, p)
+	}
+	return presence, nil
+}
+
+// Online reports which of the users have a client connected to any instance, away or not
+func (h *Hub) Online(ctx context.Context, uids ...string) (map[string]bool, error) {
+	status, err := h.backplane.Status(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	online := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		online[uid] = status[uid] != PresenceOffline
+	}
+	return online, nil
+}
+
+// handlePresence marks the client away or back, content is "away" or "online"
+func handlePresence(h *Hub, c *Client, env Envelope) {
+	if env.Content != presenceAway && env.Content != presenceActive {
+		c.Send(errorEnvelope(env.ClientID, "content must be away or online"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := h.backplane.SetAway(ctx, c.UID, c.id, env.Content == presenceAway); err != nil {
+		zap.L().Error("backplane.SetAway", zap.String("uid", c.UID), zap.Error(err))
+		c.Send(errorEnvelope(env.ClientID, "internal server error"))
+	}
+}
+
+// handleTyping forwards the typing indicator to the others in the conversation, it is not stored.
+// Clients send start every few seconds while typing and stop when done
+func handleTyping(h *Hub, c *Client, env Envelope) {
+	if env.Content == "" {
+		env.Content = TypingStart
+	}
+	if env.Content != TypingStart && env.Content != TypingStop {
+		c.Send(errorEnvelope(env.ClientID, "content must be start or stop"))
+		return
+	}
+
+	out := Envelope{Type: TypeTyping, Conversation: env.Conversation, From: c.UID, Content: env.Content,
+		CreatedAt: time.Now().UnixMilli()}
+
+	if a, b, ok := model.PrivateConversationMembers(env.Conversation); ok {
+		if c.UID != a && c.UID != b {
+			c.Send(errorEnvelope(env.ClientID, ErrNotInConversation.Error()))
+			return
+		}
+		peer := a
+		if peer == c.UID {
+			peer = b
+		}
+		h.send([]string{peer}, out, nil)
+		return
+	}
+
+	roomID, ok := model.RoomOfConversation(env.Conversation)
+	if !ok {
+		c.Send(errorEnvelope(env.ClientID, "conversation is required"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	uids, err := dao.ActiveRoomMemberUIDs(ctx, h.db, roomID)
+	if err != nil {
+		zap.L().Error("dao.ActiveRoomMemberUIDs", zap.Error(err))
+		c.Send(errorEnvelope(env.ClientID, "internal server error"))
+		return
+	}
+
+	others := make([]string, 0, len(uids))
+	member := false
+	for _, uid := range uids {
+		if uid == c.UID {
+			member = true
+		} else {
+			others = append(others, uid)
+		}
+	}
+	if !member {
+		c.Send(errorEnvelope(env.ClientID, ErrNotInConversation.Error()))
+		return
+	}
+	h.send(others, out, nil)
+}
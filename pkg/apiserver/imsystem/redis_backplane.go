@@ -0,0 +1,249 @@
+package imsystem
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	deliveryChannel   = "chat:deliveries"
+	presenceKeyPrefix = "chat:presence:"
+	// 每个实例定期刷新本实例上连接的过期时间，实例宕机后其连接在 presenceTTL 内失效
+	presenceTTL       = 90 * time.Second
+	heartbeatPeriod   = 30 * time.Second
+	backplaneTimeout  = 5 * time.Second
+	presenceBatchSize = 500
+	awaySuffix        = ":away"
+)
+
+// redisBackplane connects the hubs of all the instances through redis pub/sub.
+// The presence of a user is a hash of its connections, each with the time it expires and whether it is away
+type redisBackplane struct {
+	client *redis.Client
+
+	mu          sync.Mutex
+	connections map[string]map[string]bool // 本实例上 uid -> client id -> away
+	pubsub      *redis.PubSub
+	stop        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewRedisBackplane connects to redis and checks the connection
+func NewRedisBackplane(ctx context.Context, options *redis.Options) (Backplane, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	b := &redisBackplane{
+		client:      client,
+		connections: make(map[string]map[string]bool),
+		stop:        make(chan struct{}),
+	}
+	go b.heartbeat()
+	return b, nil
+}
+
+func (b *redisBackplane) Publish(ctx context.Context, d Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, deliveryChannel, data).Err()
+}
+
+func (b *redisBackplane) Subscribe(fn func(Delivery)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backplaneTimeout)
+	defer cancel()
+
+	pubsub := b.client.Subscribe(ctx, deliveryChannel)
+	// 等待订阅确认，之后发布的都能收到
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return err
+	}
+
+	b.mu.Lock()
+	b.pubsub = pubsub
+	b.mu.Unlock()
+
+	go func() {
+		// Channel 在 pubsub 关闭后关闭，断线时 go-redis 自动重连并重新订阅
+		for msg := range pubsub.Channel() {
+			var d Delivery
+			if err := json.Unmarshal([]byte(msg.Payload), &d); err != nil {
+				zap.L().Error("json.Unmarshal chat delivery", zap.Error(err))
+				continue
+			}
+			fn(d)
+		}
+	}()
+	return nil
+}
+
+func presenceKey(uid string) string {
+	return presenceKeyPrefix + uid
+}
+
+// presenceEntry is a connection on this instance
+type presenceEntry struct {
+	uid      string
+	clientID string
+	away     bool
+}
+
+// refresh extends the presence of the connections on this instance
+func (b *redisBackplane) refresh(ctx context.Context, entries []presenceEntry) error {
+	expires := strconv.FormatInt(time.Now().Add(presenceTTL).UnixMilli(), 10)
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, entry := range entries {
+			value := expires
+			if entry.away {
+				value += awaySuffix
+			}
+			pipe.HSet(ctx, presenceKey(entry.uid), entry.clientID, value)
+			pipe.Expire(ctx, presenceKey(entry.uid), presenceTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+func (b *redisBackplane) Connect(ctx context.Context, uid, clientID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.connections[uid] == nil {
+		b.connections[uid] = make(map[string]bool)
+	}
+	b.connections[uid][clientID] = false
+	return b.refresh(ctx, []presenceEntry{{uid: uid, clientID: clientID}})
+}
+
+func (b *redisBackplane) Disconnect(ctx context.Context, uid, clientID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.connections[uid], clientID)
+	if len(b.connections[uid]) == 0 {
+		delete(b.connections, uid)
+	}
+	return b.client.HDel(ctx, presenceKey(uid), clientID).Err()
+}
+
+func (b *redisBackplane) SetAway(ctx context.Context, uid, clientID string, away bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.connections[uid][clientID]; !ok {
+		return nil
+	}
+	b.connections[uid][clientID] = away
+	return b.refresh(ctx, []presenceEntry{{uid: uid, clientID: clientID, away: away}})
+}
+
+func (b *redisBackplane) Status(ctx context.Context, uids []string) (map[string]PresenceStatus, error) {
+	cmds := make([]*redis.StringSliceCmd, len(uids))
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, uid := range uids {
+			cmds[i] = pipe.HVals(ctx, presenceKey(uid))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	status := make(map[string]PresenceStatus, len(uids))
+	for i, uid := range uids {
+		connections := make(map[string]bool)
+		for j, v := range cmds[i].Val() {
+			expires, away := strings.CutSuffix(v, awaySuffix)
+			// 宕机实例留下的连接已过期
+			if at, _ := strconv.ParseInt(expires, 10, 64); at > now {
+				connections[strconv.Itoa(j)] = away
+			}
+		}
+		status[uid] = statusOf(connections)
+	}
+	return status, nil
+}
+
+// heartbeat refreshes the presence of the connections on this instance until the backplane closes
+func (b *redisBackplane) heartbeat() {
+	ticker := time.NewTicker(heartbeatPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		entries := b.entries()
+		for start := 0; start < len(entries); start += presenceBatchSize {
+			end := start + presenceBatchSize
+			if end > len(entries) {
+				end = len(entries)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), backplaneTimeout)
+			if err := b.refresh(ctx, entries[start:end]); err != nil {
+				zap.L().Error("refresh chat presence", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+func (b *redisBackplane) entries() []presenceEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entries []presenceEntry
+	for uid, clients := range b.connections {
+		for clientID, away := range clients {
+			entries = append(entries, presenceEntry{uid: uid, clientID: clientID, away: away})
+		}
+	}
+	return entries
+}
+
+// Close stops the heartbeat and the subscription, and takes the connections on this instance offline
+func (b *redisBackplane) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.stop)
+
+		entries := b.entries()
+		b.mu.Lock()
+		if b.pubsub != nil {
+			_ = b.pubsub.Close()
+		}
+		b.connections = make(map[string]map[string]bool)
+		b.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), backplaneTimeout)
+		defer cancel()
+		_, err = b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, entry := range entries {
+				pipe.HDel(ctx, presenceKey(entry.uid), entry.clientID)
+			}
+			return nil
+		})
+		if err != nil {
+			zap.L().Error("clear chat presence", zap.Error(err))
+		}
+		err = b.client.Close()
+	})
+	return err
+}
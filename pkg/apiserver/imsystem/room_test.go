@@ -0,0 +1,96 @@
+package imsystem
+
+import (
+	"context"
+	"testing"
+	"time"
+	"v1/pkg/dao"
+	"v1/pkg/model"
+
+	"github.com/gorilla/websocket"
+)
+
+// next reads the next envelope from the connection
+func next(t *testing.T, conn *websocket.Conn) Envelope {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var env Envelope
+	if err := conn.ReadJSON(&env); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return env
+}
+
+func TestRoomFanOut(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, uid := range []string{"bob", "carol", "dave"} {
+		if err := db.Create(&model.User{UID: uid, Username: uid, ClassHashID: "c1", Status: model.UserStatusNormal}).Error; err != nil {
+			t.Fatalf("create %s: %v", uid, err)
+		}
+	}
+	room, err := dao.CreateChatRoom(ctx, db, model.ChatRoom{Kind: model.RoomKindClass, RefID: "c1", Name: "c1", CreatorUID: "alice", Creator: "alice"})
+	if err != nil {
+		t.Fatalf("CreateChatRoom: %v", err)
+	}
+	conversation := model.RoomConversationID(room.ID)
+	if err = dao.MuteRoomMember(ctx, db, room.ID, "carol", time.Now().Add(time.Hour).UnixMilli()); err != nil {
+		t.Fatalf("mute carol: %v", err)
+	}
+	if err = dao.KickRoomMember(ctx, db, room.ID, "dave"); err != nil {
+		t.Fatalf("kick dave: %v", err)
+	}
+
+	// 成员分布在共用 backplane 的两个实例上，alice 两个会话
+	backplane := NewMemoryBackplane()
+	in1, in2 := newInstance(t, db, backplane), newInstance(t, db, backplane)
+	alice := in1.connect(t, "alice", "a1")
+	aliceOther := in2.connect(t, "alice", "a2")
+	bob := in2.connect(t, "bob", "b1")
+	carol := in1.connect(t, "carol", "c1")
+	dave := in2.connect(t, "dave", "d1")
+	erin := in1.connect(t, "erin", "e1")
+
+	if err = alice.WriteJSON(Envelope{Type: TypeRoomMessage, Conversation: conversation, Content: "hello", ClientID: "m1"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// 发送的客户端只收到 ack，其余在线成员都收到消息
+	ack := next(t, alice)
+	if ack.Type != TypeAck || ack.ClientID != "m1" || ack.ID == 0 {
+		t.Fatalf("alice got %+v, want the ack", ack)
+	}
+	for name, conn := range map[string]*websocket.Conn{"alice on hub 2": aliceOther, "bob": bob, "muted carol": carol} {
+		if msg := next(t, conn); msg.Type != TypeRoomMessage || msg.ID != ack.ID || msg.From != "alice" || msg.Conversation != conversation {
+			t.Fatalf("%s got %+v, want room message %d", name, msg, ack.ID)
+		}
+	}
+
+	// 被禁言的成员和非成员不能发送
+	if err = carol.WriteJSON(Envelope{Type: TypeRoomMessage, Conversation: conversation, Content: "hi", ClientID: "m2"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if e := next(t, carol); e.Type != TypeError || e.ClientID != "m2" || e.Error != "muted in the room" {
+		t.Fatalf("carol got %+v, want the muted error", e)
+	}
+	for name, conn := range map[string]*websocket.Conn{"kicked dave": dave, "erin": erin} {
+		if err = conn.WriteJSON(Envelope{Type: TypeRoomMessage, Conversation: conversation, Content: "hi", ClientID: "m3"}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if e := next(t, conn); e.Type != TypeError || e.Error != ErrNotInConversation.Error() {
+			t.Fatalf("%s got %+v, want %q", name, e, ErrNotInConversation)
+		}
+	}
+	var stored int64
+	if err = db.Model(&model.ChatMessage{}).Where("conversation_id = ?", conversation).Count(&stored).Error; err != nil || stored != 1 {
+		t.Fatalf("%d messages stored in the room, %v, want 1", stored, err)
+	}
+
+	// 被移出的成员收不到群消息，只收到移出的通知
+	in1.hub.NotifyRoom(ctx, room.ID, "alice", "dave", RoomEventKicked)
+	if e := next(t, dave); e.Type != TypeRoomEvent || e.Content != RoomEventKicked || e.To != "dave" {
+		t.Fatalf("dave got %+v, want the kicked event", e)
+	}
+	if e := next(t, bob); e.Type != TypeRoomEvent || e.Content != RoomEventKicked {
+		t.Fatalf("bob got %+v, want the kicked event", e)
+	}
+}
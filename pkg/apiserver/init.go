@@ -14,6 +14,7 @@ import (
 	"time"
 	"v1/pkg/dao"
 	"v1/pkg/model"
+	"v1/pkg/password"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -36,6 +37,7 @@ func (s *APIServer) initSystem() (err error) {
 
 	errs = append(errs, initSuperAdmin(ctx, s.RDBClient))
 	errs = append(errs, initConfig(ctx, s.RDBClient))
+	errs = append(errs, dao.BackfillProjectLeaders(ctx, s.RDBClient))
 	// errs = append(errs, initDefaultBenchmark(ctx, s.RDBClient))
 	// errs = append(errs, initRiskScanTask(ctx, s.RDBClient))
 
@@ -61,10 +63,15 @@ func initSuperAdmin(ctx context.Context, db *gorm.DB) error {
 	}
 
 	// 初始化超管
+	encoded, err := password.Hash(model.SuperAdminDefaultPassword)
+	if err != nil {
+		return err
+	}
+
 	_, err = dao.InsertUser(ctx, db, model.User{
 		UID:      utils.NextID(),
 		Username: model.SuperAdminUsername,
-		Password: utils.MD5Hex(model.SuperAdminDefaultPassword),
+		Password: encoded,
 		Name:     "默认管理员",
 		Creator:  model.SystemUsername,
 		Updater:  model.SystemUsername,
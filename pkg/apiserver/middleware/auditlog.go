@@ -17,6 +17,7 @@ func init() {
 	filter["/api/v1/system/logs"] = struct{}{}
 	filter["/api/v1/common/fs/"] = struct{}{}
 	filter["/api/v1/common/healthy"] = struct{}{}
+	filter["/api/v1/chat/ws"] = struct{}{}
 }
 
 func AddAuditLog(db *gorm.DB) func(c *gin.Context) {
@@ -0,0 +1,38 @@
+//go:build debug
+
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"v1/pkg/client/cache"
+	"v1/pkg/model"
+	"v1/pkg/token"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TestDebugBuild rejects a request without token by default. With --dev-auth it is served as the super admin,
+// the X-Dev-* headers still choose another user
+func TestDebugBuild(t *testing.T) {
+	manager := token.NewJWTTokenManager([]byte("s3cret"), jwt.SigningMethodHS256)
+
+	withDevAuth(t, DevAuthDefault)
+	if code, _ := serve(t, manager, cache.NewSimpleCache(), func(r *http.Request) {}); code != http.StatusUnauthorized {
+		t.Fatalf("got %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// --dev-auth
+	withDevAuth(t, true)
+	code, served := serve(t, manager, cache.NewSimpleCache(), func(r *http.Request) {})
+	if code != http.StatusOK || served.role != model.RoleTypeSuperAdmin {
+		t.Fatalf("got %d %+v, want the super admin", code, served)
+	}
+
+	code, served = serve(t, manager, cache.NewSimpleCache(), func(r *http.Request) {
+		r.Header.Set(DevAuthHeaderRole, string(model.RoleTypeStudent))
+	})
+	if code != http.StatusOK || served.role != model.RoleTypeStudent {
+		t.Fatalf("got %d %+v, want a student", code, served)
+	}
+}
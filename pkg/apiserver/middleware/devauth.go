@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"v1/pkg/model"
+	"v1/pkg/token"
+)
+
+// headers a caller uses to choose the fake user when dev auth is enabled
+const (
+	DevAuthHeaderID       = "X-Dev-User-ID"
+	DevAuthHeaderUID      = "X-Dev-User-UID"
+	DevAuthHeaderUsername = "X-Dev-Username"
+	DevAuthHeaderRole     = "X-Dev-Role"
+)
+
+// DevAuthHeaders are the request headers read in dev auth mode
+var DevAuthHeaders = []string{DevAuthHeaderID, DevAuthHeaderUID, DevAuthHeaderUsername, DevAuthHeaderRole}
+
+var devAuth bool
+
+// SetDevAuth enables or disables dev auth mode. In dev auth mode a request without
+// any token is served as the user described by the X-Dev-* headers, never enable it in production.
+func SetDevAuth(enabled bool) {
+	devAuth = enabled
+}
+
+// DevAuthEnabled reports whether dev auth mode is enabled
+func DevAuthEnabled() bool {
+	return devAuth
+}
+
+// devAuthPayload builds the impersonated payload from the X-Dev-* headers,
+// defaults to the super admin
+func devAuthPayload(c *gin.Context) (*token.Payload, bool) {
+	payload := &token.Payload{
+		ID:       1,
+		Username: model.SuperAdminUsername,
+		Name:     "默认管理员",
+		UID:      "118321494483855902",
+		Role:     model.RoleTypeSuperAdmin,
+	}
+
+	if v := c.GetHeader(DevAuthHeaderID); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		payload.ID = id
+	}
+	if v := c.GetHeader(DevAuthHeaderUID); v != "" {
+		payload.UID = v
+	}
+	if v := c.GetHeader(DevAuthHeaderUsername); v != "" {
+		payload.Username = v
+		payload.Name = v
+	}
+	if v := c.GetHeader(DevAuthHeaderRole); v != "" {
+		payload.Role = model.RoleType(v)
+		if !payload.Role.Valid() {
+			return nil, false
+		}
+	}
+
+	zap.L().Info("dev auth impersonation", zap.String("username", payload.Username), zap.String("role", string(payload.Role)))
+	return payload, true
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/ratelimit"
+	"v1/pkg/server/errutil"
+)
+
+type rateLimitedResp struct {
+	RetryAfter int64 `json:"retry_after"` // 秒
+}
+
+// RateLimit rejects requests over the policy with 429 and Retry-After. Policies keyed by user must be used after CheckToken.
+// Requests pass when the limiter fails, an unavailable cache must not take the api down
+func RateLimit(limiter ratelimit.Limiter, policy ratelimit.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.ClientIP()
+		switch policy.KeyBy {
+		case ratelimit.KeyByRoute:
+			key = c.Request.Method + ":" + c.FullPath()
+		case ratelimit.KeyByUser:
+			if uid := request.GetUserUIDFromCtx(c.Request.Context()); uid != "" {
+				key = uid
+			}
+		}
+
+		allowed, retryAfter, err := limiter.Allow(c.Request.Context(), policy, key)
+		if err != nil {
+			zap.L().Error("limiter.Allow", zap.String("policy", policy.Name), zap.Error(err))
+		}
+		if allowed {
+			return
+		}
+
+		seconds := int64(math.Ceil(retryAfter.Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+		serviceErr := errutil.ErrTooManyRequests
+		encoding.HandleError(c, errutil.NewError(serviceErr.Code, serviceErr.Message, rateLimitedResp{RetryAfter: seconds}))
+	}
+}
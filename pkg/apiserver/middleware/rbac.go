@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"v1/pkg/apiserver/encoding"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/rbac"
+	"v1/pkg/server/errutil"
+)
+
+// RequirePermission rejects callers whose role is not granted the permission by rbac.DefaultPolicy,
+// must be used after CheckToken. The granted scope is passed to handlers through the request context.
+func RequirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := request.GetRoleTypeFromCtx(c.Request.Context())
+
+		scope := rbac.DefaultPolicy.ScopeOf(role, permission)
+		if scope == rbac.ScopeNone {
+			zap.L().Info("permission denied", zap.String("role", string(role)), zap.String("permission", string(permission)),
+				zap.String("username", request.GetUsernameFromCtx(c.Request.Context())))
+			encoding.HandleError(c, errutil.ErrPermissionDenied)
+			return
+		}
+
+		c.Request = c.Request.WithContext(request.WithPermissionScopeToCtx(c.Request.Context(), scope))
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !debug
+
+package middleware
+
+// DevAuthDefault is the default of --dev-auth
+const DevAuthDefault = false
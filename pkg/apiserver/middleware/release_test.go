@@ -0,0 +1,22 @@
+//go:build !debug
+
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"v1/pkg/client/cache"
+	"v1/pkg/token"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TestReleaseBuild rejects a request without token unless --dev-auth is given
+func TestReleaseBuild(t *testing.T) {
+	withDevAuth(t, DevAuthDefault)
+	manager := token.NewJWTTokenManager([]byte("s3cret"), jwt.SigningMethodHS256)
+
+	if code, _ := serve(t, manager, cache.NewSimpleCache(), func(r *http.Request) {}); code != http.StatusUnauthorized {
+		t.Fatalf("got %d, want %d", code, http.StatusUnauthorized)
+	}
+}
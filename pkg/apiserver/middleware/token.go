@@ -1,5 +1,3 @@
-//go:build !debug
-
 package middleware
 
 import (
@@ -11,7 +9,6 @@ import (
 	"v1/pkg/apiserver/encoding"
 	"v1/pkg/apiserver/request"
 	"v1/pkg/client/cache"
-	"v1/pkg/model"
 	"v1/pkg/server/errutil"
 	"v1/pkg/token"
 )
@@ -62,24 +59,32 @@ func findTokenVal(c *gin.Context, getTokenFns ...func(c *gin.Context) string) st
 }
 
 func CheckToken(manager token.Manager, cacheClient cache.Interface) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// debug
-		bearer := c.GetHeader("Authorization")
-		if bearer == "" { // 把没带token的视为 超管
-			ctx := request.WithTokenPayloadToCtx(c.Request.Context(), &token.Payload{
-				ID:       1,
-				Username: "admin",
-				Name:     "默认管理员",
-				UID:      "118321494483855902",
-				Role:     model.RoleTypeSuperAdmin,
-			})
-			c.Request = c.Request.WithContext(ctx)
-			return
-		}
+	return checkToken(manager, cacheClient, tokenFromHeader, tokenFromCookie, tokenFromQuery)
+}
+
+// CheckTokenWithoutCookie is CheckToken for the endpoints cors doesn't protect, such as websockets.
+// The browser sends the cookie whichever site opens the connection, so the token must be in the header or the query
+func CheckTokenWithoutCookie(manager token.Manager, cacheClient cache.Interface) gin.HandlerFunc {
+	return checkToken(manager, cacheClient, tokenFromHeader, tokenFromQuery)
+}
+
+func checkToken(manager token.Manager, cacheClient cache.Interface, getTokenFns ...func(c *gin.Context) string) gin.HandlerFunc {
+	refreshManager := token.NewRefreshManager(cacheClient)
 
-		// !debug
-		tokenVal := findTokenVal(c, tokenFromHeader, tokenFromCookie, tokenFromQuery)
+	return func(c *gin.Context) {
+		tokenVal := findTokenVal(c, getTokenFns...)
 		if tokenVal == "" {
+			// --dev-auth: 没带token时使用 X-Dev-* 请求头指定的用户
+			if devAuth {
+				payload, ok := devAuthPayload(c)
+				if !ok {
+					encoding.HandleError(c, errutil.ErrIllegalParameter)
+					return
+				}
+				c.Request = c.Request.WithContext(request.WithTokenPayloadToCtx(c.Request.Context(), payload))
+				return
+			}
+
 			encoding.HandleError(c, errutil.ErrUnauthorized)
 			return
 		}
@@ -99,6 +104,15 @@ func CheckToken(manager token.Manager, cacheClient cache.Interface) gin.HandlerF
 
 		zap.L().Debug("token payload", zap.Any("payload", payload))
 
+		// token family revoked (logout / refresh token reuse / password changed), records last seen time otherwise
+		if payload.SessionID != "" {
+			if err = refreshManager.Touch(context.Background(), payload.SessionID, c.ClientIP()); err != nil {
+				zap.L().Info("token session revoked", zap.String("sid", payload.SessionID), zap.Error(err))
+				encoding.HandleError(c, errutil.ErrUnauthorized)
+				return
+			}
+		}
+
 		// renew token
 		if err = cacheClient.Set(context.Background(), "token:"+tokenVal, payload.Username, time.Minute*30); err != nil {
 			zap.L().Error("", zap.Error(err))
@@ -107,6 +121,7 @@ func CheckToken(manager token.Manager, cacheClient cache.Interface) gin.HandlerF
 		}
 
 		ctx := request.WithTokenPayloadToCtx(c.Request.Context(), &payload)
+		ctx = request.WithAccessTokenToCtx(ctx, tokenVal)
 		c.Request = c.Request.WithContext(ctx)
 		return
 	}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"v1/pkg/apiserver/request"
+	"v1/pkg/client/cache"
+	"v1/pkg/model"
+	"v1/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type caller struct {
+	uid  string
+	role model.RoleType
+}
+
+// serve runs the request through CheckToken and returns the status and the user it was served as
+func serve(t *testing.T, manager token.Manager, cacheClient cache.Interface, setup func(r *http.Request)) (int, caller) {
+	t.Helper()
+	return serveWith(t, CheckToken(manager, cacheClient), setup)
+}
+
+// serveWith runs the request through the token check
+func serveWith(t *testing.T, check gin.HandlerFunc, setup func(r *http.Request)) (int, caller) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var served caller
+	router := gin.New()
+	router.GET("/", check, func(c *gin.Context) {
+		served = caller{uid: request.GetUserUIDFromCtx(c.Request.Context()), role: request.GetRoleTypeFromCtx(c.Request.Context())}
+		c.Status(http.StatusOK)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	setup(r)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w.Code, served
+}
+
+func withDevAuth(t *testing.T, enabled bool) {
+	t.Helper()
+	old := DevAuthEnabled()
+	SetDevAuth(enabled)
+	t.Cleanup(func() { SetDevAuth(old) })
+}
+
+func TestCheckToken(t *testing.T) {
+	manager := token.NewJWTTokenManager([]byte("s3cret"), jwt.SigningMethodHS256)
+	cacheClient := cache.NewSimpleCache()
+
+	teacher, err := manager.IssueTo(token.Payload{ID: 7, UID: "u-teacher", Username: "teacher", Role: model.RoleTypeTeacher}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueTo: %v", err)
+	}
+	if err = cacheClient.Set(context.Background(), "token:"+teacher, "teacher", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	unknown, _ := manager.IssueTo(token.Payload{UID: "u-unknown", Role: model.RoleTypeStudent}, time.Hour)
+
+	bearer := func(tokenVal string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+tokenVal) }
+	}
+	headers := func(kv ...string) func(r *http.Request) {
+		return func(r *http.Request) {
+			for i := 0; i < len(kv); i += 2 {
+				r.Header.Set(kv[i], kv[i+1])
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		devAuth bool
+		setup   func(r *http.Request)
+		code    int
+		caller  caller
+	}{
+		{name: "no token", setup: headers(), code: http.StatusUnauthorized},
+		{name: "dev headers ignored", setup: headers(DevAuthHeaderRole, string(model.RoleTypeSuperAdmin)), code: http.StatusUnauthorized},
+		{name: "token", setup: bearer(teacher), code: http.StatusOK, caller: caller{"u-teacher", model.RoleTypeTeacher}},
+		{name: "token not in cache", setup: bearer(unknown), code: http.StatusUnauthorized},
+		{name: "broken token", setup: bearer("broken"), code: http.StatusUnauthorized},
+
+		{name: "dev auth default user", devAuth: true, setup: headers(), code: http.StatusOK,
+			caller: caller{"118321494483855902", model.RoleTypeSuperAdmin}},
+		{name: "dev auth headers", devAuth: true, setup: headers(DevAuthHeaderUID, "u-student", DevAuthHeaderRole, string(model.RoleTypeStudent)),
+			code: http.StatusOK, caller: caller{"u-student", model.RoleTypeStudent}},
+		{name: "dev auth invalid role", devAuth: true, setup: headers(DevAuthHeaderRole, "Root"), code: http.StatusBadRequest},
+		{name: "dev auth invalid id", devAuth: true, setup: headers(DevAuthHeaderID, "x"), code: http.StatusBadRequest},
+		// 带了 token 时 dev auth 不生效，照常校验
+		{name: "dev auth token", devAuth: true, setup: bearer(teacher), code: http.StatusOK, caller: caller{"u-teacher", model.RoleTypeTeacher}},
+		{name: "dev auth broken token", devAuth: true, setup: bearer("broken"), code: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withDevAuth(t, tt.devAuth)
+			code, served := serve(t, manager, cacheClient, tt.setup)
+			if code != tt.code || served != tt.caller {
+				t.Fatalf("got %d %+v, want %d %+v", code, served, tt.code, tt.caller)
+			}
+		})
+	}
+}
+
+func TestCheckTokenWithoutCookie(t *testing.T) {
+	manager := token.NewJWTTokenManager([]byte("s3cret"), jwt.SigningMethodHS256)
+	cacheClient := cache.NewSimpleCache()
+
+	student, err := manager.IssueTo(token.Payload{ID: 8, UID: "u-student", Username: "student", Role: model.RoleTypeStudent}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueTo: %v", err)
+	}
+	if err = cacheClient.Set(context.Background(), "token:"+student, "student", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(r *http.Request)
+		code  int
+	}{
+		// 跨站发起的 websocket 也会带上 cookie
+		{name: "cookie", setup: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "jwt", Value: student}) }, code: http.StatusUnauthorized},
+		{name: "query", setup: func(r *http.Request) { r.URL.RawQuery = "jwt=" + student }, code: http.StatusOK},
+		{name: "header", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+student) }, code: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withDevAuth(t, false)
+			code, served := serveWith(t, CheckTokenWithoutCookie(manager, cacheClient), tt.setup)
+			if code != tt.code {
+				t.Fatalf("got %d, want %d", code, tt.code)
+			}
+			if code == http.StatusOK && served.uid != "u-student" {
+				t.Fatalf("served as %+v", served)
+			}
+			// CheckToken 照常接受 cookie
+			if code, _ = serve(t, manager, cacheClient, tt.setup); code != http.StatusOK {
+				t.Fatalf("CheckToken got %d", code)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package apiserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"v1/pkg/apiserver/middleware"
+	"v1/pkg/client/cache"
+	"v1/pkg/model"
+	"v1/pkg/ratelimit"
+	"v1/pkg/rbac"
+	"v1/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// roles a route is open to
+type roles int
+
+const (
+	superAdmin roles = 1 << iota
+	collegeAdmin
+	teacher
+	student
+	firm // 企业和保留的普通用户权限相同
+
+	admins   = superAdmin | collegeAdmin
+	staff    = admins | teacher
+	everyone = staff | student | firm
+)
+
+var roleBits = map[model.RoleType]roles{
+	model.RoleTypeSuperAdmin:   superAdmin,
+	model.RoleTypeCollegeAdmin: collegeAdmin,
+	model.RoleTypeTeacher:      teacher,
+	model.RoleTypeStudent:      student,
+	model.RoleTypeFirm:         firm,
+	model.RoleTypeNormal:       firm,
+}
+
+// routes pins the permission every registered route requires and the roles granted it, an empty permission is not checked by rbac
+var routes = []struct {
+	route      string
+	permission rbac.Permission
+	roles      roles
+}{
+	{"GET /.well-known/jwks.json", "", everyone},
+
+	{"POST /api/v1/auth/login", "", everyone},
+	{"GET /api/v1/auth/captcha", "", everyone},
+	{"POST /api/v1/auth/refresh", "", everyone},
+	{"POST /api/v1/auth/login/2fa", "", everyone},
+	{"POST /api/v1/auth/login/2fa/enroll", "", everyone},
+	{"POST /api/v1/auth/password/forgot", "", everyone},
+	{"POST /api/v1/auth/password/reset", "", everyone},
+	{"GET /api/v1/auth/providers", "", everyone},
+	{"GET /api/v1/auth/sso/:provider", "", everyone},
+	{"POST /api/v1/auth/sso/:provider/callback", "", everyone},
+	{"POST /api/v1/auth/logout", "", everyone},
+	{"GET /api/v1/auth/sessions", "", everyone},
+	{"DELETE /api/v1/auth/sessions/:id", "", everyone},
+	{"GET /api/v1/auth/2fa", rbac.PermissionTwoFactorEnroll, staff},
+	{"POST /api/v1/auth/2fa/enroll", rbac.PermissionTwoFactorEnroll, staff},
+	{"POST /api/v1/auth/2fa/enable", rbac.PermissionTwoFactorEnroll, staff},
+	{"POST /api/v1/auth/2fa/disable", rbac.PermissionTwoFactorEnroll, staff},
+	{"POST /api/v1/auth/2fa/recovery-codes", rbac.PermissionTwoFactorEnroll, staff},
+
+	{"DELETE /api/v1/system/users", rbac.PermissionUserDelete, admins},
+	{"POST /api/v1/system/users", rbac.PermissionUserCreate, admins},
+	{"POST /api/v1/system/users/list", rbac.PermissionUserList, admins},
+	{"POST /api/v1/system/user/:id/detail", rbac.PermissionUserDetail, everyone},
+	{"PATCH /api/v1/system/users", rbac.PermissionUserUpdate, admins},
+	{"PUT /api/v1/system/users/password", rbac.PermissionUserPassword, everyone},
+	{"PUT /api/v1/system/users/:id/password", rbac.PermissionUserResetPassword, admins},
+	{"PUT /api/v1/system/users/:id/unlock", rbac.PermissionUserUnlock, admins},
+	{"GET /api/v1/system/users/:id/sessions", rbac.PermissionUserSession, admins},
+	{"DELETE /api/v1/system/users/:id/sessions", rbac.PermissionUserSession, admins},
+	{"POST /api/v1/system/colleges", rbac.PermissionCollegeCreate, superAdmin},
+	{"DELETE /api/v1/system/colleges", rbac.PermissionCollegeDelete, superAdmin},
+	{"POST /api/v1/system/colleges/tree", rbac.PermissionCollegeList, everyone},
+	{"POST /api/v1/system/professions", rbac.PermissionProfessionCreate, admins},
+	{"DELETE /api/v1/system/professions", rbac.PermissionProfessionDelete, admins},
+	{"POST /api/v1/system/profession/tree", rbac.PermissionProfessionList, everyone},
+	{"POST /api/v1/system/classes", rbac.PermissionClassCreate, admins},
+	{"DELETE /api/v1/system/classes", rbac.PermissionClassDelete, admins},
+	{"POST /api/v1/system/:profession_hash_id/class/tree", rbac.PermissionClassList, everyone},
+	{"GET /api/v1/system/two-factor", rbac.PermissionTwoFactorPolicy, superAdmin},
+	{"PUT /api/v1/system/two-factor", rbac.PermissionTwoFactorPolicy, superAdmin},
+
+	{"GET /api/v1/project/files/:id/download", "", everyone},
+	{"POST /api/v1/project", rbac.PermissionProjectCreate, staff},
+	{"DELETE /api/v1/project", rbac.PermissionProjectDelete, staff},
+	{"POST /api/v1/project/list", rbac.PermissionProjectList, staff | student},
+	{"POST /api/v1/project/user/list", rbac.PermissionProjectList, staff | student},
+	{"POST /api/v1/project/detail", rbac.PermissionProjectDetail, staff | student},
+	{"POST /api/v1/project/changeStatus", rbac.PermissionProjectUpdate, staff},
+	{"POST /api/v1/project/statusHistory", rbac.PermissionProjectDetail, staff | student},
+	{"POST /api/v1/project/choose", rbac.PermissionProjectChoose, superAdmin | student},
+	{"GET /api/v1/project/audit", rbac.PermissionProjectAudit, admins},
+	{"POST /api/v1/project/rounds", rbac.PermissionSelectionRound, admins},
+	{"POST /api/v1/project/rounds/list", rbac.PermissionProjectList, staff | student},
+	{"POST /api/v1/project/rounds/match", rbac.PermissionSelectionRound, admins},
+	{"POST /api/v1/project/rounds/preferences", rbac.PermissionProjectChoose, superAdmin | student},
+	{"POST /api/v1/project/rounds/myApplications", rbac.PermissionProjectChoose, superAdmin | student},
+	{"POST /api/v1/project/rounds/applicants", rbac.PermissionProjectUpdate, staff},
+	{"POST /api/v1/project/rounds/rankApplicants", rbac.PermissionProjectUpdate, staff},
+	{"POST /api/v1/project/team/members", rbac.PermissionProjectDetail, staff | student},
+	{"POST /api/v1/project/team/invite", rbac.PermissionProjectChoose, superAdmin | student},
+	{"POST /api/v1/project/team/invitations", rbac.PermissionProjectChoose, superAdmin | student},
+	{"POST /api/v1/project/team/respond", rbac.PermissionProjectChoose, superAdmin | student},
+	{"POST /api/v1/project/upload/file", rbac.PermissionProjectUpload, superAdmin | teacher | student},
+	{"POST /api/v1/project/files/uploads", rbac.PermissionProjectUpload, superAdmin | teacher | student},
+	{"GET /api/v1/project/files/uploads/:id", rbac.PermissionProjectUpload, superAdmin | teacher | student},
+	{"PUT /api/v1/project/files/uploads/:id/chunks/:index", rbac.PermissionProjectUpload, superAdmin | teacher | student},
+	{"POST /api/v1/project/files/uploads/:id/complete", rbac.PermissionProjectUpload, superAdmin | teacher | student},
+	{"POST /api/v1/project/files/list", rbac.PermissionProjectDetail, staff | student},
+	{"POST /api/v1/project/files/url", rbac.PermissionProjectDetail, staff | student},
+	{"POST /api/v1/project/phaseTemplates", rbac.PermissionPhaseTemplate, staff},
+	{"DELETE /api/v1/project/phaseTemplates", rbac.PermissionPhaseTemplate, staff},
+	{"POST /api/v1/project/phaseTemplates/list", rbac.PermissionProjectList, staff | student},
+	{"POST /api/v1/project/phases", rbac.PermissionProjectDetail, staff | student},
+	{"POST /api/v1/project/phase/submit", rbac.PermissionProjectUpload, superAdmin | teacher | student},
+	{"POST /api/v1/project/phase/review", rbac.PermissionProjectUpdate, staff},
+
+	{"POST /api/v1/resume", rbac.PermissionResumeCreate, superAdmin | student},
+	{"POST /api/v1/resume/project/tree", rbac.PermissionResumeCreate, superAdmin | student},
+	{"DELETE /api/v1/resume", rbac.PermissionResumeDelete, superAdmin | student},
+	{"POST /api/v1/resume/list", rbac.PermissionResumeList, everyone},
+	{"POST /api/v1/resume/:id/detail", rbac.PermissionResumeDetail, everyone},
+
+	{"POST /api/v1/interview", rbac.PermissionInterviewCreate, superAdmin | teacher | firm},
+	{"DELETE /api/v1/interview", rbac.PermissionInterviewDelete, superAdmin | teacher | firm},
+	{"POST /api/v1/interview/list", rbac.PermissionInterviewList, superAdmin | teacher | student | firm},
+	{"POST /api/v1/interview/change", rbac.PermissionInterviewUpdate, superAdmin | teacher | student | firm},
+	{"POST /api/v1/interview/:id/detail", rbac.PermissionInterviewDetail, superAdmin | teacher | student | firm},
+
+	{"GET /api/v1/chat/ws", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/conversations", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/history", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/read", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/presence", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/rooms/create", rbac.PermissionChatRoom, staff | firm},
+	{"POST /api/v1/chat/rooms/list", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/rooms/members", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/rooms/history", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/rooms/mute", rbac.PermissionChat, everyone},
+	{"POST /api/v1/chat/rooms/kick", rbac.PermissionChat, everyone},
+}
+
+func newTestServer(t *testing.T) *APIServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+
+	s := &APIServer{
+		router:       gin.New(),
+		TokenManager: token.NewJWTTokenManager([]byte("s3cret"), jwt.SigningMethodHS256),
+		RDBClient:    db,
+		CacheClient:  cache.NewSimpleCache(),
+	}
+	ratelimit.SetDefault(ratelimit.NewLimiter(s.CacheClient))
+	// 没有建表，请求通过权限检查后在处理函数里失败即可
+	s.router.Use(gin.RecoveryWithWriter(io.Discard))
+	s.installAPIs()
+	return s
+}
+
+// requestPath fills the path parameters of the route
+func requestPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "1"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// TestRoutesCovered fails when a route is registered without being pinned in routes, or the other way round
+func TestRoutesCovered(t *testing.T) {
+	s := newTestServer(t)
+
+	registered := make(map[string]bool)
+	for _, route := range s.router.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	pinned := make(map[string]bool)
+	for _, tt := range routes {
+		if pinned[tt.route] {
+			t.Errorf("%s pinned twice", tt.route)
+		}
+		pinned[tt.route] = true
+		if !registered[tt.route] {
+			t.Errorf("%s is pinned but not registered", tt.route)
+		}
+	}
+	for route := range registered {
+		if !pinned[route] {
+			t.Errorf("%s is registered but its permission is not pinned", route)
+		}
+	}
+}
+
+// TestRoutePermissions sends a request to every route as every role, the rbac middleware must reject
+// exactly the roles not granted the permission of the route, and reject them for that permission
+func TestRoutePermissions(t *testing.T) {
+	s := newTestServer(t)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	middleware.SetDevAuth(true)
+	defer middleware.SetDevAuth(false)
+
+	for _, tt := range routes {
+		method, path, _ := strings.Cut(tt.route, " ")
+		for role, bit := range roleBits {
+			t.Run(tt.route+"/"+string(role), func(t *testing.T) {
+				logs.TakeAll()
+
+				r := httptest.NewRequest(method, requestPath(path), strings.NewReader("{}"))
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set(middleware.DevAuthHeaderRole, string(role))
+				w := httptest.NewRecorder()
+				s.router.ServeHTTP(w, r)
+
+				var denied []string
+				for _, entry := range logs.FilterMessage("permission denied").All() {
+					if permission, ok := entry.ContextMap()["permission"]; ok {
+						denied = append(denied, permission.(string))
+					}
+				}
+
+				if tt.roles&bit != 0 {
+					if len(denied) != 0 {
+						t.Fatalf("denied for %v, want allowed", denied)
+					}
+					return
+				}
+				if w.Code != http.StatusForbidden || len(denied) != 1 || denied[0] != string(tt.permission) {
+					t.Fatalf("got %d denied for %v, want %d denied for %s", w.Code, denied, http.StatusForbidden, tt.permission)
+				}
+			})
+		}
+	}
+}
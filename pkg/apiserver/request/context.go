@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"go.uber.org/zap"
 	"v1/pkg/model"
+	"v1/pkg/rbac"
 	"v1/pkg/token"
 )
 
@@ -13,6 +14,8 @@ type ctxKey string
 const (
 	ctxUserInfoKey ctxKey = "meta"
 	ctxLanguageKey ctxKey = "language"
+	ctxScopeKey    ctxKey = "scope"
+	ctxTokenKey    ctxKey = "token"
 )
 
 func WithTokenPayloadToCtx(ctx context.Context, info *token.Payload) context.Context {
@@ -106,3 +109,35 @@ func LanguageFromCtx(ctx context.Context) string {
 
 	return ""
 }
+
+func WithPermissionScopeToCtx(ctx context.Context, scope rbac.Scope) context.Context {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+
+	return context.WithValue(ctx, ctxScopeKey, scope)
+}
+
+// PermissionScopeFromCtx returns the scope granted by middleware.RequirePermission
+func PermissionScopeFromCtx(ctx context.Context) rbac.Scope {
+	if ctx == nil {
+		return rbac.ScopeNone
+	}
+
+	if v, ok := ctx.Value(ctxScopeKey).(rbac.Scope); ok {
+		return v
+	}
+
+	return rbac.ScopeNone
+}
+
+// WithAccessTokenToCtx stores the raw access token the request was authenticated with
+func WithAccessTokenToCtx(ctx context.Context, tokenVal string) context.Context {
+	return context.WithValue(ctx, ctxTokenKey, tokenVal)
+}
+
+// AccessTokenFromCtx returns the raw access token, empty if the request carried none
+func AccessTokenFromCtx(ctx context.Context) string {
+	tokenVal, _ := ctx.Value(ctxTokenKey).(string)
+	return tokenVal
+}
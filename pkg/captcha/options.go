@@ -0,0 +1,92 @@
+package captcha
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"v1/pkg/client/cache"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	captchaDriver          = "captcha-driver"
+	captchaLength          = "captcha-length"
+	captchaExpiration      = "captcha-expiration"
+	captchaAccountFailures = "captcha-after-account-failures"
+	captchaIPFailures      = "captcha-after-ip-failures"
+)
+
+type Options struct {
+	// string, digit, math or audio
+	Driver     string
+	Length     int
+	Expiration time.Duration
+	// a login needs a captcha after this many failures of the account or the client IP, 0 always needs one
+	AccountFailures int
+	IPFailures      int
+	v               *viper.Viper
+}
+
+func NewCaptchaOptions() *Options {
+	o := &Options{
+		Driver:          DriverString,
+		Length:          DefaultLength,
+		Expiration:      DefaultExpiration,
+		AccountFailures: 3,
+		IPFailures:      10,
+		v:               viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.Driver = o.v.GetString(captchaDriver)
+	o.Length = o.v.GetInt(captchaLength)
+	o.Expiration = o.v.GetDuration(captchaExpiration)
+	o.AccountFailures = o.v.GetInt(captchaAccountFailures)
+	o.IPFailures = o.v.GetInt(captchaIPFailures)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	switch o.Driver {
+	case DriverString, DriverDigit, DriverMath, DriverAudio:
+	default:
+		errors = append(errors, fmt.Errorf("%s must be one of %s, %s, %s, %s", captchaDriver, DriverString, DriverDigit, DriverMath, DriverAudio))
+	}
+	if o.Length <= 0 {
+		errors = append(errors, fmt.Errorf("%s must be positive", captchaLength))
+	}
+	if o.Expiration <= 0 {
+		errors = append(errors, fmt.Errorf("%s must be positive", captchaExpiration))
+	}
+	if o.AccountFailures < 0 || o.IPFailures < 0 {
+		errors = append(errors, fmt.Errorf("%s and %s must not be negative", captchaAccountFailures, captchaIPFailures))
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Driver, captchaDriver, o.Driver, "string, digit, math or audio. env CAPTCHA_DRIVER")
+	fs.IntVar(&o.Length, captchaLength, o.Length, "characters of a captcha, not used by the math driver. env CAPTCHA_LENGTH")
+	fs.DurationVar(&o.Expiration, captchaExpiration, o.Expiration, "env CAPTCHA_EXPIRATION")
+	fs.IntVar(&o.AccountFailures, captchaAccountFailures, o.AccountFailures, "failed logins of an account before a captcha is required, 0 always requires one. env CAPTCHA_AFTER_ACCOUNT_FAILURES")
+	fs.IntVar(&o.IPFailures, captchaIPFailures, o.IPFailures, "failed logins from a client IP before a captcha is required, 0 always requires one. env CAPTCHA_AFTER_IP_FAILURES")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewService creates the Service described by the options, the answers are kept in the cache
+func (o *Options) NewService(cacheClient cache.Interface) *Service {
+	return NewService(NewDriver(o.Driver, o.Length), NewCacheStore(cacheClient, o.Expiration),
+		Policy{AccountFailures: o.AccountFailures, IPFailures: o.IPFailures})
+}
@@ -1,51 +1,103 @@
 package captcha
 
 import (
-	"github.com/mojocn/base64Captcha"
 	"image/color"
 	"time"
+
+	"github.com/mojocn/base64Captcha"
 )
 
-type StringConfig struct {
-	config *base64Captcha.DriverString
+const (
+	DriverString = "string"
+	DriverDigit  = "digit"
+	DriverMath   = "math"
+	DriverAudio  = "audio"
+
+	DefaultLength     = 4
+	DefaultExpiration = 1 * time.Minute
+
+	imageHeight = 100
+	imageWidth  = 200
+	// 字母验证码的字符集
+	stringSource  = "abcdefghijklmnopqrstuvwxyz"
+	audioLanguage = "en"
+	// 进程内存储最多保留的验证码数
+	gcLimitNumber = 10240
+)
+
+// Service creates captchas with the configured driver and verifies the answers in the store
+type Service struct {
+	driver base64Captcha.Driver
 	store  base64Captcha.Store
+	policy Policy
 }
 
-var (
-	GCLimitNumber = 10240
-	Expiration    = 1 * time.Minute
-	Config        = StringConfig{config: stringConfig(), store: base64Captcha.NewMemoryStore(GCLimitNumber, Expiration)}
-)
+// Policy decides when a login has to pass a captcha
+type Policy struct {
+	// a captcha is required once an account or a client IP has failed this many logins, 0 always requires one
+	AccountFailures int
+	IPFailures      int
+}
+
+// Required reports whether a login with the given failure counts has to pass a captcha
+func (p Policy) Required(accountFailures, ipFailures int) bool {
+	return accountFailures >= p.AccountFailures || ipFailures >= p.IPFailures
+}
 
-func stringConfig() *base64Captcha.DriverString {
-	stringType := &base64Captcha.DriverString{
-		Height: 100,
-		Width:  200,
-		Length: 4,
-		Source: "abcdefghijklmnopqrstuvwxyz",
-		// Source: "QWERTYUIOPASDFGHJKLZXCVBNM",
-		BgColor: &color.RGBA{
-			R: 40,
-			G: 30,
-			B: 89,
-			A: 29,
-		},
-		Fonts: nil,
+var defaultService = NewService(NewDriver(DriverString, DefaultLength),
+	base64Captcha.NewMemoryStore(gcLimitNumber, DefaultExpiration), Policy{})
+
+// NewDriver returns the captcha driver of the given type, length is ignored by the math driver
+func NewDriver(driverType string, length int) base64Captcha.Driver {
+	switch driverType {
+	case DriverDigit:
+		return base64Captcha.NewDriverDigit(imageHeight, imageWidth, length, 0.7, 80)
+	case DriverMath:
+		return base64Captcha.NewDriverMath(imageHeight, imageWidth, 0, 0, bgColor(), nil, nil)
+	case DriverAudio:
+		return base64Captcha.NewDriverAudio(length, audioLanguage)
+	default:
+		return base64Captcha.NewDriverString(imageHeight, imageWidth, 0, 0, length, stringSource, bgColor(), nil, nil)
+	}
+}
+
+func bgColor() *color.RGBA {
+	return &color.RGBA{
+		R: 40,
+		G: 30,
+		B: 89,
+		A: 29,
 	}
-	return stringType
 }
 
-func (config StringConfig) CreateCaptcha() (string, string, string, error) {
-	c := base64Captcha.NewCaptcha(config.config, config.store)
+func NewService(driver base64Captcha.Driver, store base64Captcha.Store, policy Policy) *Service {
+	return &Service{driver: driver, store: store, policy: policy}
+}
+
+// CreateCaptcha returns the id, the base64 encoded image or audio and the answer of a new captcha
+func (s *Service) CreateCaptcha() (string, string, string, error) {
+	c := base64Captcha.NewCaptcha(s.driver, s.store)
 	id, b64s, answer, err := c.Generate()
 	return id, b64s, answer, err
 }
 
-func (config StringConfig) VerifyCaptcha(id, VerifyValue string) bool {
-	// result 为步骤1 创建的图片验证码存储对象
-	return config.store.Verify(id, VerifyValue, true)
+// VerifyCaptcha checks the answer, a captcha can only be verified once
+func (s *Service) VerifyCaptcha(id, VerifyValue string) bool {
+	return s.store.Verify(id, VerifyValue, true)
+}
+
+// Required reports whether a login with the given failure counts has to pass a captcha
+func (s *Service) Required(accountFailures, ipFailures int) bool {
+	return s.policy.Required(accountFailures, ipFailures)
+}
+
+// SetDefault sets the service used by the login handlers
+func SetDefault(s *Service) {
+	if s != nil {
+		defaultService = s
+	}
 }
 
-func GetService() *StringConfig {
-	return &Config
+func GetService() *Service {
+	return defaultService
 }
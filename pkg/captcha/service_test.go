@@ -0,0 +1,32 @@
+package captcha
+
+import "testing"
+
+func TestPolicyRequired(t *testing.T) {
+	cases := []struct {
+		name                        string
+		policy                      Policy
+		accountFailures, ipFailures int
+		want                        bool
+	}{
+		{name: "no failures", policy: Policy{AccountFailures: 3, IPFailures: 10}, want: false},
+		{name: "below both", policy: Policy{AccountFailures: 3, IPFailures: 10}, accountFailures: 2, ipFailures: 9, want: false},
+		{name: "account threshold", policy: Policy{AccountFailures: 3, IPFailures: 10}, accountFailures: 3, want: true},
+		{name: "above account threshold", policy: Policy{AccountFailures: 3, IPFailures: 10}, accountFailures: 5, ipFailures: 1, want: true},
+		{name: "ip threshold", policy: Policy{AccountFailures: 3, IPFailures: 10}, accountFailures: 1, ipFailures: 10, want: true},
+		{name: "zero always requires", policy: Policy{}, want: true},
+		{name: "zero account threshold", policy: Policy{IPFailures: 10}, want: true},
+		{name: "zero ip threshold", policy: Policy{AccountFailures: 3}, want: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.Required(c.accountFailures, c.ipFailures); got != c.want {
+				t.Fatalf("Required(%d, %d) = %v, want %v", c.accountFailures, c.ipFailures, got, c.want)
+			}
+			s := NewService(NewDriver(DriverDigit, DefaultLength), NewCacheStore(nil, DefaultExpiration), c.policy)
+			if got := s.Required(c.accountFailures, c.ipFailures); got != c.want {
+				t.Fatalf("Service.Required(%d, %d) = %v, want %v", c.accountFailures, c.ipFailures, got, c.want)
+			}
+		})
+	}
+}
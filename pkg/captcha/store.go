@@ -0,0 +1,67 @@
+package captcha
+
+import (
+	"context"
+	"time"
+	"v1/pkg/client/cache"
+
+	"github.com/mojocn/base64Captcha"
+)
+
+const captchaKeyPrefix = "captcha:"
+
+// cacheStore keeps the answers in cache.Interface, so a captcha can be verified by any instance
+type cacheStore struct {
+	cacheClient cache.Interface
+	expiration  time.Duration
+}
+
+// NewCacheStore returns a captcha store on the cache, answers expire after expiration
+func NewCacheStore(cacheClient cache.Interface, expiration time.Duration) base64Captcha.Store {
+	return &cacheStore{cacheClient: cacheClient, expiration: expiration}
+}
+
+func (s *cacheStore) Set(id string, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	return s.cacheClient.Set(ctx, captchaKeyPrefix+id, value, s.expiration)
+}
+
+func (s *cacheStore) Get(id string, clear bool) string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	value, err := s.cacheClient.Get(ctx, captchaKeyPrefix+id)
+	if err != nil {
+		return ""
+	}
+	if clear {
+		_ = s.cacheClient.Del(ctx, captchaKeyPrefix+id)
+	}
+	return value
+}
+
+// Verify checks the answer, with clear the answer is consumed whether it is right or not.
+// A right answer is deleted in the same step as it is compared, so concurrent requests can't pass with it twice
+func (s *cacheStore) Verify(id, answer string, clear bool) bool {
+	if !clear {
+		value := s.Get(id, false)
+		return value != "" && value == answer
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	key := captchaKeyPrefix + id
+	// 空的 old 表示键不存在，不能用来比较
+	if answer != "" {
+		// 负的时长表示匹配时删除
+		if ok, err := s.cacheClient.CompareAndSwap(ctx, key, answer, "", -1); err == nil && ok {
+			return true
+		}
+	}
+	// 答错也作废，防止对同一个验证码反复尝试
+	_ = s.cacheClient.Del(ctx, key)
+	return false
+}
@@ -0,0 +1,97 @@
+package captcha
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"v1/pkg/client/cache"
+)
+
+func TestCacheStoreSingleUse(t *testing.T) {
+	store := NewCacheStore(cache.NewSimpleCache(), time.Minute)
+	for _, id := range []string{"right", "wrong", "peek", "empty"} {
+		if err := store.Set(id, "abcd"); err != nil {
+			t.Fatalf("Set %s: %v", id, err)
+		}
+	}
+
+	if !store.Verify("right", "abcd", true) {
+		t.Fatal("right answer rejected")
+	}
+	if store.Verify("right", "abcd", true) {
+		t.Fatal("answer accepted twice")
+	}
+
+	// 答错后验证码作废，再答对也不行
+	if store.Verify("wrong", "abce", true) {
+		t.Fatal("wrong answer accepted")
+	}
+	if store.Verify("wrong", "abcd", true) {
+		t.Fatal("answer accepted after a wrong one")
+	}
+
+	// 不清除时可以反复校验
+	if !store.Verify("peek", "abcd", false) || !store.Verify("peek", "abcd", false) || store.Get("peek", false) != "abcd" {
+		t.Fatal("answer consumed without clear")
+	}
+
+	if store.Verify("empty", "", true) || store.Verify("missing", "", true) {
+		t.Fatal("empty answer accepted")
+	}
+	if store.Get("empty", false) != "" {
+		t.Fatal("captcha kept after an empty answer")
+	}
+}
+
+// slowCache answers Get late, as a remote cache does, so requests reading the same key overlap
+type slowCache struct {
+	cache.Interface
+}
+
+func (s slowCache) Get(ctx context.Context, key string) (string, error) {
+	value, err := s.Interface.Get(ctx, key)
+	time.Sleep(time.Millisecond * 10)
+	return value, err
+}
+
+func TestCacheStoreConcurrentVerify(t *testing.T) {
+	const n = 32
+
+	store := NewCacheStore(slowCache{cache.NewSimpleCache()}, time.Minute)
+	if err := store.Set("id", "abcd"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	var passed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if store.Verify("id", "abcd", true) {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := passed.Load(); got != 1 {
+		t.Fatalf("%d requests passed with one captcha, want 1", got)
+	}
+}
+
+func TestCacheStoreExpired(t *testing.T) {
+	store := NewCacheStore(cache.NewSimpleCache(), time.Millisecond*20)
+	if err := store.Set("id", "abcd"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	if got := store.Get("id", false); got != "" {
+		t.Fatalf("Get expired = %q", got)
+	}
+	if store.Verify("id", "abcd", true) {
+		t.Fatal("expired answer accepted")
+	}
+}
@@ -26,4 +26,12 @@ type Interface interface {
 
 	// Expire updates object's expiration time, return err if key doesn't exist
 	Expire(ctx context.Context, key string, duration time.Duration) error
+
+	// Incr increments the integer value of the key by one and returns the new value,
+	// the duration is the living duration of a key created by the increment
+	Incr(ctx context.Context, key string, duration time.Duration) (int64, error)
+
+	// CompareAndSwap sets the value and living duration of the key only if its current value is old,
+	// an empty old means the key must not exist. It reports whether the value was set
+	CompareAndSwap(ctx context.Context, key string, old, value string, duration time.Duration) (bool, error)
 }
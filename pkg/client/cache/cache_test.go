@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testCompareAndSwap runs the CompareAndSwap cases on a backend, inspect returns the stored value and ttl of a key
+func testCompareAndSwap(t *testing.T, c Interface, inspect func(key string) (string, time.Duration, bool)) {
+	t.Helper()
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		current  string // empty for a missing key
+		old      string
+		value    string
+		duration time.Duration
+		swapped  bool
+		want     string // empty when the key should not exist afterwards
+		ttl      time.Duration
+	}{
+		{name: "create missing", old: "", value: "v1", duration: time.Minute, swapped: true, want: "v1", ttl: time.Minute},
+		{name: "create existing", current: "v0", old: "", value: "v1", swapped: false, want: "v0"},
+		{name: "swap matching", current: "v0", old: "v0", value: "v1", swapped: true, want: "v1"},
+		{name: "swap stale", current: "v0", old: "v9", value: "v1", swapped: false, want: "v0"},
+		{name: "swap missing", old: "v0", value: "v1", swapped: false},
+		{name: "delete matching", current: "v0", old: "v0", value: "v1", duration: -time.Second, swapped: true},
+		{name: "delete matching within a millisecond", current: "v0", old: "v0", value: "v1", duration: -time.Nanosecond, swapped: true},
+		{name: "delete stale", current: "v0", old: "v9", duration: -time.Second, swapped: false, want: "v0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := "cas:" + tt.name
+			if tt.current != "" {
+				if err := c.Set(ctx, key, tt.current, NeverExpire); err != nil {
+					t.Fatalf("Set: %v", err)
+				}
+			}
+
+			swapped, err := c.CompareAndSwap(ctx, key, tt.old, tt.value, tt.duration)
+			if err != nil || swapped != tt.swapped {
+				t.Fatalf("CompareAndSwap = %v, %v, want %v", swapped, err, tt.swapped)
+			}
+
+			value, ttl, ok := inspect(key)
+			if ok != (tt.want != "") || value != tt.want {
+				t.Fatalf("value = %q (exists %v), want %q", value, ok, tt.want)
+			}
+			// 内存缓存按剩余时间计算，允许一点误差
+			if ok && (ttl > tt.ttl || ttl < tt.ttl-time.Second) {
+				t.Fatalf("ttl = %v, want %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package cache
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{pattern: "", key: "", want: true},
+		{pattern: "", key: "a", want: false},
+		{pattern: "abc", key: "abc", want: true},
+		{pattern: "abc", key: "abcd", want: false},
+
+		{pattern: "*", key: "", want: true},
+		{pattern: "*", key: "anything", want: true},
+		{pattern: "session:*", key: "session:1", want: true},
+		{pattern: "session:*", key: "sessions:1", want: false},
+		{pattern: "*:u1", key: "sessions:u1", want: true},
+		{pattern: "a*b*c", key: "axxbyyc", want: true},
+		{pattern: "a*b*c", key: "axxbyy", want: false},
+		{pattern: "a**c", key: "abc", want: true},
+
+		{pattern: "h?llo", key: "hello", want: true},
+		{pattern: "h?llo", key: "hllo", want: false},
+		{pattern: "??", key: "ab", want: true},
+		{pattern: "??", key: "a", want: false},
+
+		{pattern: "h[ae]llo", key: "hallo", want: true},
+		{pattern: "h[ae]llo", key: "hillo", want: false},
+		{pattern: "h[^e]llo", key: "hallo", want: true},
+		{pattern: "h[^e]llo", key: "hello", want: false},
+		{pattern: "[a-z]1", key: "k1", want: true},
+		{pattern: "[a-z]1", key: "K1", want: false},
+		{pattern: "[z-a]1", key: "k1", want: true}, // reversed range as in redis
+		{pattern: "[0-9a-f]", key: "c", want: true},
+		{pattern: "[abc", key: "b", want: true}, // unclosed class runs to the end
+		{pattern: "[a]", key: "", want: false},
+
+		{pattern: `a\*b`, key: "a*b", want: true},
+		{pattern: `a\*b`, key: "axb", want: false},
+		{pattern: `a\?`, key: "a?", want: true},
+		{pattern: `a\?`, key: "ab", want: false},
+		{pattern: `\[x]`, key: "[x]", want: true},
+		{pattern: `[\]]`, key: "]", want: true},
+		{pattern: `[\-]`, key: "-", want: true},
+		{pattern: `a\`, key: `a\`, want: true}, // trailing backslash matches itself
+	}
+
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
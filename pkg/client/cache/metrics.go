@@ -0,0 +1,30 @@
+package cache
+
+import "sync/atomic"
+
+var metrics struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// Metrics counts the cache lookups of the process since start
+type Metrics struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Evictions counts the keys dropped by the memory cache to stay under its maximum entries
+	Evictions uint64 `json:"evictions"`
+	// Expirations counts the expired keys removed by the memory cache
+	Expirations uint64 `json:"expirations"`
+}
+
+// GetMetrics returns a snapshot of the cache metrics
+func GetMetrics() Metrics {
+	return Metrics{
+		Hits:        metrics.hits.Load(),
+		Misses:      metrics.misses.Load(),
+		Evictions:   metrics.evictions.Load(),
+		Expirations: metrics.expirations.Load(),
+	}
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	cacheType          = "cache-type"
+	cacheRedisAddr     = "cache-redis-addr"
+	cacheRedisPassword = "cache-redis-password"
+	cacheRedisDB       = "cache-redis-db"
+	cacheMaxEntries    = "cache-max-entries"
+	cacheCleanup       = "cache-cleanup-interval"
+
+	TypeMemory = "memory"
+	TypeRedis  = "redis"
+)
+
+type Options struct {
+	// memory keeps tokens, captchas and rate limits in the process, only suitable for a single instance.
+	// redis shares them between instances and keeps them across restarts
+	Type          string
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	// MaxEntries and CleanupInterval bound the memory cache
+	MaxEntries      int
+	CleanupInterval time.Duration
+	v               *viper.Viper
+}
+
+func NewCacheOptions() *Options {
+	o := &Options{
+		Type:            TypeMemory,
+		RedisAddr:       "localhost:6379",
+		MaxEntries:      DefaultMaxEntries,
+		CleanupInterval: DefaultCleanupInterval,
+		v:               viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.Type = o.v.GetString(cacheType)
+	o.RedisAddr = o.v.GetString(cacheRedisAddr)
+	o.RedisPassword = o.v.GetString(cacheRedisPassword)
+	o.RedisDB = o.v.GetInt(cacheRedisDB)
+	o.MaxEntries = o.v.GetInt(cacheMaxEntries)
+	o.CleanupInterval = o.v.GetDuration(cacheCleanup)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	switch o.Type {
+	case TypeMemory:
+		if o.MaxEntries <= 0 {
+			errors = append(errors, fmt.Errorf("cache max entries must be positive"))
+		}
+		if o.CleanupInterval <= 0 {
+			errors = append(errors, fmt.Errorf("cache cleanup interval must be positive"))
+		}
+	case TypeRedis:
+		if o.RedisAddr == "" {
+			errors = append(errors, fmt.Errorf("cache redis addr is empty"))
+		}
+		if o.RedisDB < 0 {
+			errors = append(errors, fmt.Errorf("cache redis db is invalid"))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("cache type must be %s or %s", TypeMemory, TypeRedis))
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Type, cacheType, o.Type, "memory or redis, redis is required to run more than one instance. env CACHE_TYPE")
+	fs.StringVar(&o.RedisAddr, cacheRedisAddr, o.RedisAddr, "host:port of redis. env CACHE_REDIS_ADDR")
+	fs.StringVar(&o.RedisPassword, cacheRedisPassword, o.RedisPassword, "env CACHE_REDIS_PASSWORD")
+	fs.IntVar(&o.RedisDB, cacheRedisDB, o.RedisDB, "env CACHE_REDIS_DB")
+	fs.IntVar(&o.MaxEntries, cacheMaxEntries, o.MaxEntries, "max keys of the memory cache, the least recently used key is evicted beyond it. env CACHE_MAX_ENTRIES")
+	fs.DurationVar(&o.CleanupInterval, cacheCleanup, o.CleanupInterval, "how often the memory cache drops expired keys. env CACHE_CLEANUP_INTERVAL")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewCacheClient creates the cache of the configured type, the janitor of the memory cache stops with stopCh
+func (o *Options) NewCacheClient(stopCh <-chan struct{}) (Interface, error) {
+	if o.Type != TypeRedis {
+		return NewSimpleCache(WithMaxEntries(o.MaxEntries), WithJanitor(o.CleanupInterval, stopCh)), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, err := NewRedisCache(ctx, &redis.Options{
+		Addr:     o.RedisAddr,
+		Password: o.RedisPassword,
+		DB:       o.RedisDB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis %s: %w", o.RedisAddr, err)
+	}
+	return client, nil
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scanCount is the COUNT hint of each SCAN call in Keys
+const scanCount = 1000
+
+// redisCache implements cache.Interface on redis, the state is shared by all api server instances
+type redisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache connects to redis and checks the connection
+func NewRedisCache(ctx context.Context, options *redis.Options) (Interface, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return &redisCache{client: client}, nil
+}
+
+// Keys uses SCAN rather than KEYS, which blocks redis while walking the whole keyspace
+func (r *redisCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var (
+		keys   []string
+		seen   = make(map[string]struct{})
+		cursor uint64
+	)
+
+	for {
+		batch, next, err := r.client.Scan(ctx, cursor, pattern, scanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		// SCAN may return a key more than once
+		for _, key := range batch {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+func (r *redisCache) Get(ctx context.Context, key string) (string, error) {
+	value, err := r.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		metrics.misses.Add(1)
+		return "", ErrNoSuchKey
+	}
+	if err == nil {
+		metrics.hits.Add(1)
+	}
+	return value, err
+}
+
+func (r *redisCache) Set(ctx context.Context, key string, value string, duration time.Duration) error {
+	if duration < NeverExpire {
+		return r.client.Del(ctx, key).Err()
+	}
+	return r.client.Set(ctx, key, value, duration).Err()
+}
+
+func (r *redisCache) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Exists reports whether all the keys exist
+func (r *redisCache) Exists(ctx context.Context, keys ...string) (bool, error) {
+	// EXISTS counts a key given twice twice
+	unique := make([]string, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			unique = append(unique, key)
+		}
+	}
+	if len(unique) == 0 {
+		return true, nil
+	}
+
+	n, err := r.client.Exists(ctx, unique...).Result()
+	if err != nil {
+		return false, err
+	}
+	return n == int64(len(unique)), nil
+}
+
+func (r *redisCache) Expire(ctx context.Context, key string, duration time.Duration) error {
+	var (
+		ok  bool
+		err error
+	)
+	if duration == NeverExpire {
+		// PERSIST returns false both for a missing key and a key without ttl
+		ok, err = r.client.Persist(ctx, key).Result()
+		if err == nil && !ok {
+			ok, err = r.Exists(ctx, key)
+		}
+	} else {
+		ok, err = r.client.Expire(ctx, key, duration).Result()
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoSuchKey
+	}
+	return nil
+}
+
+var incrScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+func (r *redisCache) Incr(ctx context.Context, key string, duration time.Duration) (int64, error) {
+	return incrScript.Run(ctx, r.client, []string{key}, duration.Milliseconds()).Int64()
+}
+
+var compareAndSwapScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if ARGV[1] == "" then
+	if current then
+		return 0
+	end
+elseif current ~= ARGV[1] then
+	return 0
+end
+
+local ms = tonumber(ARGV[3])
+if ms < 0 then
+	redis.call("DEL", KEYS[1])
+elseif ms == 0 then
+	redis.call("SET", KEYS[1], ARGV[2])
+else
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ms)
+end
+return 1
+`)
+
+func (r *redisCache) CompareAndSwap(ctx context.Context, key string, old, value string, duration time.Duration) (bool, error) {
+	// 不足一毫秒的时长不能取整成 0，那表示永不过期
+	ms := duration.Milliseconds()
+	if duration < NeverExpire {
+		ms = -1
+	} else if duration > NeverExpire && ms == 0 {
+		ms = 1
+	}
+
+	n, err := compareAndSwapScript.Run(ctx, r.client, []string{key}, old, value, ms).Int64()
+	return n == 1, err
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisCache(t *testing.T) (*redisCache, *miniredis.Miniredis) {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	c, err := NewRedisCache(context.Background(), &redis.Options{Addr: s.Addr()})
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { _ = c.(*redisCache).client.Close() })
+	return c.(*redisCache), s
+}
+
+// duplicateScanHook returns every SCAN page twice, as redis may do while rehashing
+type duplicateScanHook struct {
+	scans int
+}
+
+func (h *duplicateScanHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *duplicateScanHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if scan, ok := cmd.(*redis.ScanCmd); ok && err == nil {
+			h.scans++
+			page, cursor := scan.Val()
+			scan.SetVal(append(page, page...), cursor)
+		}
+		return err
+	}
+}
+
+func (h *duplicateScanHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRedisKeys(t *testing.T) {
+	const n = scanCount*2 + 10
+
+	c, s := newTestRedisCache(t)
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		_ = s.Set(fmt.Sprintf("session:%d", i), "v")
+	}
+	_ = s.Set("other", "v")
+
+	hook := &duplicateScanHook{}
+	c.client.AddHook(hook)
+
+	keys, err := c.Keys(ctx, "session:*")
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	if len(keys) != n {
+		t.Fatalf("got %d keys, want %d", len(keys), n)
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			t.Fatalf("key %s returned twice", key)
+		}
+		seen[key] = true
+	}
+	// 键多于一页时需要跟随游标多次 SCAN
+	if hook.scans < 2 {
+		t.Fatalf("%d SCAN calls, want the keyspace walked in pages", hook.scans)
+	}
+
+	if keys, err = c.Keys(ctx, "nothing:*"); err != nil || len(keys) != 0 {
+		t.Fatalf("Keys of no match = %v, %v", keys, err)
+	}
+}
+
+func TestRedisSet(t *testing.T) {
+	c, s := newTestRedisCache(t)
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "k", "v", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if ttl := s.TTL("k"); ttl != time.Minute {
+		t.Fatalf("ttl = %v, want 1m", ttl)
+	}
+	if err := c.Set(ctx, "k", "v2", NeverExpire); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if ttl := s.TTL("k"); ttl != 0 {
+		t.Fatalf("ttl = %v, want none", ttl)
+	}
+
+	// 负的时长删除键
+	if err := c.Set(ctx, "k", "v3", -time.Second); err != nil {
+		t.Fatalf("Set negative: %v", err)
+	}
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, ErrNoSuchKey) {
+		t.Fatalf("Get after negative Set err = %v, want ErrNoSuchKey", err)
+	}
+}
+
+func TestRedisExpire(t *testing.T) {
+	c, s := newTestRedisCache(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		setup    func()
+		duration time.Duration
+		err      error
+		ttl      time.Duration
+	}{
+		{name: "missing key", duration: time.Minute, err: ErrNoSuchKey},
+		{name: "persist missing key", duration: NeverExpire, err: ErrNoSuchKey},
+		{
+			name:     "set ttl",
+			setup:    func() { _ = s.Set("k", "v") },
+			duration: time.Minute,
+			ttl:      time.Minute,
+		},
+		{
+			name:     "persist a key with ttl",
+			setup:    func() { _ = s.Set("k", "v"); s.SetTTL("k", time.Minute) },
+			duration: NeverExpire,
+		},
+		{
+			// PERSIST 对没有过期时间的键也返回 0
+			name:     "persist a key without ttl",
+			setup:    func() { _ = s.Set("k", "v") },
+			duration: NeverExpire,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.FlushAll()
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			if err := c.Expire(ctx, "k", tt.duration); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil {
+				if ttl := s.TTL("k"); ttl != tt.ttl {
+					t.Fatalf("ttl = %v, want %v", ttl, tt.ttl)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisExists(t *testing.T) {
+	c, s := newTestRedisCache(t)
+	ctx := context.Background()
+	_ = s.Set("a", "1")
+	_ = s.Set("b", "1")
+
+	tests := []struct {
+		keys []string
+		want bool
+	}{
+		{keys: nil, want: true},
+		{keys: []string{"a"}, want: true},
+		{keys: []string{"a", "b"}, want: true},
+		{keys: []string{"a", "missing"}, want: false},
+		// EXISTS a a 为 2，去重后才不会把一个键当成两个
+		{keys: []string{"a", "a"}, want: true},
+		{keys: []string{"a", "a", "missing"}, want: false},
+	}
+
+	for _, tt := range tests {
+		ok, err := c.Exists(ctx, tt.keys...)
+		if err != nil || ok != tt.want {
+			t.Errorf("Exists(%q) = %v, %v, want %v", tt.keys, ok, err, tt.want)
+		}
+	}
+
+	s.SetTTL("a", time.Second)
+	s.FastForward(time.Second)
+	if ok, _ := c.Exists(ctx, "a", "b"); ok {
+		t.Fatal("Exists reported an expired key")
+	}
+}
+
+func TestRedisIncr(t *testing.T) {
+	c, s := newTestRedisCache(t)
+	ctx := context.Background()
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := c.Incr(ctx, "counter", time.Minute)
+		if err != nil || n != i {
+			t.Fatalf("Incr = %d, %v, want %d", n, err, i)
+		}
+		// 过期时间只在创建时设置，之后的自增不会延长
+		s.FastForward(time.Second * 10)
+	}
+	if ttl := s.TTL("counter"); ttl != time.Second*30 {
+		t.Fatalf("ttl = %v, want 30s", ttl)
+	}
+	s.FastForward(time.Second * 30)
+	if n, err := c.Incr(ctx, "counter", time.Minute); err != nil || n != 1 {
+		t.Fatalf("Incr after expiry = %d, %v, want 1", n, err)
+	}
+
+	if _, err := c.Incr(ctx, "forever", NeverExpire); err != nil {
+		t.Fatalf("Incr: %v", err)
+	}
+	if ttl := s.TTL("forever"); ttl != 0 {
+		t.Fatalf("ttl = %v, want none", ttl)
+	}
+
+	_ = s.Set("text", "abc")
+	if _, err := c.Incr(ctx, "text", time.Minute); err == nil {
+		t.Fatal("Incr of a non integer value succeeded")
+	}
+}
+
+func TestRedisCompareAndSwap(t *testing.T) {
+	c, s := newTestRedisCache(t)
+	testCompareAndSwap(t, c, func(key string) (string, time.Duration, bool) {
+		if !s.Exists(key) {
+			return "", 0, false
+		}
+		value, _ := s.Get(key)
+		return value, s.TTL(key), true
+	})
+}
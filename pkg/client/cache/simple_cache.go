@@ -1,89 +1,208 @@
 package cache
 
 import (
+	"container/list"
 	"context"
 	"errors"
-	"regexp"
-	"strings"
+	"strconv"
 	"sync"
 	"time"
 )
 
 var ErrNoSuchKey = errors.New("no such key")
 
+const (
+	// DefaultMaxEntries bounds the memory cache when no limit is given
+	DefaultMaxEntries = 100000
+	// DefaultCleanupInterval is how often the janitor drops expired keys
+	DefaultCleanupInterval = time.Minute
+)
+
 type simpleObject struct {
+	key         string
 	value       string
 	neverExpire bool
 	expiredAt   time.Time
 }
 
-// SimpleCache implements cache.Interface use memory objects, it should be used only for testing
+func (o *simpleObject) expired(now time.Time) bool {
+	return !o.neverExpire && !now.Before(o.expiredAt)
+}
+
+// simpleCache implements cache.Interface with a bounded LRU in memory, it is only shared inside the process.
+// The least recently used key is evicted once maxEntries is reached, and a janitor drops the expired keys
 type simpleCache struct {
-	store sync.Map
+	mu         sync.Mutex
+	items      map[string]*list.Element
+	lru        *list.List // front is the most recently used
+	maxEntries int
 }
 
-func NewSimpleCache() Interface {
-	return &simpleCache{store: sync.Map{}}
+type SimpleOption func(s *simpleCache)
+
+// WithMaxEntries returns a SimpleOption that bounds the number of keys, zero or less means DefaultMaxEntries
+func WithMaxEntries(n int) SimpleOption {
+	return func(s *simpleCache) {
+		if n > 0 {
+			s.maxEntries = n
+		}
+	}
 }
 
-func (s *simpleCache) Keys(ctx context.Context, pattern string) ([]string, error) {
-	// There is a little difference between go regexp and redis key pattern
-	// In redis, * means any character, while in go . means match everything.
-	pattern = strings.Replace(pattern, "*", ".", -1)
+// WithJanitor returns a SimpleOption that drops expired keys every interval until stopCh is closed
+func WithJanitor(interval time.Duration, stopCh <-chan struct{}) SimpleOption {
+	return func(s *simpleCache) {
+		if interval > 0 {
+			go s.janitor(interval, stopCh)
+		}
+	}
+}
 
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, err
+func NewSimpleCache(opts ...SimpleOption) Interface {
+	s := &simpleCache{
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: DefaultMaxEntries,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *simpleCache) janitor(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteExpired()
+		case <-stopCh:
+			return
+		}
 	}
+}
+
+func (s *simpleCache) deleteExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, elem := range s.items {
+		if elem.Value.(*simpleObject).expired(now) {
+			s.removeElement(elem)
+			metrics.expirations.Add(1)
+		}
+	}
+}
+
+// lookup returns the live object of the key, an expired one is removed. Callers must hold s.mu
+func (s *simpleCache) lookup(key string) (*list.Element, bool) {
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	if elem.Value.(*simpleObject).expired(time.Now()) {
+		s.removeElement(elem)
+		metrics.expirations.Add(1)
+		return nil, false
+	}
+	return elem, true
+}
+
+func (s *simpleCache) removeElement(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.items, elem.Value.(*simpleObject).key)
+}
+
+// store puts the object at the front of the lru and evicts the oldest keys beyond maxEntries. Callers must hold s.mu
+func (s *simpleCache) store(obj *simpleObject) {
+	if elem, ok := s.items[obj.key]; ok {
+		elem.Value = obj
+		s.lru.MoveToFront(elem)
+		return
+	}
+
+	s.items[obj.key] = s.lru.PushFront(obj)
+	for s.lru.Len() > s.maxEntries {
+		s.removeElement(s.lru.Back())
+		metrics.evictions.Add(1)
+	}
+}
+
+// Keys matches the keys with the glob style pattern of redis KEYS
+func (s *simpleCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
 	var keys []string
-	s.store.Range(func(key, value interface{}) bool {
-		if re.MatchString(key.(string)) {
-			keys = append(keys, key.(string))
+	for key, elem := range s.items {
+		if !elem.Value.(*simpleObject).expired(now) && globMatch(pattern, key) {
+			keys = append(keys, key)
 		}
-		return true
-	})
+	}
 
 	return keys, nil
 }
 
 func (s *simpleCache) Set(ctx context.Context, key string, value string, duration time.Duration) error {
-	sobject := simpleObject{
-		value:       value,
-		neverExpire: false,
-		expiredAt:   time.Now().Add(duration),
-	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if duration == NeverExpire {
-		sobject.neverExpire = true
+	// an already elapsed duration stores nothing, as redis SET with a past expiry
+	if duration < NeverExpire {
+		if elem, ok := s.items[key]; ok {
+			s.removeElement(elem)
+		}
+		return nil
 	}
 
-	s.store.Store(key, &sobject)
+	s.store(&simpleObject{
+		key:         key,
+		value:       value,
+		neverExpire: duration == NeverExpire,
+		expiredAt:   time.Now().Add(duration),
+	})
 	return nil
 }
 
 func (s *simpleCache) Del(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for _, key := range keys {
-		s.store.Delete(key)
+		if elem, ok := s.items[key]; ok {
+			s.removeElement(elem)
+		}
 	}
 	return nil
 }
 
 func (s *simpleCache) Get(ctx context.Context, key string) (string, error) {
-	if sobject, ok := s.store.Load(key); ok {
-		obj := sobject.(*simpleObject)
-		if obj.neverExpire || time.Now().Before(obj.expiredAt) {
-			return obj.value, nil
-		}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		s.store.Delete(key)
+	elem, ok := s.lookup(key)
+	if !ok {
+		metrics.misses.Add(1)
+		return "", ErrNoSuchKey
 	}
 
-	return "", ErrNoSuchKey
+	metrics.hits.Add(1)
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*simpleObject).value, nil
 }
 
+// Exists reports whether all the keys exist and have not expired
 func (s *simpleCache) Exists(ctx context.Context, keys ...string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for _, key := range keys {
-		if _, ok := s.store.Load(key); !ok {
+		if _, ok := s.lookup(key); !ok {
 			return false, nil
 		}
 	}
@@ -92,21 +211,72 @@ func (s *simpleCache) Exists(ctx context.Context, keys ...string) (bool, error)
 }
 
 func (s *simpleCache) Expire(ctx context.Context, key string, duration time.Duration) error {
-	value, err := s.Get(ctx, key)
-	if err != nil {
-		return err
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.lookup(key)
+	if !ok {
+		return ErrNoSuchKey
+	}
+	if duration < NeverExpire {
+		s.removeElement(elem)
+		return nil
 	}
 
-	sobject := simpleObject{
-		value:       value,
-		neverExpire: false,
-		expiredAt:   time.Now().Add(duration),
+	obj := elem.Value.(*simpleObject)
+	obj.neverExpire = duration == NeverExpire
+	obj.expiredAt = time.Now().Add(duration)
+	return nil
+}
+
+func (s *simpleCache) Incr(ctx context.Context, key string, duration time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.lookup(key)
+	if !ok {
+		s.store(&simpleObject{
+			key:         key,
+			value:       "1",
+			neverExpire: duration <= NeverExpire,
+			expiredAt:   time.Now().Add(duration),
+		})
+		return 1, nil
 	}
 
-	if duration == NeverExpire {
-		sobject.neverExpire = true
+	// keep the expiration time of the existing key
+	obj := elem.Value.(*simpleObject)
+	n, err := strconv.ParseInt(obj.value, 10, 64)
+	if err != nil {
+		return 0, err
 	}
+	n++
 
-	s.store.Store(key, &sobject)
-	return nil
+	obj.value = strconv.FormatInt(n, 10)
+	s.lru.MoveToFront(elem)
+	return n, nil
+}
+
+func (s *simpleCache) CompareAndSwap(ctx context.Context, key string, old, value string, duration time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.lookup(key)
+	if ok != (old != "") || ok && elem.Value.(*simpleObject).value != old {
+		return false, nil
+	}
+
+	if duration < NeverExpire {
+		if ok {
+			s.removeElement(elem)
+		}
+		return true, nil
+	}
+	s.store(&simpleObject{
+		key:         key,
+		value:       value,
+		neverExpire: duration == NeverExpire,
+		expiredAt:   time.Now().Add(duration),
+	})
+	return true, nil
 }
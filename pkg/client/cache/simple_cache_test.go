@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSimpleCache(opts ...SimpleOption) *simpleCache {
+	return NewSimpleCache(opts...).(*simpleCache)
+}
+
+// expireNow makes the key look expired without waiting for it
+func (s *simpleCache) expireNow(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj := s.items[key].Value.(*simpleObject)
+	obj.neverExpire = false
+	obj.expiredAt = time.Now().Add(-time.Second)
+}
+
+// stored returns the keys held by the cache including the expired ones, most recently used first
+func (s *simpleCache) stored() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, s.lru.Len())
+	for elem := s.lru.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*simpleObject).key)
+	}
+	return keys
+}
+
+func TestSimpleCacheLRU(t *testing.T) {
+	s := newTestSimpleCache(WithMaxEntries(3))
+	ctx := context.Background()
+	evictions := GetMetrics().Evictions
+
+	for _, key := range []string{"a", "b", "c"} {
+		_ = s.Set(ctx, key, "1", NeverExpire)
+	}
+	// 读、写和自增都算作使用
+	_, _ = s.Get(ctx, "a")
+	_ = s.Set(ctx, "b", "2", NeverExpire)
+	_, _ = s.Incr(ctx, "a", NeverExpire)
+	if got := strings.Join(s.stored(), ","); got != "a,b,c" {
+		t.Fatalf("lru = %s, want a,b,c", got)
+	}
+
+	_ = s.Set(ctx, "d", "1", NeverExpire)
+	_ = s.Set(ctx, "e", "1", NeverExpire)
+	if got := strings.Join(s.stored(), ","); got != "e,d,a" {
+		t.Fatalf("lru = %s, want e,d,a", got)
+	}
+	if ok, _ := s.Exists(ctx, "b"); ok {
+		t.Fatal("b was not evicted")
+	}
+	if got := GetMetrics().Evictions - evictions; got != 2 {
+		t.Fatalf("%d evictions, want 2", got)
+	}
+
+	// Exists 不影响淘汰顺序
+	_, _ = s.Exists(ctx, "a")
+	_ = s.Set(ctx, "f", "1", NeverExpire)
+	if got := strings.Join(s.stored(), ","); got != "f,e,d" {
+		t.Fatalf("lru = %s, want f,e,d", got)
+	}
+}
+
+func TestSimpleCacheExpired(t *testing.T) {
+	s := newTestSimpleCache()
+	ctx := context.Background()
+	expirations := GetMetrics().Expirations
+
+	_ = s.Set(ctx, "a", "1", time.Minute)
+	_ = s.Set(ctx, "b", "1", NeverExpire)
+	s.expireNow("a")
+
+	if ok, _ := s.Exists(ctx, "a"); ok {
+		t.Fatal("Exists reported an expired key")
+	}
+	if ok, _ := s.Exists(ctx, "b", "a"); ok {
+		t.Fatal("Exists reported all keys present with one expired")
+	}
+	if ok, _ := s.Exists(ctx, "b"); !ok {
+		t.Fatal("Exists missed a live key")
+	}
+	// 过期的键在访问时被删除
+	if got := strings.Join(s.stored(), ","); got != "b" {
+		t.Fatalf("stored = %s, want b", got)
+	}
+	if got := GetMetrics().Expirations - expirations; got != 1 {
+		t.Fatalf("%d expirations, want 1", got)
+	}
+
+	_ = s.Set(ctx, "c", "1", time.Minute)
+	s.expireNow("c")
+	if keys, _ := s.Keys(ctx, "*"); len(keys) != 1 || keys[0] != "b" {
+		t.Fatalf("Keys = %v, want [b]", keys)
+	}
+	if _, err := s.Get(ctx, "c"); !errors.Is(err, ErrNoSuchKey) {
+		t.Fatalf("Get expired err = %v, want ErrNoSuchKey", err)
+	}
+	if err := s.Expire(ctx, "c", time.Minute); !errors.Is(err, ErrNoSuchKey) {
+		t.Fatalf("Expire expired err = %v, want ErrNoSuchKey", err)
+	}
+}
+
+func TestSimpleCacheNegativeDuration(t *testing.T) {
+	s := newTestSimpleCache()
+	ctx := context.Background()
+
+	// 与 redis 一致，已经过去的时长不保存任何值
+	_ = s.Set(ctx, "a", "1", NeverExpire)
+	if err := s.Set(ctx, "a", "2", -time.Second); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.Set(ctx, "b", "2", -time.Second); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if stored := s.stored(); len(stored) != 0 {
+		t.Fatalf("stored = %v, want none", stored)
+	}
+
+	_ = s.Set(ctx, "c", "1", NeverExpire)
+	if err := s.Expire(ctx, "c", -time.Second); err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if ok, _ := s.Exists(ctx, "c"); ok {
+		t.Fatal("Expire with a negative duration kept the key")
+	}
+}
+
+func TestSimpleCacheExpire(t *testing.T) {
+	s := newTestSimpleCache()
+	ctx := context.Background()
+
+	if err := s.Expire(ctx, "missing", NeverExpire); !errors.Is(err, ErrNoSuchKey) {
+		t.Fatalf("Expire missing err = %v, want ErrNoSuchKey", err)
+	}
+
+	_ = s.Set(ctx, "a", "1", time.Minute)
+	if err := s.Expire(ctx, "a", NeverExpire); err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if obj := s.items["a"].Value.(*simpleObject); !obj.neverExpire {
+		t.Fatal("Expire with NeverExpire kept the ttl")
+	}
+	if err := s.Expire(ctx, "a", time.Minute); err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if obj := s.items["a"].Value.(*simpleObject); obj.neverExpire || time.Until(obj.expiredAt) > time.Minute {
+		t.Fatalf("Expire set %+v, want a ttl of 1m", obj)
+	}
+}
+
+func TestSimpleCacheIncr(t *testing.T) {
+	s := newTestSimpleCache()
+	ctx := context.Background()
+
+	for i := int64(1); i <= 3; i++ {
+		if n, err := s.Incr(ctx, "counter", time.Minute); err != nil || n != i {
+			t.Fatalf("Incr = %d, %v, want %d", n, err, i)
+		}
+	}
+	// 过期时间只在创建时设置
+	s.expireNow("counter")
+	if n, err := s.Incr(ctx, "counter", time.Minute); err != nil || n != 1 {
+		t.Fatalf("Incr after expiry = %d, %v, want 1", n, err)
+	}
+
+	_ = s.Set(ctx, "text", "abc", NeverExpire)
+	if _, err := s.Incr(ctx, "text", time.Minute); err == nil {
+		t.Fatal("Incr of a non integer value succeeded")
+	}
+}
+
+func TestSimpleCacheKeys(t *testing.T) {
+	s := newTestSimpleCache()
+	ctx := context.Background()
+	for _, key := range []string{"session:1", "session:2", "sessions:u1", "token:1"} {
+		_ = s.Set(ctx, key, "1", NeverExpire)
+	}
+
+	keys, err := s.Keys(ctx, "session:*")
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	sort.Strings(keys)
+	if got := strings.Join(keys, ","); got != "session:1,session:2" {
+		t.Fatalf("Keys = %s, want session:1,session:2", got)
+	}
+}
+
+func TestSimpleCacheJanitor(t *testing.T) {
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+
+	s := newTestSimpleCache(WithJanitor(time.Millisecond*5, stopCh))
+	ctx := context.Background()
+	_ = s.Set(ctx, "a", "1", time.Minute)
+	_ = s.Set(ctx, "b", "1", NeverExpire)
+	s.expireNow("a")
+
+	// 不访问过期的键，由清理协程删除
+	deadline := time.Now().Add(time.Second)
+	for len(s.stored()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stored = %v, the janitor didn't drop the expired key", s.stored())
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if got := s.stored(); got[0] != "b" {
+		t.Fatalf("stored = %v, want [b]", got)
+	}
+}
+
+func TestSimpleCacheCompareAndSwap(t *testing.T) {
+	s := newTestSimpleCache()
+	testCompareAndSwap(t, s, func(key string) (string, time.Duration, bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		elem, ok := s.lookup(key)
+		if !ok {
+			return "", 0, false
+		}
+		obj := elem.Value.(*simpleObject)
+		if obj.neverExpire {
+			return obj.value, 0, true
+		}
+		return obj.value, time.Until(obj.expiredAt), true
+	})
+
+	ctx := context.Background()
+	_ = s.Set(ctx, "expired", "v0", time.Minute)
+	s.expireNow("expired")
+	// 过期的键视为不存在
+	if swapped, _ := s.CompareAndSwap(ctx, "expired", "v0", "v1", NeverExpire); swapped {
+		t.Fatal("swapped the value of an expired key")
+	}
+	if swapped, _ := s.CompareAndSwap(ctx, "expired", "", "v1", NeverExpire); !swapped {
+		t.Fatal("couldn't create a key over an expired one")
+	}
+}
@@ -0,0 +1,102 @@
+package dao
+
+import (
+	"context"
+	"time"
+	"v1/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+func InsertChatMessage(ctx context.Context, db *gorm.DB, msg *model.ChatMessage) error {
+	if msg.CreatedAt == 0 {
+		msg.CreatedAt = time.Now().UnixMilli()
+	}
+	return db.WithContext(ctx).Create(msg).Error
+}
+
+// MarkChatMessagesDelivered records that the messages have been pushed to their recipient
+func MarkChatMessagesDelivered(ctx context.Context, db *gorm.DB, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Model(&model.ChatMessage{}).Where("id IN ? AND delivered_at = 0", ids).
+		Update("delivered_at", time.Now().UnixMilli()).Error
+}
+
+// LatestChatMessageID returns the id of the latest message of all conversations, 0 if there is none
+func LatestChatMessageID(ctx context.Context, db *gorm.DB) (int64, error) {
+	var latest *int64
+	err := db.WithContext(ctx).Model(&model.ChatMessage{}).Select("MAX(id)").Scan(&latest).Error
+	if err != nil || latest == nil {
+		return 0, err
+	}
+	return *latest, nil
+}
+
+// ListUndeliveredChatMessages lists the oldest messages to the user up to the message id that have not been pushed yet
+func ListUndeliveredChatMessages(ctx context.Context, db *gorm.DB, uid string, upTo int64, limit int) ([]model.ChatMessage, error) {
+	var messages []model.ChatMessage
+	err := db.WithContext(ctx).Where("recipient_uid = ? AND delivered_at = 0 AND id <= ?", uid, upTo).
+		Order("id").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+// MarkConversationRead marks the messages to the user in the conversation read up to the message id, 0 for all.
+// It returns how many became read
+func MarkConversationRead(ctx context.Context, db *gorm.DB, conversationID, uid string, upTo int64) (int64, error) {
+	now := time.Now().UnixMilli()
+	query := db.WithContext(ctx).Model(&model.ChatMessage{}).
+		Where("conversation_id = ? AND recipient_uid = ? AND read_at = 0", conversationID, uid)
+	if upTo > 0 {
+		query = query.Where("id <= ?", upTo)
+	}
+
+	// 已读的消息一定已投递
+	result := query.Updates(map[string]interface{}{
+		"read_at":      now,
+		"delivered_at": gorm.Expr("CASE WHEN delivered_at = 0 THEN ? ELSE delivered_at END", now),
+	})
+	return result.RowsAffected, result.Error
+}
+
+// ListChatHistory pages the conversation backwards from the message beforeID, the latest first. 0 starts at the latest
+func ListChatHistory(ctx context.Context, db *gorm.DB, conversationID string, beforeID int64, size int) ([]model.ChatMessage, error) {
+	query := db.WithContext(ctx).Where("conversation_id = ?", conversationID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var messages []model.ChatMessage
+	err := query.Order("id DESC").Limit(size).Find(&messages).Error
+	return messages, err
+}
+
+// ListLatestChatMessages returns the latest message of each private conversation of the user, the most recent conversation first
+func ListLatestChatMessages(ctx context.Context, db *gorm.DB, uid string, size int) ([]model.ChatMessage, error) {
+	latest := db.Model(&model.ChatMessage{}).Select("MAX(id)").
+		Where("(sender_uid = ? AND recipient_uid != '') OR recipient_uid = ?", uid, uid).Group("conversation_id")
+
+	var messages []model.ChatMessage
+	err := db.WithContext(ctx).Where("id IN (?)", latest).Order("id DESC").Limit(size).Find(&messages).Error
+	return messages, err
+}
+
+// CountUnreadChatMessages returns the unread messages to the user by conversation
+func CountUnreadChatMessages(ctx context.Context, db *gorm.DB, uid string) (map[string]int64, error) {
+	var rows []struct {
+		ConversationID string
+		Count          int64
+	}
+	err := db.WithContext(ctx).Model(&model.ChatMessage{}).Select("conversation_id, COUNT(*) AS count").
+		Where("recipient_uid = ? AND read_at = 0", uid).Group("conversation_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	unread := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		unread[row.ConversationID] = row.Count
+	}
+	return unread, nil
+}
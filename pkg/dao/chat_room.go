@@ -0,0 +1,309 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"v1/pkg/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRoomMemberNotFound the user is not a member of the room, or has been kicked
+var ErrRoomMemberNotFound = errors.New("not a member of the room")
+
+// roomUser is a user who should be in a room
+type roomUser struct {
+	UID      string
+	Username string
+}
+
+// ensureChatRoom creates the room with its creator as the owner, or loads it if it exists
+func ensureChatRoom(tx *gorm.DB, room *model.ChatRoom) error {
+	room.CreatedAt = time.Now().UnixMilli()
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(room)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return tx.Where("kind = ? AND ref_id = ?", room.Kind, room.RefID).First(room).Error
+	}
+	return addRoomMember(tx, room.ID, room.CreatorUID, room.Creator, model.RoomRoleOwner)
+}
+
+// addRoomMember adds the user to the room, a kicked member stays kicked
+func addRoomMember(tx *gorm.DB, roomID int64, uid, username string, role model.RoomRole) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.ChatRoomMember{
+		RoomID:   roomID,
+		UserUID:  uid,
+		Username: username,
+		Role:     role,
+		JoinedAt: time.Now().UnixMilli(),
+	}).Error
+}
+
+// joinProjectRoom adds the team member to the room of the project, the room is created with the teacher as the owner
+func joinProjectRoom(tx *gorm.DB, projectID int64, uid, username string) error {
+	var project model.Project
+	if err := tx.Where("id = ?", projectID).First(&project).Error; err != nil {
+		return err
+	}
+
+	room := model.ChatRoom{
+		Kind:       model.RoomKindProject,
+		RefID:      strconv.FormatInt(project.ID, 10),
+		Name:       project.ProjectName,
+		CreatorUID: project.CreatorUID,
+		Creator:    project.Creator,
+	}
+	if err := ensureChatRoom(tx, &room); err != nil {
+		return err
+	}
+	return addRoomMember(tx, room.ID, uid, username, model.RoomRoleMember)
+}
+
+// CreateChatRoom creates the room and fills it with the users it is for. It returns the existing room if there is one
+func CreateChatRoom(ctx context.Context, db *gorm.DB, room model.ChatRoom) (*model.ChatRoom, error) {
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ensureChatRoom(tx, &room); err != nil {
+			return err
+		}
+		return syncChatRoom(tx, room)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// roomUsers returns the users the room is for, besides its owner
+func roomUsers(tx *gorm.DB, room model.ChatRoom) ([]roomUser, error) {
+	var users []roomUser
+	switch room.Kind {
+	case model.RoomKindProject:
+		projectID, _ := strconv.ParseInt(room.RefID, 10, 64)
+		err := tx.Model(&model.ProjectMember{}).Select("user_uid AS uid, username").
+			Where("project_id = ?", projectID).Scan(&users).Error
+		return users, err
+	case model.RoomKindClass:
+		err := tx.Model(&model.User{}).Select("uid, username").
+			Where("class_hash_id = ? AND status = ?", room.RefID, model.UserStatusNormal).Scan(&users).Error
+		return users, err
+	case model.RoomKindInterview:
+		interviewID, _ := strconv.ParseInt(room.RefID, 10, 64)
+		err := tx.Model(&model.Interview{}).Select("interviewee_uid AS uid, interviewee AS username").
+			Where("id = ?", interviewID).Scan(&users).Error
+		return users, err
+	}
+	return nil, nil
+}
+
+// syncChatRoom adds the users the room is for and removes the members who no longer are. The owner and the kicked members are kept
+func syncChatRoom(tx *gorm.DB, room model.ChatRoom) error {
+	users, err := roomUsers(tx, room)
+	if err != nil {
+		return err
+	}
+
+	want := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		want[user.UID] = struct{}{}
+		if err = addRoomMember(tx, room.ID, user.UID, user.Username, model.RoomRoleMember); err != nil {
+			return err
+		}
+	}
+
+	var members []model.ChatRoomMember
+	err = tx.Where("room_id = ? AND role = ? AND kicked_at = 0", room.ID, model.RoomRoleMember).Find(&members).Error
+	if err != nil {
+		return err
+	}
+
+	var leave []int64
+	for _, member := range members {
+		if _, ok := want[member.UserUID]; !ok {
+			leave = append(leave, member.ID)
+		}
+	}
+	if len(leave) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", leave).Delete(&model.ChatRoomMember{}).Error
+}
+
+// SyncChatRoom brings the members of the room in line with its project team, class or interview
+func SyncChatRoom(ctx context.Context, db *gorm.DB, room model.ChatRoom) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return syncChatRoom(tx, room)
+	})
+}
+
+// SyncClassRooms syncs the rooms of the classes, after their users changed
+func SyncClassRooms(ctx context.Context, db *gorm.DB, classHashIDs ...string) error {
+	var ids []string
+	for _, id := range classHashIDs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rooms []model.ChatRoom
+	err := db.WithContext(ctx).Where("kind = ? AND ref_id IN ?", model.RoomKindClass, ids).Find(&rooms).Error
+	if err != nil {
+		return err
+	}
+	for _, room := range rooms {
+		if err = SyncChatRoom(ctx, db, room); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ListChatRoomsByKind(ctx context.Context, db *gorm.DB, kind model.RoomKind) ([]model.ChatRoom, error) {
+	var rooms []model.ChatRoom
+	err := db.WithContext(ctx).Where("kind = ?", kind).Order("id").Find(&rooms).Error
+	return rooms, err
+}
+
+func GetChatRoomByID(ctx context.Context, db *gorm.DB, id int64) (bool, model.ChatRoom, error) {
+	var room model.ChatRoom
+	err := db.WithContext(ctx).Where("id = ?", id).First(&room).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, room, nil
+	}
+	if err != nil {
+		return false, room, err
+	}
+	return true, room, nil
+}
+
+// GetChatRoomMember returns the member of the room, not found if the user has been kicked
+func GetChatRoomMember(ctx context.Context, db *gorm.DB, roomID int64, uid string) (bool, model.ChatRoomMember, error) {
+	var member model.ChatRoomMember
+	err := db.WithContext(ctx).Where("room_id = ? AND user_uid = ? AND kicked_at = 0", roomID, uid).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, member, nil
+	}
+	if err != nil {
+		return false, member, err
+	}
+	return true, member, nil
+}
+
+// ListChatRoomMembers lists the members of the room, the owner first
+func ListChatRoomMembers(ctx context.Context, db *gorm.DB, roomID int64) ([]model.ChatRoomMember, error) {
+	var members []model.ChatRoomMember
+	err := db.WithContext(ctx).Where("room_id = ? AND kicked_at = 0", roomID).Order("id").Find(&members).Error
+	return members, err
+}
+
+// ListUserChatRooms lists the rooms of the user with the membership, the latest joined first
+func ListUserChatRooms(ctx context.Context, db *gorm.DB, uid string) ([]model.ChatRoom, []model.ChatRoomMember, error) {
+	var members []model.ChatRoomMember
+	err := db.WithContext(ctx).Where("user_uid = ? AND kicked_at = 0", uid).Order("id DESC").Find(&members).Error
+	if err != nil || len(members) == 0 {
+		return nil, nil, err
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.RoomID)
+	}
+	var rooms []model.ChatRoom
+	if err = db.WithContext(ctx).Where("id IN ?", ids).Find(&rooms).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// 按成员顺序排列
+	byID := make(map[int64]model.ChatRoom, len(rooms))
+	for _, room := range rooms {
+		byID[room.ID] = room
+	}
+	rooms = rooms[:0]
+	for _, member := range members {
+		rooms = append(rooms, byID[member.RoomID])
+	}
+	return rooms, members, nil
+}
+
+// ListLatestMessagesOf returns the latest message of each of the conversations
+func ListLatestMessagesOf(ctx context.Context, db *gorm.DB, conversationIDs []string) ([]model.ChatMessage, error) {
+	if len(conversationIDs) == 0 {
+		return nil, nil
+	}
+	latest := db.Model(&model.ChatMessage{}).Select("MAX(id)").
+		Where("conversation_id IN ?", conversationIDs).Group("conversation_id")
+
+	var messages []model.ChatMessage
+	err := db.WithContext(ctx).Where("id IN (?)", latest).Find(&messages).Error
+	return messages, err
+}
+
+// CountUnreadRoomMessages returns the messages of others after the read cursor of the member
+func CountUnreadRoomMessages(ctx context.Context, db *gorm.DB, member model.ChatRoomMember) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&model.ChatMessage{}).
+		Where("conversation_id = ? AND id > ? AND sender_uid != ?", model.RoomConversationID(member.RoomID), member.ReadID, member.UserUID).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkRoomRead moves the read cursor of the member up to the message id, 0 for the latest. It returns whether it moved
+func MarkRoomRead(ctx context.Context, db *gorm.DB, roomID int64, uid string, upTo int64) (bool, error) {
+	if upTo <= 0 {
+		var latest *int64
+		err := db.WithContext(ctx).Model(&model.ChatMessage{}).Select("MAX(id)").
+			Where("conversation_id = ?", model.RoomConversationID(roomID)).Scan(&latest).Error
+		if err != nil || latest == nil {
+			return false, err
+		}
+		upTo = *latest
+	}
+
+	result := db.WithContext(ctx).Model(&model.ChatRoomMember{}).
+		Where("room_id = ? AND user_uid = ? AND kicked_at = 0 AND read_id < ?", roomID, uid, upTo).
+		Update("read_id", upTo)
+	return result.RowsAffected > 0, result.Error
+}
+
+// MuteRoomMember mutes the member until the time, unix milli, 0 unmutes. The owner can't be muted
+func MuteRoomMember(ctx context.Context, db *gorm.DB, roomID int64, uid string, until int64) error {
+	result := db.WithContext(ctx).Model(&model.ChatRoomMember{}).
+		Where("room_id = ? AND user_uid = ? AND role = ? AND kicked_at = 0", roomID, uid, model.RoomRoleMember).
+		Update("muted_until", until)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoomMemberNotFound
+	}
+	return nil
+}
+
+// KickRoomMember removes the member from the room for good, syncing won't add it back. The owner can't be kicked
+func KickRoomMember(ctx context.Context, db *gorm.DB, roomID int64, uid string) error {
+	result := db.WithContext(ctx).Model(&model.ChatRoomMember{}).
+		Where("room_id = ? AND user_uid = ? AND role = ? AND kicked_at = 0", roomID, uid, model.RoomRoleMember).
+		Update("kicked_at", time.Now().UnixMilli())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoomMemberNotFound
+	}
+	return nil
+}
+
+// ActiveRoomMemberUIDs lists the users in the room
+func ActiveRoomMemberUIDs(ctx context.Context, db *gorm.DB, roomID int64) ([]string, error) {
+	var uids []string
+	err := db.WithContext(ctx).Model(&model.ChatRoomMember{}).Where("room_id = ? AND kicked_at = 0", roomID).
+		Pluck("user_uid", &uids).Error
+	return uids, err
+}
@@ -0,0 +1,194 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+	"v1/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+// roomMembers returns the uids of the members of the room who are not kicked, sorted
+func roomMembers(t *testing.T, db *gorm.DB, roomID int64) []string {
+	t.Helper()
+	uids, err := ActiveRoomMemberUIDs(context.Background(), db, roomID)
+	if err != nil {
+		t.Fatalf("ActiveRoomMemberUIDs: %v", err)
+	}
+	sort.Strings(uids)
+	return uids
+}
+
+func setClass(t *testing.T, db *gorm.DB, uid, classHashID string) {
+	t.Helper()
+	if err := db.Model(&model.User{}).Where("uid = ?", uid).Update("class_hash_id", classHashID).Error; err != nil {
+		t.Fatalf("set class of %s: %v", uid, err)
+	}
+}
+
+func TestSyncClassRoom(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, new(model.User), new(model.ChatRoom), new(model.ChatRoomMember))
+	users := []model.User{
+		{UID: "a", Username: "a", ClassHashID: "c1", Status: model.UserStatusNormal},
+		{UID: "b", Username: "b", ClassHashID: "c1", Status: model.UserStatusNormal},
+		{UID: "c", Username: "c", ClassHashID: "c1", Status: model.UserStatusDisabled},
+		{UID: "d", Username: "d", ClassHashID: "c2", Status: model.UserStatusNormal},
+		{UID: "teacher", Username: "teacher", Status: model.UserStatusNormal},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+
+	room, err := CreateChatRoom(ctx, db, model.ChatRoom{Kind: model.RoomKindClass, RefID: "c1", Name: "c1", CreatorUID: "teacher", Creator: "teacher"})
+	if err != nil {
+		t.Fatalf("CreateChatRoom: %v", err)
+	}
+	// 禁用的用户和其他班级的不在群里
+	if got, want := roomMembers(t, db, room.ID), []string{"a", "b", "teacher"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members %v, want %v", got, want)
+	}
+	again, err := CreateChatRoom(ctx, db, model.ChatRoom{Kind: model.RoomKindClass, RefID: "c1", Name: "again", CreatorUID: "a", Creator: "a"})
+	if err != nil || again.ID != room.ID || again.CreatorUID != "teacher" {
+		t.Fatalf("CreateChatRoom again = %+v, %v, want the existing room", again, err)
+	}
+
+	// a 转到 c2，d 转进 c1；不在班级里的群主不被移出
+	setClass(t, db, "a", "c2")
+	setClass(t, db, "d", "c1")
+	if err = SyncClassRooms(ctx, db, "c1", "c2", ""); err != nil {
+		t.Fatalf("SyncClassRooms: %v", err)
+	}
+	if got, want := roomMembers(t, db, room.ID), []string{"b", "d", "teacher"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members after the class change %v, want %v", got, want)
+	}
+	var owner model.ChatRoomMember
+	if err = db.Where("room_id = ? AND user_uid = ?", room.ID, "teacher").First(&owner).Error; err != nil || owner.Role != model.RoomRoleOwner {
+		t.Fatalf("owner %+v, %v", owner, err)
+	}
+
+	// 被禁用后移出
+	if err = db.Model(&model.User{}).Where("uid = ?", "b").Update("status", model.UserStatusDisabled).Error; err != nil {
+		t.Fatalf("disable b: %v", err)
+	}
+	if err = SyncChatRoom(ctx, db, *room); err != nil {
+		t.Fatalf("SyncChatRoom: %v", err)
+	}
+	if got, want := roomMembers(t, db, room.ID), []string{"d", "teacher"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members after disabling b %v, want %v", got, want)
+	}
+}
+
+func TestSyncProjectRoom(t *testing.T) {
+	ctx := context.Background()
+	db, project, students := newTeamTestDB(t)
+	leader := students[0]
+
+	var room model.ChatRoom
+	if err := db.Where("kind = ? AND ref_id = ?", model.RoomKindProject, strconv.FormatInt(project.ID, 10)).First(&room).Error; err != nil {
+		t.Fatalf("load the room of the project: %v", err)
+	}
+	// 选题后指导老师为群主，组长加入
+	if got, want := roomMembers(t, db, room.ID), []string{leader.UID, "teacher1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members %v, want %v", got, want)
+	}
+
+	invitation, err := InviteMember(ctx, db, project, leader, students[1])
+	if err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	if err = RespondInvitation(ctx, db, invitation.ID, students[1], true); err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if got, want := roomMembers(t, db, room.ID), []string{leader.UID, students[1].UID, "teacher1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members after the accept %v, want %v", got, want)
+	}
+
+	// 离开团队后同步移出，直接加入团队的同步加入
+	if err = db.Where("project_id = ? AND user_uid = ?", project.ID, students[1].UID).Delete(&model.ProjectMember{}).Error; err != nil {
+		t.Fatalf("remove member: %v", err)
+	}
+	member := model.ProjectMember{ProjectID: project.ID, UserUID: students[2].UID, Username: students[2].Username, Role: model.MemberRoleMember}
+	if err = db.Create(&member).Error; err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+	if err = SyncChatRoom(ctx, db, room); err != nil {
+		t.Fatalf("SyncChatRoom: %v", err)
+	}
+	if got, want := roomMembers(t, db, room.ID), []string{leader.UID, students[2].UID, "teacher1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members after the team change %v, want %v", got, want)
+	}
+}
+
+func TestKickRoomMember(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, new(model.User), new(model.ChatRoom), new(model.ChatRoomMember))
+	users := []model.User{
+		{UID: "a", Username: "a", ClassHashID: "c1", Status: model.UserStatusNormal},
+		{UID: "b", Username: "b", ClassHashID: "c1", Status: model.UserStatusNormal},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+	room, err := CreateChatRoom(ctx, db, model.ChatRoom{Kind: model.RoomKindClass, RefID: "c1", Name: "c1", CreatorUID: "teacher", Creator: "teacher"})
+	if err != nil {
+		t.Fatalf("CreateChatRoom: %v", err)
+	}
+
+	// 群主不能被禁言或移出
+	if err = MuteRoomMember(ctx, db, room.ID, "teacher", time.Now().Add(time.Hour).UnixMilli()); !errors.Is(err, ErrRoomMemberNotFound) {
+		t.Fatalf("mute the owner err = %v, want ErrRoomMemberNotFound", err)
+	}
+	if err = KickRoomMember(ctx, db, room.ID, "teacher"); !errors.Is(err, ErrRoomMemberNotFound) {
+		t.Fatalf("kick the owner err = %v, want ErrRoomMemberNotFound", err)
+	}
+	if found, owner, err := GetChatRoomMember(ctx, db, room.ID, "teacher"); err != nil || !found || owner.MutedUntil != 0 || owner.KickedAt != 0 {
+		t.Fatalf("owner %+v, %v, %v", owner, found, err)
+	}
+
+	until := time.Now().Add(time.Hour).UnixMilli()
+	if err = MuteRoomMember(ctx, db, room.ID, "a", until); err != nil {
+		t.Fatalf("mute: %v", err)
+	}
+	if _, member, _ := GetChatRoomMember(ctx, db, room.ID, "a"); !member.Muted(time.Now().UnixMilli()) || member.Muted(until) {
+		t.Fatalf("member %+v, want muted until %d", member, until)
+	}
+	if err = MuteRoomMember(ctx, db, room.ID, "a", 0); err != nil {
+		t.Fatalf("unmute: %v", err)
+	}
+	if _, member, _ := GetChatRoomMember(ctx, db, room.ID, "a"); member.Muted(time.Now().UnixMilli()) {
+		t.Fatalf("member %+v still muted", member)
+	}
+
+	if err = KickRoomMember(ctx, db, room.ID, "b"); err != nil {
+		t.Fatalf("kick: %v", err)
+	}
+	if err = KickRoomMember(ctx, db, room.ID, "b"); !errors.Is(err, ErrRoomMemberNotFound) {
+		t.Fatalf("kick again err = %v, want ErrRoomMemberNotFound", err)
+	}
+	if err = MuteRoomMember(ctx, db, room.ID, "b", until); !errors.Is(err, ErrRoomMemberNotFound) {
+		t.Fatalf("mute the kicked member err = %v, want ErrRoomMemberNotFound", err)
+	}
+
+	// 被移出的成员仍在班级里，同步后也不会回来
+	if err = SyncClassRooms(ctx, db, "c1"); err != nil {
+		t.Fatalf("SyncClassRooms: %v", err)
+	}
+	if found, _, err := GetChatRoomMember(ctx, db, room.ID, "b"); err != nil || found {
+		t.Fatalf("kicked member found %v, %v after the sync", found, err)
+	}
+	if got, want := roomMembers(t, db, room.ID), []string{"a", "teacher"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members %v, want %v", got, want)
+	}
+	if _, err = CreateChatRoom(ctx, db, model.ChatRoom{Kind: model.RoomKindClass, RefID: "c1", CreatorUID: "teacher", Creator: "teacher"}); err != nil {
+		t.Fatalf("CreateChatRoom again: %v", err)
+	}
+	if rooms, _, err := ListUserChatRooms(ctx, db, "b"); err != nil || len(rooms) != 0 {
+		t.Fatalf("rooms of the kicked member %+v, %v, want none", rooms, err)
+	}
+}
@@ -0,0 +1,150 @@
+package dao
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"v1/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+// sendChatMessages stores the messages from one user to the other in order and returns their ids
+func sendChatMessages(t *testing.T, db *gorm.DB, from, to string, n int) []int64 {
+	t.Helper()
+	ids := make([]int64, n)
+	for i := range ids {
+		msg := model.ChatMessage{ConversationID: model.PrivateConversationID(from, to), SenderUID: from, RecipientUID: to, Content: "hi"}
+		if err := InsertChatMessage(context.Background(), db, &msg); err != nil {
+			t.Fatalf("InsertChatMessage: %v", err)
+		}
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func messageIDs(messages []model.ChatMessage) []int64 {
+	ids := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestListChatHistory(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, new(model.ChatMessage))
+	conversation := model.PrivateConversationID("alice", "bob")
+	ids := append(sendChatMessages(t, db, "alice", "bob", 3), sendChatMessages(t, db, "bob", "alice", 2)...)
+	// 其他会话的消息不出现
+	sendChatMessages(t, db, "alice", "carol", 2)
+
+	// 从最新一条往前翻页
+	var pages [][]int64
+	before := int64(0)
+	for {
+		messages, err := ListChatHistory(ctx, db, conversation, before, 2)
+		if err != nil {
+			t.Fatalf("ListChatHistory: %v", err)
+		}
+		if len(messages) == 0 {
+			break
+		}
+		pages = append(pages, messageIDs(messages))
+		before = messages[len(messages)-1].ID
+	}
+	want := [][]int64{{ids[4], ids[3]}, {ids[2], ids[1]}, {ids[0]}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("pages %v, want %v", pages, want)
+	}
+}
+
+func TestMarkConversationRead(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, new(model.ChatMessage))
+	toBob := sendChatMessages(t, db, "alice", "bob", 3)
+	toAlice := sendChatMessages(t, db, "bob", "alice", 1)
+	sendChatMessages(t, db, "carol", "bob", 2)
+	conversation := model.PrivateConversationID("alice", "bob")
+
+	unread := func(uid string) map[string]int64 {
+		t.Helper()
+		n, err := CountUnreadChatMessages(ctx, db, uid)
+		if err != nil {
+			t.Fatalf("CountUnreadChatMessages: %v", err)
+		}
+		return n
+	}
+	want := map[string]int64{conversation: 3, model.PrivateConversationID("bob", "carol"): 2}
+	if got := unread("bob"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unread of bob %v, want %v", got, want)
+	}
+
+	// 读到第二条，只改 bob 收到的消息
+	if n, err := MarkConversationRead(ctx, db, conversation, "bob", toBob[1]); err != nil || n != 2 {
+		t.Fatalf("MarkConversationRead = %d, %v, want 2", n, err)
+	}
+	if got := unread("bob")[conversation]; got != 1 {
+		t.Fatalf("unread of bob in the conversation %d, want 1", got)
+	}
+	if got := unread("alice")[conversation]; got != 1 {
+		t.Fatalf("unread of alice %d, want 1", got)
+	}
+
+	// 已读的消息同时记为已投递，再次标记不改变已读时间
+	var read model.ChatMessage
+	if err := db.First(&read, toBob[0]).Error; err != nil || read.ReadAt == 0 || read.DeliveredAt != read.ReadAt {
+		t.Fatalf("read message %+v, %v, want read and delivered", read, err)
+	}
+	if n, err := MarkConversationRead(ctx, db, conversation, "bob", toBob[1]); err != nil || n != 0 {
+		t.Fatalf("MarkConversationRead again = %d, %v, want 0", n, err)
+	}
+
+	// 0 表示全部已读
+	if n, err := MarkConversationRead(ctx, db, conversation, "bob", 0); err != nil || n != 1 {
+		t.Fatalf("MarkConversationRead all = %d, %v, want 1", n, err)
+	}
+	if got, ok := unread("bob")[conversation]; ok {
+		t.Fatalf("unread of bob in the conversation %d, want none", got)
+	}
+	if got := unread("alice")[conversation]; got != 1 {
+		t.Fatalf("message %d to alice read by bob", toAlice[0])
+	}
+}
+
+func TestListUndeliveredChatMessages(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, new(model.ChatMessage))
+	if latest, err := LatestChatMessageID(ctx, db); err != nil || latest != 0 {
+		t.Fatalf("LatestChatMessageID of no messages = %d, %v", latest, err)
+	}
+
+	ids := sendChatMessages(t, db, "alice", "bob", 4)
+	sendChatMessages(t, db, "bob", "alice", 1)
+	if err := MarkChatMessagesDelivered(ctx, db, ids[1:2]); err != nil {
+		t.Fatalf("MarkChatMessagesDelivered: %v", err)
+	}
+	latest, err := LatestChatMessageID(ctx, db)
+	if err != nil {
+		t.Fatalf("LatestChatMessageID: %v", err)
+	}
+	// 之后的消息不列出
+	later := sendChatMessages(t, db, "alice", "bob", 1)
+
+	messages, err := ListUndeliveredChatMessages(ctx, db, "bob", latest, 2)
+	if err != nil {
+		t.Fatalf("ListUndeliveredChatMessages: %v", err)
+	}
+	if got, want := messageIDs(messages), []int64{ids[0], ids[2]}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("first batch %v, want %v", got, want)
+	}
+	if err = MarkChatMessagesDelivered(ctx, db, messageIDs(messages)); err != nil {
+		t.Fatalf("MarkChatMessagesDelivered: %v", err)
+	}
+	if messages, err = ListUndeliveredChatMessages(ctx, db, "bob", latest, 2); err != nil || !reflect.DeepEqual(messageIDs(messages), []int64{ids[3]}) {
+		t.Fatalf("second batch %v, %v, want [%d]", messageIDs(messages), err, ids[3])
+	}
+	if messages, err = ListUndeliveredChatMessages(ctx, db, "bob", later[0], 10); err != nil || len(messages) != 2 {
+		t.Fatalf("undelivered up to the later message %v, %v, want 2", messageIDs(messages), err)
+	}
+}
@@ -0,0 +1,43 @@
+package dao
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns an in-memory database with the tables of the models
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+	return openTestDB(t, "file:"+t.Name()+"?mode=memory&cache=shared", models...)
+}
+
+// newConcurrentTestDB returns a database for concurrent transactions. sqlite has no row locks,
+// every transaction takes the write lock when it begins and the others wait for it, as they would on a locked row
+func newConcurrentTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+	return openTestDB(t, "file:"+filepath.Join(t.TempDir(), "test.db")+"?_txlock=immediate&_busy_timeout=10000", models...)
+}
+
+func openTestDB(t *testing.T, dsn string, models ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	for _, m := range models {
+		// sqlite 的索引名全局唯一，多张表同名的 idx_created_at 会冲突，表已建好即可
+		if err = db.AutoMigrate(m); err != nil && !(strings.Contains(err.Error(), "already exists") && db.Migrator().HasTable(m)) {
+			t.Fatalf("AutoMigrate %T: %v", m, err)
+		}
+	}
+	return db
+}
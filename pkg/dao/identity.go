@@ -0,0 +1,48 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+	"v1/pkg/model"
+)
+
+func GetUserIdentity(ctx context.Context, db *gorm.DB, provider, subject string) (bool, *model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := db.WithContext(ctx).Model(&model.UserIdentity{}).
+		Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return true, &identity, nil
+}
+
+// ProvisionUser creates the user of an external identity and links them in one transaction
+func ProvisionUser(ctx context.Context, db *gorm.DB, userInfo model.User, provider, subject string) (*model.User, error) {
+	var user *model.User
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		u, err := InsertUser(ctx, tx, userInfo)
+		if err != nil {
+			return err
+		}
+		user = u
+
+		return tx.Create(&model.UserIdentity{
+			UserUID:   u.UID,
+			Provider:  provider,
+			Subject:   subject,
+			CreatedAt: time.Now().UnixMilli(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func DeleteUserIdentities(ctx context.Context, db *gorm.DB, userUID string) error {
+	return db.WithContext(ctx).Where("user_uid = ?", userUID).Delete(&model.UserIdentity{}).Error
+}
@@ -2,7 +2,9 @@ package dao
 
 import (
 	"context"
+	"errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 	"v1/pkg/model"
 )
@@ -11,6 +13,9 @@ func InsertProject(ctx context.Context, db *gorm.DB, project model.Project) (*mo
 
 	project.CreatedAt = time.Now().UnixMilli()
 	project.Status = model.ProjectStatusAudit
+	if project.Capacity <= 0 {
+		project.Capacity = 1
+	}
 
 	if err := db.WithContext(ctx).Create(&project).Error; err != nil {
 		return nil, err
@@ -26,21 +31,120 @@ func GetProjectByID(ctx context.Context, db *gorm.DB, id int64) (bool, model.Pro
 	return true, project, nil
 }
 
-func UpdateProjectStatus(ctx context.Context, db *gorm.DB, id int64, status model.ProjectStatus) error {
-	err := db.WithContext(ctx).Model(&model.Project{}).Where("id = ?", id).Update("status", status).Error
+var (
+	// ErrProjectStatusChanged the project was written by someone else after it was read, or left the expected status
+	ErrProjectStatusChanged = errors.New("project status changed")
+	// ErrStudentHasProject the student already takes part in an active project
+	ErrStudentHasProject = errors.New("student already has an active project")
+)
 
-	return err
+// TransitProjectStatus moves the project from history.FromStatus to history.ToStatus together with the extra column updates,
+// and records the history in one transaction
+func TransitProjectStatus(ctx context.Context, db *gorm.DB, project model.Project, history model.ProjectStatusHistory, updates map[string]interface{}) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return transitProjectStatus(tx, project, history, updates)
+	})
 }
 
-func UpdateProjectParticipator(ctx context.Context, db *gorm.DB, id int64, user model.User) error {
-	changeInfo := map[string]interface{}{
-		"participator":    user.Username,
-		"participator_id": user.UID,
-		"status":          model.ProjectStatusProceed,
+// transitProjectStatus writes the transition only if the project is still at the version it was read,
+// so concurrent writers can't overwrite each other. scopes add conditions the row must also meet
+func transitProjectStatus(tx *gorm.DB, project model.Project, history model.ProjectStatusHistory, updates map[string]interface{},
+	scopes ...func(*gorm.DB) *gorm.DB) error {
+	changeInfo := map[string]interface{}{"status": history.ToStatus, "version": gorm.Expr("version + 1")}
+	for k, v := range updates {
+		changeInfo[k] = v
+	}
+
+	result := tx.Model(&model.Project{}).Scopes(scopes...).
+		Where("id = ? AND status = ? AND version = ?", project.ID, history.FromStatus, project.Version).
+		Updates(changeInfo)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrProjectStatusChanged
 	}
-	err := db.WithContext(ctx).Model(&model.Project{}).Where("id = ?", id).Updates(changeInfo).Error
 
-	return err
+	history.ProjectID = project.ID
+	history.CreatedAt = time.Now().UnixMilli()
+	return tx.Create(&history).Error
+}
+
+// unclaimed limits the update to a project nobody takes part in yet
+func unclaimed(db *gorm.DB) *gorm.DB {
+	return db.Where("participator_id = '' OR participator_id IS NULL")
+}
+
+// lockStudents locks the user rows so the check of their active projects holds until the transaction ends
+func lockStudents(tx *gorm.DB, uids []string) error {
+	var users []model.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("uid IN ?", uids).Order("uid").Find(&users).Error
+}
+
+// activeParticipators returns those of the students who are in the team of an active project. Callers should hold lockStudents
+func activeParticipators(tx *gorm.DB, uids []string) ([]string, error) {
+	var active []string
+	err := tx.Model(&model.ProjectMember{}).
+		Joins("JOIN projects ON projects.id = project_members.project_id").
+		Where("project_members.user_uid IN ? AND projects.status IN ?", uids, model.ActiveProjectStatuses).
+		Distinct().Pluck("project_members.user_uid", &active).Error
+	return active, err
+}
+
+// ClaimProject lets the user take the project as the team leader, and the project starts proceeding with the phases of its profession.
+// The claim succeeds only for a passed project nobody has taken, and only if the user has no active project
+func ClaimProject(ctx context.Context, db *gorm.DB, project model.Project, user model.User) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockStudents(tx, []string{user.UID}); err != nil {
+			return err
+		}
+		active, err := activeParticipators(tx, []string{user.UID})
+		if err != nil {
+			return err
+		}
+		if len(active) > 0 {
+			return ErrStudentHasProject
+		}
+
+		err = transitProjectStatus(tx, project, model.ProjectStatusHistory{
+			FromStatus: model.ProjectStatusPASS,
+			ToStatus:   model.ProjectStatusProceed,
+			ActorUID:   user.UID,
+			Actor:      user.Username,
+			ActorRole:  user.Role,
+		}, map[string]interface{}{
+			"participator":    user.Username,
+			"participator_id": user.UID,
+		}, unclaimed)
+		if err != nil {
+			return err
+		}
+		if err = addProjectMember(tx, project.ID, user.UID, user.Username, model.MemberRoleLeader); err != nil {
+			return err
+		}
+
+		now := time.Now().UnixMilli()
+		err = tx.Create(&model.ProjectSelectLog{
+			ProjectID:    project.ID,
+			ProjectName:  project.ProjectName,
+			Applicant:    user.Username,
+			ApplicantUID: user.UID,
+			Status:       model.ApplicationAccepted,
+			CreatedAt:    now,
+			DecidedAt:    now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return createProjectPhases(tx, project.ID, project.ProfessionHashID)
+	})
+}
+
+func ListProjectStatusHistory(ctx context.Context, db *gorm.DB, projectID int64) ([]model.ProjectStatusHistory, error) {
+	var history []model.ProjectStatusHistory
+	err := db.WithContext(ctx).Where("project_id = ?", projectID).Order("id").Find(&history).Error
+	return history, err
 }
 
 func DeleteProjectByID(ctx context.Context, db *gorm.DB, id int64) error {
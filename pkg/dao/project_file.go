@@ -0,0 +1,176 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+	"v1/pkg/model"
+	"v1/pkg/storage"
+	"v1/pkg/utils"
+)
+
+// InsertProjectFile adds the file as the next version of its name and makes it the latest file of the project
+func InsertProjectFile(ctx context.Context, db *gorm.DB, file model.ProjectFile) (*model.ProjectFile, error) {
+	file.CreatedAt = time.Now().UnixMilli()
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var version int
+		err := tx.Model(&model.ProjectFile{}).Where("project_id = ? AND name = ?", file.ProjectID, file.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+		if err != nil {
+			return err
+		}
+		// a concurrent upload of the same version fails on the unique index
+		file.Version = version + 1
+
+		if err = tx.Create(&file).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Project{}).Where("id = ?", file.ProjectID).Update("project_file_id", file.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func GetProjectFileByID(ctx context.Context, db *gorm.DB, id int64) (bool, model.ProjectFile, error) {
+	var file model.ProjectFile
+	err := db.WithContext(ctx).Where("id = ?", id).First(&file).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, file, nil
+	}
+	if err != nil {
+		return false, file, err
+	}
+	return true, file, nil
+}
+
+// ListProjectFiles lists all versions of the files of the project, the latest first
+func ListProjectFiles(ctx context.Context, db *gorm.DB, projectID int64) ([]model.ProjectFile, error) {
+	var files []model.ProjectFile
+	err := db.WithContext(ctx).Where("project_id = ?", projectID).Order("name, version DESC").Find(&files).Error
+	return files, err
+}
+
+// legacyBlobBatch is how many projects MigrateProjectFileBlobs loads at once, the blobs are held in memory
+const legacyBlobBatch = 20
+
+// legacyFileExtensions names the migrated files by the detected type, the old column kept no file name
+var legacyFileExtensions = map[string]string{
+	"application/pdf":              ".pdf",
+	"application/zip":              ".zip",
+	"application/x-rar-compressed": ".rar",
+	"application/x-gzip":           ".gz",
+	"image/png":                    ".png",
+	"image/jpeg":                   ".jpg",
+	"text/plain":                   ".txt",
+}
+
+type legacyProjectBlob struct {
+	ID          int64
+	CreatorUID  string
+	ProjectFile []byte
+}
+
+// MigrateProjectFileBlobs moves the files kept in the old projects.project_file column into the storage
+// as a model.ProjectFile, and clears the column. Each project is migrated in its own
+// transaction, a run that stopped halfway continues where it left off. It returns how many files were moved
+func MigrateProjectFileBlobs(ctx context.Context, db *gorm.DB, store storage.Interface) (int, error) {
+	if !db.Migrator().HasColumn(&model.Project{}, "project_file") {
+		return 0, nil
+	}
+
+	var (
+		moved  int
+		lastID int64
+	)
+	for {
+		var batch []legacyProjectBlob
+		err := db.WithContext(ctx).Table(model.Project{}.TableName()).Select("id, creator_uid, project_file").
+			Where("id > ? AND project_file IS NOT NULL", lastID).Order("id").Limit(legacyBlobBatch).Find(&batch).Error
+		if err != nil {
+			return moved, err
+		}
+		if len(batch) == 0 {
+			return moved, nil
+		}
+
+		for _, blob := range batch {
+			lastID = blob.ID
+			ok, err := migrateProjectFileBlob(ctx, db, store, blob)
+			if err != nil {
+				return moved, fmt.Errorf("project %d: %w", blob.ID, err)
+			}
+			if ok {
+				moved++
+			}
+		}
+	}
+}
+
+func migrateProjectFileBlob(ctx context.Context, db *gorm.DB, store storage.Interface, blob legacyProjectBlob) (bool, error) {
+	// 空内容不生成文件，只清空旧列
+	if len(blob.ProjectFile) == 0 {
+		return false, db.WithContext(ctx).Table(model.Project{}.TableName()).Where("id = ?", blob.ID).
+			Update("project_file", nil).Error
+	}
+
+	sum := sha256.Sum256(blob.ProjectFile)
+	file := model.ProjectFile{
+		ProjectID:   blob.ID,
+		Name:        "project_file",
+		Size:        int64(len(blob.ProjectFile)),
+		ContentType: http.DetectContentType(blob.ProjectFile),
+		SHA256:      hex.EncodeToString(sum[:]),
+		StorageKey:  path.Join("projects", strconv.FormatInt(blob.ID, 10), utils.NextID()),
+		UploaderUID: blob.CreatorUID,
+		CreatedAt:   time.Now().UnixMilli(),
+	}
+	if mediaType, _, err := mime.ParseMediaType(file.ContentType); err == nil {
+		file.Name += legacyFileExtensions[mediaType]
+	}
+
+	if err := store.Put(ctx, file.StorageKey, bytes.NewReader(blob.ProjectFile), file.Size, file.ContentType); err != nil {
+		return false, err
+	}
+
+	var migrated bool
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 只有旧列仍有内容时才迁移，同时启动的其他实例已经迁移过的跳过
+		res := tx.Table(model.Project{}.TableName()).Where("id = ? AND project_file IS NOT NULL", blob.ID).
+			Update("project_file", nil)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		var version int
+		err := tx.Model(&model.ProjectFile{}).Where("project_id = ? AND name = ?", file.ProjectID, file.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+		if err != nil {
+			return err
+		}
+		file.Version = version + 1
+		if err = tx.Create(&file).Error; err != nil {
+			return err
+		}
+
+		// 已经上传过新文件的项目保留最新的文件
+		err = tx.Model(&model.Project{}).Where("id = ? AND project_file_id = 0", blob.ID).
+			Update("project_file_id", file.ID).Error
+		migrated = err == nil
+		return err
+	})
+	if err != nil || !migrated {
+		_ = store.Delete(ctx, file.StorageKey)
+	}
+	return migrated, err
+}
@@ -0,0 +1,122 @@
+package dao
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+	"v1/pkg/model"
+	"v1/pkg/storage"
+)
+
+func TestMigrateProjectFileBlobs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, new(model.Project), new(model.ProjectFile))
+	// 旧版本的列
+	if err := db.Exec("ALTER TABLE projects ADD COLUMN project_file BLOB").Error; err != nil {
+		t.Fatalf("add project_file: %v", err)
+	}
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+
+	pdf := []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\n")
+	text := []byte("plain text proposal")
+	projects := []struct {
+		id     int64
+		blob   []byte
+		fileID int64 // latest file uploaded after the upgrade
+	}{
+		{id: 1, blob: pdf},
+		{id: 2, blob: text, fileID: 99},
+		{id: 3, blob: []byte{}},
+		{id: 4},
+	}
+	for _, p := range projects {
+		err = db.Create(&model.Project{ID: p.id, ProjectName: "p", CreatorUID: "teacher1", ProjectFileID: p.fileID}).Error
+		if err == nil && p.blob != nil {
+			err = db.Exec("UPDATE projects SET project_file = ? WHERE id = ?", p.blob, p.id).Error
+		}
+		if err != nil {
+			t.Fatalf("create project %d: %v", p.id, err)
+		}
+	}
+
+	moved, err := MigrateProjectFileBlobs(ctx, db, store)
+	if err != nil {
+		t.Fatalf("MigrateProjectFileBlobs: %v", err)
+	}
+	if moved != 2 {
+		t.Fatalf("moved %d files, want 2", moved)
+	}
+
+	tests := []struct {
+		projectID   int64
+		content     []byte
+		name        string
+		contentType string
+		latest      bool // whether it became the latest file of the project
+	}{
+		{projectID: 1, content: pdf, name: "project_file.pdf", contentType: "application/pdf", latest: true},
+		{projectID: 2, content: text, name: "project_file.txt", contentType: "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		files, err := ListProjectFiles(ctx, db, tt.projectID)
+		if err != nil || len(files) != 1 {
+			t.Fatalf("project %d files = %+v, %v, want one", tt.projectID, files, err)
+		}
+		f := files[0]
+		sum := sha256.Sum256(tt.content)
+		if f.Version != 1 || f.Size != int64(len(tt.content)) || f.SHA256 != hex.EncodeToString(sum[:]) || f.UploaderUID != "teacher1" {
+			t.Fatalf("project %d file = %+v", tt.projectID, f)
+		}
+		if f.ContentType != tt.contentType || f.Name != tt.name {
+			t.Fatalf("project %d file named %q of %q, want %q of %q", tt.projectID, f.Name, f.ContentType, tt.name, tt.contentType)
+		}
+
+		r, err := store.Get(ctx, f.StorageKey)
+		if err != nil {
+			t.Fatalf("store.Get: %v", err)
+		}
+		got, _ := io.ReadAll(r)
+		_ = r.Close()
+		if string(got) != string(tt.content) {
+			t.Fatalf("project %d stored %q, want %q", tt.projectID, got, tt.content)
+		}
+
+		_, project, _ := GetProjectByID(ctx, db, tt.projectID)
+		if latest := project.ProjectFileID == f.ID; latest != tt.latest {
+			t.Fatalf("project %d file id = %d, migrated file %d, want latest %v", tt.projectID, project.ProjectFileID, f.ID, tt.latest)
+		}
+	}
+
+	var left int64
+	db.Table("projects").Where("project_file IS NOT NULL").Count(&left)
+	if left != 0 {
+		t.Fatalf("%d projects still have a blob", left)
+	}
+	var files int64
+	db.Model(&model.ProjectFile{}).Count(&files)
+	if files != 2 {
+		t.Fatalf("%d files recorded, want 2", files)
+	}
+
+	// 再次运行没有可迁移的内容
+	if moved, err = MigrateProjectFileBlobs(ctx, db, store); err != nil || moved != 0 {
+		t.Fatalf("second run = %d, %v, want 0, nil", moved, err)
+	}
+}
+
+func TestMigrateProjectFileBlobsWithoutColumn(t *testing.T) {
+	db := newTestDB(t, new(model.Project), new(model.ProjectFile))
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+
+	if moved, err := MigrateProjectFileBlobs(context.Background(), db, store); err != nil || moved != 0 {
+		t.Fatalf("MigrateProjectFileBlobs = %d, %v, want 0, nil", moved, err)
+	}
+}
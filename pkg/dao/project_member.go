@@ -0,0 +1,213 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+	"v1/pkg/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrTeamFull the project has as many members, pending invitations included, as its capacity
+	ErrTeamFull = errors.New("project team is full")
+	// ErrInvitationExists the student is already a member or invited
+	ErrInvitationExists = errors.New("already a member or invited")
+	// ErrInvitationHandled the invitation has been accepted or declined
+	ErrInvitationHandled = errors.New("invitation already handled")
+)
+
+// addProjectMember adds the user to the team and to the chat room of the project
+func addProjectMember(tx *gorm.DB, projectID int64, uid, username string, role model.MemberRole) error {
+	err := tx.Create(&model.ProjectMember{
+		ProjectID: projectID,
+		UserUID:   uid,
+		Username:  username,
+		Role:      role,
+		JoinedAt:  time.Now().UnixMilli(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	return joinProjectRoom(tx, projectID, uid, username)
+}
+
+// ListProjectMembers lists the team of the project in joining order, the leader always joins first
+func ListProjectMembers(ctx context.Context, db *gorm.DB, projectID int64) ([]model.ProjectMember, error) {
+	var members []model.ProjectMember
+	err := db.WithContext(ctx).Where("project_id = ?", projectID).Order("id").Find(&members).Error
+	return members, err
+}
+
+func GetProjectMember(ctx context.Context, db *gorm.DB, projectID int64, uid string) (bool, model.ProjectMember, error) {
+	var member model.ProjectMember
+	err := db.WithContext(ctx).Where("project_id = ? AND user_uid = ?", projectID, uid).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, member, nil
+	}
+	if err != nil {
+		return false, member, err
+	}
+	return true, member, nil
+}
+
+// MemberProjectIDs is the subquery of the ids of the projects the user is a member of
+func MemberProjectIDs(db *gorm.DB, uid string) *gorm.DB {
+	return db.Model(&model.ProjectMember{}).Select("project_id").Where("user_uid = ?", uid)
+}
+
+// InviteMember invites the student to the team of the project. The pending invitations count against the capacity
+func InviteMember(ctx context.Context, db *gorm.DB, project model.Project, inviter, invitee model.User) (*model.ProjectInvitation, error) {
+	invitation := model.ProjectInvitation{
+		ProjectID:   project.ID,
+		ProjectName: project.ProjectName,
+		InviterUID:  inviter.UID,
+		Inviter:     inviter.Username,
+		InviteeUID:  invitee.UID,
+		Invitee:     invitee.Username,
+		Status:      model.InvitationPending,
+		CreatedAt:   time.Now().UnixMilli(),
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁住项目，邀请与接受邀请串行执行
+		var locked model.Project
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", project.ID).First(&locked).Error; err != nil {
+			return err
+		}
+
+		var members, invited int64
+		if err := tx.Model(&model.ProjectMember{}).Where("project_id = ?", project.ID).Count(&members).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.ProjectInvitation{}).Where("project_id = ? AND status = ?", project.ID, model.InvitationPending).
+			Count(&invited).Error; err != nil {
+			return err
+		}
+		if members+invited >= int64(locked.Capacity) {
+			return ErrTeamFull
+		}
+
+		var existing int64
+		err := tx.Model(&model.ProjectMember{}).Where("project_id = ? AND user_uid = ?", project.ID, invitee.UID).Count(&existing).Error
+		if err != nil {
+			return err
+		}
+		if existing == 0 {
+			err = tx.Model(&model.ProjectInvitation{}).Where("project_id = ? AND invitee_uid = ? AND status = ?",
+				project.ID, invitee.UID, model.InvitationPending).Count(&existing).Error
+			if err != nil {
+				return err
+			}
+		}
+		if existing > 0 {
+			return ErrInvitationExists
+		}
+
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// RespondInvitation accepts or declines the invitation of the user. Accepting joins the team
+// if the project is still active, the team is not full and the user has no other active project,
+// otherwise the invitation becomes invalid so it no longer counts against the capacity
+func RespondInvitation(ctx context.Context, db *gorm.DB, invitationID int64, user model.User, accept bool) error {
+	err := respondInvitation(ctx, db, invitationID, user, accept)
+	if errors.Is(err, ErrTeamFull) || errors.Is(err, ErrStudentHasProject) || errors.Is(err, ErrProjectStatusChanged) {
+		// 接受失败的事务已回滚，邀请单独作废，否则一直占着名额
+		result := db.WithContext(ctx).Model(&model.ProjectInvitation{}).
+			Where("id = ? AND invitee_uid = ? AND status = ?", invitationID, user.UID, model.InvitationPending).
+			Updates(map[string]interface{}{"status": model.InvitationInvalid, "responded_at": time.Now().UnixMilli()})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return err
+}
+
+func respondInvitation(ctx context.Context, db *gorm.DB, invitationID int64, user model.User, accept bool) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var invitation model.ProjectInvitation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND invitee_uid = ? AND status = ?", invitationID, user.UID, model.InvitationPending).
+			First(&invitation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvitationHandled
+		}
+		if err != nil {
+			return err
+		}
+
+		status := model.InvitationDeclined
+		if accept {
+			status = model.InvitationAccepted
+		}
+		err = tx.Model(&invitation).Updates(map[string]interface{}{"status": status, "responded_at": time.Now().UnixMilli()}).Error
+		if err != nil || !accept {
+			return err
+		}
+
+		var project model.Project
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status IN ?", invitation.ProjectID, model.ActiveProjectStatuses).First(&project).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProjectStatusChanged
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = lockStudents(tx, []string{user.UID}); err != nil {
+			return err
+		}
+		active, err := activeParticipators(tx, []string{user.UID})
+		if err != nil {
+			return err
+		}
+		if len(active) > 0 {
+			return ErrStudentHasProject
+		}
+
+		var members int64
+		if err = tx.Model(&model.ProjectMember{}).Where("project_id = ?", project.ID).Count(&members).Error; err != nil {
+			return err
+		}
+		if members >= int64(project.Capacity) {
+			return ErrTeamFull
+		}
+
+		return addProjectMember(tx, project.ID, user.UID, user.Username, model.MemberRoleMember)
+	})
+}
+
+// ListUserInvitations lists the pending invitations to the user
+func ListUserInvitations(ctx context.Context, db *gorm.DB, uid string) ([]model.ProjectInvitation, error) {
+	var invitations []model.ProjectInvitation
+	err := db.WithContext(ctx).Where("invitee_uid = ? AND status = ?", uid, model.InvitationPending).
+		Order("id DESC").Find(&invitations).Error
+	return invitations, err
+}
+
+// BackfillProjectLeaders adds the participator of the projects taken before teams existed as their leader
+func BackfillProjectLeaders(ctx context.Context, db *gorm.DB) error {
+	var projects []model.Project
+	err := db.WithContext(ctx).Where("participator_id != '' AND participator_id IS NOT NULL").
+		Where("id NOT IN (?)", db.Model(&model.ProjectMember{}).Select("project_id")).
+		Find(&projects).Error
+	if err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		if err = addProjectMember(db.WithContext(ctx), project.ID, project.ParticipatorID, project.Participator, model.MemberRoleLeader); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"v1/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+// newTeamTestDB returns a database with a project of capacity 3 led by students[0], and the other students
+func newTeamTestDB(t *testing.T) (*gorm.DB, model.Project, []model.User) {
+	t.Helper()
+	db := newClaimTestDB(t)
+	students := createStudents(t, db, 6)
+
+	project := createPassedProject(t, db, "team")
+	if err := db.Model(&project).Update("capacity", 3).Error; err != nil {
+		t.Fatalf("set capacity: %v", err)
+	}
+	if err := ClaimProject(context.Background(), db, project, students[0]); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if err := db.First(&project, project.ID).Error; err != nil {
+		t.Fatalf("load project: %v", err)
+	}
+	return db, project, students
+}
+
+func invitationStatus(t *testing.T, db *gorm.DB, id int64) model.InvitationStatus {
+	t.Helper()
+	var invitation model.ProjectInvitation
+	if err := db.First(&invitation, id).Error; err != nil {
+		t.Fatalf("load invitation: %v", err)
+	}
+	return invitation.Status
+}
+
+func TestInviteMember(t *testing.T) {
+	ctx := context.Background()
+	db, project, students := newTeamTestDB(t)
+	leader := students[0]
+
+	first, err := InviteMember(ctx, db, project, leader, students[1])
+	if err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	if first.Status != model.InvitationPending || first.InviteeUID != students[1].UID || first.ProjectName != project.ProjectName {
+		t.Fatalf("invitation %+v", first)
+	}
+
+	// 已是成员或已有待回复的邀请
+	for _, invitee := range []model.User{leader, students[1]} {
+		if _, err = InviteMember(ctx, db, project, leader, invitee); !errors.Is(err, ErrInvitationExists) {
+			t.Fatalf("invite %s again err = %v, want ErrInvitationExists", invitee.UID, err)
+		}
+	}
+
+	// 待回复的邀请占用名额：1 个成员加 2 个邀请已满
+	if _, err = InviteMember(ctx, db, project, leader, students[2]); err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	if _, err = InviteMember(ctx, db, project, leader, students[3]); !errors.Is(err, ErrTeamFull) {
+		t.Fatalf("invite over the capacity err = %v, want ErrTeamFull", err)
+	}
+	if got := count(t, db, new(model.ProjectInvitation), "project_id = ?", project.ID); got != 2 {
+		t.Fatalf("%d invitations, want 2", got)
+	}
+}
+
+func TestRespondInvitation(t *testing.T) {
+	ctx := context.Background()
+	db, project, students := newTeamTestDB(t)
+	leader := students[0]
+
+	accepted, err := InviteMember(ctx, db, project, leader, students[1])
+	if err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	declined, err := InviteMember(ctx, db, project, leader, students[2])
+	if err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+
+	// 只有被邀请的人能回复
+	if err = RespondInvitation(ctx, db, accepted.ID, students[2], true); !errors.Is(err, ErrInvitationHandled) {
+		t.Fatalf("respond to the invitation of another err = %v, want ErrInvitationHandled", err)
+	}
+
+	if err = RespondInvitation(ctx, db, accepted.ID, students[1], true); err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if found, member, err := GetProjectMember(ctx, db, project.ID, students[1].UID); err != nil || !found || member.Role != model.MemberRoleMember {
+		t.Fatalf("member %+v, %v, %v, want a member", member, found, err)
+	}
+	if got := count(t, db, new(model.ChatRoomMember), "user_uid = ?", students[1].UID); got != 1 {
+		t.Fatalf("accepted student in %d chat rooms, want the room of the project", got)
+	}
+	if got := invitationStatus(t, db, accepted.ID); got != model.InvitationAccepted {
+		t.Fatalf("status %d, want accepted", got)
+	}
+	if err = RespondInvitation(ctx, db, accepted.ID, students[1], false); !errors.Is(err, ErrInvitationHandled) {
+		t.Fatalf("respond again err = %v, want ErrInvitationHandled", err)
+	}
+
+	if err = RespondInvitation(ctx, db, declined.ID, students[2], false); err != nil {
+		t.Fatalf("decline: %v", err)
+	}
+	if found, _, _ := GetProjectMember(ctx, db, project.ID, students[2].UID); found {
+		t.Fatal("declined student joined the team")
+	}
+	if got := invitationStatus(t, db, declined.ID); got != model.InvitationDeclined {
+		t.Fatalf("status %d, want declined", got)
+	}
+
+	// 拒绝后名额空出，同一个人可以再被邀请
+	if _, err = InviteMember(ctx, db, project, leader, students[2]); err != nil {
+		t.Fatalf("invite after the decline: %v", err)
+	}
+	if _, err = InviteMember(ctx, db, project, leader, students[3]); !errors.Is(err, ErrTeamFull) {
+		t.Fatalf("invite over the capacity err = %v, want ErrTeamFull", err)
+	}
+}
+
+func TestRespondInvitationFailedAccept(t *testing.T) {
+	ctx := context.Background()
+	db, project, students := newTeamTestDB(t)
+	leader := students[0]
+
+	// students[1] 已在另一个进行中的项目里
+	other := createPassedProject(t, db, "other")
+	if err := ClaimProject(ctx, db, other, students[1]); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	busy, err := InviteMember(ctx, db, project, leader, students[1])
+	if err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	if _, err = InviteMember(ctx, db, project, leader, students[2]); err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+
+	if err = RespondInvitation(ctx, db, busy.ID, students[1], true); !errors.Is(err, ErrStudentHasProject) {
+		t.Fatalf("accept with another project err = %v, want ErrStudentHasProject", err)
+	}
+	if found, _, _ := GetProjectMember(ctx, db, project.ID, students[1].UID); found {
+		t.Fatal("student joined two active projects")
+	}
+	// 失效的邀请不再占用名额，也不能再接受
+	if got := invitationStatus(t, db, busy.ID); got != model.InvitationInvalid {
+		t.Fatalf("status %d, want invalid", got)
+	}
+	if err = RespondInvitation(ctx, db, busy.ID, students[1], true); !errors.Is(err, ErrInvitationHandled) {
+		t.Fatalf("accept the invalid invitation err = %v, want ErrInvitationHandled", err)
+	}
+	closing, err := InviteMember(ctx, db, project, leader, students[3])
+	if err != nil {
+		t.Fatalf("invite after the failed accept: %v", err)
+	}
+
+	// 项目结束后接受
+	if err = db.Model(&project).Update("status", model.ProjectStatusFinish).Error; err != nil {
+		t.Fatalf("finish project: %v", err)
+	}
+	if err = RespondInvitation(ctx, db, closing.ID, students[3], true); !errors.Is(err, ErrProjectStatusChanged) {
+		t.Fatalf("accept after the project finished err = %v, want ErrProjectStatusChanged", err)
+	}
+	if got := invitationStatus(t, db, closing.ID); got != model.InvitationInvalid {
+		t.Fatalf("status %d, want invalid", got)
+	}
+
+	// 团队在邀请之后被缩小
+	if err = db.Model(&project).Updates(map[string]interface{}{"status": model.ProjectStatusProceed, "capacity": 1}).Error; err != nil {
+		t.Fatalf("shrink the team: %v", err)
+	}
+	var pending model.ProjectInvitation
+	if err = db.Where("invitee_uid = ?", students[2].UID).First(&pending).Error; err != nil {
+		t.Fatalf("load invitation: %v", err)
+	}
+	if err = RespondInvitation(ctx, db, pending.ID, students[2], true); !errors.Is(err, ErrTeamFull) {
+		t.Fatalf("accept to a full team err = %v, want ErrTeamFull", err)
+	}
+	if got := invitationStatus(t, db, pending.ID); got != model.InvitationInvalid {
+		t.Fatalf("status %d, want invalid", got)
+	}
+	if got := count(t, db, new(model.ProjectMember), "project_id = ?", project.ID); got != 1 {
+		t.Fatalf("%d members, want the leader only", got)
+	}
+}
@@ -0,0 +1,121 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+	"v1/pkg/model"
+)
+
+func InsertPhaseTemplate(ctx context.Context, db *gorm.DB, template model.PhaseTemplate) (*model.PhaseTemplate, error) {
+	template.CreatedAt = time.Now().UnixMilli()
+	if err := db.WithContext(ctx).Create(&template).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func GetPhaseTemplateByID(ctx context.Context, db *gorm.DB, id int64) (bool, model.PhaseTemplate, error) {
+	var template model.PhaseTemplate
+	err := db.WithContext(ctx).Where("id = ?", id).First(&template).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, template, nil
+	}
+	if err != nil {
+		return false, template, err
+	}
+	return true, template, nil
+}
+
+func ListPhaseTemplates(ctx context.Context, db *gorm.DB, professionHashID string) ([]model.PhaseTemplate, error) {
+	var templates []model.PhaseTemplate
+	err := db.WithContext(ctx).Where("profession_hash_id = ?", professionHashID).Order("sequence, id").Find(&templates).Error
+	return templates, err
+}
+
+// DeletePhaseTemplate deletes the template, phases already generated from it are kept
+func DeletePhaseTemplate(ctx context.Context, db *gorm.DB, id int64) error {
+	return db.WithContext(ctx).Where("id = ?", id).Delete(&model.PhaseTemplate{}).Error
+}
+
+// createProjectPhases generates the phases of the project from the templates of its profession
+func createProjectPhases(tx *gorm.DB, projectID int64, professionHashID string) error {
+	var templates []model.PhaseTemplate
+	if err := tx.Where("profession_hash_id = ?", professionHashID).Order("sequence, id").Find(&templates).Error; err != nil {
+		return err
+	}
+	if len(templates) == 0 {
+		return nil
+	}
+
+	phases := make([]model.ProjectPhase, 0, len(templates))
+	for _, template := range templates {
+		phases = append(phases, model.ProjectPhase{
+			ProjectID:    projectID,
+			TemplateID:   template.ID,
+			Name:         template.Name,
+			Sequence:     template.Sequence,
+			Deadline:     template.Deadline,
+			Deliverables: template.Deliverables,
+			Status:       model.PhaseStatusPending,
+		})
+	}
+	return tx.Create(&phases).Error
+}
+
+func ListProjectPhases(ctx context.Context, db *gorm.DB, projectID int64) ([]model.ProjectPhase, error) {
+	var phases []model.ProjectPhase
+	err := db.WithContext(ctx).Where("project_id = ?", projectID).Order("sequence, id").Find(&phases).Error
+	return phases, err
+}
+
+func GetProjectPhaseByID(ctx context.Context, db *gorm.DB, id int64) (bool, model.ProjectPhase, error) {
+	var phase model.ProjectPhase
+	err := db.WithContext(ctx).Where("id = ?", id).First(&phase).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, phase, nil
+	}
+	if err != nil {
+		return false, phase, err
+	}
+	return true, phase, nil
+}
+
+// SubmitProjectPhase stores the submission of a pending or rejected phase, false if the phase was submitted concurrently
+func SubmitProjectPhase(ctx context.Context, db *gorm.DB, id int64, submitterUID string, submission []byte) (bool, error) {
+	result := db.WithContext(ctx).Model(&model.ProjectPhase{}).
+		Where("id = ? AND status IN (?)", id, []model.PhaseStatus{model.PhaseStatusPending, model.PhaseStatusRejected}).
+		Updates(map[string]interface{}{
+			"status":        model.PhaseStatusSubmitted,
+			"submission":    submission,
+			"submitter_uid": submitterUID,
+			"submitted_at":  time.Now().UnixMilli(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReviewProjectPhase approves or rejects a submitted phase, false if the phase is not waiting for review
+func ReviewProjectPhase(ctx context.Context, db *gorm.DB, id int64, reviewerUID string, approved bool, comment string) (bool, error) {
+	status := model.PhaseStatusRejected
+	if approved {
+		status = model.PhaseStatusApproved
+	}
+
+	result := db.WithContext(ctx).Model(&model.ProjectPhase{}).
+		Where("id = ? AND status = ?", id, model.PhaseStatusSubmitted).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"reviewer_uid":   reviewerUID,
+			"review_comment": comment,
+			"reviewed_at":    time.Now().UnixMilli(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ProjectPhasesApproved reports whether every phase of the project is approved, true for a project without phases
+func ProjectPhasesApproved(ctx context.Context, db *gorm.DB, projectID int64) (bool, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&model.ProjectPhase{}).
+		Where("project_id = ? AND status != ?", projectID, model.PhaseStatusApproved).Count(&count).Error
+	return count == 0, err
+}
@@ -0,0 +1,200 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"v1/pkg/model"
+
+	"gorm.io/gorm"
+)
+
+func newClaimTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newConcurrentTestDB(t, new(model.User), new(model.Project), new(model.ProjectMember), new(model.ProjectStatusHistory),
+		new(model.ProjectSelectLog), new(model.PhaseTemplate), new(model.ProjectPhase), new(model.ChatRoom), new(model.ChatRoomMember),
+		new(model.ProjectInvitation))
+
+	templates := []model.PhaseTemplate{
+		{ProfessionHashID: "p-cs", Name: "opening", Sequence: 1, CreatorUID: "teacher1"},
+		{ProfessionHashID: "p-cs", Name: "closing", Sequence: 2, CreatorUID: "teacher1"},
+	}
+	if err := db.Create(&templates).Error; err != nil {
+		t.Fatalf("create templates: %v", err)
+	}
+	return db
+}
+
+func createStudents(t *testing.T, db *gorm.DB, n int) []model.User {
+	t.Helper()
+	users := make([]model.User, n)
+	for i := range users {
+		users[i] = model.User{UID: fmt.Sprintf("s%02d", i), Username: fmt.Sprintf("student%02d", i), Role: model.RoleTypeStudent, ProfessionHashID: "p-cs"}
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("create students: %v", err)
+	}
+	return users
+}
+
+func createPassedProject(t *testing.T, db *gorm.DB, name string) model.Project {
+	t.Helper()
+	project := model.Project{ProjectName: name, Status: model.ProjectStatusPASS, ProfessionHashID: "p-cs", CreatorUID: "teacher1", Creator: "teacher"}
+	if err := db.Create(&project).Error; err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	return project
+}
+
+// isClaimRefused reports whether the claim lost the race the way ClaimProject promises
+func isClaimRefused(err error) bool {
+	return errors.Is(err, ErrProjectStatusChanged) || errors.Is(err, ErrStudentHasProject)
+}
+
+func count(t *testing.T, db *gorm.DB, m any, query string, args ...any) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Model(m).Where(query, args...).Count(&n).Error; err != nil {
+		t.Fatalf("count %T: %v", m, err)
+	}
+	return n
+}
+
+func TestClaimProjectConcurrently(t *testing.T) {
+	const n = 12
+
+	ctx := context.Background()
+	db := newClaimTestDB(t)
+	students := createStudents(t, db, n)
+	// 所有人读到的都是同一个版本
+	project := createPassedProject(t, db, "p1")
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range students {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = ClaimProject(ctx, db, project, students[i])
+		}(i)
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if winner >= 0 {
+				t.Fatalf("%s and %s both claimed the project", students[winner].UID, students[i].UID)
+			}
+			winner = i
+		case !isClaimRefused(err):
+			t.Fatalf("claim of %s: %v", students[i].UID, err)
+		}
+	}
+	if winner < 0 {
+		t.Fatal("nobody claimed the project")
+	}
+
+	var got model.Project
+	if err := db.First(&got, project.ID).Error; err != nil {
+		t.Fatalf("load project: %v", err)
+	}
+	if got.Status != model.ProjectStatusProceed || got.ParticipatorID != students[winner].UID || got.Version != project.Version+1 {
+		t.Fatalf("project status %d, participator %q, version %d, want %d, %q, %d",
+			got.Status, got.ParticipatorID, got.Version, model.ProjectStatusProceed, students[winner].UID, project.Version+1)
+	}
+	// 失败的事务不留下任何记录
+	for _, c := range []struct {
+		m    any
+		want int64
+	}{
+		{m: new(model.ProjectMember), want: 1},
+		{m: new(model.ProjectStatusHistory), want: 1},
+		{m: new(model.ProjectSelectLog), want: 1},
+		{m: new(model.ProjectPhase), want: 2},
+	} {
+		if got := count(t, db, c.m, "project_id = ?", project.ID); got != c.want {
+			t.Fatalf("%d rows of %T, want %d", got, c.m, c.want)
+		}
+	}
+	if got := count(t, db, new(model.ProjectMember), "user_uid = ?", students[winner].UID); got != 1 {
+		t.Fatalf("winner is a member of %d projects, want 1", got)
+	}
+}
+
+func TestClaimProjectOneActiveProject(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sequential", func(t *testing.T) {
+		db := newClaimTestDB(t)
+		student := createStudents(t, db, 1)[0]
+		first, second := createPassedProject(t, db, "p1"), createPassedProject(t, db, "p2")
+
+		if err := ClaimProject(ctx, db, first, student); err != nil {
+			t.Fatalf("claim first project: %v", err)
+		}
+		if err := ClaimProject(ctx, db, second, student); !errors.Is(err, ErrStudentHasProject) {
+			t.Fatalf("claim second project err = %v, want ErrStudentHasProject", err)
+		}
+
+		var got model.Project
+		if err := db.First(&got, second.ID).Error; err != nil {
+			t.Fatalf("load project: %v", err)
+		}
+		if got.Status != model.ProjectStatusPASS || got.ParticipatorID != "" {
+			t.Fatalf("second project status %d, participator %q, want it still open", got.Status, got.ParticipatorID)
+		}
+
+		// 项目结束后不再占用名额
+		if err := db.Model(&model.Project{}).Where("id = ?", first.ID).Update("status", model.ProjectStatusFinish).Error; err != nil {
+			t.Fatalf("finish project: %v", err)
+		}
+		if err := ClaimProject(ctx, db, second, student); err != nil {
+			t.Fatalf("claim after the first project finished: %v", err)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		const n = 8
+
+		db := newClaimTestDB(t)
+		student := createStudents(t, db, 1)[0]
+		projects := make([]model.Project, n)
+		for i := range projects {
+			projects[i] = createPassedProject(t, db, fmt.Sprintf("p%d", i))
+		}
+
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := range projects {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = ClaimProject(ctx, db, projects[i], student)
+			}(i)
+		}
+		wg.Wait()
+
+		claimed := 0
+		for i, err := range errs {
+			switch {
+			case err == nil:
+				claimed++
+			case !errors.Is(err, ErrStudentHasProject):
+				t.Fatalf("claim of %s: %v, want ErrStudentHasProject", projects[i].ProjectName, err)
+			}
+		}
+		if claimed != 1 {
+			t.Fatalf("student claimed %d projects, want 1", claimed)
+		}
+		if got := count(t, db, new(model.Project), "status = ?", model.ProjectStatusProceed); got != 1 {
+			t.Fatalf("%d projects proceeding, want 1", got)
+		}
+		if got := count(t, db, new(model.ProjectMember), "user_uid = ?", student.UID); got != 1 {
+			t.Fatalf("student is a member of %d projects, want 1", got)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+	"v1/pkg/matching"
+	"v1/pkg/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSelectionRoundClosed the round no longer accepts preferences or has been matched
+var ErrSelectionRoundClosed = errors.New("selection round closed")
+
+func InsertSelectionRound(ctx context.Context, db *gorm.DB, round model.SelectionRound) (*model.SelectionRound, error) {
+	round.CreatedAt = time.Now().UnixMilli()
+	round.Status = model.SelectionRoundOpen
+
+	if err := db.WithContext(ctx).Create(&round).Error; err != nil {
+		return nil, err
+	}
+	return &round, nil
+}
+
+func GetSelectionRoundByID(ctx context.Context, db *gorm.DB, id int64) (bool, model.SelectionRound, error) {
+	var round model.SelectionRound
+	if err := db.WithContext(ctx).Where("id = ?", id).First(&round).Error; err != nil {
+		return false, round, err
+	}
+	return true, round, nil
+}
+
+func ListSelectionRounds(ctx context.Context, db *gorm.DB, professionHashID string) ([]model.SelectionRound, error) {
+	var rounds []model.SelectionRound
+	err := db.WithContext(ctx).Where("profession_hash_id = ?", professionHashID).Order("id DESC").Find(&rounds).Error
+	return rounds, err
+}
+
+// SelectionRoundInProgress reports whether the profession has a round that started and has not been matched,
+// projects of the profession can't be taken directly meanwhile
+func SelectionRoundInProgress(ctx context.Context, db *gorm.DB, professionHashID string) (bool, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&model.SelectionRound{}).
+		Where("profession_hash_id = ? AND status = ? AND start_at <= ?", professionHashID, model.SelectionRoundOpen, time.Now().UnixMilli()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListDueSelectionRounds lists the open rounds whose deadline has passed
+func ListDueSelectionRounds(ctx context.Context, db *gorm.DB) ([]model.SelectionRound, error) {
+	var rounds []model.SelectionRound
+	err := db.WithContext(ctx).Where("status = ? AND end_at <= ?", model.SelectionRoundOpen, time.Now().UnixMilli()).
+		Find(&rounds).Error
+	return rounds, err
+}
+
+// lockOpenRound locks the round against matching until the transaction ends
+func lockOpenRound(tx *gorm.DB, roundID int64) error {
+	var round model.SelectionRound
+	err := tx.Clauses(clause.Locking{Strength: "SHARE"}).
+		Where("id = ? AND status = ?", roundID, model.SelectionRoundOpen).First(&round).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSelectionRoundClosed
+	}
+	return err
+}
+
+// SubmitPreferences replaces the preferences of the user in the round, projects are ordered from the most preferred.
+// The replaced applications are kept as withdrawn
+func SubmitPreferences(ctx context.Context, db *gorm.DB, roundID int64, user model.User, projects []model.Project) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockOpenRound(tx, roundID); err != nil {
+			return err
+		}
+
+		now := time.Now().UnixMilli()
+		err := tx.Model(&model.ProjectSelectLog{}).
+			Where("round_id = ? AND applicant_uid = ? AND status = ?", roundID, user.UID, model.ApplicationPending).
+			Updates(map[string]interface{}{"status": model.ApplicationWithdrawn, "decided_at": now}).Error
+		if err != nil || len(projects) == 0 {
+			return err
+		}
+
+		logs := make([]model.ProjectSelectLog, 0, len(projects))
+		for i, project := range projects {
+			logs = append(logs, model.ProjectSelectLog{
+				RoundID:      roundID,
+				ProjectID:    project.ID,
+				ProjectName:  project.ProjectName,
+				Applicant:    user.Username,
+				ApplicantUID: user.UID,
+				Rank:         i + 1,
+				Status:       model.ApplicationPending,
+				CreatedAt:    now,
+			})
+		}
+		return tx.Create(&logs).Error
+	})
+}
+
+// ListUserApplications lists the applications of the user in the round, withdrawn ones excluded
+func ListUserApplications(ctx context.Context, db *gorm.DB, roundID int64, uid string) ([]model.ProjectSelectLog, error) {
+	var logs []model.ProjectSelectLog
+	err := db.WithContext(ctx).Where("round_id = ? AND applicant_uid = ? AND status != ?", roundID, uid, model.ApplicationWithdrawn).
+		Order("`rank`").Find(&logs).Error
+	return logs, err
+}
+
+// ListProjectApplications lists the applications to the project in the round, the ranked ones first
+func ListProjectApplications(ctx context.Context, db *gorm.DB, roundID, projectID int64) ([]model.ProjectSelectLog, error) {
+	var logs []model.ProjectSelectLog
+	err := db.WithContext(ctx).Where("round_id = ? AND project_id = ? AND status != ?", roundID, projectID, model.ApplicationWithdrawn).
+		Find(&logs).Error
+	sortApplications(logs)
+	return logs, err
+}
+
+// RankApplicants sets the teacher's ranking of the applicants to the project, the first uid is the best.
+// Applicants left out stay unranked
+func RankApplicants(ctx context.Context, db *gorm.DB, roundID, projectID int64, uids []string) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockOpenRound(tx, roundID); err != nil {
+			return err
+		}
+
+		applications := tx.Model(&model.ProjectSelectLog{}).Where("round_id = ? AND project_id = ? AND status = ?",
+			roundID, projectID, model.ApplicationPending)
+		if err := applications.Session(&gorm.Session{}).Update("teacher_rank", 0).Error; err != nil {
+			return err
+		}
+		for i, uid := range uids {
+			err := applications.Session(&gorm.Session{}).Where("applicant_uid = ?", uid).Update("teacher_rank", i+1).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sortApplications orders the applications to a project as the project prefers them:
+// by the teacher's ranking, the unranked ones after by how much the student wants the project, then by time
+func sortApplications(logs []model.ProjectSelectLog) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		a, b := logs[i], logs[j]
+		if (a.TeacherRank == 0) != (b.TeacherRank == 0) {
+			return a.TeacherRank != 0
+		}
+		if a.TeacherRank != b.TeacherRank {
+			return a.TeacherRank < b.TeacherRank
+		}
+		if a.Rank != b.Rank {
+			return a.Rank < b.Rank
+		}
+		return a.ID < b.ID
+	})
+}
+
+// MatchSelectionRound closes the round and assigns the projects with the student-proposing stable matching.
+// Each matched project proceeds with its best ranked student as the team leader and the others as members. It returns how many students are matched
+func MatchSelectionRound(ctx context.Context, db *gorm.DB, roundID int64, actor model.User) (int, error) {
+	matched := 0
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		result := tx.Model(&model.SelectionRound{}).Where("id = ? AND status = ?", roundID, model.SelectionRoundOpen).
+			Updates(map[string]interface{}{"status": model.SelectionRoundMatched, "matched_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSelectionRoundClosed
+		}
+
+		var logs []model.ProjectSelectLog
+		if err := tx.Where("round_id = ? AND status = ?", roundID, model.ApplicationPending).Find(&logs).Error; err != nil {
+			return err
+		}
+
+		projectIDs := make([]int64, 0, len(logs))
+		uids := make([]string, 0, len(logs))
+		for _, log := range logs {
+			projectIDs = append(projectIDs, log.ProjectID)
+			uids = append(uids, log.ApplicantUID)
+		}
+
+		// 只分配仍可选的项目，并锁住它们防止同时被直接选走
+		var projects []model.Project
+		var busy []string
+		if len(logs) > 0 {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(unclaimed).
+				Where("id IN ? AND status = ?", projectIDs, model.ProjectStatusPASS).
+				Find(&projects).Error
+			if err != nil {
+				return err
+			}
+
+			// 已经有项目的学生不再参与分配
+			if err = lockStudents(tx, uids); err != nil {
+				return err
+			}
+			if busy, err = activeParticipators(tx, uids); err != nil {
+				return err
+			}
+		}
+
+		in, byProject := matchingInput(logs, projects, busy)
+		assignment := matching.StudentProposing(in)
+
+		available := make(map[int64]model.Project, len(projects))
+		for _, project := range projects {
+			available[project.ID] = project
+		}
+
+		var accepted []int64
+		for projectID, applications := range byProject {
+			// 按项目的偏好顺序，排名最高的学生任组长
+			var team []model.ProjectSelectLog
+			for _, application := range applications {
+				if assignment[application.ApplicantUID] == projectID {
+					team = append(team, application)
+					accepted = append(accepted, application.ID)
+				}
+			}
+			if len(team) == 0 {
+				continue
+			}
+			matched += len(team)
+			leader := team[0]
+
+			project := available[projectID]
+			err := transitProjectStatus(tx, project, model.ProjectStatusHistory{
+				FromStatus: model.ProjectStatusPASS,
+				ToStatus:   model.ProjectStatusProceed,
+				ActorUID:   actor.UID,
+				Actor:      actor.Username,
+				ActorRole:  actor.Role,
+				Reason:     "selection round matched",
+			}, map[string]interface{}{
+				"participator":    leader.Applicant,
+				"participator_id": leader.ApplicantUID,
+			}, unclaimed)
+			if err != nil {
+				return err
+			}
+			for i, member := range team {
+				role := model.MemberRoleMember
+				if i == 0 {
+					role = model.MemberRoleLeader
+				}
+				if err = addProjectMember(tx, project.ID, member.ApplicantUID, member.Applicant, role); err != nil {
+					return err
+				}
+			}
+			if err = createProjectPhases(tx, project.ID, project.ProfessionHashID); err != nil {
+				return err
+			}
+		}
+
+		if len(accepted) > 0 {
+			err := tx.Model(&model.ProjectSelectLog{}).Where("id IN ?", accepted).
+				Updates(map[string]interface{}{"status": model.ApplicationAccepted, "decided_at": now}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.ProjectSelectLog{}).Where("round_id = ? AND status = ?", roundID, model.ApplicationPending).
+			Updates(map[string]interface{}{"status": model.ApplicationRejected, "decided_at": now}).Error
+	})
+	return matched, err
+}
+
+// matchingInput builds the preferences from the pending applications, and returns the applications to each available project
+// in the order the project prefers them
+func matchingInput(logs []model.ProjectSelectLog, projects []model.Project, busy []string) (matching.Input, map[int64][]model.ProjectSelectLog) {
+	in := matching.Input{
+		Preferences: make(map[string][]int64),
+		Capacity:    make(map[int64]int, len(projects)),
+		Ranks:       make(map[int64]map[string]int, len(projects)),
+	}
+	for _, project := range projects {
+		in.Capacity[project.ID] = project.Capacity
+	}
+	excluded := make(map[string]bool, len(busy))
+	for _, uid := range busy {
+		excluded[uid] = true
+	}
+
+	byProject := make(map[int64][]model.ProjectSelectLog)
+	byStudent := make(map[string][]model.ProjectSelectLog)
+	for _, log := range logs {
+		if _, ok := in.Capacity[log.ProjectID]; !ok || excluded[log.ApplicantUID] {
+			continue
+		}
+		byProject[log.ProjectID] = append(byProject[log.ProjectID], log)
+		byStudent[log.ApplicantUID] = append(byStudent[log.ApplicantUID], log)
+	}
+
+	for uid, applications := range byStudent {
+		sort.Slice(applications, func(i, j int) bool { return applications[i].Rank < applications[j].Rank })
+		for _, application := range applications {
+			in.Preferences[uid] = append(in.Preferences[uid], application.ProjectID)
+		}
+	}
+	for projectID, applications := range byProject {
+		sortApplications(applications)
+		ranks := make(map[string]int, len(applications))
+		for i, application := range applications {
+			ranks[application.ApplicantUID] = i + 1
+		}
+		in.Ranks[projectID] = ranks
+	}
+	return in, byProject
+}
@@ -0,0 +1,125 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"v1/pkg/model"
+)
+
+func GetUserTwoFactor(ctx context.Context, db *gorm.DB, userUID string) (bool, *model.UserTwoFactor, error) {
+	var tf model.UserTwoFactor
+	err := db.WithContext(ctx).Model(&model.UserTwoFactor{}).Where("user_uid = ?", userUID).First(&tf).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return true, &tf, nil
+}
+
+// UpsertUserTwoFactor starts a new, not yet enabled enrollment, replacing the previous one
+func UpsertUserTwoFactor(ctx context.Context, db *gorm.DB, userUID, secret string, recoveryCodes []string) error {
+	codes, err := json.Marshal(recoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	tf := model.UserTwoFactor{
+		UserUID:       userUID,
+		Secret:        secret,
+		Enabled:       false,
+		RecoveryCodes: codes,
+		LastUsedStep:  0,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_uid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "enabled", "recovery_codes", "last_used_step", "updated_at"}),
+	}).Create(&tf).Error
+}
+
+// UseTwoFactorStep remembers the step of an accepted code and enables the enrollment.
+// It fails to update when the step has been used already by a concurrent request.
+func UseTwoFactorStep(ctx context.Context, db *gorm.DB, userUID string, step int64) (bool, error) {
+	res := db.WithContext(ctx).Model(&model.UserTwoFactor{}).
+		Where("user_uid = ? AND last_used_step < ?", userUID, step).
+		Updates(map[string]interface{}{
+			"enabled":        true,
+			"last_used_step": step,
+			"updated_at":     time.Now().UnixMilli(),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// UseRecoveryCode removes the recovery code hash, reports whether it was there
+func UseRecoveryCode(ctx context.Context, db *gorm.DB, userUID, codeHash string) (bool, error) {
+	found, tf, err := GetUserTwoFactor(ctx, db, userUID)
+	if err != nil || !found {
+		return false, err
+	}
+
+	var hashes []string
+	if err = json.Unmarshal(tf.RecoveryCodes, &hashes); err != nil {
+		return false, err
+	}
+
+	left := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		if h != codeHash {
+			left = append(left, h)
+		}
+	}
+	if len(left) == len(hashes) {
+		return false, nil
+	}
+
+	codes, _ := json.Marshal(left)
+	// 以旧值为条件，防止同一个恢复码被并发使用两次
+	res := db.WithContext(ctx).Model(&model.UserTwoFactor{}).
+		Where("user_uid = ? AND updated_at = ?", userUID, tf.UpdatedAt).
+		Updates(map[string]interface{}{
+			"recovery_codes": datatypes.JSON(codes),
+			"updated_at":     time.Now().UnixMilli(),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+func UpdateRecoveryCodes(ctx context.Context, db *gorm.DB, userUID string, recoveryCodes []string) error {
+	codes, err := json.Marshal(recoveryCodes)
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Model(&model.UserTwoFactor{}).Where("user_uid = ?", userUID).
+		Updates(map[string]interface{}{
+			"recovery_codes": datatypes.JSON(codes),
+			"updated_at":     time.Now().UnixMilli(),
+		}).Error
+}
+
+func DeleteUserTwoFactor(ctx context.Context, db *gorm.DB, userUID string) error {
+	return db.WithContext(ctx).Where("user_uid = ?", userUID).Delete(&model.UserTwoFactor{}).Error
+}
+
+// GetTwoFactorConfig returns the two-factor policy, an empty one if never configured
+func GetTwoFactorConfig(ctx context.Context, db *gorm.DB) (model.ConfigTwoFactor, error) {
+	var conf model.ConfigTwoFactor
+
+	c, err := GetConfigByKey(ctx, db, model.ConfigKeyTwoFactor)
+	if err == gorm.ErrRecordNotFound {
+		return conf, nil
+	}
+	if err != nil {
+		return conf, err
+	}
+
+	err = json.Unmarshal(c.Value, &conf)
+	return conf, err
+}
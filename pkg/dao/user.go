@@ -129,6 +129,9 @@ func UpdateUserInfo(ctx context.Context, db *gorm.DB, id string, userInfo model.
 		"updated_at": now,
 		"updater":    userInfo.Updater,
 	}
+	if userInfo.Status != 0 {
+		changeInfo["status"] = userInfo.Status
+	}
 
 	if err = db.WithContext(ctx).Model(&model.User{}).Where("id = ?", ID).Updates(changeInfo).Error; err != nil {
 		return err
@@ -137,6 +140,36 @@ func UpdateUserInfo(ctx context.Context, db *gorm.DB, id string, userInfo model.
 	return nil
 }
 
+func UpdateUserPassword(ctx context.Context, db *gorm.DB, id int64, encoded, updater string) error {
+	changeInfo := map[string]interface{}{
+		"password":   encoded,
+		"updated_at": time.Now().UnixMilli(),
+		"updater":    updater,
+	}
+
+	return db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Updates(changeInfo).Error
+}
+
+// UpdateUserLastSeen records when the user was last connected to the chat, it is not an update of the user info
+func UpdateUserLastSeen(ctx context.Context, db *gorm.DB, uid string, at int64) error {
+	return db.WithContext(ctx).Model(&model.User{}).Where("uid = ?", uid).UpdateColumn("last_seen_at", at).Error
+}
+
+// GetUsersLastSeen returns when the users were last connected to the chat, unknown users are left out
+func GetUsersLastSeen(ctx context.Context, db *gorm.DB, uids []string) (map[string]int64, error) {
+	var users []model.User
+	err := db.WithContext(ctx).Select("uid, last_seen_at").Where("uid IN ?", uids).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lastSeen := make(map[string]int64, len(users))
+	for _, user := range users {
+		lastSeen[user.UID] = user.LastSeenAt
+	}
+	return lastSeen, nil
+}
+
 // college
 func GetCollegeByHashID(ctx context.Context, db *gorm.DB, collegeHashID string) (bool, model.College, error) {
 	var collegeItem model.College
@@ -197,6 +230,32 @@ func GetProfessionByProfessionName(ctx context.Context, db *gorm.DB, professionN
 	return professions, err
 }
 
+func GetProfessionsByCollegeHashID(ctx context.Context, db *gorm.DB, collegeHashID string) ([]model.Profession, error) {
+	professions := make([]model.Profession, 0)
+	err := db.WithContext(ctx).Model(&model.Profession{}).Where("college_hash_id = ?", collegeHashID).Find(&professions).Error
+	return professions, err
+}
+
+// SameCollege reports whether two professions belong to the same college
+func SameCollege(ctx context.Context, db *gorm.DB, professionHashID, otherProfessionHashID string) (bool, error) {
+	if professionHashID == "" || otherProfessionHashID == "" {
+		return false, nil
+	}
+	if professionHashID == otherProfessionHashID {
+		return true, nil
+	}
+
+	professions, err := GetProfessionsByHashIDs(ctx, db, []string{professionHashID, otherProfessionHashID})
+	if err != nil {
+		return false, err
+	}
+	if len(professions) != 2 {
+		return false, nil
+	}
+
+	return professions[0].CollegeHashID == professions[1].CollegeHashID, nil
+}
+
 func InsertProfession(ctx context.Context, db *gorm.DB, professionInfo model.Profession) (*model.Profession, error) {
 	now := time.Now().UnixMilli()
 
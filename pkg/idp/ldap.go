@@ -0,0 +1,150 @@
+package idp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig a directory users log in to by binding with their own password
+type LDAPConfig struct {
+	URL                string        `mapstructure:"url"` // ldap://host:389 or ldaps://host:636
+	StartTLS           bool          `mapstructure:"start_tls"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+
+	// service account searching for the user's DN, anonymous search when empty
+	BindDN       string `mapstructure:"bind_dn"`
+	BindPassword string `mapstructure:"bind_password"`
+
+	BaseDN     string       `mapstructure:"base_dn"`
+	UserFilter string       `mapstructure:"user_filter"` // e.g. (uid=%s), %s is replaced by the escaped username
+	Attributes AttributeMap `mapstructure:"attributes"`
+}
+
+var ldapDefaultAttributes = AttributeMap{
+	Subject:  "entryUUID",
+	Username: "uid",
+	Name:     "cn",
+	Email:    "mail",
+	Phone:    "telephoneNumber",
+}
+
+type ldapProvider struct {
+	name    string
+	config  LDAPConfig
+	mapping Mapping
+}
+
+func NewLDAPProvider(name string, config LDAPConfig, mapping Mapping) (PasswordProvider, error) {
+	if config.URL == "" || config.BaseDN == "" {
+		return nil, fmt.Errorf("ldap provider %s: url and base_dn must not be empty", name)
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second * 5
+	}
+	config.Attributes = config.Attributes.withDefaults(ldapDefaultAttributes)
+
+	if err := mapping.compile(); err != nil {
+		return nil, fmt.Errorf("ldap provider %s: %w", name, err)
+	}
+
+	return &ldapProvider{name: name, config: config, mapping: mapping}, nil
+}
+
+func (p *ldapProvider) Name() string {
+	return p.name
+}
+
+func (p *ldapProvider) Type() string {
+	return TypeLDAP
+}
+
+func (p *ldapProvider) Mapping() Mapping {
+	return p.mapping
+}
+
+func (p *ldapProvider) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	// 空密码会被 LDAP 当作匿名绑定而成功
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.config.BindDN != "" {
+		if err = conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	attrs := p.config.Attributes
+	res, err := conn.Search(ldap.NewSearchRequest(
+		p.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(p.config.Timeout.Seconds()), false,
+		fmt.Sprintf(p.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{attrs.Subject, attrs.Username, attrs.Name, attrs.Email, attrs.Phone, "*"},
+		nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		// ambiguous username
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	id := &Identity{
+		Provider:   p.name,
+		Subject:    entry.DN,
+		Attributes: make(map[string][]string, len(entry.Attributes)),
+	}
+	for _, attr := range entry.Attributes {
+		id.Attributes[attr.Name] = attr.Values
+	}
+	attrs.fill(id)
+	if id.Username == "" {
+		id.Username = username
+	}
+
+	return id, nil
+}
+
+func (p *ldapProvider) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.config.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(p.config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(p.config.Timeout)
+
+	if p.config.StartTLS {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,265 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type ldapEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// ldapStub is an LDAP server answering simple binds and searches of the form (attr=value)
+type ldapStub struct {
+	addr    string
+	entries []ldapEntry
+
+	mu    sync.Mutex
+	binds []string // DNs bound successfully
+	terms []string // assertion values of the search filters, as the server decoded them
+}
+
+func newLDAPStub(t *testing.T, entries ...ldapEntry) *ldapStub {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &ldapStub{addr: ln.Addr().String(), entries: entries}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *ldapStub) url() string {
+	return "ldap://" + s.addr
+}
+
+func (s *ldapStub) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := ber.DecodeString(op.Children[1].Data.Bytes())
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if s.bind(dn, password) {
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, id, ldapResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			for _, e := range s.search(op.Children[6]) {
+				s.write(conn, id, searchEntry(e))
+			}
+			s.write(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *ldapStub) bind(dn, password string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if e.dn == dn && e.password == password && password != "" {
+			s.binds = append(s.binds, dn)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ldapStub) search(filter *ber.Packet) []ldapEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 只支持等值过滤，注入的通配符或子过滤会变成其他类型而查不到
+	if filter.Tag != ldap.FilterEqualityMatch {
+		s.terms = append(s.terms, "")
+		return nil
+	}
+	attr := ber.DecodeString(filter.Children[0].Data.Bytes())
+	value := ber.DecodeString(filter.Children[1].Data.Bytes())
+	s.terms = append(s.terms, value)
+
+	var found []ldapEntry
+	for _, e := range s.entries {
+		for _, v := range e.attributes[attr] {
+			if v == value {
+				found = append(found, e)
+				break
+			}
+		}
+	}
+	return found
+}
+
+func (s *ldapStub) write(w io.Writer, id int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+	_, _ = w.Write(packet.Bytes())
+}
+
+func ldapResult(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+func searchEntry(e ldapEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range e.attributes {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return op
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	stub := newLDAPStub(t,
+		ldapEntry{dn: "cn=svc,dc=example", password: "svc-pass"},
+		ldapEntry{dn: "uid=alice,ou=people,dc=example", password: "alice-pass", attributes: map[string][]string{
+			"uid":       {"alice"},
+			"cn":        {"Alice"},
+			"mail":      {"alice@example.com"},
+			"entryUUID": {"uuid-alice"},
+			"memberOf":  {"cn=teachers,dc=example"},
+		}},
+		ldapEntry{dn: "uid=twin1,ou=people,dc=example", password: "p", attributes: map[string][]string{"uid": {"twin"}}},
+		ldapEntry{dn: "uid=twin2,ou=people,dc=example", password: "p", attributes: map[string][]string{"uid": {"twin"}}},
+		ldapEntry{dn: "uid=bob,ou=people,dc=example", password: "bob-pass", attributes: map[string][]string{"uid": {"bob"}}},
+	)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{name: "ok", username: "alice", password: "alice-pass"},
+		{name: "wrong password", username: "alice", password: "wrong", err: ErrInvalidCredentials},
+		{name: "empty password", username: "alice", password: "", err: ErrInvalidCredentials},
+		{name: "unknown user", username: "nobody", password: "alice-pass", err: ErrInvalidCredentials},
+		{name: "ambiguous username", username: "twin", password: "p", err: ErrInvalidCredentials},
+		{name: "wildcard injection", username: "*", password: "alice-pass", err: ErrInvalidCredentials},
+		{name: "filter injection", username: "alice)(uid=*", password: "alice-pass", err: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewLDAPProvider("corp", LDAPConfig{
+				URL:          stub.url(),
+				BindDN:       "cn=svc,dc=example",
+				BindPassword: "svc-pass",
+				BaseDN:       "ou=people,dc=example",
+			}, Mapping{})
+			if err != nil {
+				t.Fatalf("NewLDAPProvider: %v", err)
+			}
+
+			id, err := p.Authenticate(context.Background(), tt.username, tt.password)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if id.Subject != "uuid-alice" || id.Username != "alice" || id.Name != "Alice" || id.Email != "alice@example.com" {
+				t.Fatalf("identity = %+v", id)
+			}
+			if groups := id.Attributes["memberOf"]; len(groups) != 1 || groups[0] != "cn=teachers,dc=example" {
+				t.Fatalf("memberOf = %v", groups)
+			}
+		})
+	}
+}
+
+// TestLDAPEscapeFilter checks the username reaches the server as the literal value of one equality filter
+func TestLDAPEscapeFilter(t *testing.T) {
+	stub := newLDAPStub(t)
+	p, err := NewLDAPProvider("corp", LDAPConfig{URL: stub.url(), BaseDN: "dc=example"}, Mapping{})
+	if err != nil {
+		t.Fatalf("NewLDAPProvider: %v", err)
+	}
+
+	usernames := []string{"*", "alice)(uid=*", `a\b`, "(|(uid=*))", "x\x00y"}
+	for _, username := range usernames {
+		if _, err = p.Authenticate(context.Background(), username, "secret"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Authenticate(%q) err = %v, want ErrInvalidCredentials", username, err)
+		}
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.terms) != len(usernames) {
+		t.Fatalf("%d searches, want %d", len(stub.terms), len(usernames))
+	}
+	for i, username := range usernames {
+		if stub.terms[i] != username {
+			t.Errorf("search for %q matched %q", username, stub.terms[i])
+		}
+	}
+	// 没有服务账号时使用匿名查询，也没有用户绑定成功
+	if len(stub.binds) != 0 {
+		t.Fatalf("binds = %v, want none", stub.binds)
+	}
+}
+
+func TestLDAPServiceBindFailure(t *testing.T) {
+	stub := newLDAPStub(t, ldapEntry{dn: "cn=svc,dc=example", password: "svc-pass"})
+	p, err := NewLDAPProvider("corp", LDAPConfig{URL: stub.url(), BaseDN: "dc=example", BindDN: "cn=svc,dc=example", BindPassword: "wrong"}, Mapping{})
+	if err != nil {
+		t.Fatalf("NewLDAPProvider: %v", err)
+	}
+
+	// 服务账号配置错误不是用户的密码错误
+	_, err = p.Authenticate(context.Background(), "alice", "alice-pass")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want a service bind error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package idp
+
+import (
+	"fmt"
+	"regexp"
+	"v1/pkg/model"
+)
+
+// Rule sets the role, profession or class of users having an attribute value matching the pattern
+type Rule struct {
+	Attribute        string         `mapstructure:"attribute"`
+	Match            string         `mapstructure:"match"` // regexp, matched against every value of the attribute
+	Role             model.RoleType `mapstructure:"role"`
+	ProfessionHashID string         `mapstructure:"profession_hash_id"`
+	ClassHashID      string         `mapstructure:"class_hash_id"`
+
+	re *regexp.Regexp
+}
+
+// Mapping maps an external identity to the local user provisioned on first login.
+// Rules are checked in order, the first matching rule setting a field wins.
+type Mapping struct {
+	DefaultRole model.RoleType `mapstructure:"default_role"` // used when no rule sets the role, empty refuses the login
+	Rules       []Rule         `mapstructure:"rules"`
+}
+
+// Mapped is the result of a mapping
+type Mapped struct {
+	Role             model.RoleType
+	ProfessionHashID string
+	ClassHashID      string
+}
+
+func (m *Mapping) compile() error {
+	if m.DefaultRole != "" && !m.DefaultRole.Valid() {
+		return fmt.Errorf("invalid default role %q", m.DefaultRole)
+	}
+
+	for i := range m.Rules {
+		r := &m.Rules[i]
+		if r.Attribute == "" {
+			return fmt.Errorf("rule %d: attribute must not be empty", i)
+		}
+		if r.Role != "" && !r.Role.Valid() {
+			return fmt.Errorf("rule %d: invalid role %q", i, r.Role)
+		}
+		// 禁止通过外部属性直接获得超级管理员
+		if r.Role == model.RoleTypeSuperAdmin {
+			return fmt.Errorf("rule %d: super admin can not be mapped", i)
+		}
+
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		r.re = re
+	}
+
+	if m.DefaultRole == model.RoleTypeSuperAdmin {
+		return fmt.Errorf("super admin can not be mapped")
+	}
+	return nil
+}
+
+// Apply maps the identity, ok is false when no role could be determined
+func (m Mapping) Apply(id *Identity) (Mapped, bool) {
+	var mapped Mapped
+
+	for _, r := range m.Rules {
+		if !r.matches(id) {
+			continue
+		}
+		if mapped.Role == "" {
+			mapped.Role = r.Role
+		}
+		if mapped.ProfessionHashID == "" {
+			mapped.ProfessionHashID = r.ProfessionHashID
+		}
+		if mapped.ClassHashID == "" {
+			mapped.ClassHashID = r.ClassHashID
+		}
+	}
+
+	if mapped.Role == "" {
+		mapped.Role = m.DefaultRole
+	}
+	return mapped, mapped.Role != ""
+}
+
+func (r Rule) matches(id *Identity) bool {
+	if r.re == nil {
+		return false
+	}
+	for _, v := range id.Attributes[r.Attribute] {
+		if r.re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package idp
+
+import (
+	"testing"
+	"v1/pkg/model"
+)
+
+func TestMappingApply(t *testing.T) {
+	mapping := Mapping{
+		DefaultRole: model.RoleTypeStudent,
+		Rules: []Rule{
+			{Attribute: "groups", Match: "^teachers$", Role: model.RoleTypeTeacher},
+			{Attribute: "department", Match: "^cs$", ProfessionHashID: "p-cs"},
+			{Attribute: "groups", Match: "^staff$", Role: model.RoleTypeCollegeAdmin, ProfessionHashID: "p-staff"},
+			{Attribute: "class", Match: "^2024-", ClassHashID: "c-2024"},
+		},
+	}
+	if err := mapping.compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		attributes map[string][]string
+		want       Mapped
+	}{
+		{
+			name: "default role",
+			want: Mapped{Role: model.RoleTypeStudent},
+		},
+		{
+			name:       "first matching rule wins",
+			attributes: map[string][]string{"groups": {"staff", "teachers"}, "department": {"cs"}},
+			want:       Mapped{Role: model.RoleTypeTeacher, ProfessionHashID: "p-cs"},
+		},
+		{
+			name:       "later rule fills the fields left empty",
+			attributes: map[string][]string{"groups": {"staff"}, "class": {"2024-1"}},
+			want:       Mapped{Role: model.RoleTypeCollegeAdmin, ProfessionHashID: "p-staff", ClassHashID: "c-2024"},
+		},
+		{
+			name:       "pattern is anchored by the rule",
+			attributes: map[string][]string{"groups": {"ex-teachers"}},
+			want:       Mapped{Role: model.RoleTypeStudent},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := mapping.Apply(&Identity{Attributes: tt.attributes})
+			if !ok || got != tt.want {
+				t.Fatalf("Apply = %+v, %v, want %+v, true", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMappingWithoutRole(t *testing.T) {
+	mapping := Mapping{Rules: []Rule{{Attribute: "department", Match: "cs", ProfessionHashID: "p-cs"}}}
+	if err := mapping.compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	if got, ok := mapping.Apply(&Identity{Attributes: map[string][]string{"department": {"cs"}}}); ok {
+		t.Fatalf("Apply = %+v, true, want no role", got)
+	}
+}
+
+func TestMappingCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+	}{
+		{name: "invalid default role", mapping: Mapping{DefaultRole: "root"}},
+		{name: "super admin default role", mapping: Mapping{DefaultRole: model.RoleTypeSuperAdmin}},
+		{name: "super admin rule", mapping: Mapping{Rules: []Rule{{Attribute: "groups", Match: "admins", Role: model.RoleTypeSuperAdmin}}}},
+		{name: "empty attribute", mapping: Mapping{Rules: []Rule{{Match: "x", Role: model.RoleTypeTeacher}}}},
+		{name: "bad pattern", mapping: Mapping{Rules: []Rule{{Attribute: "groups", Match: "(", Role: model.RoleTypeTeacher}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mapping.compile(); err == nil {
+				t.Fatal("compile succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig an OpenID Connect provider, users log in with the authorization code flow and PKCE
+type OIDCConfig struct {
+	Issuer       string       `mapstructure:"issuer"`
+	ClientID     string       `mapstructure:"client_id"`
+	ClientSecret string       `mapstructure:"client_secret"`
+	RedirectURL  string       `mapstructure:"redirect_url"` // the frontend page receiving code and state
+	Scopes       []string     `mapstructure:"scopes"`
+	Claims       AttributeMap `mapstructure:"claims"`
+}
+
+var oidcDefaultClaims = AttributeMap{
+	Subject:  "sub",
+	Username: "preferred_username",
+	Name:     "name",
+	Email:    "email",
+	Phone:    "phone_number",
+}
+
+type oidcProvider struct {
+	name    string
+	config  OIDCConfig
+	mapping Mapping
+
+	// discovered on first use, so an unreachable issuer doesn't stop the server from starting
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCProvider(name string, config OIDCConfig, mapping Mapping) (RedirectProvider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc provider %s: issuer, client_id and redirect_url must not be empty", name)
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"profile", "email"}
+	}
+	config.Claims = config.Claims.withDefaults(oidcDefaultClaims)
+
+	if err := mapping.compile(); err != nil {
+		return nil, fmt.Errorf("oidc provider %s: %w", name, err)
+	}
+
+	return &oidcProvider{name: name, config: config, mapping: mapping}, nil
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) Type() string {
+	return TypeOIDC
+}
+
+func (p *oidcProvider) Mapping() Mapping {
+	return p.mapping
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2 != nil {
+		return p.oauth2, p.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, p.config.Scopes...),
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+	return p.oauth2, p.verifier, nil
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	config, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	config, idTokenVerifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("oidc exchange: %w", err)
+	}
+
+	rawIDToken, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("oidc exchange: no id_token in token response")
+	}
+	idToken, err := idTokenVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrInvalidCredentials
+	}
+
+	claims := make(map[string]any)
+	if err = idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc claims: %w", err)
+	}
+
+	id := &Identity{
+		Provider:   p.name,
+		Subject:    idToken.Subject,
+		Attributes: make(map[string][]string, len(claims)),
+	}
+	for name, v := range claims {
+		id.Attributes[name] = claimValues(v)
+	}
+	p.config.Claims.fill(id)
+
+	return id, nil
+}
+
+// claimValues flattens a claim into strings, arrays like "groups" become multiple values
+func claimValues(v any) []string {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{t}
+	case []any:
+		values := make([]string, 0, len(t))
+		for _, item := range t {
+			values = append(values, claimValues(item)...)
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(t)}
+	}
+}
@@ -0,0 +1,261 @@
+package idp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIssuer is an OpenID Connect provider serving discovery, the token endpoint and the JWKS
+type fakeIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string        // PKCE code challenge of the last authorization request
+	claims    jwt.MapClaims // claims of the id_token issued for the code "good"
+	signer    *rsa.PrivateKey
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	f := &fakeIssuer{key: key, signer: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                f.URL,
+			"authorization_endpoint":                f.URL + "/authorize",
+			"token_endpoint":                        f.URL + "/token",
+			"jwks_uri":                              f.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", f.token)
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if r.PostFormValue("code") != "good" || base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, f.claims)
+	tok.Header["kid"] = "k1"
+	idToken, err := tok.SignedString(f.signer)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	f := newFakeIssuer(t)
+	p, err := NewOIDCProvider("corp", OIDCConfig{Issuer: f.URL, ClientID: "console", RedirectURL: "https://console/sso"}, Mapping{})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+
+	raw, err := p.AuthCodeURL(context.Background(), "state1", "nonce1", "verifier1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	if !strings.HasPrefix(raw, f.URL+"/authorize?") {
+		t.Fatalf("auth url %q is not the discovered authorization endpoint", raw)
+	}
+
+	sum := sha256.Sum256([]byte("verifier1"))
+	want := map[string]string{
+		"client_id":             "console",
+		"redirect_uri":          "https://console/sso",
+		"response_type":         "code",
+		"state":                 "state1",
+		"nonce":                 "nonce1",
+		"scope":                 "openid profile email",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	}
+	for name, v := range want {
+		if got := u.Query().Get(name); got != v {
+			t.Errorf("%s = %q, want %q", name, got, v)
+		}
+	}
+}
+
+func TestOIDCDiscoveryFailure(t *testing.T) {
+	f := newFakeIssuer(t)
+	// 发现文档中的 issuer 与配置不一致
+	p, err := NewOIDCProvider("corp", OIDCConfig{Issuer: f.URL + "/", ClientID: "console", RedirectURL: "https://console/sso"}, Mapping{})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	if _, err = p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Fatal("AuthCodeURL succeeded with a mismatched issuer")
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	f := newFakeIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	claims := func(nonce string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":                f.URL,
+			"aud":                "console",
+			"sub":                "u-42",
+			"iat":                time.Now().Unix(),
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"nonce":              nonce,
+			"preferred_username": "alice",
+			"name":               "Alice",
+			"email":              "alice@example.com",
+			"employee_id":        "E007",
+			"groups":             []string{"teachers", "staff"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		verifier string
+		claims   jwt.MapClaims
+		signer   *rsa.PrivateKey
+		err      error // nil with wantErr means any other error
+		wantErr  bool
+	}{
+		{name: "ok", code: "good", verifier: "verifier1", claims: claims("nonce1"), signer: f.key},
+		{name: "unknown code", code: "bad", verifier: "verifier1", claims: claims("nonce1"), signer: f.key, err: ErrInvalidCredentials},
+		{name: "wrong verifier", code: "good", verifier: "other", claims: claims("nonce1"), signer: f.key, err: ErrInvalidCredentials},
+		{name: "wrong nonce", code: "good", verifier: "verifier1", claims: claims("replayed"), signer: f.key, err: ErrInvalidCredentials},
+		{name: "unknown signing key", code: "good", verifier: "verifier1", claims: claims("nonce1"), signer: otherKey, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewOIDCProvider("corp", OIDCConfig{
+				Issuer:      f.URL,
+				ClientID:    "console",
+				RedirectURL: "https://console/sso",
+				Claims:      AttributeMap{Username: "employee_id"},
+			}, Mapping{})
+			if err != nil {
+				t.Fatalf("NewOIDCProvider: %v", err)
+			}
+
+			ctx := context.Background()
+			raw, err := p.AuthCodeURL(ctx, "state1", "nonce1", "verifier1")
+			if err != nil {
+				t.Fatalf("AuthCodeURL: %v", err)
+			}
+			u, _ := url.Parse(raw)
+
+			f.mu.Lock()
+			f.challenge, f.claims, f.signer = u.Query().Get("code_challenge"), tt.claims, tt.signer
+			f.mu.Unlock()
+
+			id, err := p.Exchange(ctx, tt.code, "nonce1", tt.verifier)
+			if tt.err != nil || tt.wantErr {
+				if err == nil {
+					t.Fatalf("Exchange = %+v, want an error", id)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				if tt.err == nil && errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("err = %v, want a provider error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			// 用户名取自配置的 claim，其余使用默认
+			if id.Provider != "corp" || id.Subject != "u-42" || id.Username != "E007" || id.Name != "Alice" || id.Email != "alice@example.com" {
+				t.Fatalf("identity = %+v", id)
+			}
+			if groups := id.Attributes["groups"]; len(groups) != 2 || groups[0] != "teachers" || groups[1] != "staff" {
+				t.Fatalf("groups = %v", groups)
+			}
+		})
+	}
+}
+
+func TestClaimValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim any
+		want  []string
+	}{
+		{name: "nil", claim: nil, want: nil},
+		{name: "string", claim: "a", want: []string{"a"}},
+		{name: "number", claim: float64(3), want: []string{"3"}},
+		{name: "bool", claim: true, want: []string{"true"}},
+		{name: "array", claim: []any{"a", []any{"b", float64(1)}}, want: []string{"a", "b", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := claimValues(tt.claim)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") || len(got) != len(tt.want) {
+				t.Fatalf("claimValues(%v) = %q, want %q", tt.claim, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package idp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	idpConfig = "idp-config"
+)
+
+// ProviderConfig one entry of the providers file
+type ProviderConfig struct {
+	Name    string      `mapstructure:"name"`
+	Type    string      `mapstructure:"type"`
+	LDAP    *LDAPConfig `mapstructure:"ldap"`
+	OIDC    *OIDCConfig `mapstructure:"oidc"`
+	Mapping Mapping     `mapstructure:"mapping"`
+}
+
+type Options struct {
+	// yaml or json file listing the external identity providers, none when empty
+	ConfigFile string
+	v          *viper.Viper
+}
+
+func NewIDPOptions() *Options {
+	o := &Options{
+		v: viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.ConfigFile = o.v.GetString(idpConfig)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	if _, err := o.NewProviders(); err != nil {
+		errors = append(errors, err)
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.ConfigFile, idpConfig, o.ConfigFile, "yaml or json file of the LDAP / OIDC single sign-on providers. env IDP_CONFIG")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewProviders creates the providers listed in the config file
+func (o *Options) NewProviders() ([]IdentityProvider, error) {
+	if o.ConfigFile == "" {
+		return nil, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(o.ConfigFile)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", idpConfig, err)
+	}
+
+	var file struct {
+		Providers []ProviderConfig `mapstructure:"providers"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", idpConfig, err)
+	}
+
+	list := make([]IdentityProvider, 0, len(file.Providers))
+	names := make(map[string]bool, len(file.Providers))
+	for _, pc := range file.Providers {
+		if pc.Name == "" || names[pc.Name] {
+			return nil, fmt.Errorf("identity provider name %q is empty or duplicated", pc.Name)
+		}
+		names[pc.Name] = true
+
+		var (
+			p   IdentityProvider
+			err error
+		)
+		switch {
+		case pc.Type == TypeLDAP && pc.LDAP != nil:
+			p, err = NewLDAPProvider(pc.Name, *pc.LDAP, pc.Mapping)
+		case pc.Type == TypeOIDC && pc.OIDC != nil:
+			p, err = NewOIDCProvider(pc.Name, *pc.OIDC, pc.Mapping)
+		default:
+			err = fmt.Errorf("identity provider %s: unsupported type %q or missing %s section", pc.Name, pc.Type, pc.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,150 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+const (
+	TypeLDAP = "ldap"
+	TypeOIDC = "oidc"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrProviderNotFound   = errors.New("identity provider not found")
+	ErrUnsupported        = errors.New("not supported by the identity provider")
+)
+
+// Identity is a user as asserted by an external identity provider
+type Identity struct {
+	Provider string
+	Subject  string // stable id of the user at the provider
+	Username string
+	Name     string
+	Email    string
+	Phone    string
+
+	// all attributes / claims, used by the mapping rules
+	Attributes map[string][]string
+}
+
+// IdentityProvider authenticates users against an external directory
+type IdentityProvider interface {
+	// Name is the configured name, unique among the providers
+	Name() string
+
+	// Type is TypeLDAP or TypeOIDC
+	Type() string
+
+	// Mapping maps identities of the provider to local users
+	Mapping() Mapping
+}
+
+// PasswordProvider verifies a username and password, e.g. by an LDAP bind
+type PasswordProvider interface {
+	IdentityProvider
+
+	// Authenticate returns ErrInvalidCredentials if the username or password is wrong
+	Authenticate(ctx context.Context, username, password string) (*Identity, error)
+}
+
+// RedirectProvider sends the user to the provider to log in, e.g. OpenID Connect authorization code flow
+type RedirectProvider interface {
+	IdentityProvider
+
+	// AuthCodeURL returns the url to send the user to, verifier is the PKCE code verifier
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+
+	// Exchange exchanges the authorization code for the identity of the user
+	Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]IdentityProvider)
+)
+
+// SetProviders replaces the configured providers
+func SetProviders(list []IdentityProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	providers = make(map[string]IdentityProvider, len(list))
+	for _, p := range list {
+		providers[p.Name()] = p
+	}
+}
+
+// Get returns the provider of the name
+func Get(name string) (IdentityProvider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return p, nil
+}
+
+// List returns all providers sorted by name
+func List() []IdentityProvider {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]IdentityProvider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// AttributeMap names the attributes / claims holding the fields of an Identity
+type AttributeMap struct {
+	Subject  string `mapstructure:"subject"`
+	Username string `mapstructure:"username"`
+	Name     string `mapstructure:"name"`
+	Email    string `mapstructure:"email"`
+	Phone    string `mapstructure:"phone"`
+}
+
+func (m AttributeMap) withDefaults(defaults AttributeMap) AttributeMap {
+	if m.Subject == "" {
+		m.Subject = defaults.Subject
+	}
+	if m.Username == "" {
+		m.Username = defaults.Username
+	}
+	if m.Name == "" {
+		m.Name = defaults.Name
+	}
+	if m.Email == "" {
+		m.Email = defaults.Email
+	}
+	if m.Phone == "" {
+		m.Phone = defaults.Phone
+	}
+	return m
+}
+
+// fill sets the fields of the identity from its attributes
+func (m AttributeMap) fill(id *Identity) {
+	first := func(name string) string {
+		if values := id.Attributes[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if v := first(m.Subject); v != "" {
+		id.Subject = v
+	}
+	id.Username = first(m.Username)
+	id.Name = first(m.Name)
+	id.Email = first(m.Email)
+	id.Phone = first(m.Phone)
+}
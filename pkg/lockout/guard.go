@@ -0,0 +1,311 @@
+package lockout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+	"v1/pkg/client/cache"
+)
+
+const (
+	DefaultAccountFreeFailures = 3
+	DefaultAccountMaxFailures  = 10
+	DefaultIPFreeFailures      = 10
+	DefaultBaseDelay           = time.Second
+	DefaultMaxDelay            = time.Minute * 5
+	DefaultLockDuration        = time.Minute * 15
+	DefaultFailureWindow       = time.Minute * 30
+
+	accountFailureKeyPrefix = "login_failure:account:"
+	ipFailureKeyPrefix      = "login_failure:ip:"
+	accountLockKeyPrefix    = "login_lock:"
+)
+
+// Guard throttles login attempts. Failures are counted per account and per client IP,
+// after the free attempts every further attempt has to wait exponentially longer,
+// and an account is locked for a while after too many failures.
+type Guard interface {
+	// Check returns how long the caller has to wait before the next attempt, zero if allowed now
+	Check(ctx context.Context, account, ip string) (retryAfter time.Duration, locked bool, err error)
+
+	// Failures returns the counts of recent failures of the account and of the client IP
+	Failures(ctx context.Context, account, ip string) (accountFailures, ipFailures int, err error)
+
+	// Fail records a failed attempt
+	Fail(ctx context.Context, account, ip string) error
+
+	// Succeed clears the failures of the account
+	Succeed(ctx context.Context, account string) error
+
+	// Unlock clears the lock and the failures of the account
+	Unlock(ctx context.Context, account string) error
+
+	// Status returns the lock state of the account
+	Status(ctx context.Context, account string) (Status, error)
+}
+
+// Status is the lock state of an account
+type Status struct {
+	Failures    int   `json:"failures"`
+	Locked      bool  `json:"locked"`
+	LockedUntil int64 `json:"locked_until,omitempty"` // unix milli
+}
+
+type failureRecord struct {
+	Count    int   `json:"count"`
+	LastFail int64 `json:"last_fail"` // unix milli
+}
+
+type guard struct {
+	cacheClient cache.Interface
+
+	accountFreeFailures int
+	accountMaxFailures  int
+	ipFreeFailures      int
+	baseDelay           time.Duration
+	maxDelay            time.Duration
+	lockDuration        time.Duration
+	failureWindow       time.Duration
+}
+
+type Option func(g *guard)
+
+// SetAccountFailures sets how many failures of an account are free of delay, and after how many it is locked
+func SetAccountFailures(free, max int) Option {
+	return func(g *guard) {
+		g.accountFreeFailures = free
+		g.accountMaxFailures = max
+	}
+}
+
+// SetIPFreeFailures sets how many failures of a client IP are free of delay
+func SetIPFreeFailures(free int) Option {
+	return func(g *guard) {
+		g.ipFreeFailures = free
+	}
+}
+
+// SetDelay sets the first delay and the upper bound of the exponential delay
+func SetDelay(base, max time.Duration) Option {
+	return func(g *guard) {
+		g.baseDelay = base
+		g.maxDelay = max
+	}
+}
+
+// SetLockDuration sets how long an account stays locked
+func SetLockDuration(d time.Duration) Option {
+	return func(g *guard) {
+		g.lockDuration = d
+	}
+}
+
+// SetFailureWindow sets how long failures are remembered after the last one
+func SetFailureWindow(d time.Duration) Option {
+	return func(g *guard) {
+		g.failureWindow = d
+	}
+}
+
+func NewGuard(cacheClient cache.Interface, options ...Option) Guard {
+	g := &guard{
+		cacheClient:         cacheClient,
+		accountFreeFailures: DefaultAccountFreeFailures,
+		accountMaxFailures:  DefaultAccountMaxFailures,
+		ipFreeFailures:      DefaultIPFreeFailures,
+		baseDelay:           DefaultBaseDelay,
+		maxDelay:            DefaultMaxDelay,
+		lockDuration:        DefaultLockDuration,
+		failureWindow:       DefaultFailureWindow,
+	}
+
+	for _, opt := range options {
+		opt(g)
+	}
+
+	return g
+}
+
+var defaultGuard Guard
+
+// SetDefault sets the guard used by the login and user management handlers
+func SetDefault(g Guard) {
+	if g != nil {
+		defaultGuard = g
+	}
+}
+
+// Default returns the guard set by SetDefault
+func Default() Guard {
+	return defaultGuard
+}
+
+func (g *guard) Check(ctx context.Context, account, ip string) (time.Duration, bool, error) {
+	until, err := g.lockedUntil(ctx, account)
+	if err != nil {
+		return 0, false, err
+	}
+	if wait := time.Until(time.UnixMilli(until)); wait > 0 {
+		return wait, true, nil
+	}
+
+	accountRecord, err := g.load(ctx, accountFailureKeyPrefix+account)
+	if err != nil {
+		return 0, false, err
+	}
+	ipRecord, err := g.load(ctx, ipFailureKeyPrefix+ip)
+	if err != nil {
+		return 0, false, err
+	}
+
+	wait := g.wait(accountRecord, g.accountFreeFailures)
+	if ipWait := g.wait(ipRecord, g.ipFreeFailures); ipWait > wait {
+		wait = ipWait
+	}
+	return wait, false, nil
+}
+
+func (g *guard) Failures(ctx context.Context, account, ip string) (int, int, error) {
+	accountRecord, err := g.load(ctx, accountFailureKeyPrefix+account)
+	if err != nil {
+		return 0, 0, err
+	}
+	ipRecord, err := g.load(ctx, ipFailureKeyPrefix+ip)
+	if err != nil {
+		return 0, 0, err
+	}
+	return accountRecord.Count, ipRecord.Count, nil
+}
+
+func (g *guard) Fail(ctx context.Context, account, ip string) error {
+	now := time.Now().UnixMilli()
+
+	err := g.update(ctx, ipFailureKeyPrefix+ip, func(record *failureRecord) time.Duration {
+		record.Count++
+		record.LastFail = now
+		return g.failureWindow
+	})
+	if err != nil {
+		return err
+	}
+
+	var lock bool
+	err = g.update(ctx, accountFailureKeyPrefix+account, func(record *failureRecord) time.Duration {
+		record.Count++
+		record.LastFail = now
+
+		// 超过最大失败次数，锁定账号并重新计数
+		lock = g.accountMaxFailures > 0 && record.Count >= g.accountMaxFailures
+		if lock {
+			return -1
+		}
+		return g.failureWindow
+	})
+	if err != nil || !lock {
+		return err
+	}
+
+	until := time.Now().Add(g.lockDuration).UnixMilli()
+	return g.cacheClient.Set(ctx, accountLockKeyPrefix+account, jsonString(until), g.lockDuration)
+}
+
+func (g *guard) Succeed(ctx context.Context, account string) error {
+	return g.cacheClient.Del(ctx, accountFailureKeyPrefix+account)
+}
+
+func (g *guard) Unlock(ctx context.Context, account string) error {
+	return g.cacheClient.Del(ctx, accountLockKeyPrefix+account, accountFailureKeyPrefix+account)
+}
+
+func (g *guard) Status(ctx context.Context, account string) (Status, error) {
+	record, err := g.load(ctx, accountFailureKeyPrefix+account)
+	if err != nil {
+		return Status{}, err
+	}
+	until, err := g.lockedUntil(ctx, account)
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{Failures: record.Count}
+	if until > time.Now().UnixMilli() {
+		status.Locked = true
+		status.LockedUntil = until
+	}
+	return status, nil
+}
+
+// wait returns the remaining delay after the last failure of the record
+func (g *guard) wait(record failureRecord, free int) time.Duration {
+	if record.Count <= free {
+		return 0
+	}
+
+	delay := g.baseDelay
+	for i := free + 1; i < record.Count && delay < g.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.maxDelay {
+		delay = g.maxDelay
+	}
+
+	return time.Until(time.UnixMilli(record.LastFail).Add(delay))
+}
+
+func (g *guard) lockedUntil(ctx context.Context, account string) (int64, error) {
+	val, err := g.cacheClient.Get(ctx, accountLockKeyPrefix+account)
+	if err != nil {
+		// key doesn't exist, not locked
+		return 0, nil
+	}
+
+	var until int64
+	if err = json.Unmarshal([]byte(val), &until); err != nil {
+		return 0, err
+	}
+	return until, nil
+}
+
+func (g *guard) load(ctx context.Context, key string) (failureRecord, error) {
+	var record failureRecord
+
+	val, err := g.cacheClient.Get(ctx, key)
+	if err != nil {
+		// key doesn't exist, no failure yet
+		return record, nil
+	}
+
+	err = json.Unmarshal([]byte(val), &record)
+	return record, err
+}
+
+// update changes the record of the key with compare-and-swap, so failures on all instances are counted.
+// fn returns how long to keep the record, negative deletes it
+func (g *guard) update(ctx context.Context, key string, fn func(record *failureRecord) time.Duration) error {
+	for ctx.Err() == nil {
+		var record failureRecord
+
+		val, err := g.cacheClient.Get(ctx, key)
+		if err != nil && !errors.Is(err, cache.ErrNoSuchKey) {
+			return err
+		}
+		if err == nil {
+			if err = json.Unmarshal([]byte(val), &record); err != nil {
+				return err
+			}
+		}
+
+		duration := fn(&record)
+		swapped, err := g.cacheClient.CompareAndSwap(ctx, key, val, jsonString(record), duration)
+		if err != nil || swapped {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
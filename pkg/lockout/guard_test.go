@@ -0,0 +1,103 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"v1/pkg/client/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// caches returns the backends under test, the redis one is shared by two clients as if on two instances
+func caches(t *testing.T) map[string][2]cache.Interface {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	newRedis := func() cache.Interface {
+		c, err := cache.NewRedisCache(context.Background(), &redis.Options{Addr: s.Addr()})
+		if err != nil {
+			t.Fatalf("NewRedisCache: %v", err)
+		}
+		return c
+	}
+
+	memory := cache.NewSimpleCache()
+	return map[string][2]cache.Interface{
+		"memory": {memory, memory},
+		"redis":  {newRedis(), newRedis()},
+	}
+}
+
+// failConcurrently records n failures of the account at once, spread over two guards
+func failConcurrently(t *testing.T, guards [2]Guard, account, ip string, n int) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(g Guard) {
+			defer wg.Done()
+			if err := g.Fail(context.Background(), account, ip); err != nil {
+				t.Errorf("Fail: %v", err)
+			}
+		}(guards[i%2])
+	}
+	wg.Wait()
+}
+
+func TestFailConcurrently(t *testing.T) {
+	const n = 20
+
+	for name, c := range caches(t) {
+		t.Run(name, func(t *testing.T) {
+			guards := [2]Guard{NewGuard(c[0], SetAccountFailures(3, 0)), NewGuard(c[1], SetAccountFailures(3, 0))}
+			failConcurrently(t, guards, "alice", "10.0.0.1", n)
+
+			accountFailures, ipFailures, err := guards[0].Failures(context.Background(), "alice", "10.0.0.1")
+			if err != nil {
+				t.Fatalf("Failures: %v", err)
+			}
+			if accountFailures != n || ipFailures != n {
+				t.Fatalf("failures = %d, %d, want %d, %d", accountFailures, ipFailures, n, n)
+			}
+		})
+	}
+}
+
+// TestFailLocksConcurrently counts every failure exactly once even across the lock resetting the counter
+func TestFailLocksConcurrently(t *testing.T) {
+	const (
+		n   = 12
+		max = 5
+	)
+
+	ctx := context.Background()
+	for name, c := range caches(t) {
+		t.Run(name, func(t *testing.T) {
+			options := []Option{SetAccountFailures(1, max), SetLockDuration(time.Minute)}
+			guards := [2]Guard{NewGuard(c[0], options...), NewGuard(c[1], options...)}
+			failConcurrently(t, guards, "alice", "10.0.0.1", n)
+
+			status, err := guards[1].Status(ctx, "alice")
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			if !status.Locked || status.Failures != n%max {
+				t.Fatalf("status = %+v, want locked with %d failures", status, n%max)
+			}
+			if _, locked, _ := guards[0].Check(ctx, "alice", "10.0.0.2"); !locked {
+				t.Fatal("Check let a locked account through")
+			}
+
+			if err = guards[0].Unlock(ctx, "alice"); err != nil {
+				t.Fatalf("Unlock: %v", err)
+			}
+			if status, _ = guards[1].Status(ctx, "alice"); status.Locked || status.Failures != 0 {
+				t.Fatalf("status after unlock = %+v", status)
+			}
+		})
+	}
+}
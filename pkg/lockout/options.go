@@ -0,0 +1,104 @@
+package lockout
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"v1/pkg/client/cache"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	loginAccountFreeFailures = "login-account-free-failures"
+	loginAccountMaxFailures  = "login-account-max-failures"
+	loginIPFreeFailures      = "login-ip-free-failures"
+	loginBaseDelay           = "login-base-delay"
+	loginMaxDelay            = "login-max-delay"
+	loginLockDuration        = "login-lock-duration"
+	loginFailureWindow       = "login-failure-window"
+)
+
+type Options struct {
+	AccountFreeFailures int
+	// 0 means never lock
+	AccountMaxFailures int
+	IPFreeFailures     int
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	LockDuration       time.Duration
+	FailureWindow      time.Duration
+	v                  *viper.Viper
+}
+
+func NewLockoutOptions() *Options {
+	o := &Options{
+		AccountFreeFailures: DefaultAccountFreeFailures,
+		AccountMaxFailures:  DefaultAccountMaxFailures,
+		IPFreeFailures:      DefaultIPFreeFailures,
+		BaseDelay:           DefaultBaseDelay,
+		MaxDelay:            DefaultMaxDelay,
+		LockDuration:        DefaultLockDuration,
+		FailureWindow:       DefaultFailureWindow,
+		v:                   viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.AccountFreeFailures = o.v.GetInt(loginAccountFreeFailures)
+	o.AccountMaxFailures = o.v.GetInt(loginAccountMaxFailures)
+	o.IPFreeFailures = o.v.GetInt(loginIPFreeFailures)
+	o.BaseDelay = o.v.GetDuration(loginBaseDelay)
+	o.MaxDelay = o.v.GetDuration(loginMaxDelay)
+	o.LockDuration = o.v.GetDuration(loginLockDuration)
+	o.FailureWindow = o.v.GetDuration(loginFailureWindow)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	if o.AccountFreeFailures < 0 || o.IPFreeFailures < 0 || o.AccountMaxFailures < 0 {
+		errors = append(errors, fmt.Errorf("login failure counts must not be negative"))
+	}
+	if o.AccountMaxFailures > 0 && o.AccountMaxFailures <= o.AccountFreeFailures {
+		errors = append(errors, fmt.Errorf("%s must be greater than %s", loginAccountMaxFailures, loginAccountFreeFailures))
+	}
+	if o.BaseDelay <= 0 || o.MaxDelay < o.BaseDelay {
+		errors = append(errors, fmt.Errorf("%s must be positive and not greater than %s", loginBaseDelay, loginMaxDelay))
+	}
+	if o.LockDuration <= 0 || o.FailureWindow <= 0 {
+		errors = append(errors, fmt.Errorf("%s and %s must be positive", loginLockDuration, loginFailureWindow))
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&o.AccountFreeFailures, loginAccountFreeFailures, o.AccountFreeFailures, "failed logins of an account before delays start. env LOGIN_ACCOUNT_FREE_FAILURES")
+	fs.IntVar(&o.AccountMaxFailures, loginAccountMaxFailures, o.AccountMaxFailures, "failed logins before the account is locked, 0 never locks. env LOGIN_ACCOUNT_MAX_FAILURES")
+	fs.IntVar(&o.IPFreeFailures, loginIPFreeFailures, o.IPFreeFailures, "failed logins from a client IP before delays start. env LOGIN_IP_FREE_FAILURES")
+	fs.DurationVar(&o.BaseDelay, loginBaseDelay, o.BaseDelay, "first delay, doubled on every further failure. env LOGIN_BASE_DELAY")
+	fs.DurationVar(&o.MaxDelay, loginMaxDelay, o.MaxDelay, "env LOGIN_MAX_DELAY")
+	fs.DurationVar(&o.LockDuration, loginLockDuration, o.LockDuration, "env LOGIN_LOCK_DURATION")
+	fs.DurationVar(&o.FailureWindow, loginFailureWindow, o.FailureWindow, "failures are forgotten after this long without a new one. env LOGIN_FAILURE_WINDOW")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewGuard creates the Guard described by the options
+func (o *Options) NewGuard(cacheClient cache.Interface) Guard {
+	return NewGuard(cacheClient,
+		SetAccountFailures(o.AccountFreeFailures, o.AccountMaxFailures),
+		SetIPFreeFailures(o.IPFreeFailures),
+		SetDelay(o.BaseDelay, o.MaxDelay),
+		SetLockDuration(o.LockDuration),
+		SetFailureWindow(o.FailureWindow),
+	)
+}
@@ -0,0 +1,79 @@
+// Package matching assigns students to projects with the student-proposing Gale–Shapley algorithm
+package matching
+
+import "sort"
+
+// Input of a matching round
+type Input struct {
+	// Preferences of each student, the most preferred project first
+	Preferences map[string][]int64
+	// Capacity is how many students each project takes, a project without capacity takes nobody
+	Capacity map[int64]int
+	// Ranks of the acceptable students of each project, lower is better.
+	// A student without rank is not acceptable to the project
+	Ranks map[int64]map[string]int
+}
+
+// StudentProposing returns the student-optimal stable matching, student -> project.
+// Students left without an acceptable project are absent from the result
+func StudentProposing(in Input) map[string]int64 {
+	// 按学号排序，保证结果可复现
+	free := make([]string, 0, len(in.Preferences))
+	for student := range in.Preferences {
+		free = append(free, student)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(free)))
+
+	next := make(map[string]int, len(in.Preferences))
+	held := make(map[int64][]string, len(in.Capacity))
+
+	for len(free) > 0 {
+		student := free[len(free)-1]
+		free = free[:len(free)-1]
+
+		prefs := in.Preferences[student]
+		for next[student] < len(prefs) {
+			project := prefs[next[student]]
+			next[student]++
+
+			rank, ok := in.Ranks[project][student]
+			if !ok || in.Capacity[project] <= 0 {
+				continue
+			}
+
+			students := held[project]
+			if len(students) < in.Capacity[project] {
+				held[project] = insertByRank(students, student, in.Ranks[project])
+				break
+			}
+
+			// 满员时与最差的已录取学生比较，被替换的学生继续向下一志愿申请
+			worst := students[len(students)-1]
+			if rank >= in.Ranks[project][worst] {
+				continue
+			}
+			held[project] = insertByRank(students[:len(students)-1], student, in.Ranks[project])
+			free = append(free, worst)
+			break
+		}
+	}
+
+	result := make(map[string]int64)
+	for project, students := range held {
+		for _, student := range students {
+			result[student] = project
+		}
+	}
+	return result
+}
+
+// insertByRank keeps the held students ordered from the best to the worst
+func insertByRank(students []string, student string, ranks map[string]int) []string {
+	i := sort.Search(len(students), func(i int) bool {
+		return ranks[students[i]] > ranks[student]
+	})
+	students = append(students, "")
+	copy(students[i+1:], students[i:])
+	students[i] = student
+	return students
+}
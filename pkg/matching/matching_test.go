@@ -0,0 +1,242 @@
+package matching
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// checkStable fails when the matching breaks a capacity, assigns an unacceptable pair or has a blocking pair
+func checkStable(t *testing.T, in Input, result map[string]int64) {
+	t.Helper()
+
+	assigned := make(map[int64][]string)
+	for student, project := range result {
+		assigned[project] = append(assigned[project], student)
+
+		if _, ok := in.Ranks[project][student]; !ok {
+			t.Fatalf("%s assigned to %d which doesn't accept them", student, project)
+		}
+		if prefIndex(in.Preferences[student], project) < 0 {
+			t.Fatalf("%s assigned to %d which they didn't apply to", student, project)
+		}
+	}
+	for project, students := range assigned {
+		if len(students) > in.Capacity[project] {
+			t.Fatalf("project %d holds %d students over its capacity %d", project, len(students), in.Capacity[project])
+		}
+	}
+
+	for student, prefs := range in.Preferences {
+		current := len(prefs)
+		if project, ok := result[student]; ok {
+			current = prefIndex(prefs, project)
+		}
+
+		// 学生更想去的项目既有空位或更想要该学生，则构成阻塞对
+		for _, project := range prefs[:current] {
+			rank, ok := in.Ranks[project][student]
+			if !ok || in.Capacity[project] <= 0 {
+				continue
+			}
+			if len(assigned[project]) < in.Capacity[project] {
+				t.Fatalf("blocking pair: %s prefers %d which has a free place", student, project)
+			}
+			for _, other := range assigned[project] {
+				if rank < in.Ranks[project][other] {
+					t.Fatalf("blocking pair: %s and %d prefer each other over %s", student, project, other)
+				}
+			}
+		}
+	}
+}
+
+func prefIndex(prefs []int64, project int64) int {
+	for i, p := range prefs {
+		if p == project {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestStudentProposing(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Input
+		want map[string]int64
+	}{
+		{
+			name: "empty",
+			in:   Input{},
+			want: map[string]int64{},
+		},
+		{
+			name: "everyone gets the first choice",
+			in: Input{
+				Preferences: map[string][]int64{"s1": {1, 2}, "s2": {2, 1}},
+				Capacity:    map[int64]int{1: 1, 2: 1},
+				Ranks:       map[int64]map[string]int{1: {"s1": 1, "s2": 2}, 2: {"s1": 1, "s2": 2}},
+			},
+			want: map[string]int64{"s1": 1, "s2": 2},
+		},
+		{
+			// 两个学生都想要项目 1，项目 1 更想要 s2，s1 被替换后去第二志愿
+			name: "displaced student moves down the list",
+			in: Input{
+				Preferences: map[string][]int64{"s1": {1, 2}, "s2": {1, 2}},
+				Capacity:    map[int64]int{1: 1, 2: 1},
+				Ranks:       map[int64]map[string]int{1: {"s1": 2, "s2": 1}, 2: {"s1": 1, "s2": 2}},
+			},
+			want: map[string]int64{"s1": 2, "s2": 1},
+		},
+		{
+			// 学生最优：项目的偏好与学生相反时，学生仍然得到各自的第一志愿
+			name: "student optimal",
+			in: Input{
+				Preferences: map[string][]int64{"s1": {1, 2}, "s2": {2, 1}},
+				Capacity:    map[int64]int{1: 1, 2: 1},
+				Ranks:       map[int64]map[string]int{1: {"s1": 2, "s2": 1}, 2: {"s1": 1, "s2": 2}},
+			},
+			want: map[string]int64{"s1": 1, "s2": 2},
+		},
+		{
+			name: "capacity above one",
+			in: Input{
+				Preferences: map[string][]int64{"s1": {1, 2}, "s2": {1, 2}, "s3": {1, 2}, "s4": {1}},
+				Capacity:    map[int64]int{1: 2, 2: 2},
+				Ranks: map[int64]map[string]int{
+					1: {"s1": 3, "s2": 1, "s3": 2, "s4": 4},
+					2: {"s1": 1, "s2": 2, "s3": 3, "s4": 4},
+				},
+			},
+			want: map[string]int64{"s2": 1, "s3": 1, "s1": 2},
+		},
+		{
+			name: "unacceptable students are skipped",
+			in: Input{
+				Preferences: map[string][]int64{"s1": {1, 2}, "s2": {1}},
+				Capacity:    map[int64]int{1: 2, 2: 1},
+				Ranks:       map[int64]map[string]int{1: {"s2": 1}, 2: {"s1": 1}},
+			},
+			want: map[string]int64{"s1": 2, "s2": 1},
+		},
+		{
+			name: "project without capacity takes nobody",
+			in: Input{
+				Preferences: map[string][]int64{"s1": {1, 2}, "s2": {1}},
+				Capacity:    map[int64]int{2: 1},
+				Ranks:       map[int64]map[string]int{1: {"s1": 1, "s2": 1}, 2: {"s1": 1}},
+			},
+			want: map[string]int64{"s1": 2},
+		},
+		{
+			name: "student without preferences",
+			in: Input{
+				Preferences: map[string][]int64{"s1": nil, "s2": {1}},
+				Capacity:    map[int64]int{1: 1},
+				Ranks:       map[int64]map[string]int{1: {"s1": 1, "s2": 2}},
+			},
+			want: map[string]int64{"s2": 1},
+		},
+		{
+			// 同名次时已录取的学生不被替换，s1 按学号先申请
+			name: "tied ranks keep the held student",
+			in: Input{
+				Preferences: map[string][]int64{"s1": {1}, "s2": {1}},
+				Capacity:    map[int64]int{1: 1},
+				Ranks:       map[int64]map[string]int{1: {"s1": 1, "s2": 1}},
+			},
+			want: map[string]int64{"s1": 1},
+		},
+		{
+			// s3 替换 s1，s1 再替换 s2，s2 最终去项目 3
+			name: "chain of rejections",
+			in: Input{
+				Preferences: map[string][]int64{"s1": {1, 2}, "s2": {2, 3}, "s3": {1}},
+				Capacity:    map[int64]int{1: 1, 2: 1, 3: 1},
+				Ranks: map[int64]map[string]int{
+					1: {"s1": 2, "s3": 1},
+					2: {"s1": 1, "s2": 2},
+					3: {"s2": 1},
+				},
+			},
+			want: map[string]int64{"s1": 2, "s2": 3, "s3": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := StudentProposing(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("StudentProposing = %v, want %v", got, tt.want)
+			}
+			checkStable(t, tt.in, got)
+		})
+	}
+}
+
+// randomInput returns a round of students applying to some of the projects, each ranking some of the students
+func randomInput(r *rand.Rand, students, projects int) Input {
+	in := Input{
+		Preferences: make(map[string][]int64, students),
+		Capacity:    make(map[int64]int, projects),
+		Ranks:       make(map[int64]map[string]int, projects),
+	}
+	for p := 1; p <= projects; p++ {
+		in.Capacity[int64(p)] = r.Intn(4)
+		in.Ranks[int64(p)] = make(map[string]int)
+	}
+	for s := 0; s < students; s++ {
+		student := fmt.Sprintf("s%03d", s)
+		for _, p := range r.Perm(projects)[:r.Intn(projects+1)] {
+			in.Preferences[student] = append(in.Preferences[student], int64(p+1))
+		}
+		for p := 1; p <= projects; p++ {
+			// 约五分之一的学生不被项目接受，名次允许重复
+			if r.Intn(5) > 0 {
+				in.Ranks[int64(p)][student] = r.Intn(students)
+			}
+		}
+	}
+	return in
+}
+
+func TestStudentProposingStable(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		in := randomInput(r, 1+r.Intn(30), 1+r.Intn(8))
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			checkStable(t, in, StudentProposing(in))
+		})
+	}
+}
+
+// TestStudentProposingDeterministic runs the same round many times, the map iteration order must not change the result
+func TestStudentProposingDeterministic(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 20; i++ {
+		in := randomInput(r, 40, 6)
+		want := StudentProposing(in)
+
+		for j := 0; j < 20; j++ {
+			// 重新建 map，插入顺序不同
+			copied := Input{Preferences: make(map[string][]int64), Capacity: make(map[int64]int), Ranks: make(map[int64]map[string]int)}
+			for _, student := range r.Perm(40) {
+				name := fmt.Sprintf("s%03d", student)
+				if prefs, ok := in.Preferences[name]; ok {
+					copied.Preferences[name] = prefs
+				}
+			}
+			for project, capacity := range in.Capacity {
+				copied.Capacity[project] = capacity
+				copied.Ranks[project] = in.Ranks[project]
+			}
+
+			if got := StudentProposing(copied); !reflect.DeepEqual(got, want) {
+				t.Fatalf("round %d run %d = %v, want %v", i, j, got, want)
+			}
+		}
+	}
+}
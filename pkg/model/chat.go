@@ -0,0 +1,115 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ChatMessage 聊天消息，接收者不在线时保存到上线后再投递；群消息没有接收者
+type ChatMessage struct {
+	ID             int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	ConversationID string `gorm:"not null; index:idx_conversation_id; type:varchar(80)"`
+	SenderUID      string `gorm:"column:sender_uid; not null; type:varchar(32)"`
+	RecipientUID   string `gorm:"column:recipient_uid; not null; index:idx_recipient_uid; type:varchar(32)"` // 群消息为空
+	Content        string `gorm:"not null; type:text"`
+	CreatedAt      int64  `gorm:"not null"`
+	DeliveredAt    int64  `gorm:"not null; default:0"` // 推送给接收者的时间，0 表示未投递
+	ReadAt         int64  `gorm:"not null; default:0"` // 0 表示未读
+}
+
+func (ChatMessage) TableName() string {
+	return "chat_messages"
+}
+
+const privateConversationPrefix = "p:"
+
+// PrivateConversationID is the conversation of the two users, the same whoever sends
+func PrivateConversationID(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return privateConversationPrefix + a + ":" + b
+}
+
+// PrivateConversationMembers returns the two users of a private conversation, false if it is not one
+func PrivateConversationMembers(conversationID string) (string, string, bool) {
+	if !strings.HasPrefix(conversationID, privateConversationPrefix) {
+		return "", "", false
+	}
+	uids := strings.Split(strings.TrimPrefix(conversationID, privateConversationPrefix), ":")
+	if len(uids) != 2 || uids[0] == "" || uids[1] == "" {
+		return "", "", false
+	}
+	return uids[0], uids[1], true
+}
+
+type RoomKind string
+
+const (
+	RoomKindProject   RoomKind = "project"   // 项目群：指导老师和项目团队，自动创建
+	RoomKindClass     RoomKind = "class"     // 班级群：班级的所有用户
+	RoomKindInterview RoomKind = "interview" // 面试群：面试发起人和面试者
+)
+
+type RoomRole string
+
+const (
+	RoomRoleOwner  RoomRole = "owner" // 创建者，可以禁言、移出成员
+	RoomRoleMember RoomRole = "member"
+)
+
+// ChatRoom 群聊，成员随项目团队、班级或面试同步
+type ChatRoom struct {
+	ID         int64    `gorm:"primary_key;AUTO_INCREMENT"`
+	Kind       RoomKind `gorm:"not null; index:uniq_kind_ref,unique; type:varchar(16)"`
+	RefID      string   `gorm:"not null; index:uniq_kind_ref,unique; type:varchar(64)"` // 项目id、班级hash_id 或面试id
+	Name       string   `gorm:"not null; type:varchar(64)"`
+	CreatorUID string   `gorm:"not null; type:varchar(32)"`
+	Creator    string   `gorm:"not null; type:varchar(32)"`
+	CreatedAt  int64    `gorm:"not null"`
+}
+
+func (ChatRoom) TableName() string {
+	return "chat_rooms"
+}
+
+// ChatRoomMember 群成员，被移出的成员保留记录，同步时不会再加回
+type ChatRoomMember struct {
+	ID         int64    `gorm:"primary_key;AUTO_INCREMENT"`
+	RoomID     int64    `gorm:"not null; index:uniq_room_user,unique"`
+	UserUID    string   `gorm:"not null; index:uniq_room_user,unique; index:idx_room_member_uid; type:varchar(32)"`
+	Username   string   `gorm:"not null; type:varchar(32)"`
+	Role       RoomRole `gorm:"not null; type:varchar(16)"`
+	MutedUntil int64    `gorm:"not null; default:0"` // 禁言到此时间，unix milli
+	KickedAt   int64    `gorm:"not null; default:0"` // 0 表示仍在群中
+	ReadID     int64    `gorm:"not null; default:0"` // 已读到的消息id
+	JoinedAt   int64    `gorm:"not null"`
+}
+
+func (ChatRoomMember) TableName() string {
+	return "chat_room_members"
+}
+
+// Muted reports whether the member can't send messages at the time, unix milli
+func (m ChatRoomMember) Muted(now int64) bool {
+	return m.MutedUntil > now
+}
+
+const roomConversationPrefix = "r:"
+
+// RoomConversationID is the conversation of the messages of the room
+func RoomConversationID(roomID int64) string {
+	return roomConversationPrefix + strconv.FormatInt(roomID, 10)
+}
+
+// RoomOfConversation returns the room of a room conversation, false if it is not one
+func RoomOfConversation(conversationID string) (int64, bool) {
+	if !strings.HasPrefix(conversationID, roomConversationPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(conversationID, roomConversationPrefix), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
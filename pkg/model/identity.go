@@ -0,0 +1,15 @@
+package model
+
+// UserIdentity links a local user to an external identity provider account
+type UserIdentity struct {
+	ID       int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	UserUID  string `gorm:"column:user_uid; not null; index:idx_user_uid; type:varchar(32)"`
+	Provider string `gorm:"column:provider; not null; index:uniq_provider_subject,unique; type:varchar(64)"`
+	Subject  string `gorm:"column:subject; not null; index:uniq_provider_subject,unique; type:varchar(255)"` // 外部系统中的唯一标识
+
+	CreatedAt int64 `gorm:"not null"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
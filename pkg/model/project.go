@@ -16,13 +16,18 @@ const (
 
 )
 
+// ActiveProjectStatuses 学生同一时间只能参与一个处于这些状态的项目
+var ActiveProjectStatuses = []ProjectStatus{ProjectStatusProceed}
+
 type Project struct {
 	ID               int64          `gorm:"primary_key;AUTO_INCREMENT"`
 	ProjectName      string         `gorm:"not null; type:varchar(32)"`
 	ProjectBasicInfo datatypes.JSON `gorm:"type:json"`
-	ProjectFile      []byte         `gorm:"column:project_file"`
+	ProjectFileID    int64          `gorm:"column:project_file_id; not null; default:0"` // 最近上传的文件，内容在 project_files 和对象存储中
 	Title            string         `gorm:"type:varchar(32)"`
 	Status           ProjectStatus  `gorm:"not null default:2"`
+	Capacity         int            `gorm:"not null; default:1"` // 团队人数上限，也是选题轮次中最多录取的学生数
+	Version          int64          `gorm:"not null; default:0"` // 乐观锁，状态机每次写入加一
 	ProfessionHashID string         `gorm:"not null; type:varchar(64)"`
 
 	CreatedAt      int64  `gorm:"column:created_at; not null; index:idx_created_at"`
@@ -30,7 +35,7 @@ type Project struct {
 	CreatorUID     string `gorm:"not null; index:idx_uid; type:varchar(32)"`
 	AuditUID       string `gorm:"column:audit_uid;not null; type:varchar(32)"` // admin
 	Auditor        string `gorm:"column:auditor;not null;type:varchar(32)"`
-	Participator   string `gorm:"type:varchar(64)"` // 学生
+	Participator   string `gorm:"type:varchar(64)"` // 组长，只用于兼容旧接口；团队成员见 project_members
 	ParticipatorID string `gorm:"type:varchar(64)"`
 	Contract
 }
@@ -62,12 +67,19 @@ type ProjectOption struct {
 	Professions []string `json:"professions"` // profession_hash_ids
 }
 
+// ProjectSelectLog 学生的每一次选题申请，包括选题轮次中的志愿和直接选题
 type ProjectSelectLog struct {
-	ID           int64  `gorm:"primary_key;AUTO_INCREMENT"`
-	ProjectID    int64  `gorm:"not null; type:varchar(32)"`
-	ProjectName  string `gorm:"not null; type:varchar(32)"`
-	Applicant    string `gorm:"not null; type:varchar(32)"`
-	ApplicantUID string `gorm:"not null; type:varchar(32)"`
+	ID           int64             `gorm:"primary_key;AUTO_INCREMENT"`
+	RoundID      int64             `gorm:"not null; default:0; index:idx_round_project"` // 0 表示直接选题
+	ProjectID    int64             `gorm:"not null; index:idx_round_project"`
+	ProjectName  string            `gorm:"not null; type:varchar(32)"`
+	Applicant    string            `gorm:"not null; type:varchar(32)"`
+	ApplicantUID string            `gorm:"not null; index:idx_applicant_uid; type:varchar(32)"`
+	Rank         int               `gorm:"not null; default:0"` // 学生的第几志愿
+	TeacherRank  int               `gorm:"not null; default:0"` // 老师给出的排名，0 表示未排名
+	Status       ApplicationStatus `gorm:"not null; default:1"`
+	CreatedAt    int64             `gorm:"not null"`
+	DecidedAt    int64             `gorm:"not null; default:0"`
 }
 
 func (ProjectSelectLog) TableName() string {
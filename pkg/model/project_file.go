@@ -0,0 +1,21 @@
+package model
+
+// ProjectFile metadata of an uploaded file, the content is kept in the object storage.
+// Uploading a file with the same name again adds a new version
+type ProjectFile struct {
+	ID          int64  `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID   int64  `gorm:"not null; index:uniq_project_name_version,unique"`
+	PhaseID     int64  `gorm:"not null; default:0"` // 提交到的项目阶段，0 表示不属于阶段
+	Name        string `gorm:"not null; index:uniq_project_name_version,unique; type:varchar(128)"`
+	Version     int    `gorm:"not null; index:uniq_project_name_version,unique"`
+	Size        int64  `gorm:"not null"`
+	ContentType string `gorm:"not null; type:varchar(128)"`
+	SHA256      string `gorm:"column:sha256; not null; type:varchar(64)"`
+	StorageKey  string `gorm:"not null; type:varchar(255)"`
+	UploaderUID string `gorm:"not null; type:varchar(32)"`
+	CreatedAt   int64  `gorm:"not null"`
+}
+
+func (ProjectFile) TableName() string {
+	return "project_files"
+}
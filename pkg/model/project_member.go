@@ -0,0 +1,49 @@
+package model
+
+type MemberRole string
+
+const (
+	MemberRoleLeader MemberRole = "leader" // 组长，选中项目的学生，可以邀请组员
+	MemberRoleMember MemberRole = "member" // 组员
+)
+
+// ProjectMember 项目团队的成员，人数不超过项目的 Capacity
+type ProjectMember struct {
+	ID        int64      `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID int64      `gorm:"not null; index:uniq_project_user,unique"`
+	UserUID   string     `gorm:"not null; index:uniq_project_user,unique; index:idx_user_uid; type:varchar(32)"`
+	Username  string     `gorm:"not null; type:varchar(32)"`
+	Role      MemberRole `gorm:"not null; type:varchar(16)"`
+	JoinedAt  int64      `gorm:"not null"`
+}
+
+func (ProjectMember) TableName() string {
+	return "project_members"
+}
+
+type InvitationStatus int64
+
+const (
+	InvitationPending  InvitationStatus = 1 // 待回复
+	InvitationAccepted InvitationStatus = 2 // 已接受
+	InvitationDeclined InvitationStatus = 3 // 已拒绝
+	InvitationInvalid  InvitationStatus = 4 // 已失效：接受时项目已关闭、团队已满或学生已有其他项目
+)
+
+// ProjectInvitation 组长邀请同学加入项目团队
+type ProjectInvitation struct {
+	ID          int64            `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID   int64            `gorm:"not null; index:idx_project_id"`
+	ProjectName string           `gorm:"not null; type:varchar(32)"`
+	InviterUID  string           `gorm:"not null; type:varchar(32)"`
+	Inviter     string           `gorm:"not null; type:varchar(32)"`
+	InviteeUID  string           `gorm:"not null; index:idx_invitee_uid; type:varchar(32)"`
+	Invitee     string           `gorm:"not null; type:varchar(32)"`
+	Status      InvitationStatus `gorm:"not null; default:1"`
+	CreatedAt   int64            `gorm:"not null"`
+	RespondedAt int64            `gorm:"not null; default:0"`
+}
+
+func (ProjectInvitation) TableName() string {
+	return "project_invitations"
+}
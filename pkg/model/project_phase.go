@@ -0,0 +1,51 @@
+package model
+
+import "gorm.io/datatypes"
+
+type PhaseStatus int64
+
+const (
+	PhaseStatusPending   PhaseStatus = 1 // 待提交
+	PhaseStatusSubmitted PhaseStatus = 2 // 已提交，待老师审核
+	PhaseStatusApproved  PhaseStatus = 3 // 审核通过
+	PhaseStatusRejected  PhaseStatus = 4 // 退回，需重新提交
+)
+
+// PhaseTemplate 专业的阶段模板（开题、中期、结题），项目进入进行状态时按模板生成各阶段
+type PhaseTemplate struct {
+	ID               int64          `gorm:"primary_key;AUTO_INCREMENT"`
+	ProfessionHashID string         `gorm:"not null; index:idx_profession_hash_id; type:varchar(64)"`
+	Name             string         `gorm:"not null; type:varchar(32)"`
+	Sequence         int            `gorm:"not null"`            // 阶段顺序，从小到大依次完成
+	Deadline         int64          `gorm:"not null; default:0"` // unix milli, 0 表示不限
+	Deliverables     datatypes.JSON `gorm:"type:json"`           // 需要提交的材料名称 []string
+	CreatorUID       string         `gorm:"not null; type:varchar(32)"`
+	CreatedAt        int64          `gorm:"not null"`
+}
+
+func (PhaseTemplate) TableName() string {
+	return "phase_templates"
+}
+
+// ProjectPhase 项目的一个阶段，学生按阶段提交材料，老师逐个审核
+type ProjectPhase struct {
+	ID           int64          `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID    int64          `gorm:"not null; index:idx_project_id"`
+	TemplateID   int64          `gorm:"not null"`
+	Name         string         `gorm:"not null; type:varchar(32)"`
+	Sequence     int            `gorm:"not null"`
+	Deadline     int64          `gorm:"not null; default:0"`
+	Deliverables datatypes.JSON `gorm:"type:json"` // []string
+	Status       PhaseStatus    `gorm:"not null; default:1"`
+
+	Submission    datatypes.JSON `gorm:"type:json"` // 材料名称 -> 内容或文件地址
+	SubmitterUID  string         `gorm:"type:varchar(32)"`
+	SubmittedAt   int64          `gorm:"not null; default:0"`
+	ReviewerUID   string         `gorm:"type:varchar(32)"`
+	ReviewComment string         `gorm:"type:varchar(255)"`
+	ReviewedAt    int64          `gorm:"not null; default:0"`
+}
+
+func (ProjectPhase) TableName() string {
+	return "project_phases"
+}
@@ -0,0 +1,60 @@
+package model
+
+// ProjectTransition allows the roles to move a project from one status to another
+type ProjectTransition struct {
+	From  ProjectStatus
+	To    ProjectStatus
+	Roles []RoleType
+	// OwnerOnly limits the transition to the teacher who created the project
+	OwnerOnly bool
+}
+
+// ProjectTransitions 项目状态机：审核 -> 通过审核 -> (被选择) 进行 -> 完成或关闭
+var ProjectTransitions = []ProjectTransition{
+	// 审核
+	{From: ProjectStatusAudit, To: ProjectStatusPASS, Roles: []RoleType{RoleTypeCollegeAdmin, RoleTypeSuperAdmin}},
+	{From: ProjectStatusAudit, To: ProjectStatusClose, Roles: []RoleType{RoleTypeCollegeAdmin, RoleTypeSuperAdmin}},
+	{From: ProjectStatusAudit, To: ProjectStatusClose, Roles: []RoleType{RoleTypeTeacher}, OwnerOnly: true}, // 撤回
+	// 学生选题
+	{From: ProjectStatusPASS, To: ProjectStatusProceed, Roles: []RoleType{RoleTypeStudent}},
+	{From: ProjectStatusPASS, To: ProjectStatusClose, Roles: []RoleType{RoleTypeCollegeAdmin, RoleTypeSuperAdmin}},
+	{From: ProjectStatusPASS, To: ProjectStatusClose, Roles: []RoleType{RoleTypeTeacher}, OwnerOnly: true},
+	// 进行中
+	{From: ProjectStatusProceed, To: ProjectStatusFinish, Roles: []RoleType{RoleTypeTeacher}, OwnerOnly: true},
+	{From: ProjectStatusProceed, To: ProjectStatusClose, Roles: []RoleType{RoleTypeCollegeAdmin, RoleTypeSuperAdmin}},
+	{From: ProjectStatusProceed, To: ProjectStatusClose, Roles: []RoleType{RoleTypeTeacher}, OwnerOnly: true},
+	// 关闭后重新提交审核
+	{From: ProjectStatusClose, To: ProjectStatusAudit, Roles: []RoleType{RoleTypeTeacher}, OwnerOnly: true},
+}
+
+// CanTransit reports whether the role may move a project from s to the status, owner tells whether the caller created the project
+func (s ProjectStatus) CanTransit(to ProjectStatus, role RoleType, owner bool) bool {
+	for _, t := range ProjectTransitions {
+		if t.From != s || t.To != to || (t.OwnerOnly && !owner) {
+			continue
+		}
+		for _, r := range t.Roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ProjectStatusHistory records a status transition of a project
+type ProjectStatusHistory struct {
+	ID         int64         `gorm:"primary_key;AUTO_INCREMENT"`
+	ProjectID  int64         `gorm:"not null; index:idx_project_id"`
+	FromStatus ProjectStatus `gorm:"not null"`
+	ToStatus   ProjectStatus `gorm:"not null"`
+	ActorUID   string        `gorm:"column:actor_uid; not null; type:varchar(32)"`
+	Actor      string        `gorm:"not null; type:varchar(32)"`
+	ActorRole  RoleType      `gorm:"not null; type:varchar(32)"`
+	Reason     string        `gorm:"type:varchar(255)"`
+	CreatedAt  int64         `gorm:"not null"`
+}
+
+func (ProjectStatusHistory) TableName() string {
+	return "project_status_history"
+}
@@ -1 +1,21 @@
 package model
+
+// RoleTypes all roles a user can be given
+var RoleTypes = []RoleType{
+	RoleTypeSuperAdmin,
+	RoleTypeCollegeAdmin,
+	RoleTypeTeacher,
+	RoleTypeStudent,
+	RoleTypeNormal,
+	RoleTypeFirm,
+}
+
+// Valid reports whether r is one of RoleTypes
+func (r RoleType) Valid() bool {
+	for _, role := range RoleTypes {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
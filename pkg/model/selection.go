@@ -0,0 +1,35 @@
+package model
+
+type SelectionRoundStatus int64
+
+const (
+	SelectionRoundOpen    SelectionRoundStatus = 1 // 接受志愿
+	SelectionRoundMatched SelectionRoundStatus = 2 // 已完成匹配
+)
+
+type ApplicationStatus int64
+
+const (
+	ApplicationPending   ApplicationStatus = 1 // 等待匹配
+	ApplicationAccepted  ApplicationStatus = 2 // 录取
+	ApplicationRejected  ApplicationStatus = 3 // 未录取
+	ApplicationWithdrawn ApplicationStatus = 4 // 学生重新填报后作废
+)
+
+// SelectionRound 专业的一轮选题，学生填报志愿、老师给申请者排名，截止后按稳定匹配分配项目
+type SelectionRound struct {
+	ID               int64                `gorm:"primary_key;AUTO_INCREMENT"`
+	Name             string               `gorm:"not null; type:varchar(32)"`
+	ProfessionHashID string               `gorm:"not null; index:idx_profession_hash_id; type:varchar(64)"`
+	MaxPreferences   int                  `gorm:"not null"` // 每个学生最多填报的志愿数
+	StartAt          int64                `gorm:"not null"` // unix milli
+	EndAt            int64                `gorm:"not null; index:idx_end_at"`
+	Status           SelectionRoundStatus `gorm:"not null; default:1"`
+	CreatorUID       string               `gorm:"not null; type:varchar(32)"`
+	CreatedAt        int64                `gorm:"not null"`
+	MatchedAt        int64                `gorm:"not null; default:0"`
+}
+
+func (SelectionRound) TableName() string {
+	return "selection_rounds"
+}
@@ -0,0 +1,54 @@
+package model
+
+import "gorm.io/datatypes"
+
+// roles that can enroll in two-factor authentication
+var TwoFactorRoleTypes = []RoleType{
+	RoleTypeSuperAdmin,
+	RoleTypeCollegeAdmin,
+	RoleTypeTeacher,
+}
+
+// TwoFactorCapable reports whether users of the role can enroll in two-factor authentication
+func (r RoleType) TwoFactorCapable() bool {
+	for _, role := range TwoFactorRoleTypes {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// UserTwoFactor TOTP enrollment of a user
+type UserTwoFactor struct {
+	ID            int64          `gorm:"primary_key;AUTO_INCREMENT"`
+	UserUID       string         `gorm:"column:user_uid; not null; index:uniq_user_uid,unique; type:varchar(32)"`
+	Secret        string         `gorm:"column:secret; not null; type:varchar(255)"` // AES-GCM 加密后的密钥
+	Enabled       bool           `gorm:"column:enabled; not null; default:false"`    // 验证过一次验证码后启用
+	RecoveryCodes datatypes.JSON `gorm:"column:recovery_codes; type:json"`           // 恢复码的 sha256
+	LastUsedStep  int64          `gorm:"column:last_used_step; not null; default:0"` // 防止验证码重放
+
+	CreatedAt int64 `gorm:"not null"`
+	UpdatedAt int64 `gorm:"not null; default:0"`
+}
+
+func (UserTwoFactor) TableName() string {
+	return "user_two_factors"
+}
+
+const ConfigKeyTwoFactor ConfigKey = "two_factor"
+
+// ConfigTwoFactor users of the required roles must pass two-factor authentication to log in
+type ConfigTwoFactor struct {
+	RequiredRoles []RoleType `json:"required_roles"`
+}
+
+// Required reports whether two-factor authentication is mandatory for the role
+func (c ConfigTwoFactor) Required(role RoleType) bool {
+	for _, r := range c.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
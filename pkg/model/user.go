@@ -27,7 +27,7 @@ type User struct {
 	Username         string   `gorm:"column:username; not null; index:uniq_username,unique; type:varchar(32)"` // 用户名
 	Name             string   `gorm:"column:name; not null; type:varchar(64)"`                                 // 昵称
 	Role             RoleType `gorm:"not null; type:varchar(32); default:0"`
-	Password         string   `gorm:"column:password; not null; type:varchar(32)"`
+	Password         string   `gorm:"column:password; not null; type:varchar(255)"`
 	ProfessionHashID string   `gorm:"column:profession_hash_id; not null;type:varchar(64)"`
 	ClassHashID      string   `gorm:"column:class_hash_id; type:varchar(64)"`
 
@@ -38,6 +38,8 @@ type User struct {
 	Status    UserStatus `gorm:"not null"`
 	Phone     string     `gorm:"column:phone; type:varchar(32)"`
 	Emial     string     `gorm:"column:email; type:varchar(32)"`
+
+	LastSeenAt int64 `gorm:"not null; default:0"` // 最后一次断开聊天连接的时间
 }
 
 func (User) TableName() string {
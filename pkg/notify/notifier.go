@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is a notification to a user
+type Message struct {
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+	// Secrets are the parts of the body only the user may see, e.g. a reset token, they are never logged
+	Secrets []string `json:"-"`
+}
+
+// Redacted returns the body with the secrets masked
+func (m Message) Redacted() string {
+	body := m.Body
+	for _, secret := range m.Secrets {
+		if secret != "" {
+			body = strings.ReplaceAll(body, secret, "******")
+		}
+	}
+	return body
+}
+
+// Notifier delivers messages to users, e.g. by mail or sms
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+var defaultNotifier Notifier = NewLogNotifier()
+
+// SetDefault sets the notifier used by the handlers
+func SetDefault(n Notifier) {
+	if n != nil {
+		defaultNotifier = n
+	}
+}
+
+// Default returns the notifier used by the handlers
+func Default() Notifier {
+	return defaultNotifier
+}
+
+type logNotifier struct{}
+
+// NewLogNotifier writes messages to the log with their secrets masked, for development only,
+// the file notifier keeps the secrets for reading them back
+func NewLogNotifier() Notifier {
+	return logNotifier{}
+}
+
+func (logNotifier) Notify(ctx context.Context, msg Message) error {
+	zap.L().Info("notify", zap.String("username", msg.Username), zap.String("subject", msg.Subject), zap.String("body", msg.Redacted()))
+	return nil
+}
+
+type fileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileNotifier appends messages as json lines to the file, for development only
+func NewFileNotifier(path string) Notifier {
+	return &fileNotifier{path: path}
+}
+
+func (n *fileNotifier) Notify(ctx context.Context, msg Message) error {
+	b, err := json.Marshal(struct {
+		Message
+		Time string `json:"time"`
+	}{msg, time.Now().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
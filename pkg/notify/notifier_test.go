@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var message = Message{
+	Username: "alice",
+	Subject:  "reset",
+	Body:     "your token is t0ken, valid for 30 minutes",
+	Secrets:  []string{"t0ken"},
+}
+
+func TestLogNotifierRedactsSecrets(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	if err := NewLogNotifier().Notify(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(entries))
+	}
+	body := entries[0].ContextMap()["body"].(string)
+	if strings.Contains(body, "t0ken") || body != "your token is ******, valid for 30 minutes" {
+		t.Fatalf("logged body %q", body)
+	}
+}
+
+func TestFileNotifierKeepsSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	if err := NewFileNotifier(path).Notify(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), message.Body) || strings.Contains(string(b), "secrets") {
+		t.Fatalf("file notifier wrote %s", b)
+	}
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	notifierType = "notifier"
+	notifierFile = "notifier-file"
+
+	typeLog  = "log"
+	typeFile = "file"
+)
+
+type Options struct {
+	// log or file
+	Type string
+	// file the file notifier appends to
+	File string
+	v    *viper.Viper
+}
+
+func NewNotifyOptions() *Options {
+	o := &Options{
+		Type: typeLog,
+		File: "notifications.log",
+		v:    viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.Type = o.v.GetString(notifierType)
+	o.File = o.v.GetString(notifierFile)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	switch o.Type {
+	case typeLog:
+	case typeFile:
+		if o.File == "" {
+			errors = append(errors, fmt.Errorf("%s must not be empty", notifierFile))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("unsupported notifier %q", o.Type))
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Type, notifierType, o.Type, "how password reset links etc. are delivered, log or file. env NOTIFIER")
+	fs.StringVar(&o.File, notifierFile, o.File, "file the file notifier appends to. env NOTIFIER_FILE")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewNotifier creates the Notifier described by the options
+func (o *Options) NewNotifier() Notifier {
+	if o.Type == typeFile {
+		return NewFileNotifier(o.File)
+	}
+	return NewLogNotifier()
+}
@@ -0,0 +1,157 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idID = "argon2id"
+
+	DefaultArgon2Memory      = 64 * 1024 // KiB
+	DefaultArgon2Iterations  = 3
+	DefaultArgon2Parallelism = 2
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+
+	// 存储的哈希中内存参数的上限，超过的哈希一次校验就要分配这么多内存
+	maxArgon2Memory = 1 << 20 // KiB, 1 GiB
+)
+
+type argon2idHasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// NewArgon2idHasher returns a Hasher producing hashes like
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func NewArgon2idHasher(options ...Argon2Option) Hasher {
+	h := &argon2idHasher{
+		memory:      DefaultArgon2Memory,
+		iterations:  DefaultArgon2Iterations,
+		parallelism: DefaultArgon2Parallelism,
+	}
+
+	for _, opt := range options {
+		opt(h)
+	}
+
+	return h
+}
+
+type Argon2Option func(h *argon2idHasher)
+
+// SetArgon2Memory sets the memory cost in KiB
+func SetArgon2Memory(memory uint32) Argon2Option {
+	return func(h *argon2idHasher) {
+		h.memory = memory
+	}
+}
+
+// SetArgon2Iterations sets the time cost
+func SetArgon2Iterations(iterations uint32) Argon2Option {
+	return func(h *argon2idHasher) {
+		h.iterations = iterations
+	}
+}
+
+// SetArgon2Parallelism sets the number of lanes
+func SetArgon2Parallelism(parallelism uint8) Argon2Option {
+	return func(h *argon2idHasher) {
+		h.parallelism = parallelism
+	}
+}
+
+func (h *argon2idHasher) ID() string {
+	return argon2idID
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, argon2KeyLen)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2idID, argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *argon2idHasher) Identify(encoded string) bool {
+	fields := phcFields(encoded)
+	return len(fields) > 0 && fields[0] == argon2idID
+}
+
+func (h *argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return p.memory < h.memory || p.iterations < h.iterations || p.parallelism < h.parallelism
+}
+
+func decodeArgon2id(encoded string) (*argon2Params, error) {
+	fields := phcFields(encoded)
+	if len(fields) != 5 || fields[0] != argon2idID {
+		return nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(fields[1], "v=%d", &version); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(fields[2], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return nil, ErrInvalidHash
+	}
+	// argon2.IDKey 在 t 或 p 为 0 时 panic
+	if !validArgon2Params(p.memory, p.iterations, p.parallelism) {
+		return nil, ErrInvalidHash
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(fields[3]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(fields[4]); err != nil || len(p.key) == 0 {
+		return nil, ErrInvalidHash
+	}
+
+	return p, nil
+}
+
+// validArgon2Params reports whether the parameters are safe to compute: at least one pass and one lane,
+// at least 8 KiB per lane as argon2 requires and at most maxArgon2Memory
+func validArgon2Params(memory, iterations uint32, parallelism uint8) bool {
+	return iterations >= 1 && parallelism >= 1 && memory >= 8*uint32(parallelism) && memory <= maxArgon2Memory
+}
@@ -0,0 +1,100 @@
+package password
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown password hash format")
+	ErrInvalidHash   = errors.New("invalid password hash")
+)
+
+// Hasher hashes passwords into a self-describing encoded string
+// and verifies plain passwords against it
+type Hasher interface {
+	// ID returns the algorithm identifier, the same as the PHC id of its encoded hash
+	ID() string
+
+	// Hash returns the encoded hash of the given password
+	Hash(password string) (string, error)
+
+	// Verify reports whether the password matches the encoded hash
+	Verify(password, encoded string) (bool, error)
+
+	// Identify reports whether the encoded hash was produced by this hasher
+	Identify(encoded string) bool
+
+	// NeedsRehash reports whether the encoded hash was produced with weaker parameters than the current ones
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	defaultHasher Hasher = NewArgon2idHasher()
+
+	// legacy hashers are only used to verify, never to hash
+	legacyHashers = []Hasher{NewMD5Hasher()}
+)
+
+// SetDefault sets the hasher used for newly stored passwords
+func SetDefault(h Hasher) {
+	if h != nil {
+		defaultHasher = h
+	}
+}
+
+// Default returns the hasher used for newly stored passwords
+func Default() Hasher {
+	return defaultHasher
+}
+
+// Hash hashes the password with the default hasher
+func Hash(password string) (string, error) {
+	return defaultHasher.Hash(password)
+}
+
+// Verify checks the password against an encoded hash of any supported format.
+// rehash reports whether the stored hash should be replaced by one from the default hasher.
+func Verify(password, encoded string) (ok bool, rehash bool, err error) {
+	h, err := identify(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	ok, err = h.Verify(password, encoded)
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	if h.ID() != defaultHasher.ID() {
+		return true, true, nil
+	}
+
+	return true, defaultHasher.NeedsRehash(encoded), nil
+}
+
+func identify(encoded string) (Hasher, error) {
+	if defaultHasher.Identify(encoded) {
+		return defaultHasher, nil
+	}
+
+	for _, h := range knownHashers() {
+		if h.Identify(encoded) {
+			return h, nil
+		}
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+func knownHashers() []Hasher {
+	return append([]Hasher{NewArgon2idHasher(), NewBcryptHasher()}, legacyHashers...)
+}
+
+// phcFields splits a PHC string "$id$v=19$params$salt$hash" into its fields
+func phcFields(encoded string) []string {
+	if !strings.HasPrefix(encoded, "$") {
+		return nil
+	}
+	return strings.Split(encoded[1:], "$")
+}
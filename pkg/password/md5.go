@@ -0,0 +1,42 @@
+package password
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"v1/pkg/utils"
+)
+
+const md5ID = "md5"
+
+// md5Hasher verifies the unsalted MD5 hex rows written before the hasher existed,
+// it refuses to produce new hashes
+type md5Hasher struct{}
+
+func NewMD5Hasher() Hasher {
+	return md5Hasher{}
+}
+
+func (md5Hasher) ID() string {
+	return md5ID
+}
+
+func (md5Hasher) Hash(string) (string, error) {
+	return "", errors.New("md5 is only supported for verifying legacy passwords")
+}
+
+func (md5Hasher) Verify(password, encoded string) (bool, error) {
+	return subtle.ConstantTimeCompare([]byte(utils.MD5Hex(password)), []byte(encoded)) == 1, nil
+}
+
+func (md5Hasher) Identify(encoded string) bool {
+	if len(encoded) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+func (md5Hasher) NeedsRehash(string) bool {
+	return true
+}
@@ -0,0 +1,94 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordHasher            = "password-hasher"
+	passwordBcryptCost        = "password-bcrypt-cost"
+	passwordArgon2Memory      = "password-argon2-memory"
+	passwordArgon2Iterations  = "password-argon2-iterations"
+	passwordArgon2Parallelism = "password-argon2-parallelism"
+)
+
+type Options struct {
+	Hasher            string
+	BcryptCost        int
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	v                 *viper.Viper
+}
+
+func NewPasswordOptions() *Options {
+	o := &Options{
+		Hasher:            argon2idID,
+		BcryptCost:        bcrypt.DefaultCost,
+		Argon2Memory:      DefaultArgon2Memory,
+		Argon2Iterations:  DefaultArgon2Iterations,
+		Argon2Parallelism: DefaultArgon2Parallelism,
+		v:                 viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.Hasher = o.v.GetString(passwordHasher)
+	o.BcryptCost = o.v.GetInt(passwordBcryptCost)
+	o.Argon2Memory = o.v.GetUint32(passwordArgon2Memory)
+	o.Argon2Iterations = o.v.GetUint32(passwordArgon2Iterations)
+	o.Argon2Parallelism = uint8(o.v.GetUint(passwordArgon2Parallelism))
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	switch o.Hasher {
+	case argon2idID:
+		if !validArgon2Params(o.Argon2Memory, o.Argon2Iterations, o.Argon2Parallelism) {
+			errors = append(errors, fmt.Errorf("invalid argon2 parameters, memory must be between 8*parallelism and %d KiB", maxArgon2Memory))
+		}
+	case bcryptID:
+		if o.BcryptCost < bcrypt.MinCost || o.BcryptCost > bcrypt.MaxCost {
+			errors = append(errors, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("unsupported password hasher %q", o.Hasher))
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Hasher, passwordHasher, o.Hasher, "hasher for newly stored passwords, argon2id or bcrypt. env PASSWORD_HASHER")
+	fs.IntVar(&o.BcryptCost, passwordBcryptCost, o.BcryptCost, "env PASSWORD_BCRYPT_COST")
+	fs.Uint32Var(&o.Argon2Memory, passwordArgon2Memory, o.Argon2Memory, "argon2id memory in KiB. env PASSWORD_ARGON2_MEMORY")
+	fs.Uint32Var(&o.Argon2Iterations, passwordArgon2Iterations, o.Argon2Iterations, "env PASSWORD_ARGON2_ITERATIONS")
+	fs.Uint8Var(&o.Argon2Parallelism, passwordArgon2Parallelism, o.Argon2Parallelism, "env PASSWORD_ARGON2_PARALLELISM")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewHasher creates the Hasher described by the options
+func (o *Options) NewHasher() Hasher {
+	if o.Hasher == bcryptID {
+		return NewBcryptHasher(o.BcryptCost)
+	}
+
+	return NewArgon2idHasher(
+		SetArgon2Memory(o.Argon2Memory),
+		SetArgon2Iterations(o.Argon2Iterations),
+		SetArgon2Parallelism(o.Argon2Parallelism),
+	)
+}
@@ -0,0 +1,138 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"v1/pkg/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 测试用较小的参数，免得每个用例都要几十毫秒
+func cheapArgon2(options ...Argon2Option) Hasher {
+	return NewArgon2idHasher(append([]Argon2Option{SetArgon2Memory(1024), SetArgon2Iterations(1), SetArgon2Parallelism(1)}, options...)...)
+}
+
+func useDefault(t *testing.T, h Hasher) {
+	t.Helper()
+	old := Default()
+	SetDefault(h)
+	t.Cleanup(func() { SetDefault(old) })
+}
+
+func mustHash(t *testing.T, h Hasher, password string) string {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return encoded
+}
+
+// withArgon2Params replaces the m, t and p parameters of the argon2id hash
+func withArgon2Params(encoded, params string) string {
+	fields := strings.Split(encoded, "$")
+	fields[3] = params
+	return strings.Join(fields, "$")
+}
+
+func TestVerify(t *testing.T) {
+	useDefault(t, cheapArgon2())
+
+	argon2Hash := mustHash(t, cheapArgon2(), "secret")
+	weakArgon2Hash := mustHash(t, NewArgon2idHasher(SetArgon2Memory(512), SetArgon2Iterations(1), SetArgon2Parallelism(1)), "secret")
+	bcryptHash := mustHash(t, NewBcryptHasher(bcrypt.MinCost), "secret")
+	md5Hash := utils.MD5Hex("secret")
+
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		ok       bool
+		rehash   bool
+		err      error
+	}{
+		{name: "argon2id", password: "secret", encoded: argon2Hash, ok: true},
+		{name: "argon2id wrong password", password: "wrong", encoded: argon2Hash},
+		{name: "argon2id weaker parameters", password: "secret", encoded: weakArgon2Hash, ok: true, rehash: true},
+		{name: "bcrypt", password: "secret", encoded: bcryptHash, ok: true, rehash: true},
+		{name: "bcrypt wrong password", password: "wrong", encoded: bcryptHash},
+		{name: "md5", password: "secret", encoded: md5Hash, ok: true, rehash: true},
+		{name: "md5 wrong password", password: "wrong", encoded: md5Hash},
+		{name: "unknown format", password: "secret", encoded: "plain", err: ErrUnknownFormat},
+		{name: "empty", password: "secret", encoded: "", err: ErrUnknownFormat},
+		{name: "broken argon2id", password: "secret", encoded: "$argon2id$v=19$m=1024,t=1,p=1$!!$!!", err: ErrInvalidHash},
+		{name: "argon2id without iterations", password: "secret", encoded: withArgon2Params(argon2Hash, "m=1024,t=0,p=1"), err: ErrInvalidHash},
+		{name: "argon2id without lanes", password: "secret", encoded: withArgon2Params(argon2Hash, "m=1024,t=1,p=0"), err: ErrInvalidHash},
+		{name: "argon2id memory below 8 KiB a lane", password: "secret", encoded: withArgon2Params(argon2Hash, "m=15,t=1,p=2"), err: ErrInvalidHash},
+		{name: "argon2id memory over 1 GiB", password: "secret", encoded: withArgon2Params(argon2Hash, "m=1048577,t=1,p=1"), err: ErrInvalidHash},
+		{name: "argon2id memory overflow", password: "secret", encoded: withArgon2Params(argon2Hash, "m=4294967296,t=1,p=1"), err: ErrInvalidHash},
+		{name: "argon2id lanes overflow", password: "secret", encoded: withArgon2Params(argon2Hash, "m=1024,t=1,p=256"), err: ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := Verify(tt.password, tt.encoded)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if ok != tt.ok || rehash != tt.rehash {
+				t.Fatalf("ok, rehash = %v, %v, want %v, %v", ok, rehash, tt.ok, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestVerifyBcryptDefault(t *testing.T) {
+	useDefault(t, NewBcryptHasher(bcrypt.MinCost+1))
+
+	tests := []struct {
+		name    string
+		encoded string
+		rehash  bool
+	}{
+		{name: "same cost", encoded: mustHash(t, NewBcryptHasher(bcrypt.MinCost+1), "secret")},
+		{name: "lower cost", encoded: mustHash(t, NewBcryptHasher(bcrypt.MinCost), "secret"), rehash: true},
+		{name: "argon2id", encoded: mustHash(t, cheapArgon2(), "secret"), rehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := Verify("secret", tt.encoded)
+			if err != nil || !ok || rehash != tt.rehash {
+				t.Fatalf("Verify = %v, %v, %v, want true, %v, nil", ok, rehash, err, tt.rehash)
+			}
+		})
+	}
+}
+
+// TestMD5Rehash follows the login: a legacy md5 row verifies, asks for a rehash,
+// and the new hash from the default hasher verifies without asking again
+func TestMD5Rehash(t *testing.T) {
+	useDefault(t, cheapArgon2())
+
+	ok, rehash, err := Verify("secret", utils.MD5Hex("secret"))
+	if err != nil || !ok || !rehash {
+		t.Fatalf("Verify md5 = %v, %v, %v, want true, true, nil", ok, rehash, err)
+	}
+
+	encoded, err := Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !Default().Identify(encoded) {
+		t.Fatalf("rehashed %q is not an argon2id hash", encoded)
+	}
+
+	ok, rehash, err = Verify("secret", encoded)
+	if err != nil || !ok || rehash {
+		t.Fatalf("Verify rehashed = %v, %v, %v, want true, false, nil", ok, rehash, err)
+	}
+}
+
+func TestMD5HasherRefusesToHash(t *testing.T) {
+	if _, err := NewMD5Hasher().Hash("secret"); err == nil {
+		t.Fatal("md5 hasher produced a hash")
+	}
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"v1/pkg/client/cache"
+)
+
+const rateLimitKeyPrefix = "rate_limit:"
+
+// Algorithm decides how the requests of a policy are counted
+type Algorithm string
+
+const (
+	// TokenBucket refills Limit tokens per Period up to Burst, short bursts pass at once
+	TokenBucket Algorithm = "token-bucket"
+	// SlidingWindow allows Limit requests in any Period, weighting the previous window by its overlap
+	SlidingWindow Algorithm = "sliding-window"
+)
+
+// KeyBy decides which requests share a limit
+type KeyBy string
+
+const (
+	KeyByIP    KeyBy = "ip"
+	KeyByUser  KeyBy = "user" // falls back to the client IP without a token
+	KeyByRoute KeyBy = "route"
+)
+
+// Policy is the limit of a group of routes
+type Policy struct {
+	// Name separates the counters of policies sharing a key
+	Name      string
+	Algorithm Algorithm
+	KeyBy     KeyBy
+	Limit     int
+	Period    time.Duration
+	// Burst is the bucket size of TokenBucket, zero means Limit
+	Burst int
+}
+
+// Limiter decides whether a request may pass a policy
+type Limiter interface {
+	// Allow counts a request of key, it returns how long to wait when the request is over the limit
+	Allow(ctx context.Context, policy Policy, key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// limiter keeps the state in cache.Interface, so instances sharing a redis cache share the limits.
+// Every update is atomic in the cache, both algorithms hold across instances
+type limiter struct {
+	cacheClient cache.Interface
+}
+
+func NewLimiter(cacheClient cache.Interface) Limiter {
+	return &limiter{cacheClient: cacheClient}
+}
+
+var defaultLimiter Limiter
+
+// SetDefault sets the limiter shared by the route groups
+func SetDefault(l Limiter) {
+	if l != nil {
+		defaultLimiter = l
+	}
+}
+
+// Default returns the limiter set by SetDefault
+func Default() Limiter {
+	return defaultLimiter
+}
+
+func (l *limiter) Allow(ctx context.Context, policy Policy, key string) (bool, time.Duration, error) {
+	if policy.Limit <= 0 || policy.Period <= 0 {
+		return true, 0, nil
+	}
+
+	key = rateLimitKeyPrefix + policy.Name + ":" + key
+	if policy.Algorithm == SlidingWindow {
+		return l.allowSlidingWindow(ctx, policy, key)
+	}
+	return l.allowTokenBucket(ctx, policy, key)
+}
+
+// allowTokenBucket implements the bucket as GCRA, keeping only the theoretical arrival time of the next request.
+// The time is updated with compare-and-swap, a request racing with another one on any instance retries
+func (l *limiter) allowTokenBucket(ctx context.Context, policy Policy, key string) (bool, time.Duration, error) {
+	burst := policy.Burst
+	if burst <= 0 {
+		burst = policy.Limit
+	}
+	interval := policy.Period / time.Duration(policy.Limit)
+
+	for ctx.Err() == nil {
+		now := time.Now()
+		tat := now
+
+		val, err := l.cacheClient.Get(ctx, key)
+		if err != nil && !errors.Is(err, cache.ErrNoSuchKey) {
+			return true, 0, err
+		}
+		if err == nil {
+			if n, err := strconv.ParseInt(val, 10, 64); err == nil && time.UnixMilli(n).After(now) {
+				tat = time.UnixMilli(n)
+			}
+		}
+
+		newTat := tat.Add(interval)
+		if allowAt := newTat.Add(-interval * time.Duration(burst)); now.Before(allowAt) {
+			return false, allowAt.Sub(now), nil
+		}
+
+		swapped, err := l.cacheClient.CompareAndSwap(ctx, key, val, strconv.FormatInt(newTat.UnixMilli(), 10), newTat.Sub(now))
+		if err != nil || swapped {
+			return true, 0, err
+		}
+	}
+	return true, 0, ctx.Err()
+}
+
+func (l *limiter) allowSlidingWindow(ctx context.Context, policy Policy, key string) (bool, time.Duration, error) {
+	now := time.Now()
+	window := now.UnixNano() / int64(policy.Period)
+	elapsed := time.Duration(now.UnixNano() % int64(policy.Period))
+
+	// denied requests are counted too, clients ignoring Retry-After stay limited
+	current, err := l.cacheClient.Incr(ctx, key+":"+strconv.FormatInt(window, 10), policy.Period*2)
+	if err != nil {
+		return true, 0, err
+	}
+
+	var previous int64
+	val, err := l.cacheClient.Get(ctx, key+":"+strconv.FormatInt(window-1, 10))
+	if err == nil {
+		previous, _ = strconv.ParseInt(val, 10, 64)
+	}
+
+	weight := 1 - float64(elapsed)/float64(policy.Period)
+	limit := int64(policy.Limit)
+	if float64(previous)*weight+float64(current) <= float64(limit) {
+		return true, 0, nil
+	}
+
+	// the current window alone is over the limit, wait for the next one
+	if current > limit || previous == 0 {
+		return false, policy.Period - elapsed, nil
+	}
+	// wait until the previous window weighs little enough
+	pass := time.Duration(float64(policy.Period) * (1 - float64(limit-current)/float64(previous)))
+	return false, pass - elapsed, nil
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"v1/pkg/client/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// limiters returns two limiters per backend, the redis ones sharing a server as if on two instances
+func limiters(t *testing.T) map[string][2]Limiter {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	newRedis := func() Limiter {
+		c, err := cache.NewRedisCache(context.Background(), &redis.Options{Addr: s.Addr()})
+		if err != nil {
+			t.Fatalf("NewRedisCache: %v", err)
+		}
+		return NewLimiter(c)
+	}
+
+	memory := cache.NewSimpleCache()
+	return map[string][2]Limiter{
+		"memory": {NewLimiter(memory), NewLimiter(memory)},
+		"redis":  {newRedis(), newRedis()},
+	}
+}
+
+// allowConcurrently sends n requests of one key at once and returns how many passed
+func allowConcurrently(t *testing.T, l [2]Limiter, policy Policy, n int) int {
+	t.Helper()
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int64
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(l Limiter) {
+			defer wg.Done()
+			ok, _, err := l.Allow(context.Background(), policy, "127.0.0.1")
+			if err != nil {
+				t.Errorf("Allow: %v", err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}(l[i%2])
+	}
+	wg.Wait()
+	return int(allowed.Load())
+}
+
+func TestTokenBucketConcurrently(t *testing.T) {
+	policy := Policy{Name: "test", Algorithm: TokenBucket, Limit: 1, Period: time.Hour, Burst: 5}
+	for name, l := range limiters(t) {
+		t.Run(name, func(t *testing.T) {
+			if allowed := allowConcurrently(t, l, policy, 40); allowed != policy.Burst {
+				t.Fatalf("%d requests allowed, want the burst of %d", allowed, policy.Burst)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowConcurrently(t *testing.T) {
+	policy := Policy{Name: "test", Algorithm: SlidingWindow, Limit: 5, Period: time.Hour}
+	for name, l := range limiters(t) {
+		t.Run(name, func(t *testing.T) {
+			if allowed := allowConcurrently(t, l, policy, 40); allowed != policy.Limit {
+				t.Fatalf("%d requests allowed, want the limit of %d", allowed, policy.Limit)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRetryAfter(t *testing.T) {
+	policy := Policy{Name: "test", Algorithm: TokenBucket, Limit: 2, Period: time.Minute, Burst: 2}
+	ctx := context.Background()
+	for name, l := range limiters(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < policy.Burst; i++ {
+				if ok, _, err := l[i%2].Allow(ctx, policy, "u1"); !ok || err != nil {
+					t.Fatalf("request %d = %v, %v, want allowed", i, ok, err)
+				}
+			}
+
+			ok, retryAfter, err := l[0].Allow(ctx, policy, "u1")
+			if ok || err != nil {
+				t.Fatalf("request over the burst = %v, %v, want denied", ok, err)
+			}
+			// 下一个令牌在一个间隔后补充
+			if interval := policy.Period / time.Duration(policy.Limit); retryAfter <= 0 || retryAfter > interval {
+				t.Fatalf("retry after %v, want within %v", retryAfter, interval)
+			}
+
+			// 其他键不受影响
+			if ok, _, _ = l[1].Allow(ctx, policy, "u2"); !ok {
+				t.Fatal("another key was limited")
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package ratelimit
+
+import "time"
+
+// Policies of the route groups
+var (
+	// PolicyLogin limits password guessing from a client IP, the lockout guard limits it per account
+	PolicyLogin = Policy{Name: "login", Algorithm: SlidingWindow, KeyBy: KeyByIP, Limit: 20, Period: time.Minute}
+
+	// PolicyCaptcha limits captcha generation from a client IP
+	PolicyCaptcha = Policy{Name: "captcha", Algorithm: TokenBucket, KeyBy: KeyByIP, Limit: 1, Period: time.Second, Burst: 5}
+
+	// PolicyProjectChoose limits how often a student can choose a project
+	PolicyProjectChoose = Policy{Name: "project-choose", Algorithm: SlidingWindow, KeyBy: KeyByUser, Limit: 10, Period: time.Minute}
+
+	// PolicyList limits the list and tree queries of a user
+	PolicyList = Policy{Name: "list", Algorithm: TokenBucket, KeyBy: KeyByUser, Limit: 10, Period: time.Second, Burst: 30}
+)
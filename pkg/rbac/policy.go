@@ -0,0 +1,245 @@
+package rbac
+
+import (
+	"v1/pkg/model"
+)
+
+// Permission is an action on a resource, "resource:verb"
+type Permission string
+
+const (
+	PermissionProjectCreate Permission = "project:create"
+	PermissionProjectDelete Permission = "project:delete"
+	PermissionProjectList   Permission = "project:list"
+	PermissionProjectDetail Permission = "project:detail"
+	PermissionProjectUpdate Permission = "project:update" // 更改状态
+	PermissionProjectChoose Permission = "project:choose" // 学生选题
+	PermissionProjectAudit  Permission = "project:audit"
+	PermissionProjectUpload Permission = "project:upload"
+
+	PermissionPhaseTemplate  Permission = "phase-template:manage"  // 定义专业的项目阶段模板
+	PermissionSelectionRound Permission = "selection-round:manage" // 组织选题轮次并执行匹配
+
+	PermissionResumeCreate Permission = "resume:create"
+	PermissionResumeDelete Permission = "resume:delete"
+	PermissionResumeList   Permission = "resume:list"
+	PermissionResumeDetail Permission = "resume:detail"
+
+	PermissionInterviewCreate Permission = "interview:create"
+	PermissionInterviewDelete Permission = "interview:delete"
+	PermissionInterviewList   Permission = "interview:list"
+	PermissionInterviewDetail Permission = "interview:detail"
+	PermissionInterviewUpdate Permission = "interview:update"
+
+	PermissionUserCreate        Permission = "user:create"
+	PermissionUserDelete        Permission = "user:delete"
+	PermissionUserList          Permission = "user:list"
+	PermissionUserDetail        Permission = "user:detail"
+	PermissionUserUpdate        Permission = "user:update"
+	PermissionUserPassword      Permission = "user:password"       // 修改自己的密码
+	PermissionUserResetPassword Permission = "user:reset-password" // 管理员重置密码
+	PermissionUserUnlock        Permission = "user:unlock"         // 管理员解锁账号
+	PermissionUserSession       Permission = "user:session"        // 管理员查看/强制注销用户会话
+
+	PermissionCollegeCreate Permission = "college:create"
+	PermissionCollegeDelete Permission = "college:delete"
+	PermissionCollegeList   Permission = "college:list"
+
+	PermissionProfessionCreate Permission = "profession:create"
+	PermissionProfessionDelete Permission = "profession:delete"
+	PermissionProfessionList   Permission = "profession:list"
+
+	PermissionClassCreate Permission = "class:create"
+	PermissionClassDelete Permission = "class:delete"
+	PermissionClassList   Permission = "class:list"
+
+	PermissionChat     Permission = "chat:use"         // 在线聊天
+	PermissionChatRoom Permission = "chat-room:create" // 创建班级群、面试群
+
+	PermissionTwoFactorEnroll Permission = "two-factor:enroll" // 绑定自己的两步验证
+	PermissionTwoFactorPolicy Permission = "two-factor:policy" // 设置哪些角色必须启用两步验证
+)
+
+// Scope limits which resources a granted permission applies to
+type Scope int
+
+const (
+	ScopeNone    Scope = iota // 无权限
+	ScopeOwn                  // 仅限自己创建/参与的资源
+	ScopeCollege              // 仅限本学院的资源
+	ScopeAll                  // 全部资源
+)
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeOwn:
+		return "own"
+	case ScopeCollege:
+		return "college"
+	case ScopeAll:
+		return "all"
+	}
+	return "none"
+}
+
+// Policy grants permissions to roles
+type Policy map[model.RoleType]map[Permission]Scope
+
+// ScopeOf returns the scope the role is granted the permission in, ScopeNone if not granted
+func (p Policy) ScopeOf(role model.RoleType, permission Permission) Scope {
+	return p[role][permission]
+}
+
+// Allowed reports whether the role is granted the permission in any scope
+func (p Policy) Allowed(role model.RoleType, permission Permission) bool {
+	return p.ScopeOf(role, permission) != ScopeNone
+}
+
+var catalog = map[model.RoleType]map[Permission]Scope{
+	model.RoleTypeCollegeAdmin: {
+		PermissionProjectCreate: ScopeCollege,
+		PermissionProjectDelete: ScopeCollege,
+		PermissionProjectList:   ScopeCollege,
+		PermissionProjectDetail: ScopeCollege,
+		PermissionProjectUpdate: ScopeCollege,
+		PermissionProjectAudit:  ScopeCollege,
+
+		PermissionPhaseTemplate:  ScopeCollege,
+		PermissionSelectionRound: ScopeCollege,
+
+		PermissionResumeList:   ScopeAll,
+		PermissionResumeDetail: ScopeAll,
+
+		PermissionUserCreate:        ScopeCollege,
+		PermissionUserDelete:        ScopeCollege,
+		PermissionUserList:          ScopeCollege,
+		PermissionUserDetail:        ScopeCollege,
+		PermissionUserUpdate:        ScopeCollege,
+		PermissionUserPassword:      ScopeOwn,
+		PermissionUserResetPassword: ScopeCollege,
+		PermissionUserUnlock:        ScopeCollege,
+		PermissionUserSession:       ScopeCollege,
+
+		PermissionCollegeList:      ScopeAll,
+		PermissionProfessionCreate: ScopeCollege,
+		PermissionProfessionDelete: ScopeCollege,
+		PermissionProfessionList:   ScopeAll,
+		PermissionClassCreate:      ScopeCollege,
+		PermissionClassDelete:      ScopeCollege,
+		PermissionClassList:        ScopeAll,
+
+		PermissionChat:     ScopeOwn,
+		PermissionChatRoom: ScopeCollege,
+
+		PermissionTwoFactorEnroll: ScopeOwn,
+	},
+	model.RoleTypeTeacher: {
+		PermissionProjectCreate: ScopeOwn,
+		PermissionProjectDelete: ScopeOwn,
+		PermissionProjectList:   ScopeCollege,
+		PermissionProjectDetail: ScopeCollege,
+		PermissionProjectUpdate: ScopeOwn,
+		PermissionProjectUpload: ScopeOwn,
+
+		PermissionPhaseTemplate: ScopeCollege,
+
+		PermissionResumeList:   ScopeAll,
+		PermissionResumeDetail: ScopeAll,
+
+		PermissionInterviewCreate: ScopeOwn,
+		PermissionInterviewDelete: ScopeOwn,
+		PermissionInterviewList:   ScopeOwn,
+		PermissionInterviewDetail: ScopeOwn,
+		PermissionInterviewUpdate: ScopeOwn,
+
+		PermissionUserDetail:   ScopeCollege,
+		PermissionUserPassword: ScopeOwn,
+
+		PermissionCollegeList:    ScopeAll,
+		PermissionProfessionList: ScopeAll,
+		PermissionClassList:      ScopeAll,
+
+		PermissionChat:     ScopeOwn,
+		PermissionChatRoom: ScopeCollege,
+
+		PermissionTwoFactorEnroll: ScopeOwn,
+	},
+	model.RoleTypeStudent: {
+		PermissionProjectList:   ScopeCollege,
+		PermissionProjectDetail: ScopeCollege,
+		PermissionProjectChoose: ScopeOwn,
+		PermissionProjectUpload: ScopeOwn,
+
+		PermissionResumeCreate: ScopeOwn,
+		PermissionResumeDelete: ScopeOwn,
+		PermissionResumeList:   ScopeOwn,
+		PermissionResumeDetail: ScopeOwn,
+
+		PermissionInterviewList:   ScopeOwn,
+		PermissionInterviewDetail: ScopeOwn,
+		PermissionInterviewUpdate: ScopeOwn,
+
+		PermissionUserDetail:   ScopeOwn,
+		PermissionUserPassword: ScopeOwn,
+
+		PermissionCollegeList:    ScopeAll,
+		PermissionProfessionList: ScopeAll,
+		PermissionClassList:      ScopeAll,
+
+		PermissionChat: ScopeOwn,
+	},
+	model.RoleTypeFirm:   firmPermissions(),
+	model.RoleTypeNormal: firmPermissions(),
+}
+
+// 企业用户: 查看简历、发起面试
+func firmPermissions() map[Permission]Scope {
+	return map[Permission]Scope{
+		PermissionResumeList:   ScopeAll,
+		PermissionResumeDetail: ScopeAll,
+
+		PermissionInterviewCreate: ScopeOwn,
+		PermissionInterviewDelete: ScopeOwn,
+		PermissionInterviewList:   ScopeOwn,
+		PermissionInterviewDetail: ScopeOwn,
+		PermissionInterviewUpdate: ScopeOwn,
+
+		PermissionUserDetail:   ScopeOwn,
+		PermissionUserPassword: ScopeOwn,
+
+		PermissionCollegeList:    ScopeAll,
+		PermissionProfessionList: ScopeAll,
+		PermissionClassList:      ScopeAll,
+
+		PermissionChat:     ScopeOwn,
+		PermissionChatRoom: ScopeOwn,
+	}
+}
+
+// Permissions all permissions known to the policy
+var Permissions = []Permission{
+	PermissionProjectCreate, PermissionProjectDelete, PermissionProjectList, PermissionProjectDetail,
+	PermissionProjectUpdate, PermissionProjectChoose, PermissionProjectAudit, PermissionProjectUpload,
+	PermissionPhaseTemplate, PermissionSelectionRound,
+	PermissionResumeCreate, PermissionResumeDelete, PermissionResumeList, PermissionResumeDetail,
+	PermissionInterviewCreate, PermissionInterviewDelete, PermissionInterviewList, PermissionInterviewDetail, PermissionInterviewUpdate,
+	PermissionUserCreate, PermissionUserDelete, PermissionUserList, PermissionUserDetail,
+	PermissionUserUpdate, PermissionUserPassword, PermissionUserResetPassword, PermissionUserUnlock, PermissionUserSession,
+	PermissionCollegeCreate, PermissionCollegeDelete, PermissionCollegeList,
+	PermissionProfessionCreate, PermissionProfessionDelete, PermissionProfessionList,
+	PermissionClassCreate, PermissionClassDelete, PermissionClassList,
+	PermissionChat, PermissionChatRoom,
+	PermissionTwoFactorEnroll, PermissionTwoFactorPolicy,
+}
+
+// DefaultPolicy the super admin is granted everything
+var DefaultPolicy = func() Policy {
+	p := Policy{model.RoleTypeSuperAdmin: make(map[Permission]Scope, len(Permissions))}
+	for _, permission := range Permissions {
+		p[model.RoleTypeSuperAdmin][permission] = ScopeAll
+	}
+	for role, grants := range catalog {
+		p[role] = grants
+	}
+	return p
+}()
@@ -37,4 +37,6 @@ var (
 	ErrGetAuditLogs     = NewError(http.StatusBadRequest, "get audit logs failed")          // 获取审计日志失败
 	ErrEditCredential   = NewError(http.StatusBadRequest, "edit credential info failed")    // 修改云帐号信息失败
 	ErrInvalidLicense   = NewError(http.StatusBadRequest, "license invalid")                // 验证码错误
+	ErrTooManyRequests  = NewError(http.StatusTooManyRequests, "too many requests")         // 请求过于频繁
+	ErrAccountLocked    = NewError(http.StatusLocked, "account locked")                     // 账号已被锁定
 )
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+
+	if err = store.Put(ctx, "projects/1/a", strings.NewReader("v1"), 2, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// 覆盖写入
+	if err = store.Put(ctx, "projects/1/a", strings.NewReader("v2"), 2, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	r, err := store.Get(ctx, "projects/1/a")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	b, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "v2" {
+		t.Fatalf("Get = %q, want v2", b)
+	}
+
+	if err = store.Delete(ctx, "projects/1/a", "projects/1/missing"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err = store.Get(ctx, "projects/1/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get deleted err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalStorageFailedPut(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, _ := NewLocalStorage(root)
+
+	_ = store.Put(ctx, "a", strings.NewReader("old"), 3, "text/plain")
+	broken := io.MultiReader(strings.NewReader("partial"), errReader{})
+	if err := store.Put(ctx, "a", broken, -1, "text/plain"); err == nil {
+		t.Fatal("Put of a failing reader succeeded")
+	}
+
+	// 写入失败时保留原来的对象，也不留下临时文件
+	r, err := store.Get(ctx, "a")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	b, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "old" {
+		t.Fatalf("Get = %q, want old", b)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Fatalf("root holds %d entries, want only the object", len(entries))
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestLocalStorageKeyEscape(t *testing.T) {
+	ctx := context.Background()
+	parent := t.TempDir()
+	root := filepath.Join(parent, "files")
+	store, _ := NewLocalStorage(root)
+	secret := filepath.Join(parent, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", ".", "..", "../secret", "a/../../secret", "a/../..", "../files-other/x"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if r, err := store.Get(ctx, key); err == nil {
+			_ = r.Close()
+			t.Errorf("Get(%q) succeeded", key)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+
+	if b, _ := os.ReadFile(secret); string(b) != "secret" {
+		t.Fatalf("file outside the root changed to %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "files-other")); !os.IsNotExist(err) {
+		t.Fatal("created a directory outside the root")
+	}
+
+	// 绝对路径和多余的 .. 都留在根目录下
+	for _, key := range []string{"/etc/x", "a/../b"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err != nil {
+			t.Errorf("Put(%q): %v", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc", "x")); err != nil {
+		t.Fatalf("absolute key not stored under the root: %v", err)
+	}
+}
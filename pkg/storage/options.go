@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	storageType          = "storage-type"
+	storageLocalDir      = "storage-local-dir"
+	storageS3Endpoint    = "storage-s3-endpoint"
+	storageS3AccessKey   = "storage-s3-access-key"
+	storageS3SecretKey   = "storage-s3-secret-key"
+	storageS3Bucket      = "storage-s3-bucket"
+	storageS3Region      = "storage-s3-region"
+	storageS3UseSSL      = "storage-s3-use-ssl"
+	uploadMaxSize        = "upload-max-size"
+	uploadChunkSize      = "upload-chunk-size"
+	uploadAllowedTypes   = "upload-allowed-types"
+	downloadURLExpire    = "download-url-expiration"
+	downloadURLSignedKey = "download-url-signing-key"
+
+	TypeLocal = "local"
+	TypeS3    = "s3"
+)
+
+type Options struct {
+	// local keeps the files on disk, only suitable for a single instance. s3 works with any S3 compatible service such as MinIO
+	Type        string
+	LocalDir    string
+	S3Endpoint  string
+	S3AccessKey string
+	S3SecretKey string
+	S3Bucket    string
+	S3Region    string
+	S3UseSSL    bool
+
+	MaxUploadSize int64
+	ChunkSize     int64
+	AllowedTypes  []string
+
+	URLExpiration time.Duration
+	// all instances must share the key to verify the urls signed by each other
+	URLSigningKey string
+	v             *viper.Viper
+}
+
+func NewStorageOptions() *Options {
+	o := &Options{
+		Type:          TypeLocal,
+		LocalDir:      "./data/files",
+		S3Bucket:      "graduation-project",
+		MaxUploadSize: 100 << 20,
+		ChunkSize:     5 << 20,
+		AllowedTypes: []string{
+			"application/pdf", "application/zip", "application/x-rar-compressed", "application/x-gzip",
+			"image/png", "image/jpeg", "text/plain",
+		},
+		URLExpiration: time.Minute * 10,
+		// 没有默认密钥，文件 id 是连续的，公开的默认值谁都能拿来伪造下载地址
+		v: viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.Type = o.v.GetString(storageType)
+	o.LocalDir = o.v.GetString(storageLocalDir)
+	o.S3Endpoint = o.v.GetString(storageS3Endpoint)
+	o.S3AccessKey = o.v.GetString(storageS3AccessKey)
+	o.S3SecretKey = o.v.GetString(storageS3SecretKey)
+	o.S3Bucket = o.v.GetString(storageS3Bucket)
+	o.S3Region = o.v.GetString(storageS3Region)
+	o.S3UseSSL = o.v.GetBool(storageS3UseSSL)
+	o.MaxUploadSize = o.v.GetInt64(uploadMaxSize)
+	o.ChunkSize = o.v.GetInt64(uploadChunkSize)
+	o.AllowedTypes = o.v.GetStringSlice(uploadAllowedTypes)
+	o.URLExpiration = o.v.GetDuration(downloadURLExpire)
+	o.URLSigningKey = o.v.GetString(downloadURLSignedKey)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	switch o.Type {
+	case TypeLocal:
+		if o.LocalDir == "" {
+			errors = append(errors, fmt.Errorf("%s is empty", storageLocalDir))
+		}
+	case TypeS3:
+		if o.S3Endpoint == "" || o.S3Bucket == "" {
+			errors = append(errors, fmt.Errorf("%s and %s must be set", storageS3Endpoint, storageS3Bucket))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("%s must be %s or %s", storageType, TypeLocal, TypeS3))
+	}
+	if o.MaxUploadSize <= 0 || o.ChunkSize <= 0 {
+		errors = append(errors, fmt.Errorf("%s and %s must be positive", uploadMaxSize, uploadChunkSize))
+	}
+	if len(o.AllowedTypes) == 0 {
+		errors = append(errors, fmt.Errorf("%s is empty", uploadAllowedTypes))
+	}
+	if o.URLExpiration <= 0 {
+		errors = append(errors, fmt.Errorf("%s must be positive", downloadURLExpire))
+	}
+	if o.URLSigningKey == "" {
+		errors = append(errors, fmt.Errorf("%s is required", downloadURLSignedKey))
+	} else if len(o.URLSigningKey) < 16 {
+		errors = append(errors, fmt.Errorf("%s must be at least 16 characters", downloadURLSignedKey))
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Type, storageType, o.Type, "local or s3, s3 is required to run more than one instance. env STORAGE_TYPE")
+	fs.StringVar(&o.LocalDir, storageLocalDir, o.LocalDir, "env STORAGE_LOCAL_DIR")
+	fs.StringVar(&o.S3Endpoint, storageS3Endpoint, o.S3Endpoint, "host:port of the S3 compatible service. env STORAGE_S3_ENDPOINT")
+	fs.StringVar(&o.S3AccessKey, storageS3AccessKey, o.S3AccessKey, "env STORAGE_S3_ACCESS_KEY")
+	fs.StringVar(&o.S3SecretKey, storageS3SecretKey, o.S3SecretKey, "env STORAGE_S3_SECRET_KEY")
+	fs.StringVar(&o.S3Bucket, storageS3Bucket, o.S3Bucket, "created if it doesn't exist. env STORAGE_S3_BUCKET")
+	fs.StringVar(&o.S3Region, storageS3Region, o.S3Region, "env STORAGE_S3_REGION")
+	fs.BoolVar(&o.S3UseSSL, storageS3UseSSL, o.S3UseSSL, "env STORAGE_S3_USE_SSL")
+	fs.Int64Var(&o.MaxUploadSize, uploadMaxSize, o.MaxUploadSize, "largest file accepted in bytes. env UPLOAD_MAX_SIZE")
+	fs.Int64Var(&o.ChunkSize, uploadChunkSize, o.ChunkSize, "part size of resumable uploads in bytes. env UPLOAD_CHUNK_SIZE")
+	fs.StringSliceVar(&o.AllowedTypes, uploadAllowedTypes, o.AllowedTypes, "media types accepted, detected from the file content. env UPLOAD_ALLOWED_TYPES")
+	fs.DurationVar(&o.URLExpiration, downloadURLExpire, o.URLExpiration, "how long a signed download url works. env DOWNLOAD_URL_EXPIRATION")
+	fs.StringVar(&o.URLSigningKey, downloadURLSignedKey, o.URLSigningKey, "key signing the download urls, required, at least 16 characters. env DOWNLOAD_URL_SIGNING_KEY")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewService creates the storage of the configured type
+func (o *Options) NewService() (*Service, error) {
+	var (
+		store Interface
+		err   error
+	)
+	if o.Type == TypeS3 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		store, err = NewS3Storage(ctx, o.S3Endpoint, o.S3AccessKey, o.S3SecretKey, o.S3Bucket, o.S3Region, o.S3UseSSL)
+	} else {
+		store, err = NewLocalStorage(o.LocalDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s storage: %w", o.Type, err)
+	}
+
+	return &Service{
+		Storage:       store,
+		Signer:        NewSigner([]byte(o.URLSigningKey)),
+		MaxSize:       o.MaxUploadSize,
+		ChunkSize:     o.ChunkSize,
+		AllowedTypes:  o.AllowedTypes,
+		URLExpiration: o.URLExpiration,
+	}, nil
+}
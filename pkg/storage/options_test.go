@@ -0,0 +1,25 @@
+package storage
+
+import "testing"
+
+func TestValidateRequiresSigningKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(o *Options)
+		valid bool
+	}{
+		{name: "default", setup: func(o *Options) {}},
+		{name: "short key", setup: func(o *Options) { o.URLSigningKey = "short" }},
+		{name: "key", setup: func(o *Options) { o.URLSigningKey = "0123456789abcdef" }, valid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewStorageOptions()
+			tt.setup(o)
+			if errs := o.Validate(); (len(errs) == 0) != tt.valid {
+				t.Fatalf("Validate = %v, want valid %v", errs, tt.valid)
+			}
+		})
+	}
+}
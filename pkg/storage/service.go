@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"mime"
+	"strings"
+	"time"
+)
+
+// Service is the storage of the uploaded files together with the upload limits and the download url signer
+type Service struct {
+	Storage Interface
+	Signer  *Signer
+
+	// MaxSize is the largest file accepted, in bytes
+	MaxSize int64
+	// ChunkSize is the part size of resumable uploads, the last part may be smaller
+	ChunkSize int64
+	// AllowedTypes are the media types accepted, detected from the content rather than trusted from the client
+	AllowedTypes []string
+	// URLExpiration is how long a signed download url works
+	URLExpiration time.Duration
+}
+
+// Allowed reports whether files of the detected content type may be uploaded
+func (s *Service) Allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range s.AllowedTypes {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+var defaultService *Service
+
+// SetDefault sets the service used by the project file handlers
+func SetDefault(s *Service) {
+	if s != nil {
+		defaultService = s
+	}
+}
+
+// Default returns the service set by SetDefault
+func Default() *Service {
+	return defaultService
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerVerify(t *testing.T) {
+	s := NewSigner([]byte("0123456789abcdef"))
+	expires, signature := s.Sign("project-file:1", time.Minute)
+
+	// 改动签名中的一位
+	tampered := []byte(signature)
+	if tampered[0] == '0' {
+		tampered[0] = '1'
+	} else {
+		tampered[0] = '0'
+	}
+
+	tests := []struct {
+		name      string
+		signer    *Signer
+		resource  string
+		expires   int64
+		signature string
+		want      bool
+	}{
+		{name: "valid", signer: s, resource: "project-file:1", expires: expires, signature: signature, want: true},
+		{name: "upper case hex", signer: s, resource: "project-file:1", expires: expires, signature: strings.ToUpper(signature), want: true},
+		{name: "tampered signature", signer: s, resource: "project-file:1", expires: expires, signature: string(tampered)},
+		{name: "truncated signature", signer: s, resource: "project-file:1", expires: expires, signature: signature[:len(signature)-2]},
+		{name: "not hex", signer: s, resource: "project-file:1", expires: expires, signature: "zz" + signature[2:]},
+		{name: "empty signature", signer: s, resource: "project-file:1", expires: expires},
+		{name: "another file", signer: s, resource: "project-file:2", expires: expires, signature: signature},
+		{name: "extended expiry", signer: s, resource: "project-file:1", expires: expires + 3600, signature: signature},
+		{name: "another key", signer: NewSigner([]byte("fedcba9876543210")), resource: "project-file:1", expires: expires, signature: signature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.signer.Verify(tt.resource, tt.expires, tt.signature); got != tt.want {
+				t.Fatalf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignerExpired(t *testing.T) {
+	s := NewSigner([]byte("0123456789abcdef"))
+
+	expires, signature := s.Sign("project-file:1", -time.Second)
+	if s.Verify("project-file:1", expires, signature) {
+		t.Fatal("verified an expired signature")
+	}
+}
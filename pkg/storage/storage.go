@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Interface stores the uploaded files as objects addressed by key
+type Interface interface {
+	// Put writes the object, size is -1 when unknown
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get opens the object for reading, returns ErrNotFound if it doesn't exist
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the objects, no error returned if an object doesn't exist
+	Delete(ctx context.Context, keys ...string) error
+}
@@ -1,6 +1,8 @@
 package token
 
 import (
+	"crypto"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"time"
 
@@ -17,11 +19,22 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// jwtKey is a verification key identified by the kid header
+type jwtKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
 type jwtToken struct {
 	name       string
 	signKey    any
+	signKid    string
 	verifyKey  any
 	signMethod jwt.SigningMethod
+
+	// asymmetric verification keys by kid, more than one is active during a key rotation
+	verifyKeys map[string]jwtKey
 }
 
 func (jt *jwtToken) Verify(tokenString string) (Payload, error) {
@@ -53,6 +66,9 @@ func (jt *jwtToken) IssueTo(payload Payload, expiresIn time.Duration) (string, e
 	}
 
 	token := jwt.NewWithClaims(jt.signMethod, clm)
+	if jt.signKid != "" {
+		token.Header["kid"] = jt.signKid
+	}
 
 	tokenString, err := token.SignedString(jt.signKey)
 	if err != nil {
@@ -64,6 +80,22 @@ func (jt *jwtToken) IssueTo(payload Payload, expiresIn time.Duration) (string, e
 }
 
 func (jt *jwtToken) keyFunc(t *jwt.Token) (any, error) {
+	if kid, ok := t.Header["kid"].(string); ok && kid != "" {
+		k, found := jt.verifyKeys[kid]
+		if !found {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for kid %q", t.Method.Alg(), kid)
+		}
+		return k.key, nil
+	}
+
+	// tokens without kid are only accepted from the symmetric key
+	if _, ok := jt.signMethod.(*jwt.SigningMethodHMAC); !ok || t.Method.Alg() != jt.signMethod.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+
 	if jt.verifyKey != nil {
 		return jt.verifyKey, nil
 	} else {
@@ -79,11 +111,31 @@ func SetVerifyKey(verifyKey []byte) Option {
 	}
 }
 
-func NewJWTTokenManager(signKey []byte, signMethod jwt.SigningMethod, options ...Option) Manager {
+// AddVerifyKey adds an asymmetric public key that tokens are still accepted from,
+// e.g. the key being rotated out
+func AddVerifyKey(key crypto.PublicKey) Option {
+	return func(jt *jwtToken) {
+		if err := jt.addVerifyKey(key); err != nil {
+			zap.L().Error("add jwt verify key failed", zap.Error(err))
+		}
+	}
+}
+
+// NewJWTTokenManager creates a token manager signing with signKey, which is either
+// a HMAC secret ([]byte) or a private key (RSA, ECDSA or Ed25519)
+func NewJWTTokenManager(signKey any, signMethod jwt.SigningMethod, options ...Option) Manager {
 	jt := &jwtToken{
 		name:       DefaultIssuerName,
 		signKey:    signKey,
 		signMethod: signMethod,
+		verifyKeys: make(map[string]jwtKey),
+	}
+
+	if signer, ok := signKey.(crypto.Signer); ok {
+		jt.signKid, _ = thumbprint(signer.Public())
+		if err := jt.addVerifyKey(signer.Public()); err != nil {
+			zap.L().Error("add jwt sign key failed", zap.Error(err))
+		}
 	}
 
 	for _, opt := range options {
@@ -92,3 +144,22 @@ func NewJWTTokenManager(signKey []byte, signMethod jwt.SigningMethod, options ..
 
 	return jt
 }
+
+func (jt *jwtToken) addVerifyKey(key crypto.PublicKey) error {
+	method, err := methodForKey(key)
+	if err != nil {
+		return err
+	}
+
+	// the sign key decides the method of its own kid, e.g. RS512 instead of RS256
+	kid, err := thumbprint(key)
+	if err != nil {
+		return err
+	}
+	if kid == jt.signKid && jt.signMethod != nil {
+		method = jt.signMethod
+	}
+
+	jt.verifyKeys[kid] = jwtKey{kid: kid, method: method, key: key}
+	return nil
+}
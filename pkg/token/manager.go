@@ -11,6 +11,9 @@ type Payload struct {
 	Username string         `json:"username"` // 用户名
 	Name     string         `json:"name"`     // 昵称
 	Role     model.RoleType `json:"role"`
+
+	// SessionID is the refresh token family the token was issued in
+	SessionID string `json:"sid,omitempty"`
 }
 
 // Manager issues token to user and verify token
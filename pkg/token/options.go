@@ -0,0 +1,199 @@
+package token
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	jwtSecret        = "jwt-secret"
+	jwtSigningMethod = "jwt-signing-method"
+	jwtPrivateKey    = "jwt-private-key"
+	jwtPublicKeys    = "jwt-public-keys"
+)
+
+type Options struct {
+	// HMAC secret, used when no private key is given
+	Secret string
+	// signing method, inferred from the private key when empty
+	SigningMethod string
+	// PEM file of the active private key
+	PrivateKeyFile string
+	// PEM files of public keys still accepted, e.g. the previous key during a rotation
+	PublicKeyFiles []string
+	v              *viper.Viper
+}
+
+func NewTokenOptions() *Options {
+	o := &Options{
+		// 没有默认密钥，公开的默认值谁都能拿来签发 token
+		v: viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.Secret = o.v.GetString(jwtSecret)
+	o.SigningMethod = o.v.GetString(jwtSigningMethod)
+	o.PrivateKeyFile = o.v.GetString(jwtPrivateKey)
+	o.PublicKeyFiles = o.v.GetStringSlice(jwtPublicKeys)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	if o.SigningMethod != "" && jwt.GetSigningMethod(o.SigningMethod) == nil {
+		errors = append(errors, fmt.Errorf("unsupported jwt signing method %q", o.SigningMethod))
+	}
+
+	if o.PrivateKeyFile == "" {
+		if o.Secret == "" {
+			errors = append(errors, fmt.Errorf("either %s or %s is required", jwtSecret, jwtPrivateKey))
+		}
+		if o.SigningMethod != "" && !strings.HasPrefix(o.SigningMethod, "HS") {
+			errors = append(errors, fmt.Errorf("jwt signing method %s requires a private key", o.SigningMethod))
+		}
+	} else if _, err := os.Stat(o.PrivateKeyFile); err != nil {
+		errors = append(errors, err)
+	}
+
+	for _, f := range o.PublicKeyFiles {
+		if _, err := os.Stat(f); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Secret, jwtSecret, o.Secret, "HMAC secret, required when no private key is given. env JWT_SECRET")
+	fs.StringVar(&o.SigningMethod, jwtSigningMethod, o.SigningMethod, "RS256, ES256, EdDSA... inferred from the private key when empty. env JWT_SIGNING_METHOD")
+	fs.StringVar(&o.PrivateKeyFile, jwtPrivateKey, o.PrivateKeyFile, "PEM file of the signing key. env JWT_PRIVATE_KEY")
+	fs.StringSliceVar(&o.PublicKeyFiles, jwtPublicKeys, o.PublicKeyFiles, "PEM files of extra verification keys, e.g. the previous key during a rotation. env JWT_PUBLIC_KEYS")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewTokenManager creates the token Manager described by the options
+func (o *Options) NewTokenManager() (Manager, error) {
+	if o.PrivateKeyFile == "" {
+		method := jwt.SigningMethod(jwt.SigningMethodHS256)
+		if o.SigningMethod != "" {
+			method = jwt.GetSigningMethod(o.SigningMethod)
+		}
+		return NewJWTTokenManager([]byte(o.Secret), method), nil
+	}
+
+	signKey, err := loadPrivateKey(o.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := methodForKey(signKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	if o.SigningMethod != "" {
+		method = jwt.GetSigningMethod(o.SigningMethod)
+	}
+	if _, err = method.Sign("probe", signKey); err != nil {
+		return nil, fmt.Errorf("jwt signing method %s does not match the private key: %w", method.Alg(), err)
+	}
+
+	options := make([]Option, 0, len(o.PublicKeyFiles))
+	for _, f := range o.PublicKeyFiles {
+		key, err := loadPublicKey(f)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = methodForKey(key); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		options = append(options, AddVerifyKey(key))
+	}
+
+	return NewJWTTokenManager(signKey, method, options...), nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	return block, nil
+}
+
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported private key type %T", path, key)
+	}
+
+	return signer, nil
+}
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	// a private key file also carries its public key
+	signer, err := loadPrivateKey(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unsupported PEM type %s", path, block.Type)
+	}
+
+	return signer.Public(), nil
+}
@@ -0,0 +1,48 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateRequiresSecret(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(o *Options)
+		valid bool
+	}{
+		{name: "default", setup: func(o *Options) {}},
+		{name: "secret", setup: func(o *Options) { o.Secret = "s3cret" }, valid: true},
+		{name: "private key", setup: func(o *Options) { o.PrivateKeyFile = keyFile }, valid: true},
+		{name: "missing private key", setup: func(o *Options) { o.PrivateKeyFile = keyFile + ".missing" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewTokenOptions()
+			tt.setup(o)
+			if errs := o.Validate(); (len(errs) == 0) != tt.valid {
+				t.Fatalf("Validate = %v, want valid %v", errs, tt.valid)
+			}
+		})
+	}
+}
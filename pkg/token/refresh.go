@@ -0,0 +1,340 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+	"v1/pkg/client/cache"
+	"v1/pkg/utils"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultAccessTokenExpiration  = time.Minute * 15
+	DefaultRefreshTokenExpiration = time.Hour * 24 * 7
+
+	refreshTokenKeyPrefix = "refresh_token:"
+	sessionKeyPrefix      = "session:"
+	userSessionsKeyPrefix = "user_sessions:"
+
+	// last seen time is written at most once per interval
+	touchInterval = time.Minute
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrSessionRevoked      = errors.New("session revoked")
+)
+
+// RefreshManager issues opaque refresh tokens. Every refresh token belongs to a
+// token family (session) started at login, it rotates on every use and reusing
+// an already rotated token revokes the whole family. The family is only changed by
+// compare-and-swap in the cache, so instances sharing a redis cache rotate safely.
+type RefreshManager interface {
+	// Issue starts a new family for the payload, returns the first refresh token and the family id
+	Issue(ctx context.Context, payload Payload, info SessionInfo) (refreshToken string, sessionID string, err error)
+
+	// Rotate exchanges a refresh token for a new one of the same family, and returns the payload it was issued for
+	Rotate(ctx context.Context, refreshToken string) (Payload, string, error)
+
+	// Revoke revokes the whole family, all of its refresh tokens and access tokens become invalid
+	Revoke(ctx context.Context, sessionID string) error
+
+	// RevokeAll revokes every family of the user, e.g. after the password changed
+	RevokeAll(ctx context.Context, userUID string) error
+
+	// Sessions lists the families of the user still alive
+	Sessions(ctx context.Context, userUID string) ([]Session, error)
+
+	// Touch records the family being used from ip, returns ErrSessionRevoked if it is gone
+	Touch(ctx context.Context, sessionID string, ip string) error
+}
+
+// SessionInfo describes the client a family was started from
+type SessionInfo struct {
+	Device    string `json:"device"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+// Session is a token family as shown to users
+type Session struct {
+	ID string `json:"id"`
+	SessionInfo
+	CreatedAt  int64 `json:"created_at"`
+	LastSeenAt int64 `json:"last_seen_at"`
+}
+
+type refreshTokenRecord struct {
+	SessionID string `json:"sid"`
+}
+
+type sessionRecord struct {
+	Payload    Payload     `json:"payload"`
+	Current    string      `json:"current"` // hash of the only refresh token that can be used
+	Info       SessionInfo `json:"info"`
+	CreatedAt  int64       `json:"created_at"`
+	RotatedAt  int64       `json:"rotated_at"` // the family expires expiresIn after the last rotation
+	LastSeenAt int64       `json:"last_seen_at"`
+}
+
+type refreshManager struct {
+	cacheClient cache.Interface
+	expiresIn   time.Duration
+}
+
+type RefreshOption func(m *refreshManager)
+
+// SetRefreshTokenExpiration sets how long a family stays alive without being refreshed
+func SetRefreshTokenExpiration(expiresIn time.Duration) RefreshOption {
+	return func(m *refreshManager) {
+		m.expiresIn = expiresIn
+	}
+}
+
+func NewRefreshManager(cacheClient cache.Interface, options ...RefreshOption) RefreshManager {
+	m := &refreshManager{
+		cacheClient: cacheClient,
+		expiresIn:   DefaultRefreshTokenExpiration,
+	}
+
+	for _, opt := range options {
+		opt(m)
+	}
+
+	return m
+}
+
+// SessionKey returns the cache key of a token family, access tokens carrying
+// a session id are only valid while the key exists
+func SessionKey(sessionID string) string {
+	return sessionKeyPrefix + sessionID
+}
+
+func (m *refreshManager) Issue(ctx context.Context, payload Payload, info SessionInfo) (string, string, error) {
+	payload.SessionID = utils.NextID()
+
+	now := time.Now().UnixMilli()
+	refreshToken, ok, err := m.next(ctx, &sessionRecord{Payload: payload, Info: info, CreatedAt: now, LastSeenAt: now}, "")
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", errors.New("session id " + payload.SessionID + " already taken")
+	}
+
+	// index the family under the user so all of them can be found again
+	if err = m.index(ctx, payload.UID, payload.SessionID); err != nil {
+		// 未入索引的会话无法被 RevokeAll 找到，不能留下
+		_ = m.Revoke(ctx, payload.SessionID)
+		return "", "", err
+	}
+
+	return refreshToken, payload.SessionID, nil
+}
+
+func (m *refreshManager) Rotate(ctx context.Context, refreshToken string) (Payload, string, error) {
+	hashed := utils.SHA256Hex(refreshToken)
+	val, err := m.cacheClient.Get(ctx, refreshTokenKeyPrefix+hashed)
+	if err != nil {
+		return Payload{}, "", ErrInvalidRefreshToken
+	}
+
+	record := refreshTokenRecord{}
+	if err = json.Unmarshal([]byte(val), &record); err != nil {
+		return Payload{}, "", ErrInvalidRefreshToken
+	}
+
+	// 每次交换失败都意味着别人改成功了，重试直到成功或者超时
+	for ctx.Err() == nil {
+		session, raw, err := m.session(ctx, record.SessionID)
+		if err != nil {
+			return Payload{}, "", ErrInvalidRefreshToken
+		}
+
+		// 并发使用同一个 refresh token 时只有一个能换掉 Current，其余的在这里按重用处理
+		if session.Current != hashed {
+			zap.L().Warn("refresh token reused, revoke token family", zap.String("sid", record.SessionID), zap.String("username", session.Payload.Username))
+			if err = m.Revoke(ctx, record.SessionID); err != nil {
+				return Payload{}, "", err
+			}
+			return Payload{}, "", ErrRefreshTokenReused
+		}
+
+		next, ok, err := m.next(ctx, session, raw)
+		if err != nil {
+			return Payload{}, "", err
+		}
+		if !ok {
+			// 读取之后会话被改过，重新读取再比较
+			continue
+		}
+
+		// the index has to live as long as the family
+		_ = m.cacheClient.Expire(ctx, userSessionsKeyPrefix+session.Payload.UID, m.expiresIn)
+		return session.Payload, next, nil
+	}
+
+	return Payload{}, "", ctx.Err()
+}
+
+func (m *refreshManager) Revoke(ctx context.Context, sessionID string) error {
+	return m.cacheClient.Del(ctx, SessionKey(sessionID))
+}
+
+func (m *refreshManager) RevokeAll(ctx context.Context, userUID string) error {
+	sessionIDs, _, err := m.userSessions(ctx, userUID)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userSessionsKeyPrefix + userUID}
+	for _, sid := range sessionIDs {
+		keys = append(keys, SessionKey(sid))
+	}
+	return m.cacheClient.Del(ctx, keys...)
+}
+
+func (m *refreshManager) Sessions(ctx context.Context, userUID string) ([]Session, error) {
+	sessionIDs, _, err := m.userSessions(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(sessionIDs))
+	for _, sid := range sessionIDs {
+		session, _, err := m.session(ctx, sid)
+		if err != nil {
+			// revoked or expired in between
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:          sid,
+			SessionInfo: session.Info,
+			CreatedAt:   session.CreatedAt,
+			LastSeenAt:  session.LastSeenAt,
+		})
+	}
+	return sessions, nil
+}
+
+func (m *refreshManager) Touch(ctx context.Context, sessionID string, ip string) error {
+	session, raw, err := m.session(ctx, sessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+
+	now := time.Now()
+	if now.Sub(time.UnixMilli(session.LastSeenAt)) < touchInterval && session.Info.IP == ip {
+		return nil
+	}
+	session.LastSeenAt = now.UnixMilli()
+	session.Info.IP = ip
+
+	// keep the expiration of the family unchanged
+	ttl := time.UnixMilli(session.RotatedAt).Add(m.expiresIn).Sub(now)
+	if ttl <= 0 {
+		return ErrSessionRevoked
+	}
+	b, _ := json.Marshal(session)
+	ok, err := m.cacheClient.CompareAndSwap(ctx, SessionKey(sessionID), raw, string(b), ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 被并发轮换或吊销，轮换过的会话下次再记录
+		if alive, _ := m.cacheClient.Exists(ctx, SessionKey(sessionID)); !alive {
+			return ErrSessionRevoked
+		}
+	}
+	return nil
+}
+
+// userSessions returns the ids of the user's families still alive, and the raw index they are read from
+func (m *refreshManager) userSessions(ctx context.Context, userUID string) ([]string, string, error) {
+	val, err := m.cacheClient.Get(ctx, userSessionsKeyPrefix+userUID)
+	if errors.Is(err, cache.ErrNoSuchKey) {
+		// no session yet
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var sessionIDs []string
+	if err = json.Unmarshal([]byte(val), &sessionIDs); err != nil {
+		return nil, "", err
+	}
+
+	alive := make([]string, 0, len(sessionIDs))
+	for _, sid := range sessionIDs {
+		if ok, _ := m.cacheClient.Exists(ctx, SessionKey(sid)); ok {
+			alive = append(alive, sid)
+		}
+	}
+	return alive, val, nil
+}
+
+// index adds the family to the index of the user, dropping the dead ones
+func (m *refreshManager) index(ctx context.Context, userUID string, sessionID string) error {
+	for ctx.Err() == nil {
+		sessionIDs, raw, err := m.userSessions(ctx, userUID)
+		if err != nil {
+			return err
+		}
+
+		b, _ := json.Marshal(append(sessionIDs, sessionID))
+		ok, err := m.cacheClient.CompareAndSwap(ctx, userSessionsKeyPrefix+userUID, raw, string(b), m.expiresIn)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// next generates a refresh token and makes it the current one of the family, if the family
+// is still the raw one it was read from, empty for a new family. It reports whether the family was changed
+func (m *refreshManager) next(ctx context.Context, session *sessionRecord, raw string) (string, bool, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(buf)
+	hashed := utils.SHA256Hex(refreshToken)
+
+	record, _ := json.Marshal(refreshTokenRecord{SessionID: session.Payload.SessionID})
+	if err := m.cacheClient.Set(ctx, refreshTokenKeyPrefix+hashed, string(record), m.expiresIn); err != nil {
+		return "", false, err
+	}
+
+	updated := *session
+	updated.Current = hashed
+	updated.RotatedAt = time.Now().UnixMilli()
+	b, _ := json.Marshal(updated)
+	ok, err := m.cacheClient.CompareAndSwap(ctx, SessionKey(session.Payload.SessionID), raw, string(b), m.expiresIn)
+	if err != nil || !ok {
+		_ = m.cacheClient.Del(ctx, refreshTokenKeyPrefix+hashed)
+		return "", false, err
+	}
+
+	return refreshToken, true, nil
+}
+
+func (m *refreshManager) session(ctx context.Context, sessionID string) (*sessionRecord, string, error) {
+	val, err := m.cacheClient.Get(ctx, SessionKey(sessionID))
+	if err != nil {
+		return nil, "", err
+	}
+
+	session := sessionRecord{}
+	if err = json.Unmarshal([]byte(val), &session); err != nil {
+		return nil, "", err
+	}
+
+	return &session, val, nil
+}
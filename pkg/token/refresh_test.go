@@ -0,0 +1,181 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"v1/pkg/client/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// caches returns the backends under test, the redis one is shared by two managers as if on two instances
+func caches(t *testing.T) map[string][2]cache.Interface {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	newRedis := func() cache.Interface {
+		c, err := cache.NewRedisCache(context.Background(), &redis.Options{Addr: s.Addr()})
+		if err != nil {
+			t.Fatalf("NewRedisCache: %v", err)
+		}
+		return c
+	}
+
+	memory := cache.NewSimpleCache()
+	return map[string][2]cache.Interface{
+		"memory": {memory, memory},
+		"redis":  {newRedis(), newRedis()},
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range caches(t) {
+		t.Run(name, func(t *testing.T) {
+			m := NewRefreshManager(c[0])
+			first, sid, err := m.Issue(ctx, Payload{UID: "u1", Username: "alice"}, SessionInfo{IP: "127.0.0.1"})
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+
+			payload, second, err := NewRefreshManager(c[1]).Rotate(ctx, first)
+			if err != nil {
+				t.Fatalf("Rotate: %v", err)
+			}
+			if payload.UID != "u1" || payload.SessionID != sid {
+				t.Fatalf("payload = %+v", payload)
+			}
+
+			// 重用已轮换的 token 吊销整个会话
+			if _, _, err = m.Rotate(ctx, first); !errors.Is(err, ErrRefreshTokenReused) {
+				t.Fatalf("reuse err = %v, want ErrRefreshTokenReused", err)
+			}
+			if _, _, err = m.Rotate(ctx, second); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Fatalf("rotate after revoke err = %v, want ErrInvalidRefreshToken", err)
+			}
+			if sessions, _ := m.Sessions(ctx, "u1"); len(sessions) != 0 {
+				t.Fatalf("sessions = %v, want none", sessions)
+			}
+		})
+	}
+}
+
+// TestRotateConcurrently uses one refresh token from many goroutines on two managers,
+// exactly one of them gets the next token
+func TestRotateConcurrently(t *testing.T) {
+	const n = 16
+
+	ctx := context.Background()
+	for name, c := range caches(t) {
+		t.Run(name, func(t *testing.T) {
+			managers := []RefreshManager{NewRefreshManager(c[0]), NewRefreshManager(c[1])}
+			refreshToken, _, err := managers[0].Issue(ctx, Payload{UID: "u1"}, SessionInfo{})
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+
+			var (
+				wg       sync.WaitGroup
+				mu       sync.Mutex
+				rotated  int
+				rejected int
+			)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(m RefreshManager) {
+					defer wg.Done()
+					_, _, err := m.Rotate(ctx, refreshToken)
+
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case err == nil:
+						rotated++
+					case errors.Is(err, ErrRefreshTokenReused), errors.Is(err, ErrInvalidRefreshToken):
+						rejected++
+					default:
+						t.Errorf("Rotate: %v", err)
+					}
+				}(managers[i%2])
+			}
+			wg.Wait()
+
+			if rotated != 1 || rejected != n-1 {
+				t.Fatalf("rotated %d, rejected %d, want 1 and %d", rotated, rejected, n-1)
+			}
+		})
+	}
+}
+
+// TestIssueConcurrently logs in many times at once, every family ends up in the index of the user
+func TestIssueConcurrently(t *testing.T) {
+	const n = 8
+
+	ctx := context.Background()
+	for name, c := range caches(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(m RefreshManager) {
+					defer wg.Done()
+					if _, _, err := m.Issue(ctx, Payload{UID: "u1"}, SessionInfo{}); err != nil {
+						t.Errorf("Issue: %v", err)
+					}
+				}(NewRefreshManager(c[i%2]))
+			}
+			wg.Wait()
+
+			keys, err := c[0].Keys(ctx, sessionKeyPrefix+"*")
+			if err != nil {
+				t.Fatalf("Keys: %v", err)
+			}
+			sessions, err := NewRefreshManager(c[0]).Sessions(ctx, "u1")
+			if err != nil {
+				t.Fatalf("Sessions: %v", err)
+			}
+			if len(keys) != n || len(sessions) != n {
+				t.Fatalf("%d sessions, %d indexed, want %d", len(keys), len(sessions), n)
+			}
+		})
+	}
+}
+
+func TestTouchKeepsRotation(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range caches(t) {
+		t.Run(name, func(t *testing.T) {
+			m := NewRefreshManager(c[0])
+			first, sid, err := m.Issue(ctx, Payload{UID: "u1"}, SessionInfo{IP: "127.0.0.1"})
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			_, second, err := m.Rotate(ctx, first)
+			if err != nil {
+				t.Fatalf("Rotate: %v", err)
+			}
+
+			if err = NewRefreshManager(c[1]).Touch(ctx, sid, "10.0.0.1"); err != nil {
+				t.Fatalf("Touch: %v", err)
+			}
+			sessions, _ := m.Sessions(ctx, "u1")
+			if len(sessions) != 1 || sessions[0].IP != "10.0.0.1" {
+				t.Fatalf("sessions = %+v", sessions)
+			}
+			// 记录最后使用时间不影响当前的 refresh token
+			if _, _, err = m.Rotate(ctx, second); err != nil {
+				t.Fatalf("Rotate after touch: %v", err)
+			}
+
+			if err = m.Revoke(ctx, sid); err != nil {
+				t.Fatalf("Revoke: %v", err)
+			}
+			if err = m.Touch(ctx, sid, "10.0.0.2"); !errors.Is(err, ErrSessionRevoked) {
+				t.Fatalf("Touch after revoke err = %v, want ErrSessionRevoked", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// RecoveryCodeCount recovery codes generated at a time
+	RecoveryCodeCount = 10
+
+	// codes of the previous and the next step are accepted
+	defaultSkew = 1
+)
+
+var ErrInvalidCiphertext = errors.New("invalid totp secret ciphertext")
+
+// Authenticator issues and verifies TOTP secrets, secrets leave it only encrypted
+type Authenticator struct {
+	issuer string
+	aead   cipher.AEAD
+}
+
+// NewAuthenticator creates an Authenticator, key is the AES-256 key used to encrypt the stored secrets
+func NewAuthenticator(issuer string, key []byte) (*Authenticator, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{issuer: issuer, aead: aead}, nil
+}
+
+var defaultAuthenticator *Authenticator
+
+// SetDefault sets the authenticator used by the handlers
+func SetDefault(a *Authenticator) {
+	if a != nil {
+		defaultAuthenticator = a
+	}
+}
+
+// Default returns the authenticator set by SetDefault
+func Default() *Authenticator {
+	return defaultAuthenticator
+}
+
+// Enabled reports whether two-factor authentication is offered, that is an authenticator is set
+func Enabled() bool {
+	return defaultAuthenticator != nil
+}
+
+// NewSecret generates a secret, returns its encrypted form to store and its provisioning uri
+func (a *Authenticator) NewSecret(account string) (encrypted, uri string, err error) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	encrypted, err = a.encrypt(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return encrypted, URI(a.issuer, account, secret), nil
+}
+
+// Verify checks the code against the encrypted secret. Codes of a step not after lastStep
+// have been used already and are rejected, the matched step is returned on success.
+func (a *Authenticator) Verify(encrypted, code string, lastStep int64) (int64, bool, error) {
+	secret, err := a.decrypt(encrypted)
+	if err != nil {
+		return 0, false, err
+	}
+
+	step, ok := Validate(secret, code, time.Now(), defaultSkew)
+	if !ok || step <= lastStep {
+		return 0, false, nil
+	}
+	return step, true, nil
+}
+
+func (a *Authenticator) encrypt(plain string) (string, error) {
+	nonce := make([]byte, a.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := a.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (a *Authenticator) decrypt(encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	if len(sealed) < a.aead.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+
+	nonce, ciphertext := sealed[:a.aead.NonceSize()], sealed[a.aead.NonceSize():]
+	plain, err := a.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plain), nil
+}
+
+// NewRecoveryCodes generates one-time recovery codes, returns the codes to show to the user
+// and their hashes to store
+func NewRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := strings.ToLower(b32.EncodeToString(b))
+		code := s[:4] + "-" + s[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the stored form of a recovery code
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
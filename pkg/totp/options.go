@@ -0,0 +1,85 @@
+package totp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	totpEnabled       = "totp-enabled"
+	totpIssuer        = "totp-issuer"
+	totpEncryptionKey = "totp-encryption-key"
+)
+
+type Options struct {
+	// two-factor authentication is offered, the encryption key is required then
+	Enabled bool
+	// issuer shown in authenticator apps
+	Issuer string
+	// hex encoded AES-256 key encrypting the stored secrets
+	EncryptionKey string
+	v             *viper.Viper
+}
+
+func NewTOTPOptions() *Options {
+	o := &Options{
+		Enabled: true,
+		Issuer:  "GraduationProject",
+		// 没有默认密钥，公开的默认值等于明文保存
+		v: viper.NewWithOptions(viper.EnvKeyReplacer(strings.NewReplacer("-", "_"))),
+	}
+
+	o.v.AutomaticEnv()
+	return o
+}
+
+func (o *Options) loadEnv() {
+	o.Enabled = o.v.GetBool(totpEnabled)
+	o.Issuer = o.v.GetString(totpIssuer)
+	o.EncryptionKey = o.v.GetString(totpEncryptionKey)
+}
+
+// Validate check options
+func (o *Options) Validate() []error {
+	errors := make([]error, 0)
+
+	if o.Issuer == "" {
+		errors = append(errors, fmt.Errorf("%s must not be empty", totpIssuer))
+	}
+	if o.EncryptionKey == "" {
+		if o.Enabled {
+			errors = append(errors, fmt.Errorf("%s is required unless %s=false", totpEncryptionKey, totpEnabled))
+		}
+	} else if key, err := hex.DecodeString(o.EncryptionKey); err != nil || len(key) != 32 {
+		errors = append(errors, fmt.Errorf("%s must be 32 bytes hex encoded", totpEncryptionKey))
+	}
+
+	return errors
+}
+
+// AddFlags add option flags to command line flags,
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&o.Enabled, totpEnabled, o.Enabled, "offer two-factor authentication, when disabled enrolled users log in with the password only. env TOTP_ENABLED")
+	fs.StringVar(&o.Issuer, totpIssuer, o.Issuer, "issuer shown in authenticator apps. env TOTP_ISSUER")
+	fs.StringVar(&o.EncryptionKey, totpEncryptionKey, o.EncryptionKey, "hex encoded 32 bytes key encrypting stored totp secrets, changing it invalidates all enrollments. env TOTP_ENCRYPTION_KEY")
+
+	_ = o.v.BindPFlags(fs)
+	o.loadEnv()
+}
+
+// NewAuthenticator creates the Authenticator described by the options, nil if two-factor authentication is disabled
+func (o *Options) NewAuthenticator() (*Authenticator, error) {
+	if !o.Enabled {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(o.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(o.Issuer, key)
+}
@@ -0,0 +1,45 @@
+package totp
+
+import "testing"
+
+func TestValidateEncryptionKey(t *testing.T) {
+	const key = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+	tests := []struct {
+		name    string
+		enabled bool
+		key     string
+		valid   bool
+	}{
+		{name: "enabled without key", enabled: true},
+		{name: "enabled", enabled: true, key: key, valid: true},
+		{name: "enabled with short key", enabled: true, key: key[:32]},
+		{name: "enabled with broken key", enabled: true, key: key[:63] + "x"},
+		{name: "disabled without key", valid: true},
+		{name: "disabled with broken key", key: "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewTOTPOptions()
+			o.Enabled, o.EncryptionKey = tt.enabled, tt.key
+			if errs := o.Validate(); (len(errs) == 0) != tt.valid {
+				t.Fatalf("Validate = %v, want valid %v", errs, tt.valid)
+			}
+
+			if !tt.valid {
+				return
+			}
+			a, err := o.NewAuthenticator()
+			if err != nil || (a != nil) != tt.enabled {
+				t.Fatalf("NewAuthenticator = %v, %v", a, err)
+			}
+		})
+	}
+}
+
+func TestDefaultHasNoKey(t *testing.T) {
+	if o := NewTOTPOptions(); o.EncryptionKey != "" || len(o.Validate()) == 0 {
+		t.Fatal("the default options must not carry an encryption key")
+	}
+}